@@ -12,6 +12,10 @@ type AuthToken struct {
 	mu       sync.RWMutex
 	token    string
 	filePath string
+
+	// fromEnv is set when the token was read from an environment variable,
+	// in which case the filesystem is never touched
+	fromEnv bool
 }
 
 const authTokenPrefix = "auth_token="
@@ -23,6 +27,7 @@ type authTokenConfig struct {
 	configFolder string
 	configFile   string
 	configRoot   string
+	envVar       string
 }
 
 // WithAuthConfigFolder sets the folder to store the config file in
@@ -46,6 +51,16 @@ func WithAuthConfigRoot(root string) AuthTokenOption {
 	}
 }
 
+// WithAuthFromEnv reads the token from an environment variable. When the variable
+// is set and non-empty, the token is taken from it and the filesystem is never
+// touched: no config directory is created and SaveToken only updates the token
+// in memory. When it is empty, the token file is used as usual.
+func WithAuthFromEnv(varName string) AuthTokenOption {
+	return func(c *authTokenConfig) {
+		c.envVar = varName
+	}
+}
+
 // NewAuthToken creates and initializes a new AuthToken instance.
 // configFolder: The folder to store the config file in. Default is ".spacetime_go_sdk".
 // configFile: The name of the config file. Default is "settings.ini".
@@ -63,6 +78,12 @@ func NewAuthToken(options ...AuthTokenOption) (*AuthToken, error) {
 		option(config)
 	}
 
+	if config.envVar != "" {
+		if token := os.Getenv(config.envVar); token != "" {
+			return &AuthToken{token: token, fromEnv: true}, nil
+		}
+	}
+
 	// Set default config root if not provided
 	if config.configRoot == "" {
 		homeDir, err := os.UserHomeDir()
@@ -114,6 +135,7 @@ func (at *AuthToken) GetToken() string {
 
 // SaveToken saves the auth token to local storage.
 // SpacetimeDBClient provides this token to you in the onIdentityReceived callback.
+// With WithAuthFromEnv, the token is only kept in memory.
 func (at *AuthToken) SaveToken(newToken string) error {
 	if at == nil {
 		return fmt.Errorf("AuthToken not initialized")
@@ -122,6 +144,11 @@ func (at *AuthToken) SaveToken(newToken string) error {
 	at.mu.Lock()
 	defer at.mu.Unlock()
 
+	if at.fromEnv {
+		at.token = newToken
+		return nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(at.filePath), 0755); err != nil {
 		return fmt.Errorf("could not create config directory: %w", err)
 	}
@@ -154,7 +181,8 @@ func (at *AuthToken) SaveToken(newToken string) error {
 	return nil
 }
 
-// GetFilePath returns the path where the auth token is stored (for debugging)
+// GetFilePath returns the path where the auth token is stored (for debugging).
+// It is empty when the token comes from an environment variable.
 func (at *AuthToken) GetFilePath() string {
 	if at == nil {
 		return ""
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// BoundDatabase is a DatabaseService bound to one database, so calls don't need
+// to repeat its name or identity. Bound databases share the client's HTTP
+// client, token and identity; use one per database to talk to several databases
+// on the same host.
+type BoundDatabase struct {
+	service        *DatabaseService
+	nameOrIdentity string
+}
+
+// ForDatabase returns a handle bound to the given database name or identity
+func (c *Client) ForDatabase(nameOrIdentity string) *BoundDatabase {
+	return &BoundDatabase{
+		service:        c.Database,
+		nameOrIdentity: nameOrIdentity,
+	}
+}
+
+// Name returns the database name or identity the handle is bound to
+func (d *BoundDatabase) Name() string {
+	return d.nameOrIdentity
+}
+
+// Publish publishes a WASM module to the database
+func (d *BoundDatabase) Publish(wasmModule []byte, clear bool) (*PublishResponse, error) {
+	return d.service.PublishTo(d.nameOrIdentity, wasmModule, clear)
+}
+
+// PublishWithOptions publishes a WASM module to the database, see DatabaseService.PublishWithOptions
+func (d *BoundDatabase) PublishWithOptions(wasmModule []byte, options PublishOptions) (*PublishResponse, error) {
+	return d.service.PublishWithOptions(d.nameOrIdentity, wasmModule, options)
+}
+
+// GetInfo retrieves information about the database
+func (d *BoundDatabase) GetInfo() (*DatabaseInfo, error) {
+	return d.service.GetInfo(d.nameOrIdentity)
+}
+
+// Delete deletes the database
+func (d *BoundDatabase) Delete() error {
+	return d.service.Delete(d.nameOrIdentity)
+}
+
+// GetNames gets the names the database can be identified by
+func (d *BoundDatabase) GetNames() ([]string, error) {
+	return d.service.GetNames(d.nameOrIdentity)
+}
+
+// AddName adds a name to the database
+func (d *BoundDatabase) AddName(newName string) (*SetNameResponse, error) {
+	return d.service.AddName(d.nameOrIdentity, newName)
+}
+
+// SetNames replaces the names of the database
+func (d *BoundDatabase) SetNames(names []string) ([]SetNameResult, error) {
+	return d.service.SetNames(d.nameOrIdentity, names)
+}
+
+// GetIdentity gets the identity of the database
+func (d *BoundDatabase) GetIdentity() (string, error) {
+	return d.service.GetIdentity(d.nameOrIdentity)
+}
+
+// CallReducer calls a reducer on the database
+func (d *BoundDatabase) CallReducer(reducerName string, args []any) error {
+	return d.service.CallReducer(d.nameOrIdentity, reducerName, args)
+}
+
+// CallReducerNamed calls a reducer with arguments given by parameter name, see DatabaseService.CallReducerNamed
+func (d *BoundDatabase) CallReducerNamed(reducerName string, args any) error {
+	return d.service.CallReducerNamed(d.nameOrIdentity, reducerName, args)
+}
+
+// CallReducerBulk calls a reducer once per argument list, see DatabaseService.CallReducerBulk
+func (d *BoundDatabase) CallReducerBulk(reducerName string, argsList [][]any, concurrency int) []error {
+	return d.service.CallReducerBulk(d.nameOrIdentity, reducerName, argsList, concurrency)
+}
+
+// GetSchema retrieves the module schema of the database
+func (d *BoundDatabase) GetSchema() (RawModuleDef, error) {
+	return d.service.GetSchema(d.nameOrIdentity, nil)
+}
+
+// WatchSchema polls the schema of the database, see DatabaseService.WatchSchema
+func (d *BoundDatabase) WatchSchema(interval time.Duration) (<-chan RawModuleDef, func()) {
+	return d.service.WatchSchema(d.nameOrIdentity, interval)
+}
+
+// GetLogs retrieves logs from the database
+func (d *BoundDatabase) GetLogs(numLines *int, follow bool) (string, error) {
+	return d.service.GetLogs(d.nameOrIdentity, numLines, follow)
+}
+
+// GetLogsSince retrieves the database logs written at or after since
+func (d *BoundDatabase) GetLogsSince(since time.Time) (string, error) {
+	return d.service.GetLogsSince(d.nameOrIdentity, since)
+}
+
+// FollowLogs streams the database logs to onLine until ctx is done, see
+// DatabaseService.FollowLogs
+func (d *BoundDatabase) FollowLogs(ctx context.Context, onLine func(line string)) error {
+	return d.service.FollowLogs(ctx, d.nameOrIdentity, onLine)
+}
+
+// ExecuteSQL runs SQL queries against the database
+func (d *BoundDatabase) ExecuteSQL(queries ...string) ([]SQLResult, error) {
+	return d.service.ExecuteSQL(d.nameOrIdentity, queries)
+}
+
+// ExecuteSQLToWriter runs a SQL query and writes its result to w in the given format
+func (d *BoundDatabase) ExecuteSQLToWriter(query string, w io.Writer, format ExportFormat) error {
+	return d.service.ExecuteSQLToWriter(d.nameOrIdentity, query, w, format)
+}
+
+// WaitForRow polls a SQL query until it returns at least one row or the timeout expires
+func (d *BoundDatabase) WaitForRow(query string, timeout time.Duration) (bool, error) {
+	return d.service.WaitForRow(d.nameOrIdentity, query, timeout)
+}
+
+// WaitForRows polls a SQL query until predicate matches its rows or the timeout expires
+func (d *BoundDatabase) WaitForRows(query string, timeout time.Duration, predicate func(rows []any) bool) (bool, error) {
+	return d.service.WaitForRows(d.nameOrIdentity, query, timeout, predicate)
+}
+
+// ConnectWebSocket opens a WebSocket connection to the database for
+// subscriptions and reducer calls
+func (d *BoundDatabase) ConnectWebSocket(protocol string, options ...WebSocketOption) (*WebSocketConnection, error) {
+	return d.service.ConnectWebSocket(d.nameOrIdentity, protocol, options...)
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"sort"
+	"sync"
+)
+
+// TableCache holds a local copy of subscribed table rows.
+// Rows are kept in their JSON wire form and counted, so the same row
+// inserted twice must also be deleted twice before it disappears.
+type TableCache struct {
+	mu     sync.RWMutex
+	tables map[string]map[string]int
+
+	// generation is bumped on every change, so derived indexes know when to rebuild
+	generation uint64
+}
+
+// NewTableCache creates an empty table cache
+func NewTableCache() *TableCache {
+	return &TableCache{
+		tables: make(map[string]map[string]int),
+	}
+}
+
+// Apply applies the deletes and then the inserts of a database update to the cache
+func (tc *TableCache) Apply(update DatabaseUpdate) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.generation++
+
+	for _, table := range update.Tables {
+		for _, entry := range table.Updates {
+			for _, row := range entry.Deletes {
+				tc.removeRow(table.TableName, row)
+			}
+			for _, row := range entry.Inserts {
+				tc.addRow(table.TableName, row)
+			}
+		}
+	}
+}
+
+// Reconcile replaces the cache contents with a fresh snapshot, such as the
+// InitialSubscription received after a reconnect, and returns the difference
+// between the old and new state as table updates. Rows that vanished are
+// reported as deletes and new rows as inserts; unchanged rows are not reported.
+// Tables that are cached but missing from the snapshot are treated as empty.
+// Deletes in the snapshot remove rows inserted by earlier entries, so changes
+// committed after the rows were read can be appended to it.
+func (tc *TableCache) Reconcile(snapshot []TableUpdate) []TableUpdate {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	next := make(map[string]map[string]int, len(snapshot))
+	for _, table := range snapshot {
+		rows, ok := next[table.TableName]
+		if !ok {
+			rows = make(map[string]int)
+			next[table.TableName] = rows
+		}
+		for _, entry := range table.Updates {
+			for _, row := range entry.Deletes {
+				if rows[row] <= 1 {
+					delete(rows, row)
+				} else {
+					rows[row]--
+				}
+			}
+			for _, row := range entry.Inserts {
+				rows[row]++
+			}
+		}
+	}
+
+	names := make(map[string]struct{}, len(tc.tables)+len(next))
+	for name := range tc.tables {
+		names[name] = struct{}{}
+	}
+	for name := range next {
+		names[name] = struct{}{}
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	var delta []TableUpdate
+	for _, name := range sortedNames {
+		entry := diffRows(tc.tables[name], next[name])
+		if len(entry.Inserts) == 0 && len(entry.Deletes) == 0 {
+			continue
+		}
+		delta = append(delta, TableUpdate{
+			TableName: name,
+			NumRows:   uint32(len(entry.Inserts) + len(entry.Deletes)),
+			Updates:   []TableUpdateEntry{entry},
+		})
+	}
+
+	tc.tables = next
+	tc.generation++
+	return delta
+}
+
+// Rows returns a copy of the cached rows of a table
+func (tc *TableCache) Rows(tableName string) []string {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	var rows []string
+	for row, count := range tc.tables[tableName] {
+		for range count {
+			rows = append(rows, row)
+		}
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+// Count returns the number of cached rows in a table
+func (tc *TableCache) Count(tableName string) int {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	total := 0
+	for _, count := range tc.tables[tableName] {
+		total += count
+	}
+	return total
+}
+
+// distinctCount returns the number of distinct cached rows in a table
+func (tc *TableCache) distinctCount(tableName string) int {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return len(tc.tables[tableName])
+}
+
+// TableNames returns the names of all tables with cached rows
+func (tc *TableCache) TableNames() []string {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	names := make([]string, 0, len(tc.tables))
+	for name, rows := range tc.tables {
+		if len(rows) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clear removes all rows from the cache
+func (tc *TableCache) Clear() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.tables = make(map[string]map[string]int)
+	tc.generation++
+}
+
+// snapshot returns the rows of a table along with the cache generation they belong to
+func (tc *TableCache) snapshot(tableName string) ([]string, uint64) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	var rows []string
+	for row, count := range tc.tables[tableName] {
+		for range count {
+			rows = append(rows, row)
+		}
+	}
+	return rows, tc.generation
+}
+
+func (tc *TableCache) addRow(tableName, row string) {
+	rows, ok := tc.tables[tableName]
+	if !ok {
+		rows = make(map[string]int)
+		tc.tables[tableName] = rows
+	}
+	rows[row]++
+}
+
+func (tc *TableCache) removeRow(tableName, row string) {
+	rows, ok := tc.tables[tableName]
+	if !ok {
+		return
+	}
+	if rows[row] <= 1 {
+		delete(rows, row)
+		return
+	}
+	rows[row]--
+}
+
+// diffRows returns the deletes and inserts needed to turn from into to
+func diffRows(from, to map[string]int) TableUpdateEntry {
+	var entry TableUpdateEntry
+	for row, count := range from {
+		for range count - to[row] {
+			entry.Deletes = append(entry.Deletes, row)
+		}
+	}
+	for row, count := range to {
+		for range count - from[row] {
+			entry.Inserts = append(entry.Inserts, row)
+		}
+	}
+	sort.Strings(entry.Deletes)
+	sort.Strings(entry.Inserts)
+	return entry
+}
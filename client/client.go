@@ -3,24 +3,58 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Version is the version of this SDK
+const Version = "0.1.0"
+
+// DefaultUserAgent is the User-Agent sent unless one is set with WithUserAgent
+const DefaultUserAgent = "spacetimedb-go-sdk/" + Version
+
+var (
+	// ErrBaseURLRequired is returned by Build when no base URL was set
+	ErrBaseURLRequired = errors.New("base URL is required")
+
+	// ErrInvalidBaseURL is returned by Build when the base URL cannot be parsed;
+	// the error also wraps the parse error
+	ErrInvalidBaseURL = errors.New("invalid base URL")
+
+	// ErrAuthRequired is returned by RequireAuth, and by every operation that
+	// needs a token, when the client has none
+	ErrAuthRequired = errors.New("authentication token is required for this operation")
+)
+
 // Client represents a SpacetimeDB client with access to all API endpoints
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	tokenMu    sync.RWMutex // guards token and identity
 	token      string
 	identity   string
+	tlsConfig  *tls.Config
+	userAgent  string
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 
+	// unauthorizedHandler refreshes the token after a 401; refreshing guards
+	// against retrying requests made while it runs
+	unauthorizedHandler func() (string, error)
+	refreshing          atomic.Bool
+
+	// tokenProvider, if set, supplies the token for every request
+	tokenProvider func(ctx context.Context) (string, error)
+
 	// Service interfaces for different API areas
 	Identity *IdentityService
 	Database *DatabaseService
@@ -33,12 +67,23 @@ type ClientBuilder struct {
 	identity   string
 	httpClient *http.Client
 	timeout    time.Duration
+	tlsConfig  *tls.Config
+	userAgent  string
+
+	// Transport tuning, applied when no custom HTTP client is set
+	http2        *bool
+	maxIdleConns int
+
+	unauthorizedHandler func() (string, error)
+	tokenProvider       func(ctx context.Context) (string, error)
+	roundTripper        http.RoundTripper
 }
 
 // NewClientBuilder creates a new client builder
 func NewClientBuilder() *ClientBuilder {
 	return &ClientBuilder{
-		timeout: 30 * time.Second,
+		timeout:   30 * time.Second,
+		userAgent: DefaultUserAgent,
 	}
 }
 
@@ -66,21 +111,91 @@ func (b *ClientBuilder) WithTimeout(timeout time.Duration) *ClientBuilder {
 	return b
 }
 
+// WithUserAgent sets the User-Agent header sent with every HTTP request and
+// the WebSocket handshake, replacing DefaultUserAgent. Applications can append
+// their own name, e.g. "my-game/1.2 " + client.DefaultUserAgent.
+func (b *ClientBuilder) WithUserAgent(userAgent string) *ClientBuilder {
+	b.userAgent = userAgent
+	return b
+}
+
 // WithHTTPClient sets a custom HTTP client
 func (b *ClientBuilder) WithHTTPClient(client *http.Client) *ClientBuilder {
 	b.httpClient = client
 	return b
 }
 
+// WithRoundTripper sets the transport that carries every HTTP request, for
+// example a fake that returns canned responses so tests can assert exact
+// request construction without a server. It takes precedence over the TLS and
+// transport tuning options, and has no effect when a custom client is supplied
+// via WithHTTPClient. WebSocket connections are dialed directly and do not use it.
+func (b *ClientBuilder) WithRoundTripper(roundTripper http.RoundTripper) *ClientBuilder {
+	b.roundTripper = roundTripper
+	return b
+}
+
+// WithHTTP2 enables or disables HTTP/2 for HTTPS requests. By default HTTP/2 is
+// negotiated whenever the server supports it. It has no effect when a custom
+// client is supplied via WithHTTPClient.
+func (b *ClientBuilder) WithHTTP2(enabled bool) *ClientBuilder {
+	b.http2 = &enabled
+	return b
+}
+
+// WithMaxIdleConns sets how many idle connections are kept open for reuse.
+// Since all requests go to the same host, it also raises the per-host limit,
+// which defaults to 2 and forces a burst of concurrent requests to open new
+// connections. It has no effect when a custom client is supplied via
+// WithHTTPClient.
+func (b *ClientBuilder) WithMaxIdleConns(n int) *ClientBuilder {
+	b.maxIdleConns = n
+	return b
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification for both HTTP
+// requests and WebSocket connections.
+//
+// WARNING: this is intended for local development against self-signed
+// certificates only. It makes the connection vulnerable to man-in-the-middle
+// attacks and must never be used in production. It has no effect on the HTTP
+// side when a custom client is supplied via WithHTTPClient.
+func (b *ClientBuilder) WithInsecureSkipVerify() *ClientBuilder {
+	b.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	return b
+}
+
+// WithUnauthorizedHandler sets a function called when an authenticated request
+// is rejected with 401 Unauthorized, for example because the token expired. The
+// client stores the returned token with SetToken and retries the request once.
+// If the handler fails, or the retry is rejected again, the 401 is returned.
+// Requests that get a 401 while the handler runs, including any it makes
+// itself, are not retried.
+func (b *ClientBuilder) WithUnauthorizedHandler(handler func() (newToken string, err error)) *ClientBuilder {
+	b.unauthorizedHandler = handler
+	return b
+}
+
+// WithTokenProvider sets a function called for the token of every HTTP request
+// and WebSocket handshake, instead of a token fixed with WithToken. Use it with
+// short-lived tokens, such as a JWT issued by an OIDC provider, that must be
+// fetched or refreshed before they expire; the provider should cache the token
+// while it is valid. The last token it returned is also what GetToken reports.
+// A provider error fails the request.
+func (b *ClientBuilder) WithTokenProvider(provider func(ctx context.Context) (string, error)) *ClientBuilder {
+	b.tokenProvider = provider
+	return b
+}
+
 // Build creates the configured client
 func (b *ClientBuilder) Build() (*Client, error) {
 	if b.baseURL == "" {
-		return nil, fmt.Errorf("base URL is required")
+		return nil, ErrBaseURLRequired
 	}
 
 	parsedURL, err := url.Parse(b.baseURL)
 	if err != nil {
-		return nil, fmt.Errorf("invalid base URL: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBaseURL, err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -90,6 +205,11 @@ func (b *ClientBuilder) Build() (*Client, error) {
 		httpClient = &http.Client{
 			Timeout: b.timeout,
 		}
+		if b.roundTripper != nil {
+			httpClient.Transport = b.roundTripper
+		} else if b.tlsConfig != nil || b.http2 != nil || b.maxIdleConns > 0 {
+			httpClient.Transport = b.transport()
+		}
 	}
 
 	client := &Client{
@@ -97,8 +217,13 @@ func (b *ClientBuilder) Build() (*Client, error) {
 		httpClient: httpClient,
 		token:      b.token,
 		identity:   b.identity,
+		tlsConfig:  b.tlsConfig,
+		userAgent:  b.userAgent,
 		ctx:        ctx,
 		cancelFunc: cancel,
+
+		unauthorizedHandler: b.unauthorizedHandler,
+		tokenProvider:       b.tokenProvider,
 	}
 
 	// Initialize service interfaces
@@ -108,6 +233,26 @@ func (b *ClientBuilder) Build() (*Client, error) {
 	return client, nil
 }
 
+// transport clones the default transport with the builder's TLS and tuning options
+func (b *ClientBuilder) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if b.tlsConfig != nil {
+		transport.TLSClientConfig = b.tlsConfig
+	}
+	if b.http2 != nil {
+		transport.ForceAttemptHTTP2 = *b.http2
+		if !*b.http2 {
+			// A non-nil empty map disables the automatic HTTP/2 upgrade
+			transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+	}
+	if b.maxIdleConns > 0 {
+		transport.MaxIdleConns = b.maxIdleConns
+		transport.MaxIdleConnsPerHost = b.maxIdleConns
+	}
+	return transport
+}
+
 // Close closes the client and its connections
 func (c *Client) Close() error {
 	c.cancelFunc()
@@ -118,7 +263,7 @@ func (c *Client) Close() error {
 func (c *Client) Ping() error {
 	url := fmt.Sprintf("%s/v1/ping", c.baseURL)
 
-	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	req, err := c.newRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("error creating ping request: %w", err)
 	}
@@ -136,23 +281,85 @@ func (c *Client) Ping() error {
 	return nil
 }
 
+// HealthStatus is the result of a HealthCheck
+type HealthStatus struct {
+	Reachable     bool          // The server answered the ping
+	Authenticated bool          // The token was verified against the client identity
+	Latency       time.Duration // Round trip time of the ping
+}
+
+// HealthCheck pings the server and, if a token and identity are set, verifies
+// them with Identity.Verify. The returned status is filled in as far as the
+// check got, and the error reports the step that failed. Without a token or
+// identity Authenticated is false and no error is returned.
+func (c *Client) HealthCheck() (*HealthStatus, error) {
+	status := &HealthStatus{}
+
+	start := time.Now()
+	err := c.Ping()
+	status.Latency = time.Since(start)
+	if err != nil {
+		return status, err
+	}
+	status.Reachable = true
+
+	identity := c.GetIdentity()
+	if !c.IsAuthenticated() || identity == "" {
+		return status, nil
+	}
+	if err := c.Identity.Verify(identity); err != nil {
+		return status, fmt.Errorf("error verifying token: %w", err)
+	}
+	status.Authenticated = true
+
+	return status, nil
+}
+
 // GetToken returns the current token
 func (c *Client) GetToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
 	return c.token
 }
 
+// currentToken returns the token to send, asking the token provider if one is set
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	if c.tokenProvider == nil {
+		return c.GetToken(), nil
+	}
+	token, err := c.tokenProvider(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting token: %w", err)
+	}
+	c.SetToken(token)
+	return token, nil
+}
+
+// IsAuthenticated reports whether requests are sent with a token, either one
+// set with WithToken or SetToken or one supplied by a token provider. It does
+// not check that the server accepts the token; use HealthCheck for that.
+func (c *Client) IsAuthenticated() bool {
+	return c.tokenProvider != nil || c.GetToken() != ""
+}
+
 // SetToken updates the current token
 func (c *Client) SetToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
 	c.token = token
 }
 
 // GetIdentity returns the current identity
 func (c *Client) GetIdentity() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
 	return c.identity
 }
 
 // SetIdentity updates the current identity
 func (c *Client) SetIdentity(identity string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
 	c.identity = identity
 }
 
@@ -173,9 +380,29 @@ func (c *Client) GetContext() context.Context {
 
 // Helper methods for common HTTP operations
 
+// newRequest creates a request bound to the client context, with the User-Agent set
+func (c *Client) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	return req, nil
+}
+
+// streamingHTTPClient returns the HTTP client without its overall timeout, for
+// responses that stay open until the caller stops reading
+func (c *Client) streamingHTTPClient() *http.Client {
+	streaming := *c.httpClient
+	streaming.Timeout = 0
+	return &streaming
+}
+
 // doRequest performs a basic HTTP request and returns the response
 func (c *Client) doRequest(method, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(c.ctx, method, url, body)
+	req, err := c.newRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -185,16 +412,12 @@ func (c *Client) doRequest(method, url string, body io.Reader) (*http.Response,
 
 // doAuthenticatedRequest performs an HTTP request with authentication
 func (c *Client) doAuthenticatedRequest(method, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(c.ctx, method, url, body)
+	req, err := c.newRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	if c.token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	}
-
-	return c.httpClient.Do(req)
+	return c.doWithAuth(req)
 }
 
 // doJSONRequest performs an HTTP request with JSON body and authentication
@@ -208,50 +431,110 @@ func (c *Client) doJSONRequest(method, url string, body any) (*http.Response, er
 		bodyReader = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(c.ctx, method, url, bodyReader)
+	req, err := c.newRequest(method, url, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	if c.token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	}
-
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	return c.httpClient.Do(req)
+	return c.doWithAuth(req)
 }
 
 // doWASMRequest performs an HTTP request with WASM body and authentication
 func (c *Client) doWASMRequest(method, url string, wasmModule []byte) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(c.ctx, method, url, bytes.NewReader(wasmModule))
+	req, err := c.newRequest(method, url, bytes.NewReader(wasmModule))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	if c.token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	}
 	req.Header.Set("Content-Type", "application/wasm")
 
-	return c.httpClient.Do(req)
+	return c.doWithAuth(req)
 }
 
 // doTextRequest performs an HTTP request with text body and authentication
 func (c *Client) doTextRequest(method, url string, text string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(c.ctx, method, url, strings.NewReader(text))
+	return c.doTextRequestContext(c.ctx, method, url, text)
+}
+
+// doTextRequestContext is doTextRequest bound to ctx, which should be derived
+// from the client context, instead of the client context itself
+func (c *Client) doTextRequestContext(ctx context.Context, method, url string, text string) (*http.Response, error) {
+	req, err := c.newRequest(method, url, strings.NewReader(text))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
+	req = req.WithContext(ctx)
 
-	if c.token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	}
 	req.Header.Set("Content-Type", "text/plain")
 
-	return c.httpClient.Do(req)
+	return c.doWithAuth(req)
+}
+
+// doWithAuth sends a request with the current token. On 401 Unauthorized it asks
+// the unauthorized handler, if any, for a new token and retries the request once.
+func (c *Client) doWithAuth(req *http.Request) (*http.Response, error) {
+	return c.doWithAuthUsing(c.httpClient, req)
+}
+
+// doWithAuthUsing is doWithAuth sending through the given HTTP client
+func (c *Client) doWithAuthUsing(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	token, err := c.currentToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.unauthorizedHandler == nil {
+		return resp, err
+	}
+	// The body must be replayable to retry
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return resp, nil
+	}
+	token, refreshErr := c.unauthorizedHandler()
+	c.refreshing.Store(false)
+	if refreshErr != nil || token == "" {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+
+	c.SetToken(token)
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return httpClient.Do(retry)
+}
+
+// HTTPError is returned when the server responds with an unexpected status code
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// IsUnauthorized returns true if the server rejected the request's credentials
+func (e *HTTPError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
 }
 
 // handleJSONResponse handles a JSON response and unmarshals it
@@ -260,7 +543,7 @@ func (c *Client) handleJSONResponse(resp *http.Response, target any) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	if target != nil {
@@ -278,7 +561,7 @@ func (c *Client) handleTextResponse(resp *http.Response) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return "", &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -289,10 +572,11 @@ func (c *Client) handleTextResponse(resp *http.Response) (string, error) {
 	return strings.TrimSpace(string(body)), nil
 }
 
-// requiresAuth checks if authentication is required and returns error if not available
-func (c *Client) requiresAuth() error {
-	if c.token == "" {
-		return fmt.Errorf("authentication token is required for this operation")
+// RequireAuth returns ErrAuthRequired unless the client is authenticated, so an
+// operation that needs a token can be gated without sending a failing request
+func (c *Client) RequireAuth() error {
+	if !c.IsAuthenticated() {
+		return ErrAuthRequired
 	}
 	return nil
 }
@@ -1,5 +1,15 @@
 package client
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSubscriptionQuery is returned when subscribing to a statement that is
+// not a SELECT query. Subscriptions only read; data is changed by calling reducers.
+var ErrInvalidSubscriptionQuery = errors.New("subscription query must be a SELECT statement")
+
 // ClientMessage represents all possible client-to-server messages
 type ClientMessage struct {
 	CallReducer      *CallReducer      `json:"CallReducer,omitempty"`
@@ -11,6 +21,167 @@ type ClientMessage struct {
 	UnsubscribeMulti *UnsubscribeMulti `json:"UnsubscribeMulti,omitempty"`
 }
 
+// Validate checks that exactly one message variant is set
+func (cm ClientMessage) Validate() error {
+	var variants []string
+	if cm.CallReducer != nil {
+		variants = append(variants, "CallReducer")
+	}
+	if cm.Subscribe != nil {
+		variants = append(variants, "Subscribe")
+	}
+	if cm.OneOffQuery != nil {
+		variants = append(variants, "OneOffQuery")
+	}
+	if cm.SubscribeSingle != nil {
+		variants = append(variants, "SubscribeSingle")
+	}
+	if cm.SubscribeMulti != nil {
+		variants = append(variants, "SubscribeMulti")
+	}
+	if cm.Unsubscribe != nil {
+		variants = append(variants, "Unsubscribe")
+	}
+	if cm.UnsubscribeMulti != nil {
+		variants = append(variants, "UnsubscribeMulti")
+	}
+
+	switch len(variants) {
+	case 1:
+		if cm.CallReducer != nil {
+			return validateReducerName(cm.CallReducer.Reducer)
+		}
+		return nil
+	case 0:
+		return fmt.Errorf("client message has no variant set")
+	default:
+		return fmt.Errorf("client message must have exactly one variant set, got %s", strings.Join(variants, ", "))
+	}
+}
+
+// subscriptionQueries returns the queries of a subscribe message, nil for other
+// messages
+func (cm ClientMessage) subscriptionQueries() []string {
+	switch {
+	case cm.Subscribe != nil:
+		return cm.Subscribe.QueryStrings
+	case cm.SubscribeSingle != nil:
+		return []string{cm.SubscribeSingle.Query}
+	case cm.SubscribeMulti != nil:
+		return cm.SubscribeMulti.QueryStrings
+	default:
+		return nil
+	}
+}
+
+// validateSubscriptionQuery returns ErrInvalidSubscriptionQuery unless the
+// query starts with the SELECT keyword, ignoring case and surrounding space
+func validateSubscriptionQuery(query string) error {
+	trimmed := strings.TrimSpace(query)
+	if len(trimmed) >= len("SELECT") && strings.EqualFold(trimmed[:len("SELECT")], "SELECT") {
+		rest := trimmed[len("SELECT"):]
+		if rest == "" || !isIdentifierByte(rest[0]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q; use CallReducer to modify data", ErrInvalidSubscriptionQuery, query)
+}
+
+// isIdentifierByte reports whether b can continue an SQL keyword or identifier
+func isIdentifierByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// Reducer call flags, sent in CallReducer.Flags
+const (
+	// CallReducerFullUpdate asks for a TransactionUpdate whether the call
+	// succeeded or failed. It is the default.
+	CallReducerFullUpdate uint8 = 0
+	// CallReducerNoSuccessNotify skips the TransactionUpdate of a successful
+	// call; failures are still reported
+	CallReducerNoSuccessNotify uint8 = 1
+)
+
+// Typed constructors for each client message variant
+
+// NewCallReducerMessage creates a reducer call message
+func NewCallReducerMessage(reducerName, args string, requestID uint32, flags uint8) ClientMessage {
+	return ClientMessage{
+		CallReducer: &CallReducer{
+			Reducer:   reducerName,
+			Args:      args,
+			RequestID: requestID,
+			Flags:     flags,
+		},
+	}
+}
+
+// NewSubscribeMessage creates a subscription message for multiple queries
+func NewSubscribeMessage(queries []string, requestID uint32) ClientMessage {
+	return ClientMessage{
+		Subscribe: &Subscribe{
+			QueryStrings: queries,
+			RequestID:    requestID,
+		},
+	}
+}
+
+// NewOneOffQueryMessage creates a one-off query message. A nil messageID is
+// replaced with one from NewMessageID, readable from the OneOffQuery field.
+func NewOneOffQueryMessage(messageID []byte, queryString string) ClientMessage {
+	if messageID == nil {
+		messageID = NewMessageID()
+	}
+	return ClientMessage{
+		OneOffQuery: &OneOffQuery{
+			MessageID:   messageID,
+			QueryString: queryString,
+		},
+	}
+}
+
+// NewSubscribeSingleMessage creates a single query subscription message
+func NewSubscribeSingleMessage(query string, requestID uint32, queryID QueryID) ClientMessage {
+	return ClientMessage{
+		SubscribeSingle: &SubscribeSingle{
+			Query:     query,
+			RequestID: requestID,
+			QueryID:   queryID,
+		},
+	}
+}
+
+// NewSubscribeMultiMessage creates a multi-query subscription message
+func NewSubscribeMultiMessage(queries []string, requestID uint32, queryID QueryID) ClientMessage {
+	return ClientMessage{
+		SubscribeMulti: &SubscribeMulti{
+			QueryStrings: queries,
+			RequestID:    requestID,
+			QueryID:      queryID,
+		},
+	}
+}
+
+// NewUnsubscribeMessage creates a single query unsubscription message
+func NewUnsubscribeMessage(requestID uint32, queryID QueryID) ClientMessage {
+	return ClientMessage{
+		Unsubscribe: &Unsubscribe{
+			RequestID: requestID,
+			QueryID:   queryID,
+		},
+	}
+}
+
+// NewUnsubscribeMultiMessage creates a multi-query unsubscription message
+func NewUnsubscribeMultiMessage(requestID uint32, queryID QueryID) ClientMessage {
+	return ClientMessage{
+		UnsubscribeMulti: &UnsubscribeMulti{
+			RequestID: requestID,
+			QueryID:   queryID,
+		},
+	}
+}
+
 // CallReducer represents a reducer call request
 type CallReducer struct {
 	Reducer   string `json:"reducer"`
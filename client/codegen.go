@@ -0,0 +1,451 @@
+package client
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// sdkImportPath is the import path generated bindings use for this package
+const sdkImportPath = "github.com/Yuni-sa/spacetimedb-go-sdk/client"
+
+// GenerateBindings generates Go source for typed module bindings from a schema:
+// a DbConnection wrapping a WebSocketConnection, a Reducers façade with one
+// method per reducer, taking typed arguments and calling CallReducerArgs,
+// and a Tables façade with one TableHandle per table, backed by the cache of a
+// SubscriptionManager. Tables with a primary key get a FindBy method for it.
+// Row types and named product types used by reducer parameters are emitted as structs.
+// DbConnection runs the application's goroutines with Go and stops them with Shutdown.
+func GenerateBindings(schema RawModuleDef, packageName string) ([]byte, error) {
+	if !token.IsIdentifier(packageName) {
+		return nil, fmt.Errorf("invalid package name %q", packageName)
+	}
+
+	g := newBindingGenerator(schema)
+	body := g.generate()
+
+	var out strings.Builder
+	out.WriteString("// Code generated by spacetimedb-go-sdk. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", packageName)
+	out.WriteString("import (\n")
+	imports := append([]string{sdkImportPath}, g.importList()...)
+	slices.Sort(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.WriteString(body)
+
+	source, err := format.Source([]byte(out.String()))
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated bindings: %w", err)
+	}
+	return source, nil
+}
+
+// bindingGenerator accumulates generated declarations and the imports they need
+type bindingGenerator struct {
+	schema  RawModuleDef
+	imports map[string]struct{}
+
+	// typeNames maps references to named product types onto Go type names
+	typeNames map[AlgebraicTypeRef]string
+	emitted   map[AlgebraicTypeRef]bool
+	pending   []AlgebraicTypeRef
+}
+
+func newBindingGenerator(schema RawModuleDef) *bindingGenerator {
+	g := &bindingGenerator{
+		schema:    schema,
+		imports:   make(map[string]struct{}),
+		typeNames: make(map[AlgebraicTypeRef]string),
+		emitted:   make(map[AlgebraicTypeRef]bool),
+	}
+
+	for _, named := range schema.Types {
+		target := schema.Typespace.GetType(named.Type)
+		if target == nil || target.Product == nil {
+			continue
+		}
+		if _, special := specialProductName(*target.Product); special {
+			continue
+		}
+		g.typeNames[named.Type] = exportedName(strings.Join(append(slices.Clone(named.Name.Scope), named.Name.Name), "_"))
+	}
+
+	// Row types without a declared name are named after their table
+	for _, table := range g.clientTables() {
+		if _, ok := g.typeNames[table.ProductTypeRef]; !ok {
+			g.typeNames[table.ProductTypeRef] = exportedName(table.Name)
+		}
+	}
+	return g
+}
+
+func (g *bindingGenerator) generate() string {
+	var out strings.Builder
+
+	g.use("context", "")
+	g.use("sync", "")
+	out.WriteString(`
+// DbConnection is a connection to the module with typed access to its reducers
+// and tables
+type DbConnection struct {
+	*client.WebSocketConnection
+	Subscriptions *client.SubscriptionManager
+	Reducers      *Reducers
+	Tables        *Tables
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// NewDbConnection wraps an established WebSocket connection. The application's
+// read loop must pass server messages to Subscriptions.HandleMessage to keep
+// Tables up to date.
+func NewDbConnection(conn *client.WebSocketConnection) *DbConnection {
+	subscriptions := client.NewSubscriptionManager(conn, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DbConnection{
+		WebSocketConnection: conn,
+		Subscriptions:       subscriptions,
+		Reducers:            &Reducers{conn: conn},
+		Tables:              newTables(subscriptions.Cache()),
+		ctx:                 ctx,
+		cancel:              cancel,
+	}
+}
+
+// Go runs fn in a goroutine managed by the connection, such as the read loop
+// or a command processor. Its context is cancelled by Shutdown, which waits
+// for fn to return.
+func (c *DbConnection) Go(fn func(ctx context.Context)) {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		fn(c.ctx)
+	}()
+}
+
+// Shutdown cancels the context of the goroutines started with Go, closes the
+// connection gracefully so that those blocked reading from it return, and
+// waits for all of them to finish or ctx to end. The graceful close is bounded
+// by ctx too: when ctx ends first the connection is closed at once. Once it
+// returns nil, no managed goroutine is running.
+func (c *DbConnection) Shutdown(ctx context.Context) error {
+	c.cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		closeErr := c.GracefulClose()
+		if closeErr != nil {
+			c.Close()
+		}
+		c.workers.Wait()
+		done <- closeErr
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		c.Close()
+		return ctx.Err()
+	}
+}
+
+// Reducers calls the module's reducers
+type Reducers struct {
+	conn *client.WebSocketConnection
+}
+`)
+
+	for _, reducer := range g.schema.Reducers {
+		// Lifecycle reducers are called by the host, not by clients, and
+		// reducers that failed to decode have no name
+		if reducer.Lifecycle.Some != nil || reducer.Name == "" {
+			continue
+		}
+		g.writeReducer(&out, reducer)
+	}
+
+	g.writeTables(&out)
+	g.writeNamedTypes(&out)
+	return out.String()
+}
+
+func (g *bindingGenerator) writeReducer(out *strings.Builder, reducer ReducerDef) {
+	params := make([]string, len(reducer.Params.Elements))
+	args := make([]string, len(reducer.Params.Elements))
+	used := map[string]bool{"r": true}
+	for i, element := range reducer.Params.Elements {
+		name := fmt.Sprintf("arg%d", i)
+		if element.Name != nil && element.Name.IsSome() {
+			name = paramName(element.Name.Value())
+		}
+		for used[name] {
+			name += "Arg"
+		}
+		used[name] = true
+
+		params[i] = fmt.Sprintf("%s %s", name, g.goType(element.AlgebraicType, 0))
+		args[i] = name
+	}
+
+	method := exportedName(reducer.Name)
+	fmt.Fprintf(out, "\n// %s calls the %s reducer and returns the request ID\n", method, reducer.Name)
+	fmt.Fprintf(out, "func (r *Reducers) %s(%s) (uint32, error) {\n", method, strings.Join(params, ", "))
+	fmt.Fprintf(out, "\treturn r.conn.CallReducerArgs(%q, []any{%s})\n}\n", reducer.Name, strings.Join(args, ", "))
+}
+
+// clientTables returns the user tables of the schema
+func (g *bindingGenerator) clientTables() []TableDef {
+	var tables []TableDef
+	for _, table := range g.schema.Tables {
+		if table.TableType.System != nil {
+			continue
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func (g *bindingGenerator) writeTables(out *strings.Builder) {
+	tables := g.clientTables()
+
+	out.WriteString("\n// Tables gives typed access to the subscribed rows of the module's tables\n")
+	out.WriteString("type Tables struct {\n")
+	for _, table := range tables {
+		fmt.Fprintf(out, "\t%s %sTable\n", exportedName(table.Name), exportedName(table.Name))
+	}
+	out.WriteString("}\n")
+
+	out.WriteString("\nfunc newTables(cache *client.TableCache) *Tables {\n\treturn &Tables{\n")
+	for _, table := range tables {
+		rowType := g.goType(NewRefAlgebraicType(table.ProductTypeRef), 0)
+		fmt.Fprintf(out, "\t\t%s: %sTable{client.NewTableHandle[%s](cache, %q, %d)},\n",
+			exportedName(table.Name), exportedName(table.Name), rowType, table.Name, primaryKeyColumn(table))
+	}
+	out.WriteString("\t}\n}\n")
+
+	for _, table := range tables {
+		g.writeTable(out, table)
+	}
+}
+
+func (g *bindingGenerator) writeTable(out *strings.Builder, table TableDef) {
+	handle := exportedName(table.Name) + "Table"
+	rowType := g.goType(NewRefAlgebraicType(table.ProductTypeRef), 0)
+	fmt.Fprintf(out, "\n// %s is the cached %s table\n", handle, table.Name)
+	fmt.Fprintf(out, "type %s struct {\n\t*client.TableHandle[%s]\n}\n", handle, rowType)
+
+	column := primaryKeyColumn(table)
+	row := g.schema.Typespace.Resolve(NewRefAlgebraicType(table.ProductTypeRef))
+	if column < 0 || row.Product == nil || column >= len(row.Product.Elements) {
+		return
+	}
+
+	element := row.Product.Elements[column]
+	columnName := fmt.Sprintf("col_%d", column)
+	if element.Name != nil && element.Name.IsSome() {
+		columnName = element.Name.Value()
+	}
+	method := "FindBy" + exportedName(columnName)
+	param := paramName(columnName)
+	if param == "t" {
+		param = "key"
+	}
+
+	fmt.Fprintf(out, "\n// %s finds a %s row by its primary key\n", method, table.Name)
+	fmt.Fprintf(out, "func (t %s) %s(%s %s) (%s, bool) {\n", handle, method, param, g.goType(element.AlgebraicType, 0), rowType)
+	fmt.Fprintf(out, "\treturn t.FindByPrimaryKey(%s)\n}\n", param)
+}
+
+// primaryKeyColumn returns the column index of a table's single-column primary
+// key, or -1 if it has none
+func primaryKeyColumn(table TableDef) int {
+	columns := table.PrimaryKeyColumns()
+	if len(table.PrimaryKey) != 1 || len(columns) != 1 {
+		return -1
+	}
+	return columns[0]
+}
+
+// writeNamedTypes emits a struct for every named type referenced so far,
+// including the ones those structs reference in turn
+func (g *bindingGenerator) writeNamedTypes(out *strings.Builder) {
+	for len(g.pending) > 0 {
+		ref := g.pending[0]
+		g.pending = g.pending[1:]
+
+		name := g.typeNames[ref]
+		product := g.schema.Typespace.GetType(ref).Product
+		fmt.Fprintf(out, "\n// %s is a row type defined by the module\n", name)
+		fmt.Fprintf(out, "type %s %s\n", name, g.structType(*product, 0))
+	}
+}
+
+// goType maps a SATS type onto the Go type used in generated bindings
+func (g *bindingGenerator) goType(typ AlgebraicType, depth int) string {
+	if depth > maxFormatDepth {
+		return g.use("encoding/json", "json.RawMessage")
+	}
+
+	if typ.Ref != nil {
+		if name, ok := g.typeNames[*typ.Ref]; ok {
+			if !g.emitted[*typ.Ref] {
+				g.emitted[*typ.Ref] = true
+				g.pending = append(g.pending, *typ.Ref)
+			}
+			return name
+		}
+		typ = g.schema.Typespace.Resolve(typ)
+	}
+
+	switch {
+	case typ.Primitive != "":
+		goType := primitiveGoType(typ.Primitive)
+		if strings.HasPrefix(goType, "json.") {
+			g.use("encoding/json", goType)
+		}
+		return goType
+	case typ.GetArray() != nil:
+		elem := *typ.GetArray()
+		if resolved := g.schema.Typespace.Resolve(elem); resolved.Primitive == PrimitiveU8 {
+			return "[]byte"
+		}
+		return "[]" + g.goType(elem, depth+1)
+	case typ.GetMap() != nil:
+		mapType := typ.GetMap()
+		return fmt.Sprintf("map[%s]%s", g.goType(mapType.KeyType, depth+1), g.goType(mapType.ValueType, depth+1))
+	case typ.Product != nil:
+		if name, ok := specialProductName(*typ.Product); ok {
+			switch name {
+			case "Identity":
+				return "client.Identity"
+			case "ConnectionId":
+				return "client.ConnectionID"
+			case "Timestamp":
+				return g.use("time", "time.Time")
+			case "TimeDuration":
+				return g.use("time", "time.Duration")
+			}
+		}
+		return g.structType(*typ.Product, depth)
+	case typ.Sum != nil:
+		if inner, ok := optionInner(*typ.Sum); ok {
+			return "*" + g.goType(inner, depth+1)
+		}
+		// Other sums are passed through in their [tag, value] wire form
+		return g.use("encoding/json", "json.RawMessage")
+	default:
+		return g.use("encoding/json", "json.RawMessage")
+	}
+}
+
+// structType renders a product type as a Go struct with one field per element
+func (g *bindingGenerator) structType(product ProductType, depth int) string {
+	if len(product.Elements) == 0 {
+		return "struct{}"
+	}
+
+	var out strings.Builder
+	out.WriteString("struct {\n")
+	used := make(map[string]bool)
+	for i, element := range product.Elements {
+		name := fmt.Sprintf("Field%d", i)
+		if element.Name != nil && element.Name.IsSome() {
+			name = exportedName(element.Name.Value())
+		}
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		fmt.Fprintf(&out, "\t%s %s\n", name, g.goType(element.AlgebraicType, depth+1))
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// use records an import needed by a generated type expression
+func (g *bindingGenerator) use(importPath, typeExpr string) string {
+	g.imports[importPath] = struct{}{}
+	return typeExpr
+}
+
+func (g *bindingGenerator) importList() []string {
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// primitiveGoType maps a primitive SATS type onto a Go type. Integers wider
+// than 64 bits keep their exact value as a json.Number.
+func primitiveGoType(primitive PrimitiveType) string {
+	switch primitive {
+	case PrimitiveBool:
+		return "bool"
+	case PrimitiveString:
+		return "string"
+	case PrimitiveF32:
+		return "float32"
+	case PrimitiveF64:
+		return "float64"
+	case PrimitiveI128, PrimitiveU128, PrimitiveI256, PrimitiveU256:
+		return "json.Number"
+	default:
+		// I8 -> int8, U64 -> uint64, ...
+		name := strings.ToLower(string(primitive))
+		if name[0] == 'u' {
+			return "uint" + name[1:]
+		}
+		return "int" + name[1:]
+	}
+}
+
+// exportedName converts a snake_case or camelCase name to an exported Go
+// identifier, such as entity_id -> EntityID
+func exportedName(name string) string {
+	var out strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.EqualFold(part, "id") {
+			out.WriteString("ID")
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		out.WriteString(string(runes))
+	}
+
+	result := out.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
+
+// paramName converts a name to an unexported Go identifier that is not a keyword
+func paramName(name string) string {
+	exported := exportedName(name)
+	runes := []rune(exported)
+	// Lowercase the leading initialism as a whole, so ID -> id
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	result := string(runes)
+	if token.IsKeyword(result) {
+		result += "Arg"
+	}
+	return result
+}
@@ -1,12 +1,81 @@
 package client
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
+// maxBulkAuthFailures is the number of consecutive authentication failures
+// after which CallReducerBulk stops dispatching calls
+const maxBulkAuthFailures = 3
+
+// Polling intervals used by WaitForRows
+const (
+	waitForRowsInitialInterval = 50 * time.Millisecond
+	waitForRowsMaxInterval     = time.Second
+)
+
+// ErrClearDenied is returned by PublishTo when clearing the database was
+// requested but the server denied permission
+var ErrClearDenied = errors.New("permission to clear database denied")
+
+// errRepeatedAuthFailures is reported for bulk calls skipped after repeated authentication failures
+var errRepeatedAuthFailures = errors.New("skipped after repeated authentication failures")
+
+// ErrInvalidReducerName is returned before sending a reducer call whose name is
+// empty or contains characters that would break its URL
+var ErrInvalidReducerName = errors.New("invalid reducer name")
+
+// ErrInvalidDatabaseName is returned before sending a request for a database
+// name or identity that is empty or contains characters that would break its URL
+var ErrInvalidDatabaseName = errors.New("invalid database name")
+
+// validateReducerName rejects empty reducer names and ones that would change
+// the meaning of the /call/ URL
+func validateReducerName(reducerName string) error {
+	if err := checkPathSegment(reducerName); err != nil {
+		return fmt.Errorf("%w %q: %s", ErrInvalidReducerName, reducerName, err)
+	}
+	return nil
+}
+
+// validateDatabaseName rejects empty database names and identities and ones
+// that would change the meaning of the /v1/database/ URL
+func validateDatabaseName(nameOrIdentity string) error {
+	if err := checkPathSegment(nameOrIdentity); err != nil {
+		return fmt.Errorf("%w %q: %s", ErrInvalidDatabaseName, nameOrIdentity, err)
+	}
+	return nil
+}
+
+// checkPathSegment reports why a name cannot be used as one URL path segment
+func checkPathSegment(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is empty")
+	}
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+			return fmt.Errorf("name contains %q", r)
+		case strings.ContainsRune("/?#%\\", r):
+			return fmt.Errorf("name contains %q", r)
+		}
+	}
+	return nil
+}
+
 // DatabaseService handles all database-related operations
 type DatabaseService struct {
 	client *Client
@@ -45,6 +114,29 @@ type PublishResponse struct {
 	PermissionDenied *struct {
 		Name string `json:"name"`
 	} `json:"PermissionDenied,omitempty"`
+
+	// Cleared reports whether existing data was (or, for a dry run, would be) wiped
+	Cleared bool `json:"-"`
+	// DryRun is true if the response describes a publish that was not applied
+	DryRun bool `json:"-"`
+}
+
+// Op returns "created" or "updated" depending on whether the publish created a
+// new database or replaced the module of an existing one
+func (r *PublishResponse) Op() string {
+	return r.Success.Op
+}
+
+// PublishOptions controls PublishWithOptions
+type PublishOptions struct {
+	// Clear wipes all existing data of the database before publishing
+	Clear bool
+	// DryRun reports whether the publish would create or update the database,
+	// and whether data would be cleared, without uploading the module. Clearing
+	// a database owned by another identity than the client's is reported as
+	// denied. It does not check that the module is valid or that its schema
+	// can be migrated.
+	DryRun bool
 }
 
 // NamesResponse represents the response from getting database names
@@ -71,7 +163,7 @@ type SQLResult struct {
 
 // Publish publishes a new database with no name
 func (s *DatabaseService) Publish(wasmModule []byte) (*PublishResponse, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
@@ -94,16 +186,33 @@ func (s *DatabaseService) Publish(wasmModule []byte) (*PublishResponse, error) {
 	return &publishResp, nil
 }
 
-// PublishTo publishes to a database with the specified name or identity
+// PublishTo publishes to a database with the specified name or identity. If
+// clear is set, existing data is wiped; check the response's Cleared field to
+// see whether anything was actually cleared.
 func (s *DatabaseService) PublishTo(nameOrIdentity string, wasmModule []byte, clear bool) (*PublishResponse, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	return s.PublishWithOptions(nameOrIdentity, wasmModule, PublishOptions{Clear: clear})
+}
+
+// PublishWithOptions publishes to a database with the specified name or identity.
+// The response's Op reports whether the database was created or updated, and
+// Cleared whether existing data was wiped. If clearing was requested but denied,
+// the returned error wraps ErrClearDenied.
+func (s *DatabaseService) PublishWithOptions(nameOrIdentity string, wasmModule []byte, options PublishOptions) (*PublishResponse, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
+	if options.DryRun {
+		return s.dryRunPublish(nameOrIdentity, options)
+	}
+
 	baseURL := fmt.Sprintf("%s/v1/database/%s", s.client.baseURL, nameOrIdentity)
 
 	// Add clear parameter if needed
-	if clear {
+	if options.Clear {
 		parsedURL, err := url.Parse(baseURL)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing URL: %w", err)
@@ -121,18 +230,57 @@ func (s *DatabaseService) PublishTo(nameOrIdentity string, wasmModule []byte, cl
 
 	var publishResp PublishResponse
 	if err := s.client.handleJSONResponse(resp, &publishResp); err != nil {
+		var httpErr *HTTPError
+		if options.Clear && errors.As(err, &httpErr) && httpErr.IsUnauthorized() {
+			return nil, fmt.Errorf("%w: %s: %w", ErrClearDenied, nameOrIdentity, err)
+		}
 		return nil, err
 	}
 
 	if publishResp.PermissionDenied != nil {
+		if options.Clear {
+			return &publishResp, fmt.Errorf("%w: %s", ErrClearDenied, publishResp.PermissionDenied.Name)
+		}
 		return &publishResp, fmt.Errorf("permission denied: %s", publishResp.PermissionDenied.Name)
 	}
 
+	// A newly created database had no data to clear
+	publishResp.Cleared = options.Clear && publishResp.Success.Op == "updated"
+	return &publishResp, nil
+}
+
+// dryRunPublish reports what a publish would do based on whether the database exists
+func (s *DatabaseService) dryRunPublish(nameOrIdentity string, options PublishOptions) (*PublishResponse, error) {
+	publishResp := PublishResponse{DryRun: true}
+	publishResp.Success.Op = "created"
+
+	info, err := s.GetInfo(nameOrIdentity)
+	if err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return &publishResp, nil
+		}
+		return nil, fmt.Errorf("error checking database %s: %w", nameOrIdentity, err)
+	}
+
+	publishResp.Success.Op = "updated"
+	publishResp.Success.DatabaseIdentity = info.DatabaseIdentity.Identity
+	publishResp.Cleared = options.Clear
+
+	// Only the owner may clear a database
+	owner := Identity{Identity: info.OwnerIdentity.Identity}
+	if identity := s.client.GetIdentity(); options.Clear && identity != "" && !owner.Equal(Identity{Identity: identity}) {
+		return nil, fmt.Errorf("%w: %s is owned by %s", ErrClearDenied, nameOrIdentity, owner.Hex())
+	}
 	return &publishResp, nil
 }
 
 // GetInfo retrieves information about a database
 func (s *DatabaseService) GetInfo(nameOrIdentity string) (*DatabaseInfo, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+
 	url := fmt.Sprintf("%s/v1/database/%s", s.client.baseURL, nameOrIdentity)
 
 	resp, err := s.client.doAuthenticatedRequest(http.MethodGet, url, nil)
@@ -150,7 +298,10 @@ func (s *DatabaseService) GetInfo(nameOrIdentity string) (*DatabaseInfo, error)
 
 // Delete deletes a database
 func (s *DatabaseService) Delete(nameOrIdentity string) error {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return err
+	}
+	if err := s.client.RequireAuth(); err != nil {
 		return err
 	}
 
@@ -166,6 +317,10 @@ func (s *DatabaseService) Delete(nameOrIdentity string) error {
 
 // GetNames gets the names this database can be identified by
 func (s *DatabaseService) GetNames(nameOrIdentity string) ([]string, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+
 	url := fmt.Sprintf("%s/v1/database/%s/names", s.client.baseURL, nameOrIdentity)
 
 	resp, err := s.client.doAuthenticatedRequest(http.MethodGet, url, nil)
@@ -183,7 +338,10 @@ func (s *DatabaseService) GetNames(nameOrIdentity string) ([]string, error) {
 
 // AddName adds a new name for this database
 func (s *DatabaseService) AddName(nameOrIdentity, newName string) (*SetNameResponse, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
@@ -206,29 +364,113 @@ func (s *DatabaseService) AddName(nameOrIdentity, newName string) (*SetNameRespo
 	return &setNameResp, nil
 }
 
-// SetNames sets the list of names for this database
-func (s *DatabaseService) SetNames(nameOrIdentity string, names []string) error {
-	if err := s.client.requiresAuth(); err != nil {
-		return err
+// SetNameResult reports the outcome of setting one name with SetNames
+type SetNameResult struct {
+	Name       string
+	Registered bool
+	Error      string // why the name was not registered, empty if it was
+}
+
+// setNamesResponse is the server's result of a SetNames request. Success is
+// sent as a bare string, the failure variants as single-key objects.
+type setNamesResponse struct {
+	PermissionDenied *struct {
+		Domain string `json:"domain"`
+	} `json:"PermissionDenied,omitempty"`
+	PermissionDeniedOnAny *struct {
+		Domains []string `json:"domains"`
+	} `json:"PermissionDeniedOnAny,omitempty"`
+	NotYourDatabase *struct {
+		Database string `json:"database"`
+	} `json:"NotYourDatabase,omitempty"`
+	DatabaseNotFound any     `json:"DatabaseNotFound,omitempty"`
+	OtherError       *string `json:"OtherError,omitempty"`
+}
+
+// SetNames sets the list of names for this database and reports the result
+// for each name. Names are set atomically: if any name is rejected, none are
+// registered, and the returned error describes why.
+func (s *DatabaseService) SetNames(nameOrIdentity string, names []string) ([]SetNameResult, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+	if err := s.client.RequireAuth(); err != nil {
+		return nil, err
 	}
 
 	url := fmt.Sprintf("%s/v1/database/%s/names", s.client.baseURL, nameOrIdentity)
 
 	resp, err := s.client.doJSONRequest(http.MethodPut, url, names)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 401 { // http.StatusUnauthorized
-		return fmt.Errorf("permission denied")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
-	return s.client.handleJSONResponse(resp, nil)
+	results := make([]SetNameResult, len(names))
+	for i, name := range names {
+		results[i] = SetNameResult{Name: name}
+	}
+
+	var success string
+	if resp.StatusCode == http.StatusOK && (len(bytes.TrimSpace(body)) == 0 || json.Unmarshal(body, &success) == nil) {
+		for i := range results {
+			results[i].Registered = true
+		}
+		return results, nil
+	}
+
+	var result setNamesResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return results, &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	denied := make(map[string]bool)
+	var reason string
+	switch {
+	case result.PermissionDenied != nil:
+		denied[result.PermissionDenied.Domain] = true
+		reason = fmt.Sprintf("permission denied: %s", result.PermissionDenied.Domain)
+	case result.PermissionDeniedOnAny != nil:
+		for _, domain := range result.PermissionDeniedOnAny.Domains {
+			denied[domain] = true
+		}
+		reason = fmt.Sprintf("permission denied: %s", strings.Join(result.PermissionDeniedOnAny.Domains, ", "))
+	case result.NotYourDatabase != nil:
+		reason = fmt.Sprintf("database %s is not owned by this identity", result.NotYourDatabase.Database)
+	case result.DatabaseNotFound != nil:
+		reason = fmt.Sprintf("database %s not found", nameOrIdentity)
+	case result.OtherError != nil:
+		reason = *result.OtherError
+	case resp.StatusCode == http.StatusOK:
+		for i := range results {
+			results[i].Registered = true
+		}
+		return results, nil
+	default:
+		return results, &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	for i := range results {
+		if denied[results[i].Name] {
+			results[i].Error = "permission denied"
+		} else {
+			results[i].Error = "not set: " + reason
+		}
+	}
+	return results, fmt.Errorf("failed to set names: %s", reason)
 }
 
 // GetIdentity gets the identity of a database
 func (s *DatabaseService) GetIdentity(nameOrIdentity string) (string, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return "", err
+	}
+
 	url := fmt.Sprintf("%s/v1/database/%s/identity", s.client.baseURL, nameOrIdentity)
 
 	resp, err := s.client.doAuthenticatedRequest(http.MethodGet, url, nil)
@@ -241,7 +483,17 @@ func (s *DatabaseService) GetIdentity(nameOrIdentity string) (string, error) {
 
 // CallReducer invokes a reducer in a database
 func (s *DatabaseService) CallReducer(nameOrIdentity, reducerName string, args []any) error {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return err
+	}
+	if err := validateReducerName(reducerName); err != nil {
+		return err
+	}
+	if err := s.client.RequireAuth(); err != nil {
+		return err
+	}
+
+	if err := validateReducerArgs(reducerName, args); err != nil {
 		return err
 	}
 
@@ -255,8 +507,119 @@ func (s *DatabaseService) CallReducer(nameOrIdentity, reducerName string, args [
 	return s.client.handleJSONResponse(resp, nil)
 }
 
-// GetSchema gets a schema for a database
+// CallReducerNamed invokes a reducer with arguments given as a map keyed by
+// parameter name or as a struct. It fetches the database schema to order the
+// arguments, see RawModuleDef.ReducerArgs, so calls keep working when
+// parameters are reordered. Arguments are sent in positional form with
+// EncodePositional, so struct-typed parameters nest as products. Callers
+// making many calls can fetch the schema once and use ReducerArgs with
+// CallReducer instead.
+func (s *DatabaseService) CallReducerNamed(nameOrIdentity, reducerName string, args any) error {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return err
+	}
+	if err := validateReducerName(reducerName); err != nil {
+		return err
+	}
+
+	schema, err := s.GetSchema(nameOrIdentity, nil)
+	if err != nil {
+		return fmt.Errorf("error getting schema for reducer %s: %w", reducerName, err)
+	}
+
+	ordered, err := schema.ReducerArgs(reducerName, args)
+	if err != nil {
+		return err
+	}
+	encoded := make([]any, len(ordered))
+	for i, arg := range ordered {
+		element, err := EncodePositional(arg)
+		if err != nil {
+			return fmt.Errorf("reducer %s: argument %d (%T) cannot be encoded: %w", reducerName, i, arg, err)
+		}
+		encoded[i] = element
+	}
+	return s.CallReducer(nameOrIdentity, reducerName, encoded)
+}
+
+// validateReducerArgs checks that every argument serializes to JSON, so a bad
+// argument is reported with the reducer name and its index
+func validateReducerArgs(reducerName string, args []any) error {
+	for i, arg := range args {
+		if _, err := json.Marshal(arg); err != nil {
+			return fmt.Errorf("reducer %s: argument %d (%T) cannot be serialized to JSON: %w", reducerName, i, arg, err)
+		}
+	}
+	return nil
+}
+
+// CallReducerBulk invokes a reducer once per entry of argsList using at most
+// concurrency parallel HTTP requests. The returned errors line up with argsList,
+// with nil entries for successful calls. Dispatching stops early when the client
+// is closed or after repeated authentication failures; calls that were never
+// sent report the reason as their error.
+func (s *DatabaseService) CallReducerBulk(nameOrIdentity, reducerName string, argsList [][]any, concurrency int) []error {
+	errs := make([]error, len(argsList))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancelCause(s.client.ctx)
+	defer cancel(nil)
+
+	var authFailures atomic.Int32
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range min(concurrency, len(argsList)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					errs[i] = context.Cause(ctx)
+					continue
+				}
+
+				err := s.CallReducer(nameOrIdentity, reducerName, argsList[i])
+				errs[i] = err
+
+				var httpErr *HTTPError
+				if errors.As(err, &httpErr) && httpErr.IsUnauthorized() {
+					if authFailures.Add(1) >= maxBulkAuthFailures {
+						cancel(errRepeatedAuthFailures)
+					}
+				} else if err == nil {
+					authFailures.Store(0)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range argsList {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for j := i; j < len(argsList); j++ {
+				errs[j] = context.Cause(ctx)
+			}
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// GetSchema gets a schema for a database. Parts of the schema this client
+// cannot decode are skipped and reported by SchemaParseWarnings.
 func (s *DatabaseService) GetSchema(nameOrIdentity string, _ *int) (RawModuleDef, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return RawModuleDef{}, err
+	}
+
 	baseURL := fmt.Sprintf("%s/v1/database/%s/schema", s.client.baseURL, nameOrIdentity)
 
 	parsedURL, err := url.Parse(baseURL)
@@ -282,7 +645,10 @@ func (s *DatabaseService) GetSchema(nameOrIdentity string, _ *int) (RawModuleDef
 
 // GetLogs retrieves logs from a database
 func (s *DatabaseService) GetLogs(nameOrIdentity string, numLines *int, follow bool) (string, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return "", err
+	}
+	if err := s.client.RequireAuth(); err != nil {
 		return "", err
 	}
 
@@ -310,18 +676,163 @@ func (s *DatabaseService) GetLogs(nameOrIdentity string, numLines *int, follow b
 	return s.client.handleTextResponse(resp)
 }
 
-// ExecuteSQL runs a SQL query against a database
+// LogRecord is a structured database log entry, one JSON object per log line
+type LogRecord struct {
+	Level      string    `json:"level"`
+	Timestamp  time.Time `json:"-"`
+	Target     string    `json:"target,omitempty"`
+	Filename   string    `json:"filename,omitempty"`
+	LineNumber uint32    `json:"line_number,omitempty"`
+	Message    string    `json:"message"`
+}
+
+// ParseLogRecord parses one line of database logs. The "ts" field is accepted
+// both as microseconds since the Unix epoch and as an RFC 3339 string.
+func ParseLogRecord(line string) (LogRecord, error) {
+	var raw struct {
+		LogRecord
+		TS json.RawMessage `json:"ts"`
+	}
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return LogRecord{}, fmt.Errorf("error parsing log record: %w", err)
+	}
+
+	record := raw.LogRecord
+	var micros int64
+	var text string
+	switch {
+	case json.Unmarshal(raw.TS, &micros) == nil:
+		record.Timestamp = time.UnixMicro(micros)
+	case json.Unmarshal(raw.TS, &text) == nil:
+		ts, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return LogRecord{}, fmt.Errorf("error parsing log timestamp: %w", err)
+		}
+		record.Timestamp = ts
+	default:
+		return LogRecord{}, fmt.Errorf("log record has no valid timestamp")
+	}
+	return record, nil
+}
+
+// GetLogsSince retrieves the log lines written at or after since.
+// The server's logs endpoint has no time filter, so the whole log buffer is
+// fetched and filtered client-side by each record's timestamp. Lines that are
+// not structured records are kept if the record before them was kept.
+func (s *DatabaseService) GetLogsSince(nameOrIdentity string, since time.Time) (string, error) {
+	logs, err := s.GetLogs(nameOrIdentity, nil, false)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	keep := false
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if record, err := ParseLogRecord(line); err == nil {
+			keep = !record.Timestamp.Before(since)
+		}
+		if keep {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String(), nil
+}
+
+// FollowLogs streams the database logs, like `spacetime logs -f`, calling
+// onLine with each line as it arrives. It blocks until the server ends the
+// stream, returning nil, or until ctx or the client is done, returning the
+// context error. The response body is closed on cancellation, so no
+// goroutine is left reading it. The client's HTTP timeout does not apply.
+func (s *DatabaseService) FollowLogs(ctx context.Context, nameOrIdentity string, onLine func(line string)) error {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return err
+	}
+	if err := s.client.RequireAuth(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.client.ctx, cancel)
+	defer stop()
+
+	url := fmt.Sprintf("%s/v1/database/%s/logs?follow=true", s.client.baseURL, nameOrIdentity)
+	req, err := s.client.newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := s.client.doWithAuthUsing(s.client.streamingHTTPClient(), req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	closeBody := context.AfterFunc(ctx, func() { resp.Body.Close() })
+	defer closeBody()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxLogLine)
+	for scanner.Scan() {
+		onLine(strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading logs: %w", err)
+	}
+	return nil
+}
+
+// maxLogLine bounds the size of a single followed log line
+const maxLogLine = 1 << 20
+
+// ExecuteSQL runs SQL queries against a database and returns one result per
+// statement. The queries are sent as one text/plain body separated by
+// semicolons, which the server splits with a SQL parser, so semicolons inside
+// string literals such as 'a;b' stay part of their statement. Trailing
+// semicolons and empty queries are dropped so they don't produce empty statements.
+//
+// The statements are not guaranteed to run as one transaction, so a statement
+// that fails doesn't roll back the ones before it. Transaction control
+// statements like BEGIN are rejected with ErrSQLTransactionUnsupported before
+// anything is sent; use a reducer for conditional writes.
 func (s *DatabaseService) ExecuteSQL(nameOrIdentity string, queries []string) ([]SQLResult, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	return s.executeSQL(s.client.ctx, nameOrIdentity, queries)
+}
+
+// executeSQL is ExecuteSQL with the request bound to ctx
+func (s *DatabaseService) executeSQL(ctx context.Context, nameOrIdentity string, queries []string) ([]SQLResult, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
 	url := fmt.Sprintf("%s/v1/database/%s/sql", s.client.baseURL, nameOrIdentity)
 
-	// Join queries with semicolon
-	sqlString := strings.Join(queries, ";")
+	sqlString := joinSQLStatements(queries)
+	if sqlString == "" {
+		return nil, fmt.Errorf("at least one query is required")
+	}
+	if err := checkTransactionStatements(queries); err != nil {
+		return nil, err
+	}
 
-	resp, err := s.client.doTextRequest(http.MethodPost, url, sqlString)
+	resp, err := s.client.doTextRequestContext(ctx, http.MethodPost, url, sqlString)
 	if err != nil {
 		return nil, err
 	}
@@ -333,3 +844,54 @@ func (s *DatabaseService) ExecuteSQL(nameOrIdentity string, queries []string) ([
 
 	return results, nil
 }
+
+// WaitForRow polls a SQL query until it returns at least one row or the timeout
+// expires. It returns true if a row was found and false on timeout.
+// This is a best-effort helper for observing the effects of a fire-and-forget
+// reducer call, which become visible to SQL queries eventually.
+func (s *DatabaseService) WaitForRow(nameOrIdentity, query string, timeout time.Duration) (bool, error) {
+	return s.WaitForRows(nameOrIdentity, query, timeout, func(rows []any) bool {
+		return len(rows) > 0
+	})
+}
+
+// WaitForRows polls a SQL query with exponential backoff until predicate returns
+// true for the returned rows or the timeout expires. It returns true if the
+// predicate matched and false on timeout. Query errors are returned immediately;
+// a query still running at the timeout is abandoned.
+func (s *DatabaseService) WaitForRows(nameOrIdentity, query string, timeout time.Duration, predicate func(rows []any) bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.client.ctx, timeout)
+	defer cancel()
+
+	interval := waitForRowsInitialInterval
+	for {
+		results, err := s.executeSQL(ctx, nameOrIdentity, []string{query})
+		if err != nil {
+			if s.client.ctx.Err() != nil {
+				return false, s.client.ctx.Err()
+			}
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, err
+		}
+
+		var rows []any
+		if len(results) > 0 {
+			rows = results[0].Rows
+		}
+		if predicate(rows) {
+			return true, nil
+		}
+
+		select {
+		case <-time.After(interval):
+			interval = min(interval*2, waitForRowsMaxInterval)
+		case <-ctx.Done():
+			if s.client.ctx.Err() != nil {
+				return false, s.client.ctx.Err()
+			}
+			return false, nil
+		}
+	}
+}
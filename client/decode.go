@@ -0,0 +1,439 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawJSONType  = reflect.TypeOf(json.RawMessage(nil))
+	numberType   = reflect.TypeOf(json.Number(""))
+)
+
+// DecodePositional decodes a positional JSON value, as SpacetimeDB sends table
+// rows over the JSON protocol, into dest, which must be a non-nil pointer.
+//
+// Array element i is decoded into exported struct field i in declaration order;
+// fields tagged `stdb:"-"` are skipped. Nested structs and slices are decoded
+// recursively. Pointer fields are treated as options encoded as [tag, value],
+// where tag 0 is some and tag 1 is none. Single-field special types such as
+// identities ([hex]) and timestamps ([micros]) are unwrapped into scalar fields,
+// and timestamps and durations decode into time.Time and time.Duration. Maps
+// decode from a JSON object, whose keys are parsed into the key type, or from
+// an array of [key, value] pairs.
+func DecodePositional(data []byte, dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+	return decodePositionalValue(data, rv.Elem(), "$")
+}
+
+// DecodeRow decodes a positional JSON row into its untyped column values without
+// a destination struct. Numbers are kept as json.Number rather than float64, so
+// u64 and i64 columns such as entity IDs and timestamps above 2^53 keep full
+// precision; convert them with Int64 or strconv.ParseUint.
+func DecodeRow(data []byte) ([]any, error) {
+	elements, err := splitArray(data, "$")
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]any, len(elements))
+	for i, element := range elements {
+		value, err := decodeAny(element)
+		if err != nil {
+			return nil, fmt.Errorf("$[%d]: %w", i, err)
+		}
+		row[i] = value
+	}
+	return row, nil
+}
+
+func decodePositionalValue(data []byte, v reflect.Value, path string) error {
+	data = bytes.TrimSpace(data)
+
+	switch v.Type() {
+	case timeType:
+		micros, err := decodeMicros(data, path)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.UnixMicro(micros)))
+		return nil
+	case durationType:
+		micros, err := decodeMicros(data, path)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(time.Duration(micros) * time.Microsecond))
+		return nil
+	case rawJSONType:
+		v.SetBytes(bytes.Clone(data))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		return decodeOption(data, v, path)
+	case reflect.Struct:
+		return decodeStruct(data, v, path)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && len(data) > 0 && data[0] == '"' {
+			return decodeHexBytes(data, v, path)
+		}
+		return decodeSlice(data, v, path)
+	case reflect.Array:
+		return decodeArray(data, v, path)
+	case reflect.Map:
+		return decodeMap(data, v, path)
+	case reflect.Interface:
+		value, err := decodeAny(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	default:
+		// Special types like Identity arrive as a single-element product
+		if len(data) > 0 && data[0] == '[' {
+			elements, err := splitArray(data, path)
+			if err != nil {
+				return err
+			}
+			if len(elements) != 1 {
+				return fmt.Errorf("%s: cannot decode %d-element array into %s", path, len(elements), v.Type())
+			}
+			return decodePositionalValue(elements[0], v, path+"[0]")
+		}
+		if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+// decodeOption decodes a [tag, value] option into a pointer
+func decodeOption(data []byte, v reflect.Value, path string) error {
+	if bytes.Equal(data, []byte("null")) {
+		v.SetZero()
+		return nil
+	}
+
+	elements, err := splitArray(data, path)
+	if err != nil {
+		return err
+	}
+	if len(elements) != 2 {
+		return fmt.Errorf("%s: option must be a [tag, value] pair, got %d elements", path, len(elements))
+	}
+
+	var tag int
+	if err := json.Unmarshal(elements[0], &tag); err != nil {
+		return fmt.Errorf("%s: invalid option tag: %w", path, err)
+	}
+
+	switch tag {
+	case 0:
+		value := reflect.New(v.Type().Elem())
+		if err := decodePositionalValue(elements[1], value.Elem(), path+"[1]"); err != nil {
+			return err
+		}
+		v.Set(value)
+		return nil
+	case 1:
+		v.SetZero()
+		return nil
+	default:
+		return fmt.Errorf("%s: invalid option tag %d", path, tag)
+	}
+}
+
+// decodeStruct decodes a positional array into the exported fields of a struct
+func decodeStruct(data []byte, v reflect.Value, path string) error {
+	elements, err := splitArray(data, path)
+	if err != nil {
+		return err
+	}
+
+	fields := positionalFields(v.Type())
+	if len(elements) != len(fields) {
+		return fmt.Errorf("%s: expected %d elements for %s, got %d", path, len(fields), v.Type(), len(elements))
+	}
+
+	for i, field := range fields {
+		fieldPath := fmt.Sprintf("%s.%s", path, field.Name)
+		if err := decodePositionalValue(elements[i], v.FieldByIndex(field.Index), fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeProjected decodes a row of a projected query, such as
+// "SELECT name, online FROM user", into dest. Element i of the row is decoded
+// into the struct field matching columns[i] rather than the field at position i,
+// so rows narrower than the table can be decoded into the full row type. Fields
+// match a column by their `stdb:"column"` tag or, without one, by name ignoring
+// case and underscores. Fields without a matching column are left untouched.
+func DecodeProjected(data []byte, columns []string, dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, got %T", dest)
+	}
+	if len(columns) == 0 {
+		return DecodePositional(data, dest)
+	}
+
+	elements, err := splitArray(bytes.TrimSpace(data), "$")
+	if err != nil {
+		return err
+	}
+	if len(elements) != len(columns) {
+		return fmt.Errorf("expected %d projected columns, got %d", len(columns), len(elements))
+	}
+
+	v := rv.Elem()
+	fields := positionalFields(v.Type())
+	for i, column := range columns {
+		field, ok := fieldForColumn(fields, column)
+		if !ok {
+			return fmt.Errorf("no field of %s matches column %q", v.Type(), column)
+		}
+		if err := decodePositionalValue(elements[i], v.FieldByIndex(field.Index), "$."+field.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// projectionPattern matches the column list and table of a SELECT query
+var projectionPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+`)
+
+// ProjectionColumns returns the columns selected by a subscription query, in
+// the order the server returns them. It returns nil for "SELECT *" and
+// "SELECT table.*", whose rows contain every column of the table.
+func ProjectionColumns(query string) []string {
+	match := projectionPattern.FindStringSubmatch(query)
+	if match == nil {
+		return nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(match[1], ",") {
+		column = strings.TrimSpace(column)
+		if column == "*" || strings.HasSuffix(column, ".*") {
+			return nil
+		}
+		// Drop table qualifiers and quoting
+		if i := strings.LastIndex(column, "."); i >= 0 {
+			column = column[i+1:]
+		}
+		columns = append(columns, strings.Trim(column, "\"`"))
+	}
+	return columns
+}
+
+// fieldForColumn finds the struct field for a column name
+func fieldForColumn(fields []reflect.StructField, column string) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Tag.Get("stdb") == column {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if field.Tag.Get("stdb") == "" && normalizeColumnName(field.Name) == normalizeColumnName(column) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// normalizeColumnName lowercases a name and removes underscores, so that
+// entity_id matches EntityID
+func normalizeColumnName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// positionalFields returns the exported fields of a struct type in declaration order
+func positionalFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("stdb") == "-" {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodeSlice(data []byte, v reflect.Value, path string) error {
+	if bytes.Equal(data, []byte("null")) {
+		v.SetZero()
+		return nil
+	}
+
+	elements, err := splitArray(data, path)
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(v.Type(), len(elements), len(elements))
+	for i, element := range elements {
+		if err := decodePositionalValue(element, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+func decodeArray(data []byte, v reflect.Value, path string) error {
+	elements, err := splitArray(data, path)
+	if err != nil {
+		return err
+	}
+	if len(elements) != v.Len() {
+		return fmt.Errorf("%s: expected %d elements for %s, got %d", path, v.Len(), v.Type(), len(elements))
+	}
+
+	for i, element := range elements {
+		if err := decodePositionalValue(element, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMap decodes a SATS map into a Go map. Maps with keys that fit a JSON
+// object key arrive as an object, with numbers and bools as their text;
+// other maps arrive as an array of [key, value] pairs.
+func decodeMap(data []byte, v reflect.Value, path string) error {
+	if bytes.Equal(data, []byte("null")) {
+		v.SetZero()
+		return nil
+	}
+
+	keyType, valueType := v.Type().Key(), v.Type().Elem()
+	result := reflect.MakeMap(v.Type())
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for text, raw := range entries {
+			entryPath := fmt.Sprintf("%s[%q]", path, text)
+			key := reflect.New(keyType).Elem()
+			if keyType.Kind() == reflect.String {
+				key.SetString(text)
+			} else if err := decodePositionalValue([]byte(text), key, entryPath); err != nil {
+				return err
+			}
+			value := reflect.New(valueType).Elem()
+			if err := decodePositionalValue(raw, value, entryPath); err != nil {
+				return err
+			}
+			result.SetMapIndex(key, value)
+		}
+	default:
+		pairs, err := splitArray(data, path)
+		if err != nil {
+			return err
+		}
+		for i, pair := range pairs {
+			entryPath := fmt.Sprintf("%s[%d]", path, i)
+			elements, err := splitArray(pair, entryPath)
+			if err != nil {
+				return err
+			}
+			if len(elements) != 2 {
+				return fmt.Errorf("%s: map entry must be a [key, value] pair, got %d elements", entryPath, len(elements))
+			}
+			key := reflect.New(keyType).Elem()
+			if err := decodePositionalValue(elements[0], key, entryPath+"[0]"); err != nil {
+				return err
+			}
+			value := reflect.New(valueType).Elem()
+			if err := decodePositionalValue(elements[1], value, entryPath+"[1]"); err != nil {
+				return err
+			}
+			result.SetMapIndex(key, value)
+		}
+	}
+	v.Set(result)
+	return nil
+}
+
+// decodeHexBytes decodes a hex string, the JSON encoding of byte arrays, into a []byte
+func decodeHexBytes(data []byte, v reflect.Value, path string) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return fmt.Errorf("%s: invalid hex bytes: %w", path, err)
+	}
+	v.SetBytes(decoded)
+	return nil
+}
+
+// decodeMicros decodes a microsecond count, either bare or wrapped as [micros]
+func decodeMicros(data []byte, path string) (int64, error) {
+	if len(data) > 0 && data[0] == '[' {
+		elements, err := splitArray(data, path)
+		if err != nil {
+			return 0, err
+		}
+		if len(elements) != 1 {
+			return 0, fmt.Errorf("%s: expected [micros], got %d elements", path, len(elements))
+		}
+		data = elements[0]
+	}
+
+	var micros int64
+	if err := json.Unmarshal(data, &micros); err != nil {
+		return 0, fmt.Errorf("%s: invalid microsecond value: %w", path, err)
+	}
+	return micros, nil
+}
+
+// decodeAny decodes a JSON value into an untyped Go value, keeping numbers as json.Number
+func decodeAny(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// splitArray splits a JSON array into its raw elements
+func splitArray(data []byte, path string) ([]json.RawMessage, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, fmt.Errorf("%s: expected a positional array: %w", path, err)
+	}
+	return elements, nil
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned when encoding a string that is not valid UTF-8
+var ErrInvalidUTF8 = errors.New("string is not valid UTF-8")
+
+// EncodePositional encodes a Go value into SpacetimeDB's positional JSON format,
+// the inverse of DecodePositional. Structs become arrays of their exported
+// fields in declaration order, pointers become [0, value] or [1, []] options,
+// time.Time and time.Duration become [micros], and byte slices become hex strings.
+// Maps with string, integer or bool keys become JSON objects with the keys as
+// text, sorted; other maps become arrays of [key, value] pairs.
+// Strings must be valid UTF-8, or ErrInvalidUTF8 is returned; control
+// characters such as newlines and NUL are escaped.
+func EncodePositional(value any) (json.RawMessage, error) {
+	return positionalEncoder{}.encodeValue(value)
+}
+
+// positionalEncoder holds the options of a positional encoding
+type positionalEncoder struct {
+	replaceInvalidUTF8 bool // replace invalid bytes with U+FFFD instead of failing
+}
+
+func (e positionalEncoder) encodeValue(value any) (json.RawMessage, error) {
+	if value == nil {
+		return json.RawMessage("null"), nil
+	}
+	return e.encode(reflect.ValueOf(value), "$")
+}
+
+func (e positionalEncoder) encode(v reflect.Value, path string) (json.RawMessage, error) {
+	switch v.Type() {
+	case timeType:
+		return json.Marshal([]int64{v.Interface().(time.Time).UnixMicro()})
+	case durationType:
+		return json.Marshal([]int64{time.Duration(v.Int()).Microseconds()})
+	case rawJSONType:
+		if v.IsNil() {
+			return json.RawMessage("null"), nil
+		}
+		return v.Interface().(json.RawMessage), nil
+	case numberType:
+		// json.Number is a string holding a number, such as a 128-bit ConnectionID
+		return json.Marshal(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return json.RawMessage(`[1,[]]`), nil
+		}
+		inner, err := e.encode(v.Elem(), path)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal([]json.RawMessage{json.RawMessage("0"), inner})
+	case reflect.Interface:
+		if v.IsNil() {
+			return json.RawMessage("null"), nil
+		}
+		return e.encode(v.Elem(), path)
+	case reflect.Struct:
+		fields := positionalFields(v.Type())
+		elements := make([]json.RawMessage, len(fields))
+		for i, field := range fields {
+			element, err := e.encode(v.FieldByIndex(field.Index), path+"."+field.Name)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return json.Marshal(elements)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bytes), v)
+			return json.Marshal(hex.EncodeToString(bytes))
+		}
+		elements := make([]json.RawMessage, v.Len())
+		for i := range v.Len() {
+			element, err := e.encode(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return json.Marshal(elements)
+	case reflect.Map:
+		return e.encodeMap(v, path)
+	case reflect.String:
+		text := v.String()
+		if !utf8.ValidString(text) {
+			if !e.replaceInvalidUTF8 {
+				return nil, fmt.Errorf("%s: %w", path, ErrInvalidUTF8)
+			}
+			text = strings.ToValidUTF8(text, string(utf8.RuneError))
+		}
+		return json.Marshal(text)
+	default:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return data, nil
+	}
+}
+
+// encodeMap encodes a map as an object when its keys can be object keys, and as
+// [key, value] pairs otherwise
+func (e positionalEncoder) encodeMap(v reflect.Value, path string) (json.RawMessage, error) {
+	type entry struct {
+		key   json.RawMessage
+		text  string
+		value json.RawMessage
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := e.encode(iter.Key(), path+"[key]")
+		if err != nil {
+			return nil, err
+		}
+		value, err := e.encode(iter.Value(), fmt.Sprintf("%s[%s]", path, key))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key: key, value: value})
+	}
+
+	switch v.Type().Key().Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// Object keys are text: strings unquoted, numbers and bools as written
+		for i := range entries {
+			if json.Unmarshal(entries[i].key, &entries[i].text) != nil {
+				entries[i].text = string(entries[i].key)
+			}
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.text, b.text) })
+
+		object := make([]byte, 0, 2+len(entries)*16)
+		object = append(object, '{')
+		for i, entry := range entries {
+			if i > 0 {
+				object = append(object, ',')
+			}
+			text, err := json.Marshal(entry.text)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			object = append(object, text...)
+			object = append(object, ':')
+			object = append(object, entry.value...)
+		}
+		return append(object, '}'), nil
+	default:
+		slices.SortFunc(entries, func(a, b entry) int { return bytes.Compare(a.key, b.key) })
+		pairs := make([][2]json.RawMessage, len(entries))
+		for i, entry := range entries {
+			pairs[i] = [2]json.RawMessage{entry.key, entry.value}
+		}
+		return json.Marshal(pairs)
+	}
+}
+
+// MarshalReducerArgs encodes reducer arguments as the positional JSON array the
+// server expects, encoding each argument with EncodePositional. Struct
+// arguments nest as products, so a single Vector2{X: 1, Y: 2} argument
+// becomes [[1,2]].
+func MarshalReducerArgs(args []any) (string, error) {
+	return positionalEncoder{}.marshalReducerArgs(args)
+}
+
+func (e positionalEncoder) marshalReducerArgs(args []any) (string, error) {
+	elements := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		element, err := e.encodeValue(arg)
+		if err != nil {
+			return "", fmt.Errorf("argument %d (%T) cannot be encoded: %w", i, arg, err)
+		}
+		elements[i] = element
+	}
+
+	encoded, err := json.Marshal(elements)
+	if err != nil {
+		return "", fmt.Errorf("error encoding reducer arguments: %w", err)
+	}
+	return string(encoded), nil
+}
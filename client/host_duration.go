@@ -0,0 +1,70 @@
+package client
+
+import "time"
+
+// HostTimed is implemented by server messages that report how long the host
+// spent executing the request. Messages carry this either as a TimeDuration or
+// as a raw micros field; HostExecutionDuration hides the difference.
+type HostTimed interface {
+	HostExecutionDuration() time.Duration
+}
+
+// AsDuration converts the duration to a time.Duration
+func (d TimeDuration) AsDuration() time.Duration {
+	return microsDuration(d.Duration)
+}
+
+// microsDuration converts a micros field to a time.Duration
+func microsDuration(micros uint64) time.Duration {
+	return time.Duration(micros) * time.Microsecond
+}
+
+// HostExecutionDuration returns the host execution time of the subscription
+func (m *InitialSubscription) HostExecutionDuration() time.Duration {
+	return m.TotalHostExecutionDuration.AsDuration()
+}
+
+// HostExecutionDuration returns the host execution time of the transaction
+func (m *TransactionUpdate) HostExecutionDuration() time.Duration {
+	return m.TotalHostExecutionDuration.AsDuration()
+}
+
+// HostExecutionDuration returns the host execution time of the query
+func (m *OneOffQueryResponse) HostExecutionDuration() time.Duration {
+	return m.TotalHostExecutionDuration.AsDuration()
+}
+
+// HostExecutionDuration returns the host execution time of the subscription
+func (m *SubscribeApplied) HostExecutionDuration() time.Duration {
+	return microsDuration(m.TotalHostExecutionDurationMicros)
+}
+
+// HostExecutionDuration returns the host execution time of the unsubscription
+func (m *UnsubscribeApplied) HostExecutionDuration() time.Duration {
+	return microsDuration(m.TotalHostExecutionDurationMicros)
+}
+
+// HostExecutionDuration returns the host execution time spent before the error
+func (m *SubscriptionError) HostExecutionDuration() time.Duration {
+	return microsDuration(m.TotalHostExecutionDurationMicros)
+}
+
+// HostExecutionDuration returns the host execution time of the subscription
+func (m *SubscribeMultiApplied) HostExecutionDuration() time.Duration {
+	return microsDuration(m.TotalHostExecutionDurationMicros)
+}
+
+// HostExecutionDuration returns the host execution time of the unsubscription
+func (m *UnsubscribeMultiApplied) HostExecutionDuration() time.Duration {
+	return microsDuration(m.TotalHostExecutionDurationMicros)
+}
+
+// HostExecutionDuration returns the host execution time reported by the message,
+// and false for message types that don't report one
+func (sm *ServerMessage) HostExecutionDuration() (time.Duration, bool) {
+	timed, ok := sm.Payload.(HostTimed)
+	if !ok {
+		return 0, false
+	}
+	return timed.HostExecutionDuration(), true
+}
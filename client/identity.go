@@ -1,11 +1,21 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/mail"
 	"net/url"
+	"strings"
 )
 
+// ErrInvalidEmail is returned when an email address fails client-side validation
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// maxEmailLength is the maximum length of an email address per RFC 5321
+const maxEmailLength = 254
+
 // IdentityService handles all identity-related operations
 type IdentityService struct {
 	client *Client
@@ -49,9 +59,40 @@ func (s *IdentityService) Create() (*IdentityResponse, error) {
 	return &identityResp, nil
 }
 
+// CreateWithEmail creates a new identity, configures the client with its token
+// and identity, then associates the given email with it.
+// If associating the email fails, the client's previous token and identity are
+// restored and the created identity is returned together with the error, since
+// identities cannot be deleted once created.
+func (s *IdentityService) CreateWithEmail(email string) (*IdentityResponse, error) {
+	// Validate before creating so a bad email doesn't leave an orphaned identity
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	identityResp, err := s.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	previousToken := s.client.GetToken()
+	previousIdentity := s.client.GetIdentity()
+
+	s.client.SetToken(identityResp.Token)
+	s.client.SetIdentity(identityResp.Identity)
+
+	if err := s.SetEmail(identityResp.Identity, email); err != nil {
+		s.client.SetToken(previousToken)
+		s.client.SetIdentity(previousIdentity)
+		return identityResp, fmt.Errorf("created identity %s but failed to set email: %w", identityResp.Identity, err)
+	}
+
+	return identityResp, nil
+}
+
 // CreateWebSocketToken generates a short-lived access token for use in untrusted contexts
 func (s *IdentityService) CreateWebSocketToken() (*WebSocketTokenResponse, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
@@ -82,9 +123,15 @@ func (s *IdentityService) GetPublicKey() (string, error) {
 	return s.client.handleTextResponse(resp)
 }
 
-// SetEmail associates an email with a Spacetime identity
+// SetEmail associates an email with a Spacetime identity.
+// The email is validated client-side first and ErrInvalidEmail is returned for
+// obviously malformed input.
 func (s *IdentityService) SetEmail(identity, email string) error {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := s.client.RequireAuth(); err != nil {
+		return err
+	}
+
+	if err := validateEmail(email); err != nil {
 		return err
 	}
 
@@ -104,13 +151,52 @@ func (s *IdentityService) SetEmail(identity, email string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	message := strings.TrimSpace(string(body))
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil // Email associated with the identity
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: server rejected %q: %s", ErrInvalidEmail, email, message)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("token is invalid or no authorization header provided")
+	case http.StatusForbidden:
+		return fmt.Errorf("token does not match identity %s", identity)
+	case http.StatusConflict:
+		return fmt.Errorf("email %q is already associated with another identity", email)
+	default:
+		return &HTTPError{StatusCode: resp.StatusCode, Body: message}
+	}
+}
+
+// validateEmail performs RFC 5322 style validation of a bare email address
+func validateEmail(email string) error {
+	if email == "" {
+		return fmt.Errorf("%w: email is empty", ErrInvalidEmail)
+	}
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("%w: email exceeds %d characters", ErrInvalidEmail, maxEmailLength)
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidEmail, email, err)
+	}
+
+	// Reject display names ("Name <a@b.com>") and surrounding whitespace
+	if addr.Name != "" || addr.Address != email {
+		return fmt.Errorf("%w: %q must be a bare address", ErrInvalidEmail, email)
+	}
 
-	return s.client.handleJSONResponse(resp, nil)
+	return nil
 }
 
 // Verify verifies an identity and token pair
 func (s *IdentityService) Verify(identity string) error {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := s.client.RequireAuth(); err != nil {
 		return err
 	}
 
@@ -137,7 +223,7 @@ func (s *IdentityService) Verify(identity string) error {
 
 // GetDatabases returns a list of databases owned by an identity
 func (s *IdentityService) GetDatabases(identity string) ([]string, error) {
-	if err := s.client.requiresAuth(); err != nil {
+	if err := s.client.RequireAuth(); err != nil {
 		return nil, err
 	}
 
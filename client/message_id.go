@@ -0,0 +1,23 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+)
+
+// messageIDSize is the length of the IDs generated by NewMessageID
+const messageIDSize = 16
+
+// NewMessageID returns a random 16 byte ID for correlating a OneOffQuery with
+// its OneOffQueryResponse
+func NewMessageID() []byte {
+	id := make([]byte, messageIDSize)
+	rand.Read(id) // never returns an error
+	return id
+}
+
+// MessageIDEqual reports whether two message IDs are the same. A nil ID and an
+// empty one are equal, as both encode to an empty message_id.
+func MessageIDEqual(a, b []byte) bool {
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// String returns the tag of the message type, as it appears on the wire
+func (t ServerMessageType) String() string {
+	for tag, msgType := range serverMessageTypes {
+		if msgType == t {
+			return tag
+		}
+	}
+	return "ServerMessageType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// String summarizes the message on one line for logging, for example
+// InitialSubscription(request_id=1, 3 tables, 120 rows) or
+// TransactionUpdate(reducer=SendMessage, status=committed, 1 tables, 2 rows).
+// Row counts include inserts and deletes. Tokens are never included.
+func (sm *ServerMessage) String() string {
+	if sm == nil {
+		return "<nil>"
+	}
+
+	var summary string
+	switch payload := sm.Payload.(type) {
+	case *InitialSubscription:
+		summary = fmt.Sprintf("request_id=%d, %s", payload.RequestID, updateSummary(payload.DatabaseUpdate))
+	case *TransactionUpdate:
+		summary = fmt.Sprintf("reducer=%s, status=%s", payload.ReducerCall.ReducerName, statusSummary(payload.Status))
+		if payload.Status.Committed != nil {
+			summary += ", " + updateSummary(*payload.Status.Committed)
+		}
+	case *TransactionUpdateLight:
+		summary = fmt.Sprintf("request_id=%d, %s", payload.RequestID, updateSummary(payload.Update))
+	case *IdentityToken:
+		summary = "identity=" + payload.Identity.Hex()
+	case *OneOffQueryResponse:
+		if payload.Error != nil {
+			summary = fmt.Sprintf("error=%q", *payload.Error)
+		} else {
+			summary = fmt.Sprintf("%d tables", len(payload.Tables))
+		}
+	case *SubscribeApplied:
+		summary = fmt.Sprintf("query_id=%d, %s", payload.QueryID.ID, updateSummary(payload.Rows.DatabaseUpdate()))
+	case *UnsubscribeApplied:
+		summary = fmt.Sprintf("query_id=%d, %s", payload.QueryID.ID, updateSummary(payload.Rows.DatabaseUpdate()))
+	case *SubscriptionError:
+		if payload.QueryID != nil {
+			summary = fmt.Sprintf("query_id=%d, ", *payload.QueryID)
+		}
+		summary += strconv.Quote(payload.Error)
+	case *SubscribeMultiApplied:
+		summary = fmt.Sprintf("query_id=%d, %s", payload.QueryID.ID, updateSummary(payload.Update))
+	case *UnsubscribeMultiApplied:
+		summary = fmt.Sprintf("query_id=%d, %s", payload.QueryID.ID, updateSummary(payload.Update))
+	default:
+		summary = fmt.Sprintf("%T", sm.Payload)
+	}
+	return sm.Type.String() + "(" + summary + ")"
+}
+
+// updateSummary counts the tables and rows of an update
+func updateSummary(update DatabaseUpdate) string {
+	rows := 0
+	for _, table := range update.Tables {
+		for _, entry := range table.Updates {
+			rows += len(entry.Inserts) + len(entry.Deletes)
+		}
+	}
+	return fmt.Sprintf("%d tables, %d rows", len(update.Tables), rows)
+}
+
+// statusSummary names the variant of a transaction status
+func statusSummary(status UpdateStatus) string {
+	switch {
+	case status.Committed != nil:
+		return "committed"
+	case status.Failed != nil:
+		return "failed " + strconv.Quote(*status.Failed)
+	case status.OutOfEnergy != nil:
+		return "out of energy"
+	}
+	return "unknown"
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrPoolClosed is returned by ConnectionPool.Get after CloseAll
+var ErrPoolClosed = errors.New("connection pool closed")
+
+// PoolMessage is a server message received by one connection of a pool. Err is
+// set instead of Message when the connection failed for good; the connection is
+// then dropped from the pool and the next Get connects again.
+type PoolMessage struct {
+	Database string
+	Message  *ServerMessage
+	Err      error
+}
+
+// ConnectionPool holds one WebSocket connection per database, connected on
+// first use with the same protocol and options, such as a shared
+// WithReconnectHandler policy. The pool reads every connection and multiplexes
+// their messages onto Messages, so the connections must not be read directly.
+// It is safe for concurrent use.
+type ConnectionPool struct {
+	service  *DatabaseService
+	protocol string
+	options  []WebSocketOption
+
+	mu       sync.Mutex
+	conns    map[string]*pooledConnection
+	closed   bool
+	readers  sync.WaitGroup
+	messages chan PoolMessage
+	done     chan struct{}
+}
+
+// pooledConnection is a pool entry; ready is closed once the connect attempt ended
+type pooledConnection struct {
+	conn  *WebSocketConnection
+	err   error
+	ready chan struct{}
+}
+
+// NewConnectionPool creates an empty pool of connections to databases on this
+// server, opened with the given protocol and options
+func (s *DatabaseService) NewConnectionPool(protocol string, options ...WebSocketOption) *ConnectionPool {
+	return &ConnectionPool{
+		service:  s,
+		protocol: protocol,
+		options:  options,
+		conns:    make(map[string]*pooledConnection),
+		messages: make(chan PoolMessage),
+		done:     make(chan struct{}),
+	}
+}
+
+// Get returns the connection to a database, connecting it first if the pool
+// has none. Concurrent calls for the same database share one connect attempt;
+// a failed attempt is not kept, so a later Get tries again.
+func (p *ConnectionPool) Get(nameOrIdentity string) (*WebSocketConnection, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if entry, ok := p.conns[nameOrIdentity]; ok {
+		p.mu.Unlock()
+		<-entry.ready
+		return entry.conn, entry.err
+	}
+	entry := &pooledConnection{ready: make(chan struct{})}
+	p.conns[nameOrIdentity] = entry
+	p.mu.Unlock()
+
+	conn, err := p.service.ConnectWebSocket(nameOrIdentity, p.protocol, p.options...)
+
+	p.mu.Lock()
+	switch {
+	case err != nil:
+		delete(p.conns, nameOrIdentity)
+		entry.err = err
+	case p.closed:
+		// CloseAll ran while connecting
+		delete(p.conns, nameOrIdentity)
+		conn.Close()
+		entry.err = ErrPoolClosed
+	default:
+		entry.conn = conn
+		p.readers.Add(1)
+		go p.read(nameOrIdentity, entry)
+	}
+	p.mu.Unlock()
+	close(entry.ready)
+	return entry.conn, entry.err
+}
+
+// Databases returns the sorted names of the databases with an open connection
+func (p *ConnectionPool) Databases() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.conns))
+	for name, entry := range p.conns {
+		if entry.conn != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Messages returns the stream of messages from all connections, tagged with
+// their database. It must be drained, since a connection is not read further
+// until its message is taken. The channel is closed by CloseAll.
+func (p *ConnectionPool) Messages() <-chan PoolMessage {
+	return p.messages
+}
+
+// read forwards the messages of one connection until it fails or the pool closes
+func (p *ConnectionPool) read(nameOrIdentity string, entry *pooledConnection) {
+	defer p.readers.Done()
+	for {
+		message, err := entry.conn.ReceiveServerMessage()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			if p.conns[nameOrIdentity] == entry {
+				delete(p.conns, nameOrIdentity)
+			}
+			p.mu.Unlock()
+			entry.conn.Close()
+			if !closed {
+				p.send(PoolMessage{Database: nameOrIdentity, Err: err})
+			}
+			return
+		}
+		if !p.send(PoolMessage{Database: nameOrIdentity, Message: message}) {
+			return
+		}
+	}
+}
+
+// send delivers a message unless the pool is closing
+func (p *ConnectionPool) send(message PoolMessage) bool {
+	select {
+	case p.messages <- message:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// CloseAll closes every connection, waits for their readers to stop and closes
+// the Messages channel. Get fails with ErrPoolClosed afterwards.
+func (p *ConnectionPool) CloseAll() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	var conns []*WebSocketConnection
+	for _, entry := range p.conns {
+		if entry.conn != nil {
+			conns = append(conns, entry.conn)
+		}
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.readers.Wait()
+	close(p.messages)
+	return errors.Join(errs...)
+}
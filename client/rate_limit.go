@@ -0,0 +1,110 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a reducer call exceeds the rate set with
+// WithReducerRateLimit
+var ErrRateLimited = errors.New("reducer call rate limit exceeded")
+
+// WithReducerRateLimit limits reducer calls sent over the connection to
+// perSecond on average, allowing bursts of up to burst calls. Calls over the
+// limit fail with ErrRateLimited, or wait for their turn with
+// WithRateLimitWait. Other messages such as subscriptions are not limited.
+func WithReducerRateLimit(perSecond int, burst int) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.reducerRate = perSecond
+		c.reducerBurst = max(burst, 1)
+	}
+}
+
+// WithRateLimitWait makes reducer calls over the WithReducerRateLimit limit
+// block until they may be sent, instead of failing with ErrRateLimited. A
+// blocked call returns early with an error if the connection or client is closed.
+func WithRateLimitWait() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.rateLimitWait = true
+	}
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSecond, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(perSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accrued since the last call; the caller must hold b.mu
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow takes a token if one is available
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token, going into debt if none is available, and returns how
+// long the caller must wait before using it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// waitForReducerSlot applies the reducer rate limit before a call is sent
+func (ws *WebSocketConnection) waitForReducerSlot() error {
+	if ws.limiter == nil {
+		return nil
+	}
+	if !ws.config.rateLimitWait {
+		if !ws.limiter.allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	wait := ws.limiter.reserve()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ws.done:
+		return errors.New("WebSocket connection closed while waiting for the reducer rate limit")
+	case <-ws.client.ctx.Done():
+		return ws.client.ctx.Err()
+	}
+}
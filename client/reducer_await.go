@@ -0,0 +1,274 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrReducerFailed is returned when an awaited reducer call was rejected or
+// ran out of energy
+var ErrReducerFailed = errors.New("reducer failed")
+
+// ReducerCall is a reducer invocation for CallReducerBatchAwait
+type ReducerCall struct {
+	Reducer string
+	Args    []any
+}
+
+// ReducerLatency is the timing of an awaited reducer call, reported to the hook
+// of WithReducerLatencyHook
+type ReducerLatency struct {
+	Reducer   string
+	RequestID uint32
+	// RoundTrip is the time from sending the call to receiving the
+	// TransactionUpdate answering it, as measured by the client
+	RoundTrip time.Duration
+	// HostExecution is the TotalHostExecutionDuration the server reported
+	HostExecution time.Duration
+	Update        *TransactionUpdate
+}
+
+// WithReducerLatencyHook calls hook with the timing of every call made with
+// CallReducerAwait or CallReducerBatchAwait once its TransactionUpdate arrives,
+// for example to show the ping to the server or to diagnose laggy sessions. The
+// round trip minus the host execution time approximates the network and queueing
+// delay. The hook runs on the goroutine reading messages, so it should return
+// quickly. Calls that are not answered, such as those whose context ended, are
+// not reported.
+func WithReducerLatencyHook(hook func(ReducerLatency)) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.latencyHook = hook
+	}
+}
+
+// pendingCall is the waiter of an awaited reducer call
+type pendingCall struct {
+	reducer string
+	sent    time.Time
+	done    chan *TransactionUpdate
+}
+
+// CallReducerAwait calls a reducer with typed arguments and waits for the
+// TransactionUpdate answering it, matched by request ID and, as other clients
+// use the same request IDs, by caller connection or identity. The update is
+// delivered through ReceiveMessage or ReceiveServerMessage, so the application's
+// read loop must be running in another goroutine. If the reducer failed, the
+// update is returned together with an error wrapping ErrReducerFailed.
+func (ws *WebSocketConnection) CallReducerAwait(ctx context.Context, reducerName string, args []any) (*TransactionUpdate, error) {
+	requestID, waiter, err := ws.sendAwaited(ReducerCall{Reducer: reducerName, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	defer ws.forgetPendingCall(requestID)
+
+	select {
+	case update := <-waiter:
+		return update, reducerFailure(update)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for reducer %s: %w", reducerName, ctx.Err())
+	}
+}
+
+// CallReducerBatchAwait sends all calls, then waits for the TransactionUpdate
+// answering each one. Results are returned in call order. Failed reducers are
+// reported in the joined error while their updates are still returned; calls
+// that were not answered before ctx ended have a nil result.
+func (ws *WebSocketConnection) CallReducerBatchAwait(ctx context.Context, calls []ReducerCall) ([]*TransactionUpdate, error) {
+	results := make([]*TransactionUpdate, len(calls))
+	waiters := make([]chan *TransactionUpdate, 0, len(calls))
+
+	for i, call := range calls {
+		requestID, waiter, err := ws.sendAwaited(call)
+		if err != nil {
+			return results, fmt.Errorf("call %d (%s): %w", i, call.Reducer, err)
+		}
+		defer ws.forgetPendingCall(requestID)
+		waiters = append(waiters, waiter)
+	}
+
+	var errs []error
+	for i, waiter := range waiters {
+		select {
+		case update := <-waiter:
+			results[i] = update
+			if err := reducerFailure(update); err != nil {
+				errs = append(errs, fmt.Errorf("call %d (%s): %w", i, calls[i].Reducer, err))
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("waiting for call %d (%s): %w", i, calls[i].Reducer, ctx.Err()))
+			return results, errors.Join(errs...)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// namedCallWaiter waits for the next TransactionUpdate of a reducer called by
+// an identity, for CallAndWait
+type namedCallWaiter struct {
+	reducer  string
+	identity Identity // empty matches any caller
+	done     chan *TransactionUpdate
+}
+
+// CallAndWait calls a reducer with JSON-encoded arguments and waits for the next
+// TransactionUpdate of a call to that reducer made by the client's identity. It
+// returns nil if the transaction committed, and otherwise an error wrapping
+// ErrReducerFailed with the failure message. As with CallReducerAwait, the
+// application's read loop must be running in another goroutine.
+//
+// Matching by reducer name cannot tell two concurrent calls to the same reducer
+// apart, so either may resolve the wait for the other; use CallReducerAwait,
+// which correlates by request ID, when calls can overlap. If the client has no
+// identity, for example an anonymous connection without WithAutoSaveToken, a
+// call to the reducer by any caller matches.
+func (ws *WebSocketConnection) CallAndWait(ctx context.Context, reducerName string, args string) error {
+	waiter := &namedCallWaiter{
+		reducer: reducerName,
+		done:    make(chan *TransactionUpdate, 1),
+	}
+	if ws.client != nil {
+		waiter.identity = Identity{Identity: ws.client.GetIdentity()}
+	}
+
+	ws.pendingMu.Lock()
+	ws.namedCalls = append(ws.namedCalls, waiter)
+	ws.pendingMu.Unlock()
+
+	defer func() {
+		ws.pendingMu.Lock()
+		ws.namedCalls = slices.DeleteFunc(ws.namedCalls, func(w *namedCallWaiter) bool { return w == waiter })
+		ws.pendingMu.Unlock()
+	}()
+
+	if err := ws.SendCallReducerWithFlags(reducerName, args, ws.NextRequestID(), CallReducerFullUpdate); err != nil {
+		return err
+	}
+
+	select {
+	case update := <-waiter.done:
+		return reducerFailure(update)
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for reducer %s: %w", reducerName, ctx.Err())
+	}
+}
+
+// sendAwaited registers a waiter for a new request ID and sends the call
+func (ws *WebSocketConnection) sendAwaited(call ReducerCall) (uint32, chan *TransactionUpdate, error) {
+	requestID := ws.NextRequestID()
+	waiter := &pendingCall{reducer: call.Reducer, done: make(chan *TransactionUpdate, 1)}
+
+	encoded, err := ws.encodeReducerArgs(call.Reducer, call.Args)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ws.pendingMu.Lock()
+	if ws.pending == nil {
+		ws.pending = make(map[uint32]*pendingCall)
+	}
+	ws.pending[requestID] = waiter
+	// Set under the lock, as the answer may arrive before the send returns
+	waiter.sent = time.Now()
+	ws.pendingMu.Unlock()
+
+	err = ws.SendCallReducerWithFlags(call.Reducer, encoded, requestID, CallReducerFullUpdate)
+	if err != nil {
+		ws.forgetPendingCall(requestID)
+		return 0, nil, err
+	}
+	return requestID, waiter.done, nil
+}
+
+func (ws *WebSocketConnection) forgetPendingCall(requestID uint32) {
+	ws.pendingMu.Lock()
+	defer ws.pendingMu.Unlock()
+	delete(ws.pending, requestID)
+}
+
+func (ws *WebSocketConnection) hasPendingCalls() bool {
+	ws.pendingMu.Lock()
+	defer ws.pendingMu.Unlock()
+	return len(ws.pending) > 0 || len(ws.namedCalls) > 0
+}
+
+// resolvePendingCall hands a TransactionUpdate to the waiter of its request ID
+func (ws *WebSocketConnection) resolvePendingCall(msg *ServerMessage) {
+	update, ok := msg.AsTransactionUpdate()
+	if !ok {
+		return
+	}
+
+	received := time.Now()
+	ws.pendingMu.Lock()
+
+	// Each update resolves the oldest matching CallAndWait
+	for i, named := range ws.namedCalls {
+		if named.reducer == update.ReducerCall.ReducerName && (named.identity.Hex() == "" || update.IsCaller(named.identity)) {
+			ws.namedCalls = slices.Delete(ws.namedCalls, i, i+1)
+			named.done <- update
+			break
+		}
+	}
+
+	waiter, ok := ws.pending[update.ReducerCall.RequestID]
+	if ok && !ws.isOwnCall(update) {
+		// Another client's call that happens to use the same request ID
+		ok = false
+	}
+	if ok {
+		delete(ws.pending, update.ReducerCall.RequestID)
+	}
+	ws.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if ws.config.latencyHook != nil {
+		ws.config.latencyHook(ReducerLatency{
+			Reducer:       waiter.reducer,
+			RequestID:     update.ReducerCall.RequestID,
+			RoundTrip:     received.Sub(waiter.sent),
+			HostExecution: update.HostExecutionDuration(),
+			Update:        update,
+		})
+	}
+	waiter.done <- update
+}
+
+// isOwnCall reports whether a TransactionUpdate may answer a call made on this
+// connection. Request IDs are only unique per connection and other clients'
+// transactions reach every subscriber, so an update naming another caller
+// connection, or if either connection ID is unknown another caller identity,
+// is not ours. Updates without caller information are accepted.
+func (ws *WebSocketConnection) isOwnCall(update *TransactionUpdate) bool {
+	if own, ok := ws.ConnectionID(); ok && !update.CallerConnectionID.IsZero() {
+		return update.CallerConnectionID.Equal(own)
+	}
+	if ws.client == nil {
+		return true
+	}
+	own := Identity{Identity: ws.client.GetIdentity()}
+	caller := update.CallerIdentity
+	if caller.Hex() == "" {
+		caller = update.ReducerCall.CallerIdentity
+	}
+	if own.Hex() == "" || caller.Hex() == "" {
+		return true
+	}
+	return caller.Equal(own)
+}
+
+// reducerFailure returns an error if the transaction did not commit
+func reducerFailure(update *TransactionUpdate) error {
+	switch {
+	case update.Status.Failed != nil:
+		return fmt.Errorf("%w: %s", ErrReducerFailed, *update.Status.Failed)
+	case update.Status.OutOfEnergy != nil:
+		return fmt.Errorf("%w: out of energy", ErrReducerFailed)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MessageSource is a stream of parsed server messages. WebSocketConnection
+// implements it, and ReplayConnection replays a recorded session, so message
+// handlers written against MessageSource can be tested offline.
+type MessageSource interface {
+	ReceiveServerMessage() (*ServerMessage, error)
+}
+
+// recorder tees received frames to a writer as NDJSON
+type recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// RecordTo writes every frame received from now on to w, one JSON message per
+// line, for replay with NewReplayConnection. Frames are recorded whichever
+// receive method reads them, including messages MessagesOfType drops. Pass nil
+// to stop recording. Only the JSON protocol can be recorded: recording stops,
+// with a message to the connection's logger, after the first write error or
+// frame that is not JSON.
+func (ws *WebSocketConnection) RecordTo(w io.Writer) {
+	ws.recorder.mu.Lock()
+	defer ws.recorder.mu.Unlock()
+	ws.recorder.w = w
+}
+
+// record writes a received frame to the recorder, if one is set, and stops
+// recording with a message to logf if that fails
+func (r *recorder) record(data []byte, logf func(format string, args ...any)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+
+	// Frames are compacted so each message stays on a single line
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		logf("spacetimedb: stopped recording at a frame that is not JSON: %v", err)
+		r.w = nil
+		return
+	}
+	line.WriteByte('\n')
+	if _, err := r.w.Write(line.Bytes()); err != nil {
+		logf("spacetimedb: stopped recording: %v", err)
+		r.w = nil
+	}
+}
+
+// ReplayConnection replays server messages recorded with RecordTo
+type ReplayConnection struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// maxReplayLine bounds the size of a single recorded message
+const maxReplayLine = 64 << 20
+
+// NewReplayConnection creates a connection replaying the messages recorded in r
+func NewReplayConnection(r io.Reader) *ReplayConnection {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxReplayLine)
+	return &ReplayConnection{scanner: scanner}
+}
+
+// ReceiveServerMessage parses the next recorded message, skipping blank lines.
+// It returns io.EOF once the recording is exhausted.
+func (rc *ReplayConnection) ReceiveServerMessage() (*ServerMessage, error) {
+	for rc.scanner.Scan() {
+		rc.line++
+		data := bytes.TrimSpace(rc.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		message, err := ParseServerMessage(data)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", rc.line, err)
+		}
+		return message, nil
+	}
+	if err := rc.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading recording: %w", err)
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,340 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Desync describes a table whose cached rows don't match the server
+type Desync struct {
+	Table  string
+	Cached int // distinct rows in the cache
+	Server int // rows on the server, or -1 when found by Resync
+}
+
+// resync tracks the probe subscriptions of a Resync in progress
+type resync struct {
+	pending  int
+	snapshot []TableUpdate
+	err      error
+	done     chan struct{} // closed once every probe was applied or rejected
+	delta    []TableUpdate
+
+	// migrated holds the subscriptions moved to new query IDs by Resubscribe,
+	// which act as the probes and are detached once the resync completes
+	migrated []*queryState
+}
+
+// errResubscribed fails a Resync whose probes were dropped by Resubscribe
+var errResubscribed = errors.New("resync abandoned by Resubscribe")
+
+// OnDesyncDetected registers a callback invoked for every table found out of
+// sync, by Resync or by an integrity check
+func (m *SubscriptionManager) OnDesyncDetected(callback func(desync Desync)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.desyncListeners = append(m.desyncListeners, callback)
+}
+
+// Resync recovers a cache that drifted from the server, for example after
+// messages were lost around a reconnect. It subscribes the queries of every
+// active query set again in a single SubscribeMulti under a new query ID, so
+// the server takes their rows at one point in time, replaces the cache
+// contents with those rows through TableCache.Reconcile, and unsubscribes the
+// extra query ID. Listeners registered with OnUpdate receive the correcting
+// delta, which is also returned, and OnDesyncDetected is called for each table
+// it touches.
+//
+// Rows of queries subscribed directly on the connection are dropped from the
+// cache, and subscriptions made while Resync runs should be waited for before
+// calling it. Like Replace, it blocks until the server answers, so it must not
+// be called from the read loop goroutine.
+func (m *SubscriptionManager) Resync(ctx context.Context) ([]TableUpdate, error) {
+	m.mu.Lock()
+	sync := &resync{done: make(chan struct{})}
+	var active []*queryState
+	for _, state := range m.queries {
+		if state.refs > 0 && state.resync == nil && state.err == nil && isClosed(state.applied) {
+			active = append(active, state)
+		}
+	}
+	slices.SortFunc(active, func(a, b *queryState) int { return int(a.queryID) - int(b.queryID) })
+	if len(active) == 0 {
+		m.mu.Unlock()
+		return nil, nil
+	}
+
+	// Probing every query set separately would snapshot each at a different
+	// time, and a transaction committed in between would be reverted
+	var queries []string
+	for _, state := range active {
+		queries = append(queries, state.queries...)
+	}
+	probe := m.newQueryState(queries, true)
+	probe.refs = 0 // never shared
+	probe.resync = sync
+	sync.pending = 1
+	message := NewSubscribeMultiMessage(probe.queries, m.allocateRequestID(), QueryID{ID: probe.queryID})
+	m.mu.Unlock()
+
+	probes := []*queryState{probe}
+	if err := m.sender.SendMessage(message); err != nil {
+		m.abortResync(nil, probes)
+		return nil, fmt.Errorf("error resubscribing for resync: %w", err)
+	}
+
+	select {
+	case <-sync.done:
+	case <-ctx.Done():
+		m.abortResync(probes, nil)
+		return nil, ctx.Err()
+	case <-m.ctx.Done():
+		m.abortResync(probes, nil)
+		return nil, m.ctx.Err()
+	}
+
+	m.abortResync(probes, nil)
+	if sync.err != nil {
+		return nil, sync.err
+	}
+	return sync.delta, nil
+}
+
+// Resubscribe restores the manager's subscriptions on a new session, such as
+// after WithReconnectHandler reconnected, when the query IDs of the previous
+// session are no longer known to the server. Every subscription that was not
+// released is sent again under a newly allocated query ID, which its handles
+// use from then on, so a later Unsubscribe targets the new ID. Once all of them
+// were applied the cache is reconciled with their rows, together with the
+// transactions committed while waiting, as with Resync:
+// listeners registered with OnUpdate receive the delta and OnDesyncDetected is
+// called for each table it touches. Subscriptions the server now rejects fail,
+// and their rows are dropped from the cache.
+//
+// Resubscribe only sends the requests and does not wait for the server, so it
+// may be called from the read loop, for example when a new IdentityToken shows
+// the connection was re-established. Subscriptions that were being
+// unsubscribed are considered removed, and a Resync in progress fails.
+func (m *SubscriptionManager) Resubscribe() error {
+	m.mu.Lock()
+	sync := &resync{done: make(chan struct{})}
+	for queryID, state := range m.queries {
+		delete(m.queries, queryID)
+		switch {
+		case state.refs > 0 && state.err == nil:
+			sync.migrated = append(sync.migrated, state)
+		case state.resync != nil:
+			// A probe of a Resync in progress
+			state.cancelled = true
+			if !isClosed(state.resync.done) {
+				state.resync.err = errResubscribed
+				close(state.resync.done)
+			}
+		case !isClosed(state.removed):
+			// The old session's subscription ended with it
+			close(state.removed)
+		}
+	}
+	slices.SortFunc(sync.migrated, func(a, b *queryState) int { return int(a.queryID) - int(b.queryID) })
+
+	messages := make([]ClientMessage, len(sync.migrated))
+	for i, state := range sync.migrated {
+		m.nextQueryID++
+		state.queryID = m.nextQueryID
+		state.resync = sync
+		m.queries[state.queryID] = state
+
+		requestID := m.allocateRequestID()
+		if state.single {
+			messages[i] = NewSubscribeSingleMessage(state.queries[0], requestID, QueryID{ID: state.queryID})
+		} else {
+			messages[i] = NewSubscribeMultiMessage(state.queries, requestID, QueryID{ID: state.queryID})
+		}
+	}
+	sync.pending = len(sync.migrated)
+	m.resubscribing = nil
+	if sync.pending == 0 {
+		close(sync.done)
+	} else {
+		m.resubscribing = sync
+	}
+	m.mu.Unlock()
+
+	for _, message := range messages {
+		if err := m.sender.SendMessage(message); err != nil {
+			return fmt.Errorf("error resubscribing: %w", err)
+		}
+	}
+	return nil
+}
+
+// abortResync drops the probes of a resync: sent probes are unsubscribed and
+// their rows ignored, unsent ones are forgotten
+func (m *SubscriptionManager) abortResync(sent, unsent []*queryState) {
+	m.mu.Lock()
+	var unsubscribe []ClientMessage
+	for _, probe := range sent {
+		if probe.cancelled {
+			continue
+		}
+		probe.cancelled = true
+		if _, ok := m.queries[probe.queryID]; ok {
+			unsubscribe = append(unsubscribe, unsubscribeMessage(probe, m.allocateRequestID()))
+		}
+	}
+	for _, probe := range unsent {
+		delete(m.queries, probe.queryID)
+	}
+	m.mu.Unlock()
+
+	for _, message := range unsubscribe {
+		if err := m.sender.SendMessage(message); err != nil {
+			m.logf("spacetimedb: could not unsubscribe resync query: %v", err)
+			return
+		}
+	}
+}
+
+// applyProbe records the rows of a resync probe instead of caching them, and
+// reconciles the cache once the last probe arrived; the caller must hold m.mu,
+// which is released before notifying.
+func (m *SubscriptionManager) applyProbe(state *queryState, update DatabaseUpdate, subErr error) {
+	sync := state.resync
+	if subErr != nil && sync.err == nil {
+		sync.err = fmt.Errorf("resync: %w", subErr)
+	}
+	sync.snapshot = append(sync.snapshot, update.Tables...)
+	sync.pending--
+	if sync.pending > 0 {
+		m.mu.Unlock()
+		return
+	}
+	for _, migrated := range sync.migrated {
+		migrated.resync = nil
+	}
+	if m.resubscribing == sync {
+		m.resubscribing = nil
+	}
+
+	// A probe that failed leaves the cache as it was, but a migrated
+	// subscription that failed no longer exists on the server
+	if sync.err != nil && sync.migrated == nil {
+		m.mu.Unlock()
+		close(sync.done)
+		return
+	}
+	sync.delta = m.cache.Reconcile(sync.snapshot)
+	listeners := slices.Clone(m.listeners)
+	desyncListeners := slices.Clone(m.desyncListeners)
+	m.mu.Unlock()
+
+	notify(listeners, DatabaseUpdate{Tables: sync.delta})
+	for _, table := range sync.delta {
+		desync := Desync{Table: table.TableName, Cached: m.cache.distinctCount(table.TableName), Server: -1}
+		for _, listener := range desyncListeners {
+			listener(desync)
+		}
+	}
+	close(sync.done)
+}
+
+// isClosed reports whether a channel used as a signal was closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// RowCounter returns the number of rows a table holds on the server
+type RowCounter func(table string) (int, error)
+
+// SQLRowCounter counts rows with SELECT COUNT(*) over the HTTP SQL endpoint
+func SQLRowCounter(db *DatabaseService, nameOrIdentity string) RowCounter {
+	return func(table string) (int, error) {
+		results, err := db.ExecuteSQL(nameOrIdentity, []string{fmt.Sprintf("SELECT COUNT(*) AS count FROM %s", table)})
+		if err != nil {
+			return 0, err
+		}
+		if len(results) != 1 || len(results[0].Rows) != 1 {
+			return 0, fmt.Errorf("unexpected COUNT(*) result for %s", table)
+		}
+		row := sqlRowCells(results[0].Rows[0])
+		count, ok := cellNumber(row[0])
+		if !ok || len(row) != 1 {
+			return 0, fmt.Errorf("unexpected COUNT(*) result for %s: %v", table, row)
+		}
+		return int(count), nil
+	}
+}
+
+// wholeTablePattern matches queries that subscribe to every row of one table
+var wholeTablePattern = regexp.MustCompile("(?is)^\\s*SELECT\\s+\\*\\s+FROM\\s+[\"`]?(\\w+)[\"`]?\\s*;?\\s*$")
+
+// CheckIntegrity compares the cached row count of every table subscribed in
+// full, with a query of the form "SELECT * FROM table", against counter, and
+// returns the tables that differ. OnDesyncDetected callbacks are called for
+// each of them. Tables only subscribed with filtered queries are skipped, as
+// their cache holds a subset of the table. Counts can also differ briefly
+// while a transaction is in flight, so a single mismatch is not proof of a
+// desync.
+func (m *SubscriptionManager) CheckIntegrity(counter RowCounter) ([]Desync, error) {
+	var tables []string
+	for _, query := range m.ActiveQueries() {
+		if match := wholeTablePattern.FindStringSubmatch(query); match != nil && !slices.Contains(tables, match[1]) {
+			tables = append(tables, match[1])
+		}
+	}
+
+	var desyncs []Desync
+	for _, table := range tables {
+		server, err := counter(table)
+		if err != nil {
+			return desyncs, fmt.Errorf("error counting rows of %s: %w", table, err)
+		}
+		if cached := m.cache.distinctCount(table); cached != server {
+			desyncs = append(desyncs, Desync{Table: table, Cached: cached, Server: server})
+		}
+	}
+
+	m.mu.Lock()
+	listeners := slices.Clone(m.desyncListeners)
+	m.mu.Unlock()
+	for _, desync := range desyncs {
+		for _, listener := range listeners {
+			listener(desync)
+		}
+	}
+	return desyncs, nil
+}
+
+// StartIntegrityChecks runs CheckIntegrity every interval until ctx is done.
+// Errors are logged, see WithSubscriptionLogger; desyncs are reported to OnDesyncDetected callbacks, which
+// may call Resync from another goroutine to recover. It returns an error
+// without starting the checks if interval is not positive.
+func (m *SubscriptionManager) StartIntegrityChecks(ctx context.Context, interval time.Duration, counter RowCounter) error {
+	if interval <= 0 {
+		return fmt.Errorf("integrity check interval must be positive, got %s", interval)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.CheckIntegrity(counter); err != nil {
+					m.logf("spacetimedb: integrity check failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// RowDecoders prepares row decoders for the tables of a module schema. Each
+// table's columns are resolved through the typespace once, and the decoder is
+// reused by every later PrepareDecoder call for the same table. It is safe for
+// concurrent use.
+type RowDecoders struct {
+	schemas map[string]TableSchema
+
+	mu       sync.Mutex
+	decoders map[string]*RowDecoder
+}
+
+// RowDecoder decodes the rows of one table. It matches row columns to struct
+// fields by name, like DecodeProjected, so fields may be declared in any order.
+// The mapping is computed on the first decode into a struct type and cached.
+type RowDecoder struct {
+	Table   string
+	Columns []Column
+
+	plans sync.Map // reflect.Type -> *decodePlan
+}
+
+// decodePlan maps the columns of a row to the fields of one struct type
+type decodePlan struct {
+	fields [][]int  // field index for each column
+	paths  []string // error path for each column
+}
+
+// NewRowDecoders creates a row decoder cache for the tables of def
+func NewRowDecoders(def *RawModuleDef) *RowDecoders {
+	schemas := make(map[string]TableSchema, len(def.Tables))
+	for _, schema := range def.TableSchemas() {
+		schemas[schema.Name] = schema
+	}
+	return &RowDecoders{
+		schemas:  schemas,
+		decoders: make(map[string]*RowDecoder),
+	}
+}
+
+// PrepareDecoder returns the decoder for a table, creating it on first use
+func (d *RowDecoders) PrepareDecoder(tableName string) (*RowDecoder, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if decoder, ok := d.decoders[tableName]; ok {
+		return decoder, nil
+	}
+	schema, ok := d.schemas[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %q not found in schema", tableName)
+	}
+	if len(schema.Columns) == 0 {
+		return nil, fmt.Errorf("table %q has no columns", tableName)
+	}
+
+	decoder := &RowDecoder{Table: tableName, Columns: schema.Columns}
+	d.decoders[tableName] = decoder
+	return decoder, nil
+}
+
+// Decode decodes a positional JSON row of the table into dest, which must be a
+// non-nil pointer to a struct with a field for every column
+func (r *RowDecoder) Decode(raw []byte, dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, got %T", dest)
+	}
+
+	v := rv.Elem()
+	plan, err := r.plan(v.Type())
+	if err != nil {
+		return err
+	}
+
+	elements, err := splitArray(bytes.TrimSpace(raw), "$")
+	if err != nil {
+		return err
+	}
+	if len(elements) != len(r.Columns) {
+		return fmt.Errorf("%s: expected %d columns, got %d", r.Table, len(r.Columns), len(elements))
+	}
+
+	for i, element := range elements {
+		if err := decodePositionalValue(element, v.FieldByIndex(plan.fields[i]), plan.paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan returns the cached column to field mapping for a struct type
+func (r *RowDecoder) plan(t reflect.Type) (*decodePlan, error) {
+	if cached, ok := r.plans.Load(t); ok {
+		return cached.(*decodePlan), nil
+	}
+
+	fields := positionalFields(t)
+	plan := &decodePlan{
+		fields: make([][]int, len(r.Columns)),
+		paths:  make([]string, len(r.Columns)),
+	}
+	for i, column := range r.Columns {
+		field, ok := fieldForColumn(fields, column.Name)
+		if !ok {
+			return nil, fmt.Errorf("no field of %s matches column %q of %s", t, column.Name, r.Table)
+		}
+		plan.fields[i] = field.Index
+		plan.paths[i] = "$." + field.Name
+	}
+
+	cached, _ := r.plans.LoadOrStore(t, plan)
+	return cached.(*decodePlan), nil
+}
@@ -0,0 +1,65 @@
+package client
+
+// IterInserts calls yield with each inserted row of the update as raw JSON,
+// stopping early if yield returns false. Use it with range:
+//
+//	for raw := range update.IterInserts {
+//		decoder.Decode(raw, &row)
+//	}
+//
+// Rows are passed through one reused buffer instead of a []byte allocated per
+// row, so raw is only valid until yield returns and must not be retained.
+func (t TableUpdate) IterInserts(yield func(raw []byte) bool) {
+	iterRows(t.Updates, func(entry TableUpdateEntry) []string { return entry.Inserts }, yield)
+}
+
+// IterDeletes is like IterInserts for the deleted rows of the update
+func (t TableUpdate) IterDeletes(yield func(raw []byte) bool) {
+	iterRows(t.Updates, func(entry TableUpdateEntry) []string { return entry.Deletes }, yield)
+}
+
+func iterRows(entries []TableUpdateEntry, rows func(TableUpdateEntry) []string, yield func(raw []byte) bool) {
+	var buf []byte
+	for _, entry := range entries {
+		for _, row := range rows(entry) {
+			buf = append(buf[:0], row...)
+			if !yield(buf) {
+				return
+			}
+		}
+	}
+}
+
+// IterRows calls yield with each BSATN-encoded row of the list, split using
+// the size hint, stopping early if yield returns false. Rows are subslices of
+// RowsData and are not copied, so they must not be modified. Lists without a
+// usable size hint yield nothing.
+func (l BsatnRowList) IterRows(yield func(row []byte) bool) {
+	data := l.RowsData
+	switch {
+	case l.SizeHint.FixedSize != nil:
+		size := int(*l.SizeHint.FixedSize)
+		if size == 0 {
+			return
+		}
+		for start := 0; start+size <= len(data); start += size {
+			if !yield(data[start : start+size : start+size]) {
+				return
+			}
+		}
+	case l.SizeHint.RowOffsets != nil:
+		offsets := l.SizeHint.RowOffsets
+		for i, offset := range offsets {
+			end := uint64(len(data))
+			if i+1 < len(offsets) {
+				end = offsets[i+1]
+			}
+			if offset > end || end > uint64(len(data)) {
+				return
+			}
+			if !yield(data[offset:end:end]) {
+				return
+			}
+		}
+	}
+}
@@ -3,6 +3,10 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 )
 
 const SatsProtocol = "v1.json.spacetimedb"
@@ -18,6 +22,126 @@ type AlgebraicType struct {
 	Product *ProductType      `json:"Product,omitempty"`
 	Builtin *BuiltinType      `json:"Builtin,omitempty"`
 	Ref     *AlgebraicTypeRef `json:"Ref,omitempty"`
+
+	// Primitive is set for primitive types, which the server encodes as
+	// a bare tag such as {"U32": []} rather than inside Builtin
+	Primitive PrimitiveType `json:"-"`
+
+	// Unknown holds the encoding of a type whose tag this version doesn't know,
+	// such as one added by a newer server, so schemas using it still decode
+	Unknown json.RawMessage `json:"-"`
+}
+
+// PrimitiveType names a primitive SATS type as it appears on the wire
+type PrimitiveType string
+
+const (
+	PrimitiveBool   PrimitiveType = "Bool"
+	PrimitiveI8     PrimitiveType = "I8"
+	PrimitiveU8     PrimitiveType = "U8"
+	PrimitiveI16    PrimitiveType = "I16"
+	PrimitiveU16    PrimitiveType = "U16"
+	PrimitiveI32    PrimitiveType = "I32"
+	PrimitiveU32    PrimitiveType = "U32"
+	PrimitiveI64    PrimitiveType = "I64"
+	PrimitiveU64    PrimitiveType = "U64"
+	PrimitiveI128   PrimitiveType = "I128"
+	PrimitiveU128   PrimitiveType = "U128"
+	PrimitiveI256   PrimitiveType = "I256"
+	PrimitiveU256   PrimitiveType = "U256"
+	PrimitiveF32    PrimitiveType = "F32"
+	PrimitiveF64    PrimitiveType = "F64"
+	PrimitiveString PrimitiveType = "String"
+)
+
+var primitiveTypes = map[PrimitiveType]struct{}{
+	PrimitiveBool: {}, PrimitiveI8: {}, PrimitiveU8: {}, PrimitiveI16: {}, PrimitiveU16: {},
+	PrimitiveI32: {}, PrimitiveU32: {}, PrimitiveI64: {}, PrimitiveU64: {},
+	PrimitiveI128: {}, PrimitiveU128: {}, PrimitiveI256: {}, PrimitiveU256: {},
+	PrimitiveF32: {}, PrimitiveF64: {}, PrimitiveString: {},
+}
+
+// MarshalJSON implements custom JSON marshaling for AlgebraicType using the
+// server's tagged encoding
+func (at AlgebraicType) MarshalJSON() ([]byte, error) {
+	switch {
+	case at.Sum != nil:
+		return json.Marshal(map[string]any{"Sum": at.Sum})
+	case at.Product != nil:
+		return json.Marshal(map[string]any{"Product": at.Product})
+	case at.Ref != nil:
+		return json.Marshal(map[string]any{"Ref": at.Ref})
+	case at.Primitive != "":
+		return json.Marshal(map[string]any{string(at.Primitive): []any{}})
+	case at.GetArray() != nil:
+		return json.Marshal(map[string]any{"Array": at.GetArray()})
+	case at.GetMap() != nil:
+		return json.Marshal(map[string]any{"Map": at.GetMap()})
+	case at.Builtin != nil:
+		return json.Marshal(map[string]any{"Builtin": at.Builtin})
+	case at.Unknown != nil:
+		return at.Unknown, nil
+	default:
+		return []byte("{}"), nil
+	}
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for AlgebraicType.
+// It accepts the server's tagged encoding, where primitives and arrays appear
+// as top-level tags, as well as the legacy Builtin wrapper. Unknown tags are
+// kept in Unknown rather than failing, so newer schemas still decode.
+func (at *AlgebraicType) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*at = AlgebraicType{}
+	if len(m) == 0 {
+		return nil
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("AlgebraicType must have exactly one variant, got %d", len(m))
+	}
+
+	for tag, raw := range m {
+		switch tag {
+		case "Sum":
+			at.Sum = &SumType{}
+			return json.Unmarshal(raw, at.Sum)
+		case "Product":
+			at.Product = &ProductType{}
+			return json.Unmarshal(raw, at.Product)
+		case "Ref":
+			at.Ref = new(AlgebraicTypeRef)
+			return json.Unmarshal(raw, at.Ref)
+		case "Builtin":
+			at.Builtin = &BuiltinType{}
+			return json.Unmarshal(raw, at.Builtin)
+		case "Array":
+			var element AlgebraicType
+			if err := json.Unmarshal(raw, &element); err != nil {
+				return err
+			}
+			at.Builtin = &BuiltinType{Array: element}
+			return nil
+		case "Map":
+			var mapType MapType
+			if err := json.Unmarshal(raw, &mapType); err != nil {
+				return err
+			}
+			at.Builtin = &BuiltinType{Map: &mapType}
+			return nil
+		default:
+			if _, ok := primitiveTypes[PrimitiveType(tag)]; !ok {
+				at.Unknown = slices.Clone(json.RawMessage(data))
+				return nil
+			}
+			at.Primitive = PrimitiveType(tag)
+			return nil
+		}
+	}
+	return nil
 }
 
 // Values
@@ -114,6 +238,20 @@ type ProductType struct {
 	Elements []ProductTypeElement `json:"elements"`
 }
 
+// ColumnNames returns the element names in order.
+// Unnamed elements are reported by position as "col_<index>".
+func (pt ProductType) ColumnNames() []string {
+	names := make([]string, len(pt.Elements))
+	for i, element := range pt.Elements {
+		if element.Name != nil && element.Name.IsSome() {
+			names[i] = element.Name.Value()
+		} else {
+			names[i] = fmt.Sprintf("col_%d", i)
+		}
+	}
+	return names
+}
+
 // ProductTypeElement represents an element in a product type
 type ProductTypeElement struct {
 	AlgebraicType AlgebraicType   `json:"algebraic_type"`
@@ -266,6 +404,32 @@ func (at AlgebraicType) IsRef() bool {
 	return at.Ref != nil
 }
 
+// IsPrimitive returns true if this is a primitive type
+func (at AlgebraicType) IsPrimitive() bool {
+	return at.Primitive != ""
+}
+
+// IsEmpty returns true if no variant of the type is set
+func (at AlgebraicType) IsEmpty() bool {
+	return at.Sum == nil && at.Product == nil && at.Builtin == nil && at.Ref == nil && at.Primitive == ""
+}
+
+// GetArray returns the element type if this is an array type
+func (at AlgebraicType) GetArray() *AlgebraicType {
+	if at.Builtin == nil || at.Builtin.Array.IsEmpty() {
+		return nil
+	}
+	return &at.Builtin.Array
+}
+
+// GetMap returns the MapType if this is a map type
+func (at AlgebraicType) GetMap() *MapType {
+	if at.Builtin == nil {
+		return nil
+	}
+	return at.Builtin.Map
+}
+
 // GetSum returns the SumType if this is a sum type
 func (at AlgebraicType) GetSum() *SumType {
 	return at.Sum
@@ -300,6 +464,273 @@ func (ts Typespace) GetType(ref AlgebraicTypeRef) *AlgebraicType {
 	return &ts.Types[index]
 }
 
+// Resolve follows type references until it reaches a non-reference type.
+// Dangling or cyclic references resolve to an empty type.
+func (ts Typespace) Resolve(typ AlgebraicType) AlgebraicType {
+	for range len(ts.Types) + 1 {
+		if typ.Ref == nil {
+			return typ
+		}
+		target := ts.GetType(*typ.Ref)
+		if target == nil {
+			return AlgebraicType{}
+		}
+		typ = *target
+	}
+	return AlgebraicType{}
+}
+
+// FormatType renders a type as a readable, fully resolved type expression
+// such as "u32", "Option<String>", "Array<Identity>" or "(x: f32, y: f32)"
+func (ts Typespace) FormatType(typ AlgebraicType) string {
+	return ts.formatType(typ, 0)
+}
+
+// maxFormatDepth bounds recursion when formatting self-referential types
+const maxFormatDepth = 32
+
+func (ts Typespace) formatType(typ AlgebraicType, depth int) string {
+	if depth > maxFormatDepth {
+		return "..."
+	}
+	typ = ts.Resolve(typ)
+
+	switch {
+	case typ.Primitive != "":
+		if typ.Primitive == PrimitiveString {
+			return "String"
+		}
+		return strings.ToLower(string(typ.Primitive))
+	case typ.GetArray() != nil:
+		return fmt.Sprintf("Array<%s>", ts.formatType(*typ.GetArray(), depth+1))
+	case typ.GetMap() != nil:
+		mapType := typ.GetMap()
+		return fmt.Sprintf("Map<%s, %s>", ts.formatType(mapType.KeyType, depth+1), ts.formatType(mapType.ValueType, depth+1))
+	case typ.Product != nil:
+		if name, ok := specialProductName(*typ.Product); ok {
+			return name
+		}
+		fields := make([]string, len(typ.Product.Elements))
+		for i, element := range typ.Product.Elements {
+			fieldType := ts.formatType(element.AlgebraicType, depth+1)
+			if element.Name != nil && element.Name.IsSome() {
+				fields[i] = fmt.Sprintf("%s: %s", element.Name.Value(), fieldType)
+			} else {
+				fields[i] = fieldType
+			}
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	case typ.Sum != nil:
+		if inner, ok := optionInner(*typ.Sum); ok {
+			return fmt.Sprintf("Option<%s>", ts.formatType(inner, depth+1))
+		}
+		variants := make([]string, len(typ.Sum.Variants))
+		for i, variant := range typ.Sum.Variants {
+			variantType := ts.formatType(variant.AlgebraicType, depth+1)
+			if variant.Name != nil && variant.Name.IsSome() {
+				variants[i] = fmt.Sprintf("%s(%s)", variant.Name.Value(), variantType)
+			} else {
+				variants[i] = variantType
+			}
+		}
+		return strings.Join(variants, " | ")
+	case typ.Builtin != nil:
+		return "builtin"
+	default:
+		return "unknown"
+	}
+}
+
+// specialProductName recognizes the single-field products SpacetimeDB uses for
+// its special types, such as {__identity__: U256}
+func specialProductName(pt ProductType) (string, bool) {
+	if len(pt.Elements) != 1 || pt.Elements[0].Name == nil {
+		return "", false
+	}
+	switch pt.Elements[0].Name.Value() {
+	case "__identity__":
+		return "Identity", true
+	case "__connection_id__":
+		return "ConnectionId", true
+	case "__timestamp_micros_since_unix_epoch__":
+		return "Timestamp", true
+	case "__time_duration_micros__":
+		return "TimeDuration", true
+	default:
+		return "", false
+	}
+}
+
+// optionInner returns the payload type if the sum type is an Option (some | none)
+func optionInner(st SumType) (AlgebraicType, bool) {
+	if len(st.Variants) != 2 {
+		return AlgebraicType{}, false
+	}
+	some, none := st.Variants[0], st.Variants[1]
+	if some.Name == nil || none.Name == nil || some.Name.Value() != "some" || none.Name.Value() != "none" {
+		return AlgebraicType{}, false
+	}
+	return some.AlgebraicType, true
+}
+
+// DecodeProduct decodes a positional JSON product, such as a table row, into
+// a ProductValue whose elements are decoded according to the product type
+func (ts Typespace) DecodeProduct(data []byte, product ProductType) (ProductValue, error) {
+	value, err := ts.decodeValue(data, NewProductAlgebraicType(product), "$", 0)
+	if err != nil {
+		return ProductValue{}, err
+	}
+	return value.(ProductValue), nil
+}
+
+// DecodeValue decodes JSON into the AlgebraicValue matching a type, recursing
+// into nested products, sums and arrays. Products become ProductValue, sums
+// encoded as [tag, value] become SumValue tagged with the variant name, arrays
+// become a BuiltinValue holding []AlgebraicValue, and primitives become a
+// BuiltinValue holding the matching Go type, with integers wider than 64 bits
+// kept as json.Number, or as a string when sent as hex.
+func (ts Typespace) DecodeValue(data []byte, typ AlgebraicType) (AlgebraicValue, error) {
+	return ts.decodeValue(data, typ, "$", 0)
+}
+
+func (ts Typespace) decodeValue(data []byte, typ AlgebraicType, path string, depth int) (AlgebraicValue, error) {
+	if depth > maxFormatDepth {
+		return nil, fmt.Errorf("%s: value nested too deeply", path)
+	}
+	typ = ts.Resolve(typ)
+
+	switch {
+	case typ.Primitive != "":
+		value, err := decodePrimitive(data, typ.Primitive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return BuiltinValue{Value: value}, nil
+	case typ.Product != nil:
+		elements, err := splitArray(data, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(elements) != len(typ.Product.Elements) {
+			return nil, fmt.Errorf("%s: expected %d product elements, got %d", path, len(typ.Product.Elements), len(elements))
+		}
+		values := make([]AlgebraicValue, len(elements))
+		for i, element := range elements {
+			value, err := ts.decodeValue(element, typ.Product.Elements[i].AlgebraicType, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return ProductValue{Elements: values}, nil
+	case typ.Sum != nil:
+		elements, err := splitArray(data, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(elements) != 2 {
+			return nil, fmt.Errorf("%s: sum must be a [tag, value] pair, got %d elements", path, len(elements))
+		}
+		var tag int
+		if err := json.Unmarshal(elements[0], &tag); err != nil {
+			return nil, fmt.Errorf("%s: invalid sum tag: %w", path, err)
+		}
+		if tag < 0 || tag >= len(typ.Sum.Variants) {
+			return nil, fmt.Errorf("%s: sum tag %d out of range", path, tag)
+		}
+		variant := typ.Sum.Variants[tag]
+		value, err := ts.decodeValue(elements[1], variant.AlgebraicType, path+"[1]", depth+1)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%d", tag)
+		if variant.Name != nil && variant.Name.IsSome() {
+			name = variant.Name.Value()
+		}
+		return SumValue{Tag: name, Value: value}, nil
+	case typ.GetArray() != nil:
+		elementType := *typ.GetArray()
+		if ts.Resolve(elementType).Primitive == PrimitiveU8 && len(data) > 0 && data[0] == '"' {
+			var bytes []byte
+			if err := decodeHexBytes(data, reflect.ValueOf(&bytes).Elem(), path); err != nil {
+				return nil, err
+			}
+			return BuiltinValue{Value: bytes}, nil
+		}
+		elements, err := splitArray(data, path)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]AlgebraicValue, len(elements))
+		for i, element := range elements {
+			value, err := ts.decodeValue(element, elementType, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return BuiltinValue{Value: values}, nil
+	default:
+		// Maps and unknown types keep their untyped JSON value
+		value, err := decodeAny(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return BuiltinValue{Value: value}, nil
+	}
+}
+
+// decodePrimitive decodes a primitive JSON value into the matching Go type
+func decodePrimitive(data []byte, primitive PrimitiveType) (any, error) {
+	var target any
+	switch primitive {
+	case PrimitiveBool:
+		target = new(bool)
+	case PrimitiveString:
+		target = new(string)
+	case PrimitiveI8:
+		target = new(int8)
+	case PrimitiveU8:
+		target = new(uint8)
+	case PrimitiveI16:
+		target = new(int16)
+	case PrimitiveU16:
+		target = new(uint16)
+	case PrimitiveI32:
+		target = new(int32)
+	case PrimitiveU32:
+		target = new(uint32)
+	case PrimitiveI64:
+		target = new(int64)
+	case PrimitiveU64:
+		target = new(uint64)
+	case PrimitiveF32:
+		target = new(float32)
+	case PrimitiveF64:
+		target = new(float64)
+	default:
+		// 128- and 256-bit integers arrive as numbers, or as hex strings
+		// inside identities and connection IDs
+		if len(data) > 0 && data[0] == '"' {
+			var text string
+			if err := json.Unmarshal(data, &text); err != nil {
+				return nil, fmt.Errorf("invalid %s value: %w", primitive, err)
+			}
+			return text, nil
+		}
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return nil, fmt.Errorf("invalid %s value: %w", primitive, err)
+		}
+		return number, nil
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return nil, fmt.Errorf("invalid %s value: %w", primitive, err)
+	}
+	return reflect.ValueOf(target).Elem().Interface(), nil
+}
+
 // AddType adds a type to the typespace and returns its reference
 func (ts *Typespace) AddType(typ AlgebraicType) AlgebraicTypeRef {
 	ts.Types = append(ts.Types, typ)
@@ -316,6 +747,346 @@ type RawModuleDef struct {
 	Types            []NamedTypeDef `json:"types"`
 	MiscExports      []any          `json:"misc_exports"`
 	RowLevelSecurity []any          `json:"row_level_security"`
+
+	// warnings collects problems skipped while decoding, see SchemaParseWarnings
+	warnings []string
+}
+
+// ReducerID returns the numeric ID the server uses for a reducer, which is its
+// index in the module's reducer list. Server messages such as TransactionUpdate
+// report reducers by this ID. The client protocol only accepts reducer names in
+// CallReducer, so the ID cannot be used to shorten reducer calls.
+func (def RawModuleDef) ReducerID(name string) (uint32, bool) {
+	if name == "" {
+		return 0, false
+	}
+	for i, reducer := range def.Reducers {
+		if reducer.Name == name {
+			return uint32(i), true
+		}
+	}
+	return 0, false
+}
+
+// ReducerName returns the name of the reducer with the given numeric ID. It
+// reports false for a reducer the schema could not decode.
+func (def RawModuleDef) ReducerName(id uint32) (string, bool) {
+	if int(id) >= len(def.Reducers) || def.Reducers[id].Name == "" {
+		return "", false
+	}
+	return def.Reducers[id].Name, true
+}
+
+// OrderReducerArgs orders named reducer arguments into the positional list the
+// server expects, following the reducer's parameter order. Every parameter must
+// be given, including optional ones; unnamed parameters are named by position
+// as "col_<index>". Missing and unknown argument names are reported together.
+func (def RawModuleDef) OrderReducerArgs(reducerName string, args map[string]any) ([]any, error) {
+	index := slices.IndexFunc(def.Reducers, func(reducer ReducerDef) bool { return reducer.Name == reducerName })
+	if index < 0 {
+		return nil, fmt.Errorf("reducer %q not found in schema", reducerName)
+	}
+
+	names := def.Reducers[index].Params.ColumnNames()
+	ordered := make([]any, len(names))
+	var missing []string
+	for i, name := range names {
+		arg, ok := args[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		ordered[i] = arg
+	}
+
+	var unknown []string
+	for name := range args {
+		if !slices.Contains(names, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+
+	switch {
+	case len(missing) > 0 && len(unknown) > 0:
+		return nil, fmt.Errorf("reducer %s: missing arguments %s and unknown arguments %s", reducerName, strings.Join(missing, ", "), strings.Join(unknown, ", "))
+	case len(missing) > 0:
+		return nil, fmt.Errorf("reducer %s: missing arguments %s", reducerName, strings.Join(missing, ", "))
+	case len(unknown) > 0:
+		return nil, fmt.Errorf("reducer %s: unknown arguments %s", reducerName, strings.Join(unknown, ", "))
+	}
+	return ordered, nil
+}
+
+// ReducerArgs converts reducer arguments given in any supported form into the
+// positional list the server expects. args may be a map[string]any keyed by
+// parameter name, handled like OrderReducerArgs, a struct or struct pointer
+// whose exported fields are matched to parameters by name, like DecodeProjected,
+// or an []any already in parameter order, which is only checked for length.
+func (def RawModuleDef) ReducerArgs(reducerName string, args any) ([]any, error) {
+	switch args := args.(type) {
+	case nil:
+		return def.OrderReducerArgs(reducerName, nil)
+	case map[string]any:
+		return def.OrderReducerArgs(reducerName, args)
+	case []any:
+		index := slices.IndexFunc(def.Reducers, func(reducer ReducerDef) bool { return reducer.Name == reducerName })
+		if index < 0 {
+			return nil, fmt.Errorf("reducer %q not found in schema", reducerName)
+		}
+		if want := len(def.Reducers[index].Params.Elements); len(args) != want {
+			return nil, fmt.Errorf("reducer %s: expected %d arguments, got %d", reducerName, want, len(args))
+		}
+		return args, nil
+	}
+
+	v := reflect.ValueOf(args)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("reducer %s: arguments must be a map, struct or []any, got %T", reducerName, args)
+	}
+
+	index := slices.IndexFunc(def.Reducers, func(reducer ReducerDef) bool { return reducer.Name == reducerName })
+	if index < 0 {
+		return nil, fmt.Errorf("reducer %q not found in schema", reducerName)
+	}
+
+	// Key each field by the parameter it matches, so OrderReducerArgs reports
+	// unmatched fields as unknown arguments under their Go names
+	fields := positionalFields(v.Type())
+	named := make(map[string]any, len(fields))
+	matched := make(map[string]bool, len(fields))
+	for _, param := range def.Reducers[index].Params.ColumnNames() {
+		if field, ok := fieldForColumn(fields, param); ok {
+			named[param] = v.FieldByIndex(field.Index).Interface()
+			matched[field.Name] = true
+		}
+	}
+	for _, field := range fields {
+		if !matched[field.Name] {
+			named[field.Name] = v.FieldByIndex(field.Index).Interface()
+		}
+	}
+	return def.OrderReducerArgs(reducerName, named)
+}
+
+// TableSchema describes a table and its columns, resolved through the typespace
+type TableSchema struct {
+	Name       string
+	IsPublic   bool
+	IsSystem   bool
+	PrimaryKey []string
+	Columns    []Column
+}
+
+// Column is a table column with its type resolved through the typespace.
+// Unnamed columns are reported by position as "col_<index>".
+type Column struct {
+	Name string
+	Type AlgebraicType
+}
+
+// TableSchemas lists the module's tables with their columns and primary key
+// names. Tables whose row type does not resolve to a product have no columns.
+func (def *RawModuleDef) TableSchemas() []TableSchema {
+	schemas := make([]TableSchema, 0, len(def.Tables))
+	for _, table := range def.Tables {
+		schema := TableSchema{
+			Name:     table.Name,
+			IsPublic: table.TableAccess.Public != nil,
+			IsSystem: table.TableType.System != nil,
+		}
+
+		row := def.Typespace.Resolve(NewRefAlgebraicType(table.ProductTypeRef))
+		if row.Product != nil {
+			names := row.Product.ColumnNames()
+			schema.Columns = make([]Column, len(names))
+			for i, element := range row.Product.Elements {
+				schema.Columns[i] = Column{
+					Name: names[i],
+					Type: def.Typespace.Resolve(element.AlgebraicType),
+				}
+			}
+		}
+
+		for _, index := range table.PrimaryKeyColumns() {
+			if index < len(schema.Columns) {
+				schema.PrimaryKey = append(schema.PrimaryKey, schema.Columns[index].Name)
+			}
+		}
+
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
+
+// PrimaryKeyColumns returns the names of the primary key columns of a table, in
+// key order. It returns an empty list for tables without a primary key and an
+// error if the table doesn't exist or its key refers to a missing column.
+func (def *RawModuleDef) PrimaryKeyColumns(tableName string) ([]string, error) {
+	index := slices.IndexFunc(def.Tables, func(table TableDef) bool { return table.Name == tableName })
+	if index < 0 {
+		return nil, fmt.Errorf("table %q not found in schema", tableName)
+	}
+	table := def.Tables[index]
+
+	var names []string
+	if row := def.Typespace.Resolve(NewRefAlgebraicType(table.ProductTypeRef)); row.Product != nil {
+		names = row.Product.ColumnNames()
+	}
+
+	columns := []string{}
+	for _, column := range table.PrimaryKeyColumns() {
+		if column < 0 || column >= len(names) {
+			return nil, fmt.Errorf("table %q: primary key column %d out of range", tableName, column)
+		}
+		columns = append(columns, names[column])
+	}
+	return columns, nil
+}
+
+// ReducerSignature describes a reducer with its parameters resolved through the
+// typespace. Lifecycle reducers are run by the host on Init, OnConnect or
+// OnDisconnect and cannot be called by clients.
+type ReducerSignature struct {
+	Name      string
+	Lifecycle string // see ReducerLifecycle.Event, empty for ordinary reducers
+	Params    []Param
+}
+
+// Param is a reducer parameter. Unnamed parameters are reported by position as "col_<index>".
+type Param struct {
+	Name string
+	Type AlgebraicType
+}
+
+// Callable reports whether clients can call the reducer
+func (r ReducerSignature) Callable() bool {
+	return r.Lifecycle == ""
+}
+
+// ReducerSignatures lists the module's reducers with their parameter types,
+// including lifecycle reducers, which are flagged by Lifecycle
+func (def *RawModuleDef) ReducerSignatures() []ReducerSignature {
+	signatures := make([]ReducerSignature, 0, len(def.Reducers))
+	for _, reducer := range def.Reducers {
+		if reducer.Name == "" {
+			// A placeholder for a reducer that failed to decode
+			continue
+		}
+		names := reducer.Params.ColumnNames()
+		signature := ReducerSignature{
+			Name:      reducer.Name,
+			Lifecycle: reducer.Lifecycle.Event(),
+			Params:    make([]Param, len(names)),
+		}
+		for i, element := range reducer.Params.Elements {
+			signature.Params[i] = Param{
+				Name: names[i],
+				Type: def.Typespace.Resolve(element.AlgebraicType),
+			}
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures
+}
+
+// RowLevelSecurityRule is a row-level security filter of the module. Clients
+// only see the rows of Table matched by SQL; filters using :sender depend on
+// the identity of the caller.
+type RowLevelSecurityRule struct {
+	SQL        string
+	Table      string // table filtered by the rule, empty if it could not be determined
+	UsesSender bool   // the filter refers to the caller's identity via :sender
+}
+
+// Patterns locating the filtered table of an RLS query, which selects whole rows
+// of one table, possibly through joins: SELECT * FROM t or SELECT t.* FROM ...
+var (
+	rlsQualifiedPattern = regexp.MustCompile(`(?is)^\s*select\s+(\w+)\.\*\s+(from\s+.*)$`)
+	rlsFromPattern      = regexp.MustCompile(`(?i)\bfrom\s+(\w+)(?:\s+(?:as\s+)?(\w+))?`)
+	rlsJoinPattern      = regexp.MustCompile(`(?i)\bjoin\s+(\w+)(?:\s+(?:as\s+)?(\w+))?`)
+)
+
+// RowLevelSecurityRules parses the module's row-level security filters. A
+// subscription to a table with rules returns only the rows the rules allow,
+// which explains an identity seeing fewer rows than SQL run by the owner.
+func (def *RawModuleDef) RowLevelSecurityRules() []RowLevelSecurityRule {
+	var rules []RowLevelSecurityRule
+	for _, raw := range def.RowLevelSecurity {
+		var entry struct {
+			SQL string `json:"sql"`
+		}
+		data, err := json.Marshal(raw)
+		if err != nil || json.Unmarshal(data, &entry) != nil || entry.SQL == "" {
+			continue
+		}
+		rules = append(rules, RowLevelSecurityRule{
+			SQL:        entry.SQL,
+			Table:      rlsTable(entry.SQL),
+			UsesSender: strings.Contains(entry.SQL, ":sender"),
+		})
+	}
+	return rules
+}
+
+// RestrictedTables returns the sorted names of the tables that have row-level security rules
+func (def *RawModuleDef) RestrictedTables() []string {
+	var tables []string
+	for _, rule := range def.RowLevelSecurityRules() {
+		if rule.Table != "" && !slices.Contains(tables, rule.Table) {
+			tables = append(tables, rule.Table)
+		}
+	}
+	slices.Sort(tables)
+	return tables
+}
+
+// PublicTables returns the sorted names of the tables any client can subscribe
+// to and query
+func (def *RawModuleDef) PublicTables() []string {
+	return def.tablesByAccess(true)
+}
+
+// PrivateTables returns the sorted names of the tables only the database owner
+// can read. Subscriptions of other clients to them see no rows.
+func (def *RawModuleDef) PrivateTables() []string {
+	return def.tablesByAccess(false)
+}
+
+// tablesByAccess returns the sorted names of the public or the private tables
+func (def *RawModuleDef) tablesByAccess(public bool) []string {
+	tables := []string{}
+	for _, table := range def.Tables {
+		if (table.TableAccess.Public != nil) == public {
+			tables = append(tables, table.Name)
+		}
+	}
+	slices.Sort(tables)
+	return tables
+}
+
+// rlsTable returns the table whose rows an RLS query selects
+func rlsTable(sql string) string {
+	qualified := rlsQualifiedPattern.FindStringSubmatch(sql)
+	if qualified == nil {
+		if from := rlsFromPattern.FindStringSubmatch(sql); from != nil {
+			return from[1]
+		}
+		return ""
+	}
+
+	// Resolve the alias or table name before .* among the joined tables
+	target, rest := qualified[1], qualified[2]
+	matches := append(rlsFromPattern.FindAllStringSubmatch(rest, -1), rlsJoinPattern.FindAllStringSubmatch(rest, -1)...)
+	for _, match := range matches {
+		if strings.EqualFold(match[1], target) || strings.EqualFold(match[2], target) {
+			return match[1]
+		}
+	}
+	return target
 }
 
 // TableDef represents a table definition
@@ -331,6 +1102,22 @@ type TableDef struct {
 	TableAccess    TableAccessType  `json:"table_access"`
 }
 
+// PrimaryKeyColumns returns the column indexes of the table's primary key
+func (t TableDef) PrimaryKeyColumns() []int {
+	columns := make([]int, 0, len(t.PrimaryKey))
+	for _, column := range t.PrimaryKey {
+		switch column := column.(type) {
+		case float64:
+			columns = append(columns, int(column))
+		case int:
+			columns = append(columns, column)
+		case uint16:
+			columns = append(columns, int(column))
+		}
+	}
+	return columns
+}
+
 // ScheduleType represents table scheduling options
 type ScheduleType struct {
 	None []any `json:"none"`
@@ -361,6 +1148,23 @@ type ReducerLifecycle struct {
 	Some *ReducerLifecycleEvent `json:"some,omitempty"`
 }
 
+// Event returns the lifecycle event that runs the reducer: "Init",
+// "OnConnect", "OnDisconnect", or empty for reducers called by clients
+func (l ReducerLifecycle) Event() string {
+	switch {
+	case l.Some == nil:
+		return ""
+	case l.Some.Init != nil:
+		return "Init"
+	case l.Some.OnConnect != nil:
+		return "OnConnect"
+	case l.Some.OnDisconnect != nil:
+		return "OnDisconnect"
+	}
+	// An event added by a newer server; still not callable by clients
+	return "Unknown"
+}
+
 // ReducerLifecycleEvent represents specific lifecycle events
 type ReducerLifecycleEvent struct {
 	OnConnect    []any `json:"OnConnect,omitempty"`
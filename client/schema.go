@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SchemaChangeSet summarizes the differences between two module schemas
+type SchemaChangeSet struct {
+	AddedTables     []string
+	RemovedTables   []string
+	ChangedTables   []TableChange
+	AddedReducers   []string
+	RemovedReducers []string
+	ChangedReducers []ReducerChange
+}
+
+// TableChange describes how the columns of a table present in both schemas changed.
+// A renamed column shows up as one removed and one added column.
+type TableChange struct {
+	Name           string
+	AddedColumns   []string
+	RemovedColumns []string
+	RetypedColumns []ColumnTypeChange
+}
+
+// ColumnTypeChange describes a column whose type changed
+type ColumnTypeChange struct {
+	Name    string
+	OldType string
+	NewType string
+}
+
+// ReducerChange describes a reducer whose parameter signature changed
+type ReducerChange struct {
+	Name         string
+	OldSignature string
+	NewSignature string
+}
+
+// IsEmpty returns true if the change set contains no changes
+func (cs SchemaChangeSet) IsEmpty() bool {
+	return len(cs.AddedTables) == 0 && len(cs.RemovedTables) == 0 && len(cs.ChangedTables) == 0 &&
+		len(cs.AddedReducers) == 0 && len(cs.RemovedReducers) == 0 && len(cs.ChangedReducers) == 0
+}
+
+// IsBreaking returns true if the change set may break existing clients:
+// removed tables or reducers, changed reducer signatures, or removed or retyped columns
+func (cs SchemaChangeSet) IsBreaking() bool {
+	if len(cs.RemovedTables) > 0 || len(cs.RemovedReducers) > 0 || len(cs.ChangedReducers) > 0 {
+		return true
+	}
+	for _, table := range cs.ChangedTables {
+		if len(table.RemovedColumns) > 0 || len(table.RetypedColumns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SchemaDiff compares two module schemas and reports added, removed and changed
+// tables and reducers. Column and parameter types are compared after resolving
+// them through each schema's typespace.
+func SchemaDiff(before, after RawModuleDef) SchemaChangeSet {
+	oldTables := make([]string, len(before.Tables))
+	for i, table := range before.Tables {
+		oldTables[i] = table.Name
+	}
+	newTables := make([]string, len(after.Tables))
+	for i, table := range after.Tables {
+		newTables[i] = table.Name
+	}
+
+	// Reducers that failed to decode are placeholders without a name
+	var oldReducers, newReducers []string
+	for _, reducer := range before.Reducers {
+		if reducer.Name != "" {
+			oldReducers = append(oldReducers, reducer.Name)
+		}
+	}
+	for _, reducer := range after.Reducers {
+		if reducer.Name != "" {
+			newReducers = append(newReducers, reducer.Name)
+		}
+	}
+
+	var changes SchemaChangeSet
+	changes.AddedTables, changes.RemovedTables = diffNames(oldTables, newTables)
+	changes.AddedReducers, changes.RemovedReducers = diffNames(oldReducers, newReducers)
+
+	afterTables := make(map[string]TableDef, len(after.Tables))
+	for _, table := range after.Tables {
+		afterTables[table.Name] = table
+	}
+	for _, oldTable := range before.Tables {
+		newTable, ok := afterTables[oldTable.Name]
+		if !ok {
+			continue
+		}
+		oldColumns := tableColumnTypes(before, oldTable)
+		newColumns := tableColumnTypes(after, newTable)
+		if change, changed := diffColumns(oldTable.Name, oldColumns, newColumns); changed {
+			changes.ChangedTables = append(changes.ChangedTables, change)
+		}
+	}
+	sort.Slice(changes.ChangedTables, func(i, j int) bool {
+		return changes.ChangedTables[i].Name < changes.ChangedTables[j].Name
+	})
+
+	afterReducers := make(map[string]ReducerDef, len(after.Reducers))
+	for _, reducer := range after.Reducers {
+		afterReducers[reducer.Name] = reducer
+	}
+	for _, oldReducer := range before.Reducers {
+		newReducer, ok := afterReducers[oldReducer.Name]
+		if !ok || oldReducer.Name == "" {
+			continue
+		}
+		oldSignature := before.Typespace.FormatType(NewProductAlgebraicType(oldReducer.Params))
+		newSignature := after.Typespace.FormatType(NewProductAlgebraicType(newReducer.Params))
+		if oldSignature != newSignature {
+			changes.ChangedReducers = append(changes.ChangedReducers, ReducerChange{
+				Name:         oldReducer.Name,
+				OldSignature: oldSignature,
+				NewSignature: newSignature,
+			})
+		}
+	}
+	sort.Slice(changes.ChangedReducers, func(i, j int) bool {
+		return changes.ChangedReducers[i].Name < changes.ChangedReducers[j].Name
+	})
+
+	return changes
+}
+
+// columnType pairs a column name with its formatted type
+type columnType struct {
+	name string
+	typ  string
+}
+
+// tableColumnTypes returns the columns of a table with their resolved types
+func tableColumnTypes(def RawModuleDef, table TableDef) []columnType {
+	resolved := def.Typespace.Resolve(NewRefAlgebraicType(table.ProductTypeRef))
+	if resolved.Product == nil {
+		return nil
+	}
+
+	names := resolved.Product.ColumnNames()
+	columns := make([]columnType, len(names))
+	for i, element := range resolved.Product.Elements {
+		columns[i] = columnType{
+			name: names[i],
+			typ:  def.Typespace.FormatType(element.AlgebraicType),
+		}
+	}
+	return columns
+}
+
+// diffColumns compares the columns of a table by name
+func diffColumns(tableName string, before, after []columnType) (TableChange, bool) {
+	change := TableChange{Name: tableName}
+
+	oldNames := make([]string, len(before))
+	oldTypes := make(map[string]string, len(before))
+	for i, column := range before {
+		oldNames[i] = column.name
+		oldTypes[column.name] = column.typ
+	}
+	newNames := make([]string, len(after))
+	for i, column := range after {
+		newNames[i] = column.name
+	}
+
+	change.AddedColumns, change.RemovedColumns = diffNames(oldNames, newNames)
+	for _, column := range after {
+		oldType, ok := oldTypes[column.name]
+		if ok && oldType != column.typ {
+			change.RetypedColumns = append(change.RetypedColumns, ColumnTypeChange{
+				Name:    column.name,
+				OldType: oldType,
+				NewType: column.typ,
+			})
+		}
+	}
+
+	changed := len(change.AddedColumns) > 0 || len(change.RemovedColumns) > 0 || len(change.RetypedColumns) > 0
+	return change, changed
+}
+
+// diffNames returns the sorted names only present in after and only present in before
+func diffNames(before, after []string) (added, removed []string) {
+	oldSet := make(map[string]struct{}, len(before))
+	for _, name := range before {
+		oldSet[name] = struct{}{}
+	}
+	newSet := make(map[string]struct{}, len(after))
+	for _, name := range after {
+		newSet[name] = struct{}{}
+	}
+
+	for name := range newSet {
+		if _, ok := oldSet[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range oldSet {
+		if _, ok := newSet[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// defaultSchemaWatchInterval is the WatchSchema poll interval used for
+// non-positive intervals
+const defaultSchemaWatchInterval = 30 * time.Second
+
+// WatchSchema polls the schema of a database every interval and sends it on the
+// returned channel whenever it differs from the previously seen schema. The first
+// successfully fetched schema is always sent. Failed polls are skipped and retried
+// on the next tick. Call the returned function to stop watching; the channel is
+// closed once the watcher exits. Use SchemaDiff to inspect what changed. A
+// non-positive interval polls every 30 seconds.
+func (s *DatabaseService) WatchSchema(nameOrIdentity string, interval time.Duration) (<-chan RawModuleDef, func()) {
+	if interval <= 0 {
+		interval = defaultSchemaWatchInterval
+	}
+	ctx, cancel := context.WithCancel(s.client.ctx)
+	schemas := make(chan RawModuleDef)
+
+	go func() {
+		defer close(schemas)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last *RawModuleDef
+		for {
+			schema, err := s.GetSchema(nameOrIdentity, nil)
+			if err == nil && (last == nil || !reflect.DeepEqual(*last, schema)) {
+				select {
+				case schemas <- schema:
+					last = &schema
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return schemas, cancel
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// UnmarshalJSON decodes a module schema leniently, so a schema from a newer or
+// older server still yields everything this client understands. Unknown fields
+// are ignored. A missing typespace, tables or reducers field, or a table,
+// reducer or type that fails to decode, is skipped and recorded as a warning
+// instead of failing the whole schema. Types that fail to decode are kept as
+// empty placeholders so type references stay valid, and types with a tag this
+// client doesn't know keep their encoding in AlgebraicType.Unknown. Reducers
+// that fail to decode are likewise kept as placeholders without a name, so
+// reducer IDs still match their index. Only input that is not a JSON object is
+// an error.
+func (def *RawModuleDef) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*def = RawModuleDef{}
+	warn := func(format string, args ...any) {
+		def.warnings = append(def.warnings, fmt.Sprintf(format, args...))
+	}
+
+	// field returns a schema field, warning if a required one is missing
+	field := func(name string, required bool) (json.RawMessage, bool) {
+		raw, ok := fields[name]
+		if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if required {
+				warn("missing field %q", name)
+			}
+			return nil, false
+		}
+		return raw, true
+	}
+
+	if raw, ok := field("typespace", true); ok {
+		var typespace struct {
+			Types []json.RawMessage `json:"types"`
+		}
+		if err := json.Unmarshal(raw, &typespace); err != nil {
+			warn("typespace: %v", err)
+		}
+		def.Typespace.Types = make([]AlgebraicType, len(typespace.Types))
+		for i, element := range typespace.Types {
+			if err := json.Unmarshal(element, &def.Typespace.Types[i]); err != nil {
+				warn("typespace.types[%d]: %v", i, err)
+				def.Typespace.Types[i] = AlgebraicType{}
+			} else if def.Typespace.Types[i].Unknown != nil {
+				warn("typespace.types[%d]: unknown AlgebraicType variant %s", i, def.Typespace.Types[i].Unknown)
+			}
+		}
+	}
+	if raw, ok := field("tables", true); ok {
+		def.Tables = decodeSchemaList[TableDef](raw, "tables", false, warn)
+	}
+	if raw, ok := field("reducers", true); ok {
+		// Reducers are identified by index, so failed ones keep their slot
+		def.Reducers = decodeSchemaList[ReducerDef](raw, "reducers", true, warn)
+	}
+	if raw, ok := field("types", false); ok {
+		def.Types = decodeSchemaList[NamedTypeDef](raw, "types", false, warn)
+	}
+	if raw, ok := field("misc_exports", false); ok {
+		def.MiscExports = decodeSchemaList[any](raw, "misc_exports", false, warn)
+	}
+	if raw, ok := field("row_level_security", false); ok {
+		def.RowLevelSecurity = decodeSchemaList[any](raw, "row_level_security", false, warn)
+	}
+	return nil
+}
+
+// decodeSchemaList decodes a schema array element by element. Elements that
+// fail to decode are skipped, or kept as zero values if placeholders is set.
+func decodeSchemaList[T any](raw json.RawMessage, name string, placeholders bool, warn func(format string, args ...any)) []T {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		warn("%s: %v", name, err)
+		return nil
+	}
+
+	list := make([]T, 0, len(elements))
+	for i, element := range elements {
+		var value T
+		if err := json.Unmarshal(element, &value); err != nil {
+			warn("%s[%d]: %v", name, i, err)
+			if !placeholders {
+				continue
+			}
+			value = *new(T)
+		}
+		list = append(list, value)
+	}
+	return list
+}
+
+// SchemaParseWarnings returns the problems skipped while decoding the schema,
+// such as missing fields or tables that could not be decoded. It is empty for a
+// schema that decoded completely.
+func (def RawModuleDef) SchemaParseWarnings() []string {
+	return slices.Clone(def.warnings)
+}
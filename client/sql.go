@@ -0,0 +1,446 @@
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrSQLTransactionUnsupported is returned by ExecuteSQL for transaction control
+// statements such as BEGIN and COMMIT. SpacetimeDB's SQL endpoint has no
+// transactions a client can control; logic that must read and write atomically,
+// such as incrementing a counter below a limit, belongs in a reducer, which
+// always runs as a single transaction.
+var ErrSQLTransactionUnsupported = errors.New("SQL transactions are not supported, use a reducer for atomic read-then-write logic")
+
+// transactionKeywords start the transaction control statements ExecuteSQL rejects
+var transactionKeywords = []string{"BEGIN", "START", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE"}
+
+// ExportFormat selects the output format of ExecuteSQLToWriter
+type ExportFormat int
+
+const (
+	// ExportJSONLines writes one JSON object per row, keyed by column name
+	ExportJSONLines ExportFormat = iota
+	// ExportCSV writes a header line of column names followed by one record per row
+	ExportCSV
+)
+
+// SplitSQLStatements splits a SQL script into its statements at semicolons that
+// are not inside single-quoted string literals or double-quoted identifiers.
+// Statements are trimmed and empty ones are dropped.
+func SplitSQLStatements(script string) []string {
+	var statements []string
+	var quote rune
+	start := 0
+	for i, r := range script {
+		switch {
+		case quote != 0:
+			// A doubled quote inside a literal is an escaped quote and toggles
+			// twice, leaving the state unchanged
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			statements = appendStatement(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	return appendStatement(statements, script[start:])
+}
+
+func appendStatement(statements []string, statement string) []string {
+	if statement = strings.TrimSpace(statement); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// checkTransactionStatements returns ErrSQLTransactionUnsupported if a query
+// contains a transaction control statement
+func checkTransactionStatements(queries []string) error {
+	for _, query := range queries {
+		for _, statement := range SplitSQLStatements(query) {
+			keyword := strings.Fields(statement)[0]
+			for _, transactionKeyword := range transactionKeywords {
+				if strings.EqualFold(keyword, transactionKeyword) {
+					return fmt.Errorf("%w: %q", ErrSQLTransactionUnsupported, statement)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// joinSQLStatements joins queries into one script, dropping empty queries and
+// the trailing semicolons that would otherwise produce empty statements
+func joinSQLStatements(queries []string) string {
+	statements := make([]string, 0, len(queries))
+	for _, query := range queries {
+		query = strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+		if query != "" {
+			statements = append(statements, query)
+		}
+	}
+	return strings.Join(statements, ";\n")
+}
+
+// ColumnNames returns the column names of the result in schema order
+func (r SQLResult) ColumnNames() []string {
+	return r.Schema.ColumnNames()
+}
+
+// Records renders every row as a slice of strings, one per column.
+// Optional [tag, value] cells are flattened to their value and None or nil
+// cells render as empty strings.
+func (r SQLResult) Records() [][]string {
+	records := make([][]string, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		cells, ok := row.([]any)
+		if !ok {
+			cells = []any{row}
+		}
+
+		record := make([]string, len(cells))
+		for i, cell := range cells {
+			var typ AlgebraicType
+			if i < len(r.Schema.Elements) {
+				typ = r.Schema.Elements[i].AlgebraicType
+			}
+			record[i] = formatCell(cell, typ)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// ToCSV writes the result as CSV with a header line of column names
+func (r SQLResult) ToCSV(w io.Writer) error {
+	return r.writeDelimited(w, ',')
+}
+
+// ToTSV writes the result as tab-separated values with a header line of column names
+func (r SQLResult) ToTSV(w io.Writer) error {
+	return r.writeDelimited(w, '\t')
+}
+
+func (r SQLResult) writeDelimited(w io.Writer, comma rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	if err := writer.Write(r.ColumnNames()); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if err := writer.WriteAll(r.Records()); err != nil {
+		return fmt.Errorf("error writing records: %w", err)
+	}
+	return nil
+}
+
+// tableCellEscaper escapes the control characters that would break table alignment
+var tableCellEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`, "\t", `\t`)
+
+// ToTable renders the result as an aligned ASCII table, similar to the output
+// of the spacetime sql command. Newlines, carriage returns and tabs in cells
+// are escaped so that every row stays on one line.
+func (r SQLResult) ToTable() string {
+	columns := r.ColumnNames()
+	records := r.Records()
+	for _, record := range records {
+		for i, cell := range record {
+			record[i] = tableCellEscaper.Replace(cell)
+		}
+	}
+
+	widths := make([]int, len(columns))
+	for i, name := range columns {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, record := range records {
+		for i, cell := range record {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var sb strings.Builder
+	writeTableRow(&sb, columns, widths)
+
+	separators := make([]string, len(widths))
+	for i, width := range widths {
+		separators[i] = strings.Repeat("-", width)
+	}
+	sb.WriteString(strings.Join(separators, "-+-"))
+	sb.WriteString("\n")
+
+	for _, record := range records {
+		writeTableRow(&sb, record, widths)
+	}
+	return sb.String()
+}
+
+func writeTableRow(sb *strings.Builder, cells []string, widths []int) {
+	padded := make([]string, len(widths))
+	for i, width := range widths {
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		padded[i] = cell + strings.Repeat(" ", width-utf8.RuneCountInString(cell))
+	}
+	sb.WriteString(strings.TrimRight(strings.Join(padded, " | "), " "))
+	sb.WriteString("\n")
+}
+
+// ExecuteSQLToWriter runs a single SQL query and streams its rows to w in the
+// given format. The HTTP response body is decoded incrementally, so the full
+// result set is never held in memory. Note that the client timeout (see
+// WithTimeout) still bounds the total duration of the export.
+func (s *DatabaseService) ExecuteSQLToWriter(nameOrIdentity, query string, w io.Writer, format ExportFormat) error {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return err
+	}
+	if err := s.client.RequireAuth(); err != nil {
+		return err
+	}
+	if format != ExportJSONLines && format != ExportCSV {
+		return fmt.Errorf("unsupported export format: %d", format)
+	}
+
+	url := fmt.Sprintf("%s/v1/database/%s/sql", s.client.baseURL, nameOrIdentity)
+
+	resp, err := s.client.doTextRequest(http.MethodPost, url, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		if err := streamSQLResult(decoder, w, format); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+// streamSQLResult decodes one {"schema":...,"rows":[...]} object and writes its rows
+func streamSQLResult(decoder *json.Decoder, w io.Writer, format ExportFormat) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	var schema *ProductType
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error reading SQL result: %w", err)
+		}
+
+		switch key {
+		case "schema":
+			var pt ProductType
+			if err := decoder.Decode(&pt); err != nil {
+				return fmt.Errorf("error decoding SQL result schema: %w", err)
+			}
+			schema = &pt
+		case "rows":
+			if schema == nil {
+				return fmt.Errorf("SQL result rows received before schema")
+			}
+			if err := streamSQLRows(decoder, *schema, w, format); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return fmt.Errorf("error reading SQL result: %w", err)
+			}
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+// streamSQLRows writes each row of a rows array as it is decoded
+func streamSQLRows(decoder *json.Decoder, schema ProductType, w io.Writer, format ExportFormat) error {
+	columns := schema.ColumnNames()
+
+	var csvWriter *csv.Writer
+	if format == ExportCSV {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(columns); err != nil {
+			return fmt.Errorf("error writing CSV header: %w", err)
+		}
+	}
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		var row []json.RawMessage
+		if err := decoder.Decode(&row); err != nil {
+			return fmt.Errorf("error decoding SQL row: %w", err)
+		}
+
+		if csvWriter != nil {
+			record, err := formatRecord(schema, row)
+			if err != nil {
+				return err
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV record: %w", err)
+			}
+			continue
+		}
+
+		if err := writeJSONLine(w, columns, row); err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(decoder, ']'); err != nil {
+		return err
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+	return nil
+}
+
+// writeJSONLine writes a row as a JSON object, preserving column order
+func writeJSONLine(w io.Writer, columns []string, row []json.RawMessage) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, cell := range row {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name := columnName(columns, i)
+		key, err := json.Marshal(name)
+		if err != nil {
+			return fmt.Errorf("error encoding column name: %w", err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(cell)
+	}
+	buf.WriteString("}\n")
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing JSON line: %w", err)
+	}
+	return nil
+}
+
+// formatRecord renders the raw cells of a row as strings using the schema
+func formatRecord(schema ProductType, row []json.RawMessage) ([]string, error) {
+	record := make([]string, len(row))
+	for i, raw := range row {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("error decoding SQL cell %d: %w", i, err)
+		}
+
+		var typ AlgebraicType
+		if i < len(schema.Elements) {
+			typ = schema.Elements[i].AlgebraicType
+		}
+		record[i] = formatCell(value, typ)
+	}
+	return record, nil
+}
+
+// formatCell renders a decoded SQL cell as a string.
+// Sum values encoded as [tag, value] are flattened to their payload, and
+// the "none" variant of an option renders as an empty string.
+func formatCell(value any, typ AlgebraicType) string {
+	if sum := typ.GetSum(); sum != nil {
+		if pair, ok := value.([]any); ok && len(pair) == 2 {
+			if tag, ok := sumTag(pair[0]); ok && tag < len(sum.Variants) {
+				variant := sum.Variants[tag]
+				if variant.Name != nil && variant.Name.Value() == "none" {
+					return ""
+				}
+				return formatCell(pair[1], variant.AlgebraicType)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// sumTag extracts a sum variant tag from a decoded JSON value
+func sumTag(value any) (int, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		tag, err := strconv.Atoi(v.String())
+		return tag, err == nil && tag >= 0
+	case float64:
+		return int(v), v >= 0 && v == float64(int(v))
+	default:
+		return 0, false
+	}
+}
+
+// columnName returns the name of column i, falling back to its position
+func columnName(columns []string, i int) string {
+	if i < len(columns) {
+		return columns[i]
+	}
+	return fmt.Sprintf("col_%d", i)
+}
+
+// expectDelim reads the next token and checks it is the given delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("error reading SQL response: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected token in SQL response: expected %q, got %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// EqualUnordered reports whether two results have the same columns and the
+// same rows, in any order. Rows are compared with RowsEqual, and duplicate rows
+// must appear the same number of times in both results.
+func (r SQLResult) EqualUnordered(other SQLResult) bool {
+	if !slices.Equal(r.ColumnNames(), other.ColumnNames()) || len(r.Rows) != len(other.Rows) {
+		return false
+	}
+
+	matched := make([]bool, len(other.Rows))
+	for _, row := range r.Rows {
+		found := false
+		for i, candidate := range other.Rows {
+			if !matched[i] && RowsEqual(sqlRowCells(row), sqlRowCells(candidate)) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sqlRowCells returns the cells of a result row, treating a row that is not an
+// array as a single cell like Records does
+func sqlRowCells(row any) []any {
+	if cells, ok := row.([]any); ok {
+		return cells
+	}
+	return []any{row}
+}
+
+// RowsEqual reports whether two decoded rows hold the same values. Numbers are
+// compared by value whatever their Go type, so a float64 decoded from JSON
+// equals the int written in a test, and arrays such as optional [tag, value]
+// cells and products are compared element by element.
+func RowsEqual(a, b []any) bool {
+	return len(a) == len(b) && cellsEqual(a, b)
+}
+
+func cellsEqual(a, b any) bool {
+	if x, ok := cellNumber(a); ok {
+		y, ok := cellNumber(b)
+		return ok && x == y
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	switch va.Kind() {
+	case reflect.Slice, reflect.Array:
+		if vb.Kind() != reflect.Slice && vb.Kind() != reflect.Array || va.Len() != vb.Len() {
+			return false
+		}
+		for i := range va.Len() {
+			if !cellsEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if vb.Kind() != reflect.Map || va.Type().Key() != vb.Type().Key() || va.Len() != vb.Len() {
+			return false
+		}
+		for _, key := range va.MapKeys() {
+			other := vb.MapIndex(key)
+			if !other.IsValid() || !cellsEqual(va.MapIndex(key).Interface(), other.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// cellNumber converts any Go number, or a json.Number, to a float64
+func cellNumber(value any) (float64, bool) {
+	if number, ok := value.(json.Number); ok {
+		f, err := strconv.ParseFloat(number.String(), 64)
+		return f, err == nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
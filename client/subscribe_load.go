@@ -0,0 +1,217 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TypedSubscription is a subscription to the rows of one table, decoded into T
+// with DecodePositional. It embeds the Subscription handle, so it is ended
+// with SubscriptionManager.Unsubscribe(sub.Subscription).
+type TypedSubscription[T any] struct {
+	*Subscription
+	table string
+}
+
+// queryTablePattern matches the table a query selects from
+var queryTablePattern = regexp.MustCompile("(?is)\\bFROM\\s+([\\w\"`*]+)")
+
+// SubscribeAndLoad subscribes to a single-table query, waits until the server
+// applied it and returns its initial rows decoded into []T together with the
+// live subscription:
+//
+//	msgs, sub, err := client.SubscribeAndLoad[Message](manager, "SELECT * FROM message")
+//
+// Like SubscriptionManager.Replace, it blocks until the subscription is
+// applied, so it must not be called from the read loop goroutine. If the query
+// is already subscribed, the subscription is shared and the snapshot is read
+// from the cache, where it may include rows of other queries on the same
+// table. "SELECT * FROM *" spans every table and is rejected; subscribe to
+// each table separately instead.
+func SubscribeAndLoad[T any](m *SubscriptionManager, query string) ([]T, *TypedSubscription[T], error) {
+	table, err := queryTable(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	state := m.share([]string{query})
+	shared := state != nil
+	var message ClientMessage
+	if !shared {
+		state = m.newQueryState([]string{query}, false)
+		state.keepInitial = true
+		// Resubscribe may change the query ID once m.mu is released
+		message = NewSubscribeMultiMessage(state.queries, m.allocateRequestID(), QueryID{ID: state.queryID})
+	}
+	m.mu.Unlock()
+
+	if !shared {
+		if err := m.sender.SendMessage(message); err != nil {
+			m.forget(state)
+			return nil, nil, err
+		}
+	}
+
+	sub := &TypedSubscription[T]{Subscription: &Subscription{manager: m, state: state}, table: table}
+	if err := m.waitApplied(m.ctx, state); err != nil {
+		m.abandon(sub.Subscription, err)
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	err = state.err
+	var rows []string
+	// Only the caller that subscribed takes the initial rows; a caller sharing
+	// the pending subscription reads the cache below
+	if !shared && state.keepInitial {
+		for _, update := range state.update.Tables {
+			if update.TableName == table {
+				rows = slices.Grow(rows, insertCount(update))
+				for _, entry := range update.Updates {
+					rows = append(rows, entry.Inserts...)
+				}
+			}
+		}
+		state.keepInitial = false
+		state.update = DatabaseUpdate{}
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	if shared {
+		rows = m.cache.Rows(table)
+	}
+
+	loaded := make([]T, 0, len(rows))
+	for _, raw := range rows {
+		var row T
+		if err := DecodePositional([]byte(raw), &row); err != nil {
+			m.Unsubscribe(sub.Subscription)
+			return nil, nil, fmt.Errorf("error decoding %s row: %w", table, err)
+		}
+		loaded = append(loaded, row)
+	}
+	return loaded, sub, nil
+}
+
+// queryTable returns the table a single-table query selects from
+func queryTable(query string) (string, error) {
+	match := queryTablePattern.FindStringSubmatch(query)
+	if match == nil {
+		return "", fmt.Errorf("cannot determine the table of query %q", query)
+	}
+	table := strings.Trim(match[1], "\"`")
+	if table == "*" {
+		return "", fmt.Errorf("query %q subscribes to every table; use SubscribeAndLoad with one query per table", query)
+	}
+	return table, nil
+}
+
+// Table returns the name of the subscribed table
+func (sub *TypedSubscription[T]) Table() string {
+	return sub.table
+}
+
+// OnChange registers a callback invoked with the decoded rows inserted into and
+// deleted from the subscribed table, for as long as the subscription is
+// active; it is dropped once the subscription is released. Changes made by
+// other subscriptions to the same table are included. Rows that fail to
+// decode are skipped.
+func (sub *TypedSubscription[T]) OnChange(callback func(inserted, deleted []T)) {
+	sub.manager.onSubscriptionUpdate(sub.Subscription, func(update DatabaseUpdate) {
+		var inserted, deleted []T
+		for _, table := range update.Tables {
+			if table.TableName != sub.table {
+				continue
+			}
+			for _, entry := range table.Updates {
+				inserted = appendDecoded(inserted, entry.Inserts)
+				deleted = appendDecoded(deleted, entry.Deletes)
+			}
+		}
+		if len(inserted) > 0 || len(deleted) > 0 {
+			callback(inserted, deleted)
+		}
+	})
+}
+
+type subscriptionListener struct {
+	sub      *Subscription
+	callback func(DatabaseUpdate)
+}
+
+// onSubscriptionUpdate registers a listener that receives every change applied
+// to the cache while sub is active, and is dropped once sub is released
+func (m *SubscriptionManager) onSubscriptionUpdate(sub *Subscription, callback func(DatabaseUpdate)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptionListeners = append(m.subscriptionListeners, subscriptionListener{sub: sub, callback: callback})
+	if !m.subscriptionDispatchRegistered {
+		m.subscriptionDispatchRegistered = true
+		m.listeners = append(m.listeners, m.dispatchSubscriptionUpdates)
+	}
+}
+
+// dropSubscriptionListeners removes the listeners of a released subscription;
+// the caller must hold m.mu
+func (m *SubscriptionManager) dropSubscriptionListeners(sub *Subscription) {
+	m.subscriptionListeners = slices.DeleteFunc(m.subscriptionListeners, func(l subscriptionListener) bool {
+		return l.sub == sub
+	})
+}
+
+// dispatchSubscriptionUpdates delivers an update to the listeners of active
+// subscriptions, dropping those whose subscription ended
+func (m *SubscriptionManager) dispatchSubscriptionUpdates(update DatabaseUpdate) {
+	m.mu.Lock()
+	m.subscriptionListeners = slices.DeleteFunc(m.subscriptionListeners, func(l subscriptionListener) bool {
+		return l.sub.released || l.sub.state.refs == 0 || l.sub.state.err != nil
+	})
+	listeners := slices.Clone(m.subscriptionListeners)
+	m.mu.Unlock()
+
+	for _, l := range listeners {
+		l.callback(update)
+	}
+}
+
+// checkRowCounts logs a warning for every table update whose NumRows does not
+// match the rows it holds. Updates built without NumRows, where it is 0, are
+// not checked.
+func (m *SubscriptionManager) checkRowCounts(update DatabaseUpdate) {
+	for _, table := range update.Tables {
+		actual := 0
+		for _, entry := range table.Updates {
+			actual += len(entry.Inserts) + len(entry.Deletes)
+		}
+		if table.NumRows != 0 && int(table.NumRows) != actual {
+			m.logf("spacetimedb: update of table %s declares %d rows but holds %d", table.TableName, table.NumRows, actual)
+		}
+	}
+}
+
+// insertCount returns how many rows a table update inserts, for pre-sizing the
+// decoded rows
+func insertCount(update TableUpdate) int {
+	n := 0
+	for _, entry := range update.Updates {
+		n += len(entry.Inserts)
+	}
+	return n
+}
+
+// appendDecoded appends the rows that decode into T, skipping the others
+func appendDecoded[T any](rows []T, raws []string) []T {
+	rows = slices.Grow(rows, len(raws))
+	for _, raw := range raws {
+		var row T
+		if err := DecodePositional([]byte(raw), &row); err == nil {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sqlIdentifierPattern matches the table and column names accepted in built queries
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// whereOperators are the comparison operators SubscribeWhere accepts
+var whereOperators = []string{"=", "!=", "<>", "<", "<=", ">", ">="}
+
+// SubscribeWhere subscribes with the SubscribeSingle message to the rows of a
+// table whose column compares to value with op, one of =, !=, <>, <, <=, > and
+// >=, such as the messages sent by the client's own identity:
+//
+//	sub, err := manager.SubscribeWhere("message", "sender", "=", myIdentity)
+//
+// The value is written into the query as a SQL literal: an Identity as the hex
+// literal SpacetimeDB compares identities with, a ConnectionID, integer, float
+// or bool as is, and a string quoted with embedded quotes doubled. Other
+// types, and table or column names that are not plain identifiers, are
+// rejected, so the query cannot be altered by the value.
+func (m *SubscriptionManager) SubscribeWhere(table, column, op string, value any) (*Subscription, error) {
+	query, err := whereQuery(table, column, op, value)
+	if err != nil {
+		return nil, err
+	}
+	return m.SubscribeSingle(query)
+}
+
+// SubscribeByKey subscribes to the single row of a table whose primary key
+// column equals pkValue, such as the local player, like SubscribeWhere with
+// the = operator:
+//
+//	sub, err := manager.SubscribeByKey("player", "identity", myIdentity)
+//
+// Floating-point values are rejected, since they cannot be primary keys.
+func (m *SubscriptionManager) SubscribeByKey(table, pkColumn string, pkValue any) (*Subscription, error) {
+	if kind := reflect.ValueOf(pkValue).Kind(); kind == reflect.Float32 || kind == reflect.Float64 {
+		return nil, fmt.Errorf("invalid value for %s.%s: unsupported primary key type %T", table, pkColumn, pkValue)
+	}
+	return m.SubscribeWhere(table, pkColumn, "=", pkValue)
+}
+
+// whereQuery builds the query selecting the rows of a table matching one comparison
+func whereQuery(table, column, op string, value any) (string, error) {
+	for _, name := range []string{table, column} {
+		if !sqlIdentifierPattern.MatchString(name) {
+			return "", fmt.Errorf("invalid SQL identifier %q", name)
+		}
+	}
+	if !slices.Contains(whereOperators, op) {
+		return "", fmt.Errorf("unsupported comparison operator %q", op)
+	}
+	literal, err := sqlLiteral(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid value for %s.%s: %w", table, column, err)
+	}
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s %s %s", table, column, op, literal), nil
+}
+
+// sqlLiteral encodes a value as a SQL literal
+func sqlLiteral(value any) (string, error) {
+	switch v := value.(type) {
+	case Identity:
+		raw, err := v.Bytes()
+		if err != nil {
+			return "", err
+		}
+		return "0x" + hex.EncodeToString(raw), nil
+	case ConnectionID:
+		digits := v.ConnectionID.String()
+		if !isDecimal(digits) {
+			return "", fmt.Errorf("invalid connection ID %q", digits)
+		}
+		return digits, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return "'" + strings.ReplaceAll(rv.String(), "'", "''") + "'", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%v has no SQL literal", f)
+		}
+		return strconv.FormatFloat(f, 'f', -1, rv.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
+
+// isDecimal reports whether s is a non-empty run of decimal digits
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
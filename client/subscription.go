@@ -0,0 +1,878 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSubscriptionCancelled is returned by Wait for a subscription cancelled with
+// CancelPending before the server applied it
+var ErrSubscriptionCancelled = errors.New("subscription cancelled")
+
+// ErrSubscribeTimeout is returned when the server did not apply a subscription
+// within the timeout set with WithSubscribeTimeout
+var ErrSubscribeTimeout = errors.New("timed out waiting for subscription to be applied")
+
+// MessageSender sends client messages to the server.
+// WebSocketConnection implements it.
+type MessageSender interface {
+	SendMessage(message any) error
+}
+
+// SubscriptionManager tracks query subscriptions made over a connection and keeps
+// a TableCache up to date with their rows. It does not read from the connection
+// itself: the application's read loop must pass every parsed server message to
+// HandleMessage. Blocking methods such as Replace must therefore not be called
+// from the read loop goroutine.
+//
+// Subscribing to a query set that is already subscribed shares the existing
+// server-side subscription instead of sending a duplicate request. Shared
+// subscriptions are reference counted, and the unsubscribe request is only
+// sent when the last handle is released.
+type SubscriptionManager struct {
+	mu            sync.Mutex
+	sender        MessageSender
+	cache         *TableCache
+	ctx           context.Context
+	nextQueryID   uint32
+	nextRequestID uint32
+	queries       map[uint32]*queryState
+	listeners     []func(DatabaseUpdate)
+
+	desyncListeners []func(Desync)
+
+	// resubscribing is the Resubscribe waiting for its subscriptions, whose
+	// snapshot also receives the transactions committed in the meantime
+	resubscribing *resync
+
+	// Ordered per-entry handlers and transaction boundary callbacks, run by
+	// dispatchTableUpdates once it is registered as a listener
+	tableHandlers      []orderedTableHandler
+	completeListeners  []func()
+	dispatchRegistered bool
+
+	// Listeners of TypedSubscription.OnChange, dropped once their subscription
+	// is released, run by dispatchSubscriptionUpdates
+	subscriptionListeners          []subscriptionListener
+	subscriptionDispatchRegistered bool
+
+	// InitialSubscription messages by request ID that arrived before they were
+	// waited for, the request IDs announced with ExpectInitialSubscription, and
+	// the callers waiting for them
+	initials         map[uint32]*InitialSubscription
+	expectedInitials map[uint32]struct{}
+	initialWaiters   map[uint32]chan *InitialSubscription
+
+	subscribeTimeout     time.Duration
+	unsubscribeOnTimeout bool
+	logger               *log.Logger
+}
+
+// SubscriptionOption configures a SubscriptionManager
+type SubscriptionOption func(*SubscriptionManager)
+
+// WithSubscribeTimeout bounds how long Wait, Replace, SubscribeAndLoad and
+// WaitForInitialSubscription wait for the server to apply a subscription
+// before failing with ErrSubscribeTimeout. Zero (the default) means no timeout.
+// The subscription stays pending after a timeout and may still be applied,
+// unless WithUnsubscribeOnTimeout is set.
+func WithSubscribeTimeout(timeout time.Duration) SubscriptionOption {
+	return func(m *SubscriptionManager) {
+		m.subscribeTimeout = timeout
+	}
+}
+
+// WithUnsubscribeOnTimeout cancels subscriptions that hit the subscribe
+// timeout as with CancelPending, so rows arriving later are not cached.
+// Subscriptions made with WebSocketConnection.Subscribe and awaited with
+// WaitForInitialSubscription have no query ID and cannot be cancelled.
+func WithUnsubscribeOnTimeout() SubscriptionOption {
+	return func(m *SubscriptionManager) {
+		m.unsubscribeOnTimeout = true
+	}
+}
+
+// WithSubscriptionLogger sets where the manager logs the problems it does not
+// return as errors, such as failed periodic integrity checks. It defaults to the
+// logger of the WebSocketConnection the manager sends through, if one was set
+// with WithLogger, and to the standard logger otherwise.
+func WithSubscriptionLogger(logger *log.Logger) SubscriptionOption {
+	return func(m *SubscriptionManager) {
+		m.logger = logger
+	}
+}
+
+// Subscription is a handle to a set of subscribed queries
+type Subscription struct {
+	manager  *SubscriptionManager
+	state    *queryState
+	released bool
+}
+
+// queryState tracks one server-side query set, identified by its QueryID
+type queryState struct {
+	queryID   uint32
+	queries   []string
+	key       string // identifies identical query sets for sharing
+	single    bool   // subscribed with SubscribeSingle rather than SubscribeMulti
+	cancelled bool   // cancelled before it was applied; its rows never reach the cache
+	refs      int    // subscription handles sharing this query; 0 once unsubscribing
+
+	applied chan struct{} // closed once the server applied or rejected the subscription
+	removed chan struct{} // closed once the server applied the unsubscription
+	err     error
+
+	// quiet suppresses listener notifications for this query's applied and
+	// removed rows, which are then kept in update for coalescing
+	quiet  bool
+	update DatabaseUpdate
+
+	// keepInitial keeps the applied rows in update for SubscribeAndLoad
+	// without suppressing listener notifications
+	keepInitial bool
+
+	// resync is set for the probe subscriptions of a Resync, whose rows
+	// replace the cache instead of being added to it
+	resync *resync
+}
+
+// NewSubscriptionManager creates a subscription manager that sends through sender
+// and stores rows in cache. A new cache is created if cache is nil.
+func NewSubscriptionManager(sender MessageSender, cache *TableCache, opts ...SubscriptionOption) *SubscriptionManager {
+	if cache == nil {
+		cache = NewTableCache()
+	}
+
+	ctx := context.Background()
+	var logger *log.Logger
+	if ws, ok := sender.(*WebSocketConnection); ok {
+		if ws.client != nil {
+			ctx = ws.client.ctx
+		}
+		logger = ws.config.logger
+	}
+
+	m := &SubscriptionManager{
+		sender:           sender,
+		cache:            cache,
+		ctx:              ctx,
+		queries:          make(map[uint32]*queryState),
+		initials:         make(map[uint32]*InitialSubscription),
+		expectedInitials: make(map[uint32]struct{}),
+		initialWaiters:   make(map[uint32]chan *InitialSubscription),
+		logger:           logger,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// logf logs through the logger set with WithSubscriptionLogger, or the standard logger
+func (m *SubscriptionManager) logf(format string, args ...any) {
+	if m.logger != nil {
+		m.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Cache returns the table cache fed by this manager
+func (m *SubscriptionManager) Cache() *TableCache {
+	return m.cache
+}
+
+// OnUpdate registers a callback invoked with every change applied to the cache
+func (m *SubscriptionManager) OnUpdate(callback func(update DatabaseUpdate)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, callback)
+}
+
+// Subscribe subscribes to a set of queries. It returns as soon as the request is
+// sent; use Wait on the returned subscription to block until the server applied it.
+// If the same queries are already subscribed, the existing subscription is shared
+// and no request is sent.
+func (m *SubscriptionManager) Subscribe(queries ...string) (*Subscription, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("at least one query is required")
+	}
+
+	state, _, err := m.subscribe(queries, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{manager: m, state: state}, nil
+}
+
+// SubscribeSingle subscribes to a single query using the SubscribeSingle
+// message. The initial rows arrive in a SubscribeApplied message and are
+// applied to the cache like those of Subscribe.
+func (m *SubscriptionManager) SubscribeSingle(query string) (*Subscription, error) {
+	m.mu.Lock()
+	if state := m.share([]string{query}); state != nil {
+		m.mu.Unlock()
+		return &Subscription{manager: m, state: state}, nil
+	}
+	state := m.newQueryState([]string{query}, false)
+	state.single = true
+	// Resubscribe may change the query ID once m.mu is released
+	message := NewSubscribeSingleMessage(query, m.allocateRequestID(), QueryID{ID: state.queryID})
+	m.mu.Unlock()
+
+	if err := m.sender.SendMessage(message); err != nil {
+		m.forget(state)
+		return nil, err
+	}
+	return &Subscription{manager: m, state: state}, nil
+}
+
+// Unsubscribe ends a subscription. The cache is updated once the server confirms.
+// If other subscriptions share the same queries, only this handle is released
+// and the queries stay subscribed.
+func (m *SubscriptionManager) Unsubscribe(sub *Subscription) error {
+	m.mu.Lock()
+	state := sub.state
+	if _, ok := m.queries[state.queryID]; !ok || sub.released || state.refs == 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("subscription %d is not active", state.queryID)
+	}
+	sub.released = true
+	m.dropSubscriptionListeners(sub)
+	state.refs--
+	if state.refs > 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	message := unsubscribeMessage(state, m.allocateRequestID())
+	m.mu.Unlock()
+
+	return m.sender.SendMessage(message)
+}
+
+// CancelPending cancels a subscription the server has not applied yet. It sends
+// the unsubscribe request for its query ID right away, and Wait on the
+// subscription returns ErrSubscriptionCancelled. If other subscriptions share
+// the same queries, only this handle is released.
+//
+// The server may apply the subscription before the cancel reaches it, in which
+// case the applied message and the cancel cross on the wire. The late rows of a
+// cancelled subscription are not added to the cache and listeners are not
+// notified of them, nor of their removal once the server handles the
+// unsubscribe. Use Unsubscribe for subscriptions that were already applied.
+func (m *SubscriptionManager) CancelPending(sub *Subscription) error {
+	m.mu.Lock()
+	state := sub.state
+	if _, ok := m.queries[state.queryID]; !ok || sub.released || state.refs == 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("subscription %d is not active", state.queryID)
+	}
+	select {
+	case <-state.applied:
+		m.mu.Unlock()
+		return fmt.Errorf("subscription %d was already applied", state.queryID)
+	default:
+	}
+	sub.released = true
+	m.dropSubscriptionListeners(sub)
+	state.refs--
+	if state.refs > 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	state.cancelled = true
+	state.err = ErrSubscriptionCancelled
+	close(state.applied)
+	message := unsubscribeMessage(state, m.allocateRequestID())
+	m.mu.Unlock()
+
+	return m.sender.SendMessage(message)
+}
+
+// Replace switches a subscription to a new set of queries. The new queries are
+// subscribed first and the old ones are only unsubscribed once the new ones were
+// applied, so the cache never loses rows covered by both. Listeners receive a
+// single coalesced update for the transition instead of separate applied and
+// removed updates. If the server rejects the new queries, the old subscription
+// stays active and the error is returned.
+func (m *SubscriptionManager) Replace(sub *Subscription, newQueries []string) error {
+	if len(newQueries) == 0 {
+		return fmt.Errorf("at least one query is required")
+	}
+
+	m.mu.Lock()
+	old := sub.state
+	if _, ok := m.queries[old.queryID]; !ok || sub.released || old.refs == 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("subscription %d is not active", old.queryID)
+	}
+	m.mu.Unlock()
+
+	next, shared, err := m.subscribe(newQueries, true)
+	if err != nil {
+		return err
+	}
+	if err := m.waitApplied(m.ctx, next); err != nil {
+		m.abandon(&Subscription{manager: m, state: next}, err)
+		return err
+	}
+	if next.err != nil {
+		return next.err
+	}
+
+	m.mu.Lock()
+	old.refs--
+	if old.refs > 0 {
+		// Other subscriptions still use the old queries, so their rows stay
+		// cached and only the new rows are reported
+		sub.state = next
+		var listeners []func(DatabaseUpdate)
+		if !shared {
+			next.quiet = false
+			listeners = slices.Clone(m.listeners)
+		}
+		update := next.update
+		m.mu.Unlock()
+
+		notify(listeners, update)
+		return nil
+	}
+	old.quiet = true
+	message := unsubscribeMessage(old, m.allocateRequestID())
+	m.mu.Unlock()
+
+	err = m.sender.SendMessage(message)
+	if err == nil {
+		err = m.wait(old.removed)
+	}
+
+	m.mu.Lock()
+	sub.state = next
+	if !shared {
+		next.quiet = false
+	}
+	coalesced := coalesceUpdates(next.update, old.update)
+	listeners := slices.Clone(m.listeners)
+	m.mu.Unlock()
+
+	notify(listeners, coalesced)
+	if err != nil {
+		return fmt.Errorf("subscribed to new queries but failed to unsubscribe old ones: %w", err)
+	}
+	return nil
+}
+
+// HandleMessage updates subscription state and the cache from a server message.
+// Rows of InitialSubscription, SubscribeApplied and SubscribeMultiApplied, and
+// committed changes from TransactionUpdate and TransactionUpdateLight, are
+// applied to the cache, including those of queries subscribed directly on the
+// connection rather than through the manager. Messages unrelated to
+// subscriptions or table data are ignored.
+func (m *SubscriptionManager) HandleMessage(msg *ServerMessage) {
+	switch msg.Type {
+	case ServerMessageTypeSubscribeMultiApplied:
+		applied, _ := msg.AsSubscribeMultiApplied()
+		m.checkRowCounts(applied.Update)
+		m.handleApplied(applied.QueryID.ID, applied.Update)
+	case ServerMessageTypeUnsubscribeMultiApplied:
+		removed, _ := msg.AsUnsubscribeMultiApplied()
+		m.checkRowCounts(removed.Update)
+		m.handleRemoved(removed.QueryID.ID, removed.Update)
+	case ServerMessageTypeSubscribeApplied:
+		applied, _ := msg.AsSubscribeApplied()
+		m.checkRowCounts(applied.Rows.DatabaseUpdate())
+		m.handleApplied(applied.QueryID.ID, applied.Rows.DatabaseUpdate())
+	case ServerMessageTypeUnsubscribeApplied:
+		removed, _ := msg.AsUnsubscribeApplied()
+		m.checkRowCounts(removed.Rows.DatabaseUpdate())
+		m.handleRemoved(removed.QueryID.ID, removed.Rows.DatabaseUpdate())
+	case ServerMessageTypeInitialSubscription:
+		initial, _ := msg.AsInitialSubscription()
+		m.checkRowCounts(initial.DatabaseUpdate)
+		m.apply(initial.DatabaseUpdate)
+		m.deliverInitial(initial)
+	case ServerMessageTypeSubscriptionError:
+		subErr, _ := msg.AsSubscriptionError()
+		m.handleError(subErr)
+	case ServerMessageTypeTransactionUpdate:
+		tx, _ := msg.AsTransactionUpdate()
+		if tx.Status.Committed != nil {
+			m.checkRowCounts(*tx.Status.Committed)
+			m.applyCommitted(*tx.Status.Committed)
+		}
+	case ServerMessageTypeTransactionUpdateLight:
+		// Sent instead of TransactionUpdate to callers that opted out of full
+		// updates; the update is always committed
+		light, _ := msg.AsTransactionUpdateLight()
+		m.checkRowCounts(light.Update)
+		m.applyCommitted(light.Update)
+	}
+}
+
+// WaitForInitialSubscription blocks until the InitialSubscription answering the
+// Subscribe request with the given request ID was handled, and returns it. Use it
+// with the request ID returned by WebSocketConnection.Subscribe, so several
+// subscribes in flight each resolve to their own initial rows. A message that
+// arrives before the wait starts is only kept if its request ID was announced
+// with ExpectInitialSubscription; otherwise it is applied to the cache but not
+// kept, so unclaimed messages don't pile up.
+func (m *SubscriptionManager) WaitForInitialSubscription(ctx context.Context, requestID uint32) (*InitialSubscription, error) {
+	m.mu.Lock()
+	if initial, ok := m.initials[requestID]; ok {
+		delete(m.initials, requestID)
+		m.mu.Unlock()
+		return initial, nil
+	}
+	if _, ok := m.initialWaiters[requestID]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("already waiting for initial subscription of request %d", requestID)
+	}
+	waiter := make(chan *InitialSubscription, 1)
+	m.initialWaiters[requestID] = waiter
+	m.mu.Unlock()
+
+	if m.subscribeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, m.subscribeTimeout,
+			fmt.Errorf("%w: request %d after %s", ErrSubscribeTimeout, requestID, m.subscribeTimeout))
+		defer cancel()
+	}
+
+	select {
+	case initial := <-waiter:
+		return initial, nil
+	case <-ctx.Done():
+		m.mu.Lock()
+		delete(m.initialWaiters, requestID)
+		// A late message must not answer a later wait reusing the request ID
+		delete(m.expectedInitials, requestID)
+		m.mu.Unlock()
+		// The message may have been delivered while giving up
+		select {
+		case initial := <-waiter:
+			return initial, nil
+		default:
+		}
+		return nil, context.Cause(ctx)
+	}
+}
+
+// ActiveQueries returns the sorted, distinct queries of all subscriptions that
+// have not been released, including those still waiting to be applied
+func (m *SubscriptionManager) ActiveQueries() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var queries []string
+	for _, state := range m.queries {
+		if state.refs == 0 {
+			continue
+		}
+		for _, query := range state.queries {
+			if _, ok := seen[query]; !ok {
+				seen[query] = struct{}{}
+				queries = append(queries, query)
+			}
+		}
+	}
+	slices.Sort(queries)
+	return queries
+}
+
+// Queries returns the queries of the subscription
+func (sub *Subscription) Queries() []string {
+	sub.manager.mu.Lock()
+	defer sub.manager.mu.Unlock()
+	return slices.Clone(sub.state.queries)
+}
+
+// QueryID returns the server-side query ID currently used by the subscription
+func (sub *Subscription) QueryID() QueryID {
+	sub.manager.mu.Lock()
+	defer sub.manager.mu.Unlock()
+	return QueryID{ID: sub.state.queryID}
+}
+
+// Wait blocks until the server applied or rejected the subscription and returns
+// the subscription error, if any. It fails with ErrSubscribeTimeout if the
+// manager has a subscribe timeout and the server does not answer in time.
+func (sub *Subscription) Wait(ctx context.Context) error {
+	m := sub.manager
+	m.mu.Lock()
+	state := sub.state
+	m.mu.Unlock()
+
+	if err := m.waitApplied(ctx, state); err != nil {
+		if errors.Is(err, ErrSubscribeTimeout) && m.unsubscribeOnTimeout {
+			m.CancelPending(sub)
+		}
+		return err
+	}
+	return state.err
+}
+
+// waitApplied blocks until the server applied or rejected a subscription, ctx
+// ends or the subscribe timeout passes
+func (m *SubscriptionManager) waitApplied(ctx context.Context, state *queryState) error {
+	var timeout <-chan time.Time
+	if m.subscribeTimeout > 0 {
+		timer := time.NewTimer(m.subscribeTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-state.applied:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	case <-timeout:
+		m.mu.Lock()
+		queryID := state.queryID
+		m.mu.Unlock()
+		return fmt.Errorf("%w: query %d after %s", ErrSubscribeTimeout, queryID, m.subscribeTimeout)
+	}
+}
+
+// abandon gives up on a subscription handle whose wait failed with err. It is
+// cancelled if it timed out and the manager unsubscribes on timeout, and
+// otherwise only released, so a late applied message still caches its rows.
+func (m *SubscriptionManager) abandon(sub *Subscription, err error) {
+	if errors.Is(err, ErrSubscribeTimeout) && m.unsubscribeOnTimeout && m.CancelPending(sub) == nil {
+		return
+	}
+	m.release(sub.state)
+}
+
+// subscribe shares an active subscription to the same queries, or allocates a
+// query ID and sends a SubscribeMulti request. It reports whether the
+// subscription was shared.
+func (m *SubscriptionManager) subscribe(queries []string, quiet bool) (*queryState, bool, error) {
+	m.mu.Lock()
+	if state := m.share(queries); state != nil {
+		m.mu.Unlock()
+		return state, true, nil
+	}
+	state := m.newQueryState(queries, quiet)
+	// Resubscribe may change the query ID once m.mu is released
+	message := NewSubscribeMultiMessage(state.queries, m.allocateRequestID(), QueryID{ID: state.queryID})
+	m.mu.Unlock()
+
+	if err := m.sender.SendMessage(message); err != nil {
+		m.forget(state)
+		return nil, false, err
+	}
+	return state, false, nil
+}
+
+// share returns an active query state for the same queries with its reference
+// count incremented, or nil if there is none; the caller must hold m.mu
+func (m *SubscriptionManager) share(queries []string) *queryState {
+	key := queryKey(queries)
+	for _, state := range m.queries {
+		if state.key == key && state.refs > 0 && state.err == nil {
+			state.refs++
+			return state
+		}
+	}
+	return nil
+}
+
+// release drops a reference taken by subscribe without sending an unsubscribe
+func (m *SubscriptionManager) release(state *queryState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state.refs > 0 {
+		state.refs--
+	}
+}
+
+// newQueryState allocates a query ID and registers its state; the caller must hold m.mu
+func (m *SubscriptionManager) newQueryState(queries []string, quiet bool) *queryState {
+	m.nextQueryID++
+	state := &queryState{
+		queryID: m.nextQueryID,
+		queries: slices.Clone(queries),
+		key:     queryKey(queries),
+		refs:    1,
+		applied: make(chan struct{}),
+		removed: make(chan struct{}),
+		quiet:   quiet,
+	}
+	m.queries[state.queryID] = state
+	return state
+}
+
+// queryKey identifies a query set; sets with the same queries in the same order share a key
+func queryKey(queries []string) string {
+	return strings.Join(queries, "\x00")
+}
+
+// forget unregisters a query whose subscribe request could not be sent
+func (m *SubscriptionManager) forget(state *queryState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queries, state.queryID)
+}
+
+// unsubscribeMessage builds the unsubscribe request matching how a query was subscribed
+func unsubscribeMessage(state *queryState, requestID uint32) ClientMessage {
+	if state.single {
+		return NewUnsubscribeMessage(requestID, QueryID{ID: state.queryID})
+	}
+	return NewUnsubscribeMultiMessage(requestID, QueryID{ID: state.queryID})
+}
+
+// requestIDSource is implemented by senders that assign request IDs, such as
+// WebSocketConnection
+type requestIDSource interface {
+	NextRequestID() uint32
+}
+
+// allocateRequestID returns the next request ID, taken from the sender if it
+// assigns them so IDs stay unique across the connection; the caller must hold m.mu
+func (m *SubscriptionManager) allocateRequestID() uint32 {
+	if source, ok := m.sender.(requestIDSource); ok {
+		return source.NextRequestID()
+	}
+	m.nextRequestID++
+	return m.nextRequestID
+}
+
+// wait blocks until done is closed or the manager's context ends
+func (m *SubscriptionManager) wait(done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	}
+}
+
+func (m *SubscriptionManager) handleApplied(queryID uint32, update DatabaseUpdate) {
+	m.mu.Lock()
+	state, ok := m.queries[queryID]
+	if !ok {
+		m.mu.Unlock()
+		// Queries subscribed directly on the connection still carry rows
+		m.apply(update)
+		return
+	}
+	if state.cancelled {
+		// Crossed with CancelPending; applied was closed when cancelling
+		m.mu.Unlock()
+		return
+	}
+	if state.resync != nil {
+		// A migrated subscription may have been applied on the old session
+		if !isClosed(state.applied) {
+			close(state.applied)
+		}
+		if state.keepInitial {
+			state.update = update
+		}
+		m.applyProbe(state, update, nil)
+		return
+	}
+
+	m.cache.Apply(update)
+	var listeners []func(DatabaseUpdate)
+	if state.quiet {
+		state.update = update
+	} else {
+		listeners = slices.Clone(m.listeners)
+	}
+	if state.keepInitial {
+		state.update = update
+	}
+	close(state.applied)
+	m.mu.Unlock()
+
+	notify(listeners, update)
+}
+
+func (m *SubscriptionManager) handleRemoved(queryID uint32, update DatabaseUpdate) {
+	m.mu.Lock()
+	state, ok := m.queries[queryID]
+	if !ok {
+		m.mu.Unlock()
+		// Queries subscribed directly on the connection still carry rows
+		m.apply(update)
+		return
+	}
+	delete(m.queries, queryID)
+	if state.cancelled {
+		// The rows of a cancelled subscription were never cached
+		close(state.removed)
+		m.mu.Unlock()
+		return
+	}
+
+	m.cache.Apply(update)
+	var listeners []func(DatabaseUpdate)
+	if state.quiet {
+		state.update = update
+	} else {
+		listeners = slices.Clone(m.listeners)
+	}
+	close(state.removed)
+	m.mu.Unlock()
+
+	notify(listeners, update)
+}
+
+func (m *SubscriptionManager) handleError(subErr *SubscriptionError) {
+	if subErr.QueryID == nil {
+		return
+	}
+
+	m.mu.Lock()
+	state, ok := m.queries[*subErr.QueryID]
+	if ok && state.resync != nil && !state.cancelled {
+		delete(m.queries, state.queryID)
+		state.err = fmt.Errorf("subscription error: %s", subErr.Error)
+		state.cancelled = true
+		if !isClosed(state.applied) {
+			close(state.applied)
+		}
+		close(state.removed)
+		m.applyProbe(state, DatabaseUpdate{}, state.err) // releases m.mu
+		return
+	}
+	defer m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	delete(m.queries, state.queryID)
+	if state.cancelled {
+		close(state.removed)
+		return
+	}
+
+	state.err = fmt.Errorf("subscription error: %s", subErr.Error)
+	select {
+	case <-state.applied:
+		// The error ended an already applied subscription
+		close(state.removed)
+	default:
+		close(state.applied)
+	}
+}
+
+// ExpectInitialSubscription announces that the InitialSubscription answering
+// the request ID will be waited for with WaitForInitialSubscription, so it is
+// kept if it arrives before the wait starts. Call it before sending the
+// Subscribe request, for example with the ID from WebSocketConnection.NextRequestID.
+func (m *SubscriptionManager) ExpectInitialSubscription(requestID uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectedInitials[requestID] = struct{}{}
+}
+
+// deliverInitial hands an InitialSubscription to the caller waiting for its
+// request ID, or keeps it for a later WaitForInitialSubscription if expected
+func (m *SubscriptionManager) deliverInitial(initial *InitialSubscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, expected := m.expectedInitials[initial.RequestID]
+	delete(m.expectedInitials, initial.RequestID)
+	if waiter, ok := m.initialWaiters[initial.RequestID]; ok {
+		delete(m.initialWaiters, initial.RequestID)
+		waiter <- initial
+		return
+	}
+	if expected {
+		m.initials[initial.RequestID] = initial
+	}
+}
+
+// apply applies an update to the cache and notifies listeners
+func (m *SubscriptionManager) apply(update DatabaseUpdate) {
+	m.mu.Lock()
+	m.cache.Apply(update)
+	listeners := slices.Clone(m.listeners)
+	m.mu.Unlock()
+
+	notify(listeners, update)
+}
+
+// applyCommitted applies a committed transaction like apply, and also to the
+// snapshot of a pending Resubscribe. The new session only sends the changes of
+// subscriptions it already applied, so they belong to the snapshot, whose rows
+// for those subscriptions would otherwise be stale by the time it is reconciled.
+func (m *SubscriptionManager) applyCommitted(update DatabaseUpdate) {
+	m.mu.Lock()
+	if sync := m.resubscribing; sync != nil {
+		sync.snapshot = append(sync.snapshot, update.Tables...)
+	}
+	m.cache.Apply(update)
+	listeners := slices.Clone(m.listeners)
+	m.mu.Unlock()
+
+	notify(listeners, update)
+}
+
+func notify(listeners []func(DatabaseUpdate), update DatabaseUpdate) {
+	if len(update.Tables) == 0 {
+		return
+	}
+	for _, listener := range listeners {
+		listener(update)
+	}
+}
+
+// coalesceUpdates merges several updates into one per table, dropping rows that
+// are both inserted and deleted
+func coalesceUpdates(updates ...DatabaseUpdate) DatabaseUpdate {
+	type rowCounts struct {
+		inserts map[string]int
+		deletes map[string]int
+	}
+
+	var order []string
+	tables := make(map[string]*rowCounts)
+	for _, update := range updates {
+		for _, table := range update.Tables {
+			counts, ok := tables[table.TableName]
+			if !ok {
+				counts = &rowCounts{inserts: make(map[string]int), deletes: make(map[string]int)}
+				tables[table.TableName] = counts
+				order = append(order, table.TableName)
+			}
+			for _, entry := range table.Updates {
+				for _, row := range entry.Inserts {
+					counts.inserts[row]++
+				}
+				for _, row := range entry.Deletes {
+					counts.deletes[row]++
+				}
+			}
+		}
+	}
+
+	var result DatabaseUpdate
+	for _, name := range order {
+		counts := tables[name]
+		entry := diffRows(counts.deletes, counts.inserts)
+		if len(entry.Inserts) == 0 && len(entry.Deletes) == 0 {
+			continue
+		}
+		result.Tables = append(result.Tables, TableUpdate{
+			TableName: name,
+			NumRows:   uint32(len(entry.Inserts) + len(entry.Deletes)),
+			Updates:   []TableUpdateEntry{entry},
+		})
+	}
+	return result
+}
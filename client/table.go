@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"sync"
+)
+
+// TableHandle gives typed, read-only access to the cached rows of one table.
+// Rows are decoded from the TableCache with DecodePositional on access, and a
+// primary key index is rebuilt lazily whenever the cache changed. It is safe
+// for concurrent use.
+type TableHandle[Row any] struct {
+	cache      *TableCache
+	name       string
+	primaryKey int // column index of the primary key, -1 if the table has none
+
+	mu         sync.Mutex
+	generation uint64
+	indexed    bool
+	index      map[string]string // encoded primary key -> row
+}
+
+// NewTableHandle creates a typed handle on a cached table. primaryKey is the
+// column index of the table's primary key, or -1 if it has none.
+func NewTableHandle[Row any](cache *TableCache, name string, primaryKey int) *TableHandle[Row] {
+	return &TableHandle[Row]{
+		cache:      cache,
+		name:       name,
+		primaryKey: primaryKey,
+	}
+}
+
+// Name returns the table name
+func (t *TableHandle[Row]) Name() string {
+	return t.name
+}
+
+// Count returns the number of cached rows
+func (t *TableHandle[Row]) Count() int {
+	return t.cache.Count(t.name)
+}
+
+// Iter iterates over the cached rows. Rows that fail to decode are skipped.
+func (t *TableHandle[Row]) Iter() iter.Seq[Row] {
+	return func(yield func(Row) bool) {
+		for _, raw := range t.cache.Rows(t.name) {
+			var row Row
+			if err := DecodePositional([]byte(raw), &row); err != nil {
+				continue
+			}
+			if !yield(row) {
+				return
+			}
+		}
+	}
+}
+
+// Find returns the first cached row matching the predicate
+func (t *TableHandle[Row]) Find(match func(row Row) bool) (Row, bool) {
+	for row := range t.Iter() {
+		if match(row) {
+			return row, true
+		}
+	}
+	var zero Row
+	return zero, false
+}
+
+// FindByPrimaryKey looks up a row by its primary key value, given as the Go
+// type of the key column. It reports false if no row matches or the table has
+// no primary key.
+func (t *TableHandle[Row]) FindByPrimaryKey(key any) (Row, bool) {
+	var zero Row
+	if t.primaryKey < 0 {
+		return zero, false
+	}
+
+	encoded, err := EncodePositional(key)
+	if err != nil {
+		return zero, false
+	}
+	keyString, err := compactJSON(encoded)
+	if err != nil {
+		return zero, false
+	}
+
+	raw, ok := t.lookup(keyString)
+	if !ok {
+		return zero, false
+	}
+
+	var row Row
+	if err := DecodePositional([]byte(raw), &row); err != nil {
+		return zero, false
+	}
+	return row, true
+}
+
+// lookup finds a raw row in the primary key index, rebuilding it if stale
+func (t *TableHandle[Row]) lookup(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rows, generation := t.cache.snapshot(t.name)
+	if !t.indexed || generation != t.generation {
+		t.index = make(map[string]string, len(rows))
+		for _, raw := range rows {
+			elements, err := splitArray([]byte(raw), "$")
+			if err != nil || t.primaryKey >= len(elements) {
+				continue
+			}
+			rowKey, err := compactJSON(elements[t.primaryKey])
+			if err != nil {
+				continue
+			}
+			t.index[rowKey] = raw
+		}
+		t.generation = generation
+		t.indexed = true
+	}
+
+	raw, ok := t.index[key]
+	return raw, ok
+}
+
+// compactJSON normalizes JSON so equal values compare equal as strings
+func compactJSON(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return "", fmt.Errorf("error compacting JSON: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,95 @@
+package client
+
+import "slices"
+
+// UpdateOrder selects the order in which OnTableUpdate delivers the rows of
+// an update
+type UpdateOrder int
+
+const (
+	// WireOrder delivers tables and their entries in the order the server sent
+	// them. Within an entry, deletes apply before inserts.
+	WireOrder UpdateOrder = iota
+	// DeletesFirst delivers every delete of the update, across all tables,
+	// before any insert, so a row moved from one table to another is never
+	// seen in both
+	DeletesFirst
+)
+
+// TableUpdateHandler receives one entry of a table update
+type TableUpdateHandler func(table string, entry TableUpdateEntry)
+
+type orderedTableHandler struct {
+	order   UpdateOrder
+	handler TableUpdateHandler
+}
+
+// OnTableUpdate registers a handler called with each entry of every change
+// applied to the cache, in the given order. With DeletesFirst each entry holds
+// only deletes or only inserts. Handlers run on the goroutine calling
+// HandleMessage, one update at a time, after the cache was updated.
+func (m *SubscriptionManager) OnTableUpdate(order UpdateOrder, handler TableUpdateHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tableHandlers = append(m.tableHandlers, orderedTableHandler{order: order, handler: handler})
+	m.registerDispatch()
+}
+
+// OnTransactionComplete registers a callback invoked once every OnTableUpdate
+// handler received an update, marking the end of a transaction or of the rows
+// a subscription added or removed. Updates that change no cached rows have no
+// boundary. Use it to batch work such as rendering.
+func (m *SubscriptionManager) OnTransactionComplete(callback func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completeListeners = append(m.completeListeners, callback)
+	m.registerDispatch()
+}
+
+// registerDispatch adds dispatchTableUpdates to the listeners on first use; the
+// caller must hold m.mu
+func (m *SubscriptionManager) registerDispatch() {
+	if m.dispatchRegistered {
+		return
+	}
+	m.dispatchRegistered = true
+	m.listeners = append(m.listeners, m.dispatchTableUpdates)
+}
+
+// dispatchTableUpdates delivers an update to the table handlers and then
+// signals the transaction boundary
+func (m *SubscriptionManager) dispatchTableUpdates(update DatabaseUpdate) {
+	m.mu.Lock()
+	handlers := slices.Clone(m.tableHandlers)
+	completeListeners := slices.Clone(m.completeListeners)
+	m.mu.Unlock()
+
+	for _, h := range handlers {
+		switch h.order {
+		case DeletesFirst:
+			forEachEntry(update, func(table string, entry TableUpdateEntry) {
+				if len(entry.Deletes) > 0 {
+					h.handler(table, TableUpdateEntry{Deletes: entry.Deletes})
+				}
+			})
+			forEachEntry(update, func(table string, entry TableUpdateEntry) {
+				if len(entry.Inserts) > 0 {
+					h.handler(table, TableUpdateEntry{Inserts: entry.Inserts})
+				}
+			})
+		default:
+			forEachEntry(update, h.handler)
+		}
+	}
+	for _, callback := range completeListeners {
+		callback()
+	}
+}
+
+func forEachEntry(update DatabaseUpdate, fn func(table string, entry TableUpdateEntry)) {
+	for _, table := range update.Tables {
+		for _, entry := range table.Updates {
+			fn(table.TableName, entry)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// conditionWatcher waits for an inserted row of a table matching a predicate
+type conditionWatcher struct {
+	table   string
+	match   func(row json.RawMessage) bool
+	matched chan struct{}
+}
+
+// WaitForCondition blocks until a row inserted into table matches pred. Inserts
+// are taken from InitialSubscription, SubscribeApplied, SubscribeMultiApplied,
+// TransactionUpdate and TransactionUpdateLight messages delivered through
+// ReceiveMessage, ReceiveServerMessage or MessagesOfType, so the application's
+// read loop must be running in another goroutine. Only rows arriving after the
+// call are seen: to wait for rows of a new subscription, call it before
+// subscribing, or check the table cache first.
+func (ws *WebSocketConnection) WaitForCondition(ctx context.Context, table string, pred func(row json.RawMessage) bool) error {
+	watcher := &conditionWatcher{
+		table:   table,
+		match:   pred,
+		matched: make(chan struct{}),
+	}
+
+	ws.pendingMu.Lock()
+	if ws.watchers == nil {
+		ws.watchers = make(map[*conditionWatcher]struct{})
+	}
+	ws.watchers[watcher] = struct{}{}
+	ws.pendingMu.Unlock()
+
+	defer func() {
+		ws.pendingMu.Lock()
+		delete(ws.watchers, watcher)
+		ws.pendingMu.Unlock()
+	}()
+
+	select {
+	case <-watcher.matched:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for a matching %s row: %w", table, ctx.Err())
+	}
+}
+
+func (ws *WebSocketConnection) hasWatchers() bool {
+	ws.pendingMu.Lock()
+	defer ws.pendingMu.Unlock()
+	return len(ws.watchers) > 0
+}
+
+// checkConditions runs the predicates of the condition watchers against the
+// rows a message inserts
+func (ws *WebSocketConnection) checkConditions(msg *ServerMessage) {
+	update, ok := insertedRows(msg)
+	if !ok {
+		return
+	}
+
+	ws.pendingMu.Lock()
+	watchers := make([]*conditionWatcher, 0, len(ws.watchers))
+	for watcher := range ws.watchers {
+		watchers = append(watchers, watcher)
+	}
+	ws.pendingMu.Unlock()
+
+	for _, watcher := range watchers {
+		if !matchesInsert(update, watcher) {
+			continue
+		}
+		ws.pendingMu.Lock()
+		if _, ok := ws.watchers[watcher]; ok {
+			delete(ws.watchers, watcher)
+			close(watcher.matched)
+		}
+		ws.pendingMu.Unlock()
+	}
+}
+
+// matchesInsert reports whether an update inserts a row the watcher is waiting for
+func matchesInsert(update DatabaseUpdate, watcher *conditionWatcher) bool {
+	for _, table := range update.Tables {
+		if table.TableName != watcher.table {
+			continue
+		}
+		for _, entry := range table.Updates {
+			for _, row := range entry.Inserts {
+				if watcher.match(json.RawMessage(row)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// insertedRows returns the table rows carried by a message
+func insertedRows(msg *ServerMessage) (DatabaseUpdate, bool) {
+	switch msg.Type {
+	case ServerMessageTypeInitialSubscription:
+		initial, _ := msg.AsInitialSubscription()
+		return initial.DatabaseUpdate, true
+	case ServerMessageTypeSubscribeApplied:
+		applied, _ := msg.AsSubscribeApplied()
+		return applied.Rows.DatabaseUpdate(), true
+	case ServerMessageTypeSubscribeMultiApplied:
+		applied, _ := msg.AsSubscribeMultiApplied()
+		return applied.Update, true
+	case ServerMessageTypeTransactionUpdate:
+		tx, _ := msg.AsTransactionUpdate()
+		if tx.Status.Committed == nil {
+			return DatabaseUpdate{}, false
+		}
+		return *tx.Status.Committed, true
+	case ServerMessageTypeTransactionUpdateLight:
+		light, _ := msg.AsTransactionUpdateLight()
+		return light.Update, true
+	default:
+		return DatabaseUpdate{}, false
+	}
+}
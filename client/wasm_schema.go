@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// describeModuleExport is the function SpacetimeDB modules export to describe
+// their schema. The host calls it with a BytesSink handle, and the module
+// writes its BSATN-encoded RawModuleDef to the sink through the
+// bytes_sink_write import of the spacetime_10.0 host module.
+const describeModuleExport = "__describe_module__"
+
+var (
+	// ErrNotWasmModule is returned by ExtractSchema for data that is not a
+	// WebAssembly binary
+	ErrNotWasmModule = errors.New("not a WebAssembly module")
+
+	// ErrNotSpacetimeModule is returned by ExtractSchema for WebAssembly modules
+	// that don't export __describe_module__
+	ErrNotSpacetimeModule = errors.New("WebAssembly module does not export " + describeModuleExport)
+
+	// ErrWasmRuntimeRequired is returned by ExtractSchema for valid SpacetimeDB
+	// modules, whose schema can only be read by running them
+	ErrWasmRuntimeRequired = errors.New("extracting a schema requires running the module in a WebAssembly runtime")
+)
+
+// ExtractSchema is meant to read the schema of a compiled SpacetimeDB module
+// without a running server. The schema is not stored in the binary: it is
+// produced by calling the module's __describe_module__(sink u32) export, which
+// writes a BSATN-encoded RawModuleDef to the sink through the host's
+// bytes_sink_write(sink u32, buffer *u8, len *usize) import. This package has
+// no WebAssembly runtime, so ExtractSchema only checks that wasm is a
+// SpacetimeDB module and then returns ErrWasmRuntimeRequired.
+//
+// To generate bindings offline, write the schema to a file with
+// "spacetime describe --json" once and pass it to spacetimedb-codegen -schema.
+func ExtractSchema(wasm []byte) (RawModuleDef, error) {
+	exports, err := wasmExports(wasm)
+	if err != nil {
+		return RawModuleDef{}, err
+	}
+	for _, name := range exports {
+		if name == describeModuleExport {
+			return RawModuleDef{}, ErrWasmRuntimeRequired
+		}
+	}
+	return RawModuleDef{}, ErrNotSpacetimeModule
+}
+
+// wasmExportSection is the ID of the export section of a WebAssembly binary
+const wasmExportSection = 7
+
+// wasmExports returns the names of the exports of a WebAssembly binary
+func wasmExports(wasm []byte) ([]string, error) {
+	if len(wasm) < 8 || !bytes.Equal(wasm[:4], []byte("\x00asm")) {
+		return nil, ErrNotWasmModule
+	}
+	if !bytes.Equal(wasm[4:8], []byte{1, 0, 0, 0}) {
+		return nil, fmt.Errorf("%w: unsupported version %v", ErrNotWasmModule, wasm[4:8])
+	}
+
+	r := wasmReader{data: wasm[8:]}
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		section, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if id == wasmExportSection {
+			return parseWasmExports(section)
+		}
+	}
+	return nil, nil
+}
+
+func parseWasmExports(section []byte) ([]string, error) {
+	r := wasmReader{data: section}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for range count {
+		name, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		// Export kind and index
+		if _, err := r.byte(); err != nil {
+			return nil, err
+		}
+		if _, err := r.u32(); err != nil {
+			return nil, err
+		}
+		names = append(names, string(name))
+	}
+	return names, nil
+}
+
+// wasmReader reads the primitives of the WebAssembly binary format
+type wasmReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *wasmReader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.done() {
+		return 0, fmt.Errorf("%w: unexpected end of data", ErrNotWasmModule)
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// u32 reads an unsigned LEB128 integer
+func (r *wasmReader) u32() (uint32, error) {
+	var value uint32
+	for shift := 0; shift < 35; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: integer too long", ErrNotWasmModule)
+}
+
+// bytes reads a length-prefixed byte vector
+func (r *wasmReader) bytes() ([]byte, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrNotWasmModule)
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
@@ -1,25 +1,360 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrWriteTimeout is returned when a WebSocket write does not complete within
+// the configured write timeout. The connection is unusable afterwards and
+// should be closed or reconnected.
+var ErrWriteTimeout = errors.New("WebSocket write timed out")
+
+// ErrRedirectNotWebSocket is returned when the WebSocket handshake is
+// redirected to a location that does not accept WebSocket connections
+var ErrRedirectNotWebSocket = errors.New("WebSocket handshake redirected to a non-WebSocket endpoint")
+
+// HandshakeError is returned when the server answers the WebSocket handshake
+// with an HTTP status instead of upgrading the connection
+type HandshakeError struct {
+	StatusCode int
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("WebSocket handshake failed. Status: %d", e.StatusCode)
+}
+
+// IsUnauthorized returns true if the server rejected the handshake's credentials
+func (e *HandshakeError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// defaultHandshakeTimeout bounds connecting unless WithHandshakeTimeout is set
+const defaultHandshakeTimeout = 45 * time.Second
+
+// maxWebSocketRedirects bounds how many handshake redirects are followed
+const maxWebSocketRedirects = 5
+
+// Delays between automatic reconnect attempts, doubling from the initial delay
+const (
+	reconnectInitialDelay = 500 * time.Millisecond
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// closeMessageTimeout bounds how long GracefulClose waits to send the close message
+const closeMessageTimeout = time.Second
+
 // WebSocket connection methods
 
 // WebSocketConnection represents a WebSocket connection to a database
 type WebSocketConnection struct {
-	conn   *websocket.Conn
-	client *Client
-	dbName string
+	// conn is the underlying connection, which changes on reconnect. It is
+	// never guarded by writeMu, so closing does not wait for a stalled write.
+	conn     atomic.Pointer[websocket.Conn]
+	client   *Client
+	service  *DatabaseService
+	dbName   string
+	protocol string
+	config   webSocketConfig
+
+	// closed is set once Close is called, which stops reconnecting
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// writeMu serializes writes, as the underlying connection supports only one concurrent writer
+	writeMu sync.Mutex
+
+	// requestID is the last request ID handed out by NextRequestID
+	requestID atomic.Uint32
+
+	// pending holds the waiters of awaited reducer calls by request ID,
+	// namedCalls the callers of CallAndWait, and watchers the callers of
+	// WaitForCondition
+	pendingMu  sync.Mutex
+	pending    map[uint32]*pendingCall
+	namedCalls []*namedCallWaiter
+	watchers   map[*conditionWatcher]struct{}
+
+	// recorder receives a copy of every frame after RecordTo
+	recorder recorder
+
+	// limiter applies WithReducerRateLimit, nil without a limit
+	limiter *tokenBucket
+
+	// connectionID is the session ID from the IdentityToken of the current
+	// connection, nil until it arrives
+	connectionID atomic.Pointer[ConnectionID]
+
+	// adoptedToken is the server-assigned token WithAnonymousConnect adopted,
+	// which reconnects then send
+	adoptedToken atomic.Pointer[string]
+}
+
+// WebSocketOption is a functional option for configuring a WebSocket connection
+type WebSocketOption func(*webSocketConfig)
+
+type webSocketConfig struct {
+	writeTimeout        time.Duration
+	handshakeTimeout    time.Duration
+	redirectAuth        bool
+	skipUnknownMessages bool
+	netDial             func(ctx context.Context, network, addr string) (net.Conn, error)
+	reconnectHandler    ReconnectHandler
+	shouldReconnect     ShouldReconnect
+	lightUpdates        bool
+	tokenStore          *AuthToken
+	anonymous           bool
+	token               string
+	reducerRate         int
+	reducerBurst        int
+	rateLimitWait       bool
+	replaceInvalidUTF8  bool
+	reducerFlags        uint8
+	latencyHook         func(ReducerLatency)
+	logger              *log.Logger
+	uncheckedQueries    bool
+}
+
+// ReconnectHandler is called before each automatic reconnect attempt with the
+// attempt number (starting at 1), the error that ended the connection or failed
+// the previous attempt, and the delay before the attempt. Returning false aborts
+// reconnecting, and the read that noticed the failure returns lastErr.
+type ReconnectHandler func(attempt int, lastErr error, nextDelay time.Duration) bool
+
+// WithWriteTimeout bounds how long a single message write may block, for example
+// when a slow peer stops reading. Zero (the default) means no timeout.
+func WithWriteTimeout(timeout time.Duration) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.writeTimeout = timeout
+	}
+}
+
+// WithHandshakeTimeout bounds how long connecting may take, from dialing to the
+// end of the WebSocket handshake, so startup probes and health checks fail fast
+// when the server is unreachable or hangs. It also applies to every reconnect
+// attempt and to each redirect followed. Zero (the default) means 45 seconds.
+func WithHandshakeTimeout(timeout time.Duration) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.handshakeTimeout = timeout
+	}
+}
+
+// WithRedirectAuthorization keeps sending the Authorization header when the
+// handshake is redirected to another host. By default, like net/http, the header
+// is only sent to the host the connection was opened to.
+func WithRedirectAuthorization() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.redirectAuth = true
+	}
+}
+
+// WithDefaultReducerFlags sets the flags sent with reducer calls that don't
+// choose their own, such as CallReducerNoSuccessNotify for clients that only
+// care about failures. Flags passed to SendCallReducerWithFlags take precedence
+// over the default. Awaited calls (CallReducerAwait, CallReducerBatchAwait and
+// CallAndWait) always request CallReducerFullUpdate, as they wait for the update.
+func WithDefaultReducerFlags(flags uint8) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.reducerFlags = flags
+	}
+}
+
+// WithReplaceInvalidUTF8 makes SendCallReducerArgs replace invalid UTF-8 bytes
+// in string arguments with U+FFFD instead of failing with ErrInvalidUTF8
+func WithReplaceInvalidUTF8() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.replaceInvalidUTF8 = true
+	}
+}
+
+// WithUncheckedSubscriptionQueries sends subscription queries without checking
+// that they are SELECT statements, for query forms the server supports but this
+// client does not know yet. Invalid queries then fail with a SubscriptionError
+// from the server instead of ErrInvalidSubscriptionQuery.
+func WithUncheckedSubscriptionQueries() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.uncheckedQueries = true
+	}
+}
+
+// WithLogger sets where the connection logs the problems it does not return as
+// errors, such as skipped messages, a token that could not be saved or a
+// recording that stopped. The standard logger is used by default.
+func WithLogger(logger *log.Logger) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.logger = logger
+	}
+}
+
+// WithSkipUnknownMessages makes ReceiveMessage and ReceiveServerMessage log and
+// skip frames that are not valid JSON or not a known server message, instead of
+// returning an error. This keeps older clients working when the server adds new
+// message types. Connection errors are still returned.
+func WithSkipUnknownMessages() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.skipUnknownMessages = true
+	}
+}
+
+// WithWebSocketNetDialer makes ConnectWebSocket open the underlying network
+// connection with dial instead of a TCP dial to the base URL host, for example to
+// reach a server on a unix domain socket or to inject an in-memory connection in
+// tests. The base URL still determines the request path, Host header and scheme.
+// For https base URLs the TLS handshake runs over the returned connection using
+// the client's TLS config, so dial should return a plain connection.
+func WithWebSocketNetDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.netDial = dial
+	}
+}
+
+// ShouldReconnect decides whether a read failure triggers an automatic reconnect,
+// and whether a failed redial is retried. closeCode is the code of the close
+// frame the server sent, such as websocket.CloseGoingAway, or 0 if the
+// connection failed without one; err is the read error, which wraps a
+// *websocket.CloseError when there was a close frame, or the dial error, which is
+// a *HandshakeError when the server refused the handshake.
+type ShouldReconnect func(closeCode int, err error) bool
+
+// DefaultShouldReconnect is the ShouldReconnect used unless WithShouldReconnect
+// sets another. It reconnects on transient failures, such as a server going away
+// or a dropped network connection, and stops on policy violations, for example a
+// revoked token, on protocol errors and on redials refused with 401 or 403, which
+// reconnecting with the same credentials and client would only repeat.
+func DefaultShouldReconnect(closeCode int, err error) bool {
+	switch closeCode {
+	case websocket.ClosePolicyViolation, websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData:
+		return false
+	}
+	var handshakeErr *HandshakeError
+	if errors.As(err, &handshakeErr) && handshakeErr.IsUnauthorized() {
+		return false
+	}
+	return true
+}
+
+// WithShouldReconnect replaces DefaultShouldReconnect in deciding which read
+// failures WithReconnectHandler reconnects after, and which failed redials it
+// retries. When it returns false, the read returns the error without calling the
+// reconnect handler again. It has no effect without a reconnect handler.
+func WithShouldReconnect(shouldReconnect ShouldReconnect) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.shouldReconnect = shouldReconnect
+	}
+}
+
+// WithReconnectHandler makes the connection reconnect automatically when a read
+// fails, with exponential backoff from 500ms up to 30s, calling handler before
+// every attempt. Use it to show reconnect progress and to give up by returning
+// false. Reads block while reconnecting and continue on the new connection once
+// it succeeds. Subscriptions are not restored: the server sends a new
+// IdentityToken, and the application must subscribe again, or call
+// SubscriptionManager.Resubscribe to restore the manager's subscriptions.
+// Failures rejected by DefaultShouldReconnect, or by the predicate set with
+// WithShouldReconnect, such as a policy violation, end the read without a
+// reconnect.
+func WithReconnectHandler(handler ReconnectHandler) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.reconnectHandler = handler
+	}
+}
+
+// WithLightUpdates opts the connection into light mode. Transactions caused by
+// other clients then arrive as TransactionUpdateLight messages, which carry only
+// the request ID and the table changes, instead of full TransactionUpdate
+// messages. This saves the reducer call, caller identity, timestamp and energy
+// metadata on every update, which adds up for games receiving many updates per
+// second, but that metadata is then unavailable for other clients' calls. The
+// connection's own reducer calls still get a full TransactionUpdate.
+// SubscriptionManager and WaitForCondition handle both message types.
+func WithLightUpdates() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.lightUpdates = true
+	}
+}
+
+// WithAutoSaveToken saves the token of the IdentityToken message the server
+// sends after connecting to store, and sets it as the client's token and
+// identity. A client that connected without a token thereby keeps the identity
+// the server generated for it, without calling Identity.Create. The token is
+// saved when the message is received through ReceiveMessage,
+// ReceiveServerMessage or MessagesOfType, including after a reconnect.
+func WithAutoSaveToken(store *AuthToken) WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.tokenStore = store
+	}
+}
+
+// WithAnonymousConnect dials without an Authorization header, even if the client
+// has a token or token provider, so the server assigns a new identity. The token
+// and identity of the IdentityToken message the server sends first are adopted
+// by the connection, and saved to the store of WithAutoSaveToken if one is set,
+// once the message is received through ReceiveMessage, ReceiveServerMessage or
+// MessagesOfType. The client only takes them over if it has no token or token
+// provider of its own, so its HTTP calls keep their identity. Reconnects after
+// that send the adopted token, keeping the identity; reconnects before it
+// connect anonymously again.
+func WithAnonymousConnect() WebSocketOption {
+	return func(c *webSocketConfig) {
+		c.anonymous = true
+	}
 }
 
 // ConnectWebSocket establishes a WebSocket connection to a database
-func (s *DatabaseService) ConnectWebSocket(nameOrIdentity string, protocol string) (*WebSocketConnection, error) {
+func (s *DatabaseService) ConnectWebSocket(nameOrIdentity string, protocol string, options ...WebSocketOption) (*WebSocketConnection, error) {
+	if err := validateDatabaseName(nameOrIdentity); err != nil {
+		return nil, err
+	}
+
+	var config webSocketConfig
+	for _, option := range options {
+		option(&config)
+	}
+
+	// Validate protocol
+	if protocol == "" {
+		protocol = SatsProtocol
+	}
+	if protocol != SatsProtocol && protocol != BsatnProtocol {
+		return nil, fmt.Errorf("invalid protocol: %s", protocol)
+	}
+
+	conn, err := s.dialWebSocket(nameOrIdentity, protocol, config)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &WebSocketConnection{
+		client:   s.client,
+		service:  s,
+		dbName:   nameOrIdentity,
+		protocol: protocol,
+		config:   config,
+		done:     make(chan struct{}),
+	}
+	ws.conn.Store(conn)
+	if config.reducerRate > 0 {
+		ws.limiter = newTokenBucket(config.reducerRate, config.reducerBurst)
+	}
+	return ws, nil
+}
+
+// dialWebSocket opens the WebSocket connection to a database's subscribe endpoint
+func (s *DatabaseService) dialWebSocket(nameOrIdentity, protocol string, config webSocketConfig) (*websocket.Conn, error) {
 	// Parse the base URL to extract just the host
 	baseURL, err := url.Parse(s.client.baseURL)
 	if err != nil {
@@ -37,13 +372,8 @@ func (s *DatabaseService) ConnectWebSocket(nameOrIdentity string, protocol strin
 		Host:   baseURL.Host,
 		Path:   fmt.Sprintf("/v1/database/%s/subscribe", nameOrIdentity),
 	}
-
-	// Validate protocol
-	if protocol == "" {
-		protocol = SatsProtocol
-	}
-	if protocol != SatsProtocol && protocol != BsatnProtocol {
-		return nil, fmt.Errorf("invalid protocol: %s", protocol)
+	if config.lightUpdates {
+		wsURL.RawQuery = "light=true"
 	}
 
 	// Set up required headers for SpacetimeDB WebSocket connection
@@ -52,50 +382,122 @@ func (s *DatabaseService) ConnectWebSocket(nameOrIdentity string, protocol strin
 		"Sec-WebSocket-Version":  []string{"13"},
 	}
 
-	if s.client.token != "" {
-		headers["Authorization"] = []string{fmt.Sprintf("Bearer %s", s.client.token)}
+	if config.token != "" {
+		headers["Authorization"] = []string{fmt.Sprintf("Bearer %s", config.token)}
+	} else if !config.anonymous {
+		token, err := s.client.currentToken(s.client.ctx)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			headers["Authorization"] = []string{fmt.Sprintf("Bearer %s", token)}
+		}
+	}
+	if s.client.userAgent != "" {
+		headers["User-Agent"] = []string{s.client.userAgent}
 	}
 
+	handshakeTimeout := config.handshakeTimeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = defaultHandshakeTimeout
+	}
 	dialer := websocket.Dialer{
-		HandshakeTimeout: 45 * time.Second,
+		HandshakeTimeout: handshakeTimeout,
 		Subprotocols:     []string{protocol},
+		TLSClientConfig:  s.client.tlsConfig,
+		NetDialContext:   config.netDial,
 	}
 
-	conn, resp, err := dialer.Dial(wsURL.String(), headers)
-	if err != nil {
-		if resp != nil {
-			return nil, fmt.Errorf("WebSocket handshake failed. Status: %d", resp.StatusCode)
+	target := &wsURL
+	for redirects := 0; ; redirects++ {
+		conn, resp, err := dialer.Dial(target.String(), headers)
+		if err == nil {
+			return conn, nil
+		}
+		if resp == nil {
+			return nil, fmt.Errorf("error connecting to WebSocket: %w", err)
+		}
+		resp.Body.Close()
+
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			if redirects > 0 {
+				return nil, fmt.Errorf("%w: %s answered with status %d", ErrRedirectNotWebSocket, target.Redacted(), resp.StatusCode)
+			}
+			return nil, &HandshakeError{StatusCode: resp.StatusCode}
+		}
+		if redirects == maxWebSocketRedirects {
+			return nil, fmt.Errorf("WebSocket handshake redirected more than %d times", maxWebSocketRedirects)
+		}
+		if target, err = redirectTarget(target, location); err != nil {
+			return nil, err
+		}
+		// Don't hand the token to a host it wasn't meant for
+		if !config.redirectAuth && !strings.EqualFold(target.Host, wsURL.Host) {
+			headers.Del("Authorization")
 		}
-		return nil, fmt.Errorf("error connecting to WebSocket: %w", err)
 	}
+}
 
-	return &WebSocketConnection{
-		conn:   conn,
-		client: s.client,
-		dbName: nameOrIdentity,
-	}, nil
+// isRedirect reports whether a handshake status asks to retry at the Location
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectTarget resolves a handshake redirect against the URL that was dialed,
+// mapping http and https locations to ws and wss. A redirect from wss to ws is
+// refused, since the bearer token would then be sent in the clear.
+func redirectTarget(from *url.URL, location string) (*url.URL, error) {
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket redirect location %q: %w", location, err)
+	}
+	target := from.ResolveReference(ref)
+	switch target.Scheme {
+	case "http":
+		target.Scheme = "ws"
+	case "https":
+		target.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRedirectNotWebSocket, target.Redacted())
+	}
+	if from.Scheme == "wss" && target.Scheme == "ws" {
+		return nil, fmt.Errorf("refusing WebSocket redirect from wss to %s", target.Redacted())
+	}
+	return target, nil
 }
 
 // Close closes the WebSocket connection
 func (ws *WebSocketConnection) Close() error {
-	if ws.conn != nil {
-		return ws.conn.Close()
+	ws.markClosed()
+	if conn := ws.currentConn(); conn != nil {
+		return conn.Close()
 	}
 	return nil
 }
 
 func (ws *WebSocketConnection) GracefulClose() error {
-	if ws.conn != nil {
-		// Send a close message with normal closure code (1000)
-		err := ws.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		if err != nil {
+	ws.markClosed()
+	if conn := ws.currentConn(); conn != nil {
+		// Send a close message with normal closure code (1000). WriteControl is
+		// safe alongside message writes, so a stalled write only delays it until
+		// the deadline.
+		message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeMessageTimeout)); err != nil {
+			conn.Close()
 			return fmt.Errorf("error sending close message: %w", err)
 		}
 
 		// Wait for the peer to respond
 		time.Sleep(100 * time.Millisecond)
 
-		err = ws.conn.Close()
+		err := conn.Close()
 		if err != nil {
 			return fmt.Errorf("error closing websocket connection: %w", err)
 		}
@@ -103,113 +505,542 @@ func (ws *WebSocketConnection) GracefulClose() error {
 	return nil
 }
 
+// markClosed records that the connection was closed on purpose, so it is not reconnected
+func (ws *WebSocketConnection) markClosed() {
+	ws.closed.Store(true)
+	ws.closeOnce.Do(func() {
+		if ws.done != nil {
+			close(ws.done)
+		}
+	})
+}
+
+// currentConn returns the underlying connection, which changes on reconnect
+func (ws *WebSocketConnection) currentConn() *websocket.Conn {
+	return ws.conn.Load()
+}
+
 // SendSubscribe sends a subscription request
 func (ws *WebSocketConnection) SendSubscribe(queries []string, requestID uint32) error {
-	subscribeMsg := ClientMessage{
-		Subscribe: &Subscribe{
-			QueryStrings: queries,
-			RequestID:    requestID,
-		},
-	}
-	return ws.SendMessage(subscribeMsg)
+	return ws.SendMessage(NewSubscribeMessage(queries, requestID))
 }
 
-// SendCallReducer sends a reducer call request
+// SendCallReducer sends a reducer call request with the connection's default
+// flags, see WithDefaultReducerFlags
 func (ws *WebSocketConnection) SendCallReducer(reducerName string, args string, requestID uint32) error {
-	callMsg := ClientMessage{
-		CallReducer: &CallReducer{
-			Reducer:   reducerName,
-			Args:      args,
-			RequestID: requestID,
-			Flags:     0,
-		},
+	return ws.SendCallReducerWithFlags(reducerName, args, requestID, ws.config.reducerFlags)
+}
+
+// SendCallReducerWithFlags sends a reducer call request with the given flags,
+// overriding the connection's default
+func (ws *WebSocketConnection) SendCallReducerWithFlags(reducerName string, args string, requestID uint32, flags uint8) error {
+	return ws.SendMessage(NewCallReducerMessage(reducerName, args, requestID, flags))
+}
+
+// SendCallReducerArgs sends a reducer call request with typed arguments,
+// encoding them with MarshalReducerArgs. Strings that are not valid UTF-8 fail
+// with ErrInvalidUTF8 unless the connection was opened WithReplaceInvalidUTF8.
+func (ws *WebSocketConnection) SendCallReducerArgs(reducerName string, args []any, requestID uint32) error {
+	encoded, err := ws.encodeReducerArgs(reducerName, args)
+	if err != nil {
+		return err
+	}
+	return ws.SendCallReducer(reducerName, encoded, requestID)
+}
+
+// DryRunReducer encodes and validates a reducer call exactly as CallReducerArgs
+// would and returns the JSON frame that would be sent, without sending it. Use
+// it to preview a call or to assert payloads in tests. The frame carries
+// request ID 0 and the connection's default flags; no request ID is used up,
+// the rate limit is not applied and the connection need not be open.
+func (ws *WebSocketConnection) DryRunReducer(reducerName string, args ...any) (string, error) {
+	encoded, err := ws.encodeReducerArgs(reducerName, args)
+	if err != nil {
+		return "", err
+	}
+	data, _, err := encodeClientMessage(NewCallReducerMessage(reducerName, encoded, 0, ws.config.reducerFlags))
+	if err != nil {
+		return "", err
 	}
-	return ws.SendMessage(callMsg)
+	return string(data), nil
 }
 
-func (ws *WebSocketConnection) SendOneOffQuery(messageID []byte, queryString string) error {
-	queryMsg := ClientMessage{
-		OneOffQuery: &OneOffQuery{
-			MessageID:   messageID,
-			QueryString: queryString,
-		},
+// encodeReducerArgs encodes typed reducer arguments with the connection's options
+func (ws *WebSocketConnection) encodeReducerArgs(reducerName string, args []any) (string, error) {
+	encoded, err := positionalEncoder{replaceInvalidUTF8: ws.config.replaceInvalidUTF8}.marshalReducerArgs(args)
+	if err != nil {
+		return "", fmt.Errorf("reducer %s: %w", reducerName, err)
 	}
-	return ws.SendMessage(queryMsg)
+	return encoded, nil
 }
 
-func (ws *WebSocketConnection) SendSubscribeSingle(query string, requestID uint32, queryID QueryID) error {
-	subscribeMsg := ClientMessage{
-		SubscribeSingle: &SubscribeSingle{
-			Query:     query,
-			RequestID: requestID,
-			QueryID:   queryID,
-		},
+// SendOneOffQuery sends a one-off query and returns its message ID, which the
+// OneOffQueryResponse carries back. A nil messageID generates one with NewMessageID.
+func (ws *WebSocketConnection) SendOneOffQuery(messageID []byte, queryString string) ([]byte, error) {
+	msg := NewOneOffQueryMessage(messageID, queryString)
+	if err := ws.SendMessage(msg); err != nil {
+		return nil, err
 	}
-	return ws.SendMessage(subscribeMsg)
+	return msg.OneOffQuery.MessageID, nil
+}
+
+func (ws *WebSocketConnection) SendSubscribeSingle(query string, requestID uint32, queryID QueryID) error {
+	return ws.SendMessage(NewSubscribeSingleMessage(query, requestID, queryID))
 }
 
 func (ws *WebSocketConnection) SendSubscribeMulti(queries []string, requestID uint32, queryID QueryID) error {
-	subscribeMsg := ClientMessage{
-		SubscribeMulti: &SubscribeMulti{
-			QueryStrings: queries,
-			RequestID:    requestID,
-			QueryID:      queryID,
-		},
-	}
-	return ws.SendMessage(subscribeMsg)
+	return ws.SendMessage(NewSubscribeMultiMessage(queries, requestID, queryID))
 }
 
 func (ws *WebSocketConnection) SendUnsubscribe(requestID uint32, queryID QueryID) error {
-	unsubscribeMsg := ClientMessage{
-		Unsubscribe: &Unsubscribe{
-			RequestID: requestID,
-			QueryID:   queryID,
-		},
-	}
-	return ws.SendMessage(unsubscribeMsg)
+	return ws.SendMessage(NewUnsubscribeMessage(requestID, queryID))
 }
 
 func (ws *WebSocketConnection) SendUnsubscribeMulti(requestID uint32, queryID QueryID) error {
-	unsubscribeMsg := ClientMessage{
-		UnsubscribeMulti: &UnsubscribeMulti{
-			RequestID: requestID,
-			QueryID:   queryID,
-		},
-	}
-	return ws.SendMessage(unsubscribeMsg)
+	return ws.SendMessage(NewUnsubscribeMultiMessage(requestID, queryID))
 }
 
 func (ws *WebSocketConnection) SendSubscribeAll(requestID uint32) error {
-	subscribeMsg := ClientMessage{
-		Subscribe: &Subscribe{
-			RequestID:    requestID,
-			QueryStrings: []string{"SELECT * FROM *"},
-		},
-	}
-	return ws.SendMessage(subscribeMsg)
+	return ws.SendMessage(NewSubscribeMessage([]string{"SELECT * FROM *"}, requestID))
+}
+
+// NextRequestID returns a request ID that is unique on this connection.
+// IDs start at 1, so 0 never collides with an automatically assigned ID.
+func (ws *WebSocketConnection) NextRequestID() uint32 {
+	return ws.requestID.Add(1)
+}
+
+// Variants of the Send helpers that assign the request ID automatically and
+// return it, so responses can be correlated with their requests
+
+// Subscribe sends a subscription request and returns its request ID
+func (ws *WebSocketConnection) Subscribe(queries []string) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendSubscribe(queries, requestID)
+}
+
+// SubscribeAll subscribes to all tables and returns the request ID
+func (ws *WebSocketConnection) SubscribeAll() (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendSubscribeAll(requestID)
+}
+
+// SubscribeSingle subscribes to a single query and returns the request ID
+func (ws *WebSocketConnection) SubscribeSingle(query string, queryID QueryID) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendSubscribeSingle(query, requestID, queryID)
+}
+
+// SubscribeMulti subscribes to multiple queries and returns the request ID
+func (ws *WebSocketConnection) SubscribeMulti(queries []string, queryID QueryID) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendSubscribeMulti(queries, requestID, queryID)
+}
+
+// Unsubscribe ends a single-query subscription and returns the request ID
+func (ws *WebSocketConnection) Unsubscribe(queryID QueryID) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendUnsubscribe(requestID, queryID)
+}
+
+// UnsubscribeMulti ends a multi-query subscription and returns the request ID
+func (ws *WebSocketConnection) UnsubscribeMulti(queryID QueryID) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendUnsubscribeMulti(requestID, queryID)
+}
+
+// CallReducer calls a reducer with JSON-encoded arguments and returns the request ID
+func (ws *WebSocketConnection) CallReducer(reducerName string, args string) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendCallReducer(reducerName, args, requestID)
+}
+
+// CallReducerArgs calls a reducer with typed arguments and returns the request ID
+func (ws *WebSocketConnection) CallReducerArgs(reducerName string, args []any) (uint32, error) {
+	requestID := ws.NextRequestID()
+	return requestID, ws.SendCallReducerArgs(reducerName, args, requestID)
 }
 
 // Basic websocket send and receive
 
-// SendMessage sends a message through the WebSocket connection
+// SendMessage sends a message through the WebSocket connection.
+// A ClientMessage is validated first, so a message with zero or several
+// variants set fails client-side instead of confusing the server.
 func (ws *WebSocketConnection) SendMessage(message any) error {
-	if ws.conn == nil {
+	if ws.currentConn() == nil {
 		return fmt.Errorf("WebSocket connection not established")
 	}
-	return ws.conn.WriteJSON(message)
+
+	if err := ws.checkSubscriptionQueries(message); err != nil {
+		return err
+	}
+	data, isReducerCall, err := encodeClientMessage(message)
+	if err != nil {
+		return err
+	}
+	if isReducerCall {
+		if err := ws.waitForReducerSlot(); err != nil {
+			return err
+		}
+	}
+	return ws.write(func(conn *websocket.Conn) error {
+		return conn.WriteMessage(websocket.TextMessage, data)
+	})
+}
+
+// encodeClientMessage validates a message and encodes the frame that sends it,
+// reporting whether it calls a reducer
+func encodeClientMessage(message any) ([]byte, bool, error) {
+	var isReducerCall bool
+	switch msg := message.(type) {
+	case ClientMessage:
+		if err := msg.Validate(); err != nil {
+			return nil, false, err
+		}
+		isReducerCall = msg.CallReducer != nil
+	case *ClientMessage:
+		if msg == nil {
+			return nil, false, fmt.Errorf("client message is nil")
+		}
+		if err := msg.Validate(); err != nil {
+			return nil, false, err
+		}
+		isReducerCall = msg.CallReducer != nil
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, false, fmt.Errorf("error encoding message: %w", err)
+	}
+	return data, isReducerCall, nil
+}
+
+// checkSubscriptionQueries returns ErrInvalidSubscriptionQuery if a subscribe
+// message has a query that is not a SELECT, unless WithUncheckedSubscriptionQueries
+// is set
+func (ws *WebSocketConnection) checkSubscriptionQueries(message any) error {
+	if ws.config.uncheckedQueries {
+		return nil
+	}
+	var queries []string
+	switch msg := message.(type) {
+	case ClientMessage:
+		queries = msg.subscriptionQueries()
+	case *ClientMessage:
+		if msg != nil {
+			queries = msg.subscriptionQueries()
+		}
+	}
+	for _, query := range queries {
+		if err := validateSubscriptionQuery(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write runs a write on the current connection while holding the write lock,
+// applying the configured write timeout
+func (ws *WebSocketConnection) write(writeFn func(*websocket.Conn) error) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	conn := ws.currentConn()
+	if ws.config.writeTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(ws.config.writeTimeout)); err != nil {
+			return fmt.Errorf("error setting write deadline: %w", err)
+		}
+	}
+
+	err := writeFn(conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w after %s: %v", ErrWriteTimeout, ws.config.writeTimeout, err)
+	}
+	return err
 }
 
 // ReceiveMessage receives a message from the WebSocket connection
 func (ws *WebSocketConnection) ReceiveMessage() (any, error) {
-	if ws.conn == nil {
+	for {
+		data, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		var message any
+		if err := json.Unmarshal(data, &message); err != nil {
+			if ws.config.skipUnknownMessages {
+				ws.logSkippedMessage(err)
+				continue
+			}
+			return nil, fmt.Errorf("error reading message: %w", err)
+		}
+		if ws.config.skipUnknownMessages || ws.hasObservers() || ws.parsesIdentityToken(data) {
+			parsed, err := ParseServerMessage(data)
+			if err != nil && ws.config.skipUnknownMessages {
+				ws.logSkippedMessage(err)
+				continue
+			}
+			if err == nil {
+				ws.observe(parsed)
+			}
+		}
+		return message, nil
+	}
+}
+
+// ReceiveServerMessage receives and parses the next server message
+func (ws *WebSocketConnection) ReceiveServerMessage() (*ServerMessage, error) {
+	message, _, err := ws.ReceiveServerMessageRaw()
+	return message, err
+}
+
+// ReceiveServerMessageRaw receives the next server message and returns it both
+// parsed and as the exact frame bytes, for logging or forwarding without
+// re-serializing. The bytes are owned by the caller: every frame is read into
+// a fresh buffer that the connection does not reuse or modify.
+func (ws *WebSocketConnection) ReceiveServerMessageRaw() (*ServerMessage, []byte, error) {
+	for {
+		data, err := ws.readFrame()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		message, err := ParseServerMessage(data)
+		if err != nil {
+			if ws.config.skipUnknownMessages {
+				ws.logSkippedMessage(err)
+				continue
+			}
+			return nil, nil, fmt.Errorf("error parsing server message: %w", err)
+		}
+		ws.observe(message)
+		return message, data, nil
+	}
+}
+
+// MessagesOfType starts a goroutine that reads from the connection and forwards
+// only messages of the given types, or all messages if none are given. Other
+// messages are consumed and dropped after reading just their tag, without
+// decoding the payload. Frames that cannot be parsed are logged and skipped.
+// Awaited reducer calls and WaitForCondition are still served from dropped messages.
+//
+// The channel is closed when ctx is done or the connection fails. The reader
+// owns the connection, so ReceiveMessage must not be called concurrently; after
+// ctx is done the goroutine exits once its current read returns.
+func (ws *WebSocketConnection) MessagesOfType(ctx context.Context, types ...ServerMessageType) <-chan *ServerMessage {
+	wanted := make(map[ServerMessageType]bool, len(types))
+	for _, msgType := range types {
+		wanted[msgType] = true
+	}
+
+	messages := make(chan *ServerMessage)
+	go func() {
+		defer close(messages)
+		for ctx.Err() == nil {
+			data, err := ws.readFrame()
+			if err != nil {
+				return
+			}
+
+			msgType, ok := peekServerMessageType(data)
+			if !ok {
+				ws.logSkippedMessage(fmt.Errorf("%w in frame of %d bytes", ErrUnknownMessageType, len(data)))
+				continue
+			}
+			forward := len(wanted) == 0 || wanted[msgType]
+			if !forward && !ws.hasObservers() && !ws.parsesIdentityToken(data) {
+				continue
+			}
+
+			message, err := ParseServerMessage(data)
+			if err != nil {
+				ws.logSkippedMessage(err)
+				continue
+			}
+			ws.observe(message)
+			if !forward {
+				continue
+			}
+
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return messages
+}
+
+// observe resolves awaited reducer calls and condition watchers from a received
+// message, and saves identity tokens for WithAutoSaveToken and
+// WithAnonymousConnect
+func (ws *WebSocketConnection) observe(msg *ServerMessage) {
+	ws.resolvePendingCall(msg)
+	ws.checkConditions(msg)
+	ws.recordConnectionID(msg)
+	ws.saveIdentityToken(msg)
+}
+
+// parsesIdentityToken reports whether a frame is an IdentityToken that must be
+// parsed, to record the connection ID or to save the token for WithAutoSaveToken
+// or WithAnonymousConnect
+func (ws *WebSocketConnection) parsesIdentityToken(data []byte) bool {
+	if ws.config.tokenStore == nil && !ws.config.anonymous && ws.connectionID.Load() != nil {
+		return false
+	}
+	msgType, ok := peekServerMessageType(data)
+	return ok && msgType == ServerMessageTypeIdentityToken
+}
+
+// ConnectionID returns the ID the server assigned to this session in its
+// IdentityToken message. It is only known once that message, the first one
+// the server sends, was received through ReceiveMessage, ReceiveServerMessage
+// or MessagesOfType; until then ok is false. A reconnect starts a new session
+// with a new ID. Compare it with TransactionUpdate.CallerConnectionID to tell
+// this connection's transactions from those of other clients.
+func (ws *WebSocketConnection) ConnectionID() (id ConnectionID, ok bool) {
+	if current := ws.connectionID.Load(); current != nil {
+		return *current, true
+	}
+	return ConnectionID{}, false
+}
+
+// recordConnectionID keeps the connection ID of an IdentityToken message
+func (ws *WebSocketConnection) recordConnectionID(msg *ServerMessage) {
+	if token, ok := msg.AsIdentityToken(); ok {
+		id := token.ConnectionID
+		ws.connectionID.Store(&id)
+	}
+}
+
+// saveIdentityToken stores the token of an IdentityToken message and adopts it
+// and the identity, for WithAnonymousConnect on the connection and, if the
+// client has no token of its own, on the client
+func (ws *WebSocketConnection) saveIdentityToken(msg *ServerMessage) {
+	if ws.config.tokenStore == nil && !ws.config.anonymous {
+		return
+	}
+	token, ok := msg.AsIdentityToken()
+	if !ok || token.Token == "" {
+		return
+	}
+
+	if ws.config.tokenStore != nil {
+		if err := ws.config.tokenStore.SaveToken(token.Token); err != nil {
+			ws.logf("spacetimedb: could not save identity token: %v", err)
+		}
+	}
+	if ws.config.anonymous {
+		ws.adoptedToken.Store(&token.Token)
+	}
+	if ws.client != nil && (!ws.config.anonymous || !ws.client.IsAuthenticated()) {
+		ws.client.SetToken(token.Token)
+		ws.client.SetIdentity(token.Identity.Hex())
+	}
+}
+
+// hasObservers reports whether received messages must be parsed for awaited
+// reducer calls or condition watchers
+func (ws *WebSocketConnection) hasObservers() bool {
+	return ws.hasPendingCalls() || ws.hasWatchers()
+}
+
+// readFrame reads the next data frame from the connection, reconnecting first
+// if the connection failed and a reconnect handler is configured
+func (ws *WebSocketConnection) readFrame() ([]byte, error) {
+	if ws.currentConn() == nil {
 		return nil, fmt.Errorf("WebSocket connection not established")
 	}
 
-	var message any
-	err := ws.conn.ReadJSON(&message)
-	if err != nil {
-		return nil, fmt.Errorf("error reading message: %w", err)
+	for {
+		_, data, err := ws.currentConn().ReadMessage()
+		if err == nil {
+			ws.recorder.record(data, ws.logf)
+			return data, nil
+		}
+		err = fmt.Errorf("error reading message: %w", err)
+		if ws.config.reconnectHandler == nil || ws.closed.Load() || !ws.shouldReconnect(err) {
+			return nil, err
+		}
+		if reconnectErr := ws.reconnect(err); reconnectErr != nil {
+			return nil, reconnectErr
+		}
+	}
+}
+
+// shouldReconnect applies the configured ShouldReconnect to a read or dial error
+func (ws *WebSocketConnection) shouldReconnect(err error) bool {
+	shouldReconnect := ws.config.shouldReconnect
+	if shouldReconnect == nil {
+		shouldReconnect = DefaultShouldReconnect
 	}
+	closeCode := 0
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		closeCode = closeErr.Code
+	}
+	return shouldReconnect(closeCode, err)
+}
+
+// reconnect dials the database again with exponential backoff until it
+// succeeds, the reconnect handler gives up, ShouldReconnect rejects a failed
+// dial or the connection is closed
+func (ws *WebSocketConnection) reconnect(lastErr error) error {
+	delay := reconnectInitialDelay
+	for attempt := 1; ; attempt++ {
+		if !ws.config.reconnectHandler(attempt, lastErr, delay) {
+			return lastErr
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ws.done:
+			timer.Stop()
+			return lastErr
+		case <-ws.client.ctx.Done():
+			timer.Stop()
+			return lastErr
+		}
+
+		config := ws.config
+		if adopted := ws.adoptedToken.Load(); adopted != nil {
+			config.token = *adopted
+		}
+		conn, err := ws.service.dialWebSocket(ws.dbName, ws.protocol, config)
+		if err != nil {
+			if !ws.shouldReconnect(err) {
+				return err
+			}
+			lastErr = err
+			delay = min(delay*2, reconnectMaxDelay)
+			continue
+		}
+
+		// Closing the old connection fails any write still blocked on it
+		ws.conn.Swap(conn).Close()
+		ws.connectionID.Store(nil)
+
+		// Close may have been called while dialing
+		if ws.closed.Load() {
+			conn.Close()
+			return lastErr
+		}
+		return nil
+	}
+}
+
+// logf logs through the logger set with WithLogger, or the standard logger
+func (ws *WebSocketConnection) logf(format string, args ...any) {
+	if ws.config.logger != nil {
+		ws.config.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
 
-	return message, nil
+func (ws *WebSocketConnection) logSkippedMessage(err error) {
+	ws.logf("spacetimedb: skipping unrecognized server message: %v", err)
 }
@@ -0,0 +1,92 @@
+// Command spacetimedb-codegen generates typed Go bindings for a SpacetimeDB
+// module from its published schema, or offline from a schema file written by
+// "spacetime describe --json".
+//
+// Usage:
+//
+//	go run github.com/Yuni-sa/spacetimedb-go-sdk/cmd/spacetimedb-codegen -db quickstart-chat -package bindings -out bindings/bindings.go
+//	go run github.com/Yuni-sa/spacetimedb-go-sdk/cmd/spacetimedb-codegen -schema schema.json -package bindings -out bindings/bindings.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:3000", "SpacetimeDB server URL")
+	database := flag.String("db", "", "database name or identity")
+	schemaPath := flag.String("schema", "", "read the schema from a JSON file instead of the server")
+	packageName := flag.String("package", "bindings", "package name of the generated file")
+	outPath := flag.String("out", "", "output file (default stdout)")
+	flag.Parse()
+
+	if (*database == "") == (*schemaPath == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -db and -schema is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*server, *database, *schemaPath, *packageName, *outPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(server, database, schemaPath, packageName, outPath string) error {
+	var schema client.RawModuleDef
+	var err error
+	if schemaPath != "" {
+		schema, err = readSchema(schemaPath)
+	} else {
+		schema, err = fetchSchema(server, database)
+	}
+	if err != nil {
+		return err
+	}
+
+	source, err := client.GenerateBindings(schema, packageName)
+	if err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(outPath, source, 0o644)
+}
+
+func fetchSchema(server, database string) (client.RawModuleDef, error) {
+	stdb, err := client.NewClientBuilder().WithBaseURL(server).Build()
+	if err != nil {
+		return client.RawModuleDef{}, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer stdb.Close()
+
+	schema, err := stdb.Database.GetSchema(database, nil)
+	if err != nil {
+		return client.RawModuleDef{}, fmt.Errorf("failed to get schema: %w", err)
+	}
+	return schema, nil
+}
+
+func readSchema(path string) (client.RawModuleDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return client.RawModuleDef{}, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	var schema client.RawModuleDef
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return client.RawModuleDef{}, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+	for _, warning := range schema.SchemaParseWarnings() {
+		log.Printf("schema warning: %s", warning)
+	}
+	return schema, nil
+}
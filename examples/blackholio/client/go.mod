@@ -9,6 +9,9 @@ require (
 	github.com/setanarut/kamera/v2 v2.96.2
 )
 
+// Identity.Equal is not in a tagged release yet, so build against this tree
+replace github.com/Yuni-sa/spacetimedb-go-sdk => ../../..
+
 require (
 	github.com/ebitengine/gomobile v0.0.0-20241016134836-cc2e38a7c0ee // indirect
 	github.com/ebitengine/hideconsole v1.0.0 // indirect
@@ -14,11 +14,9 @@ import (
 
 // Player represents a player
 type Player struct {
-	Identity struct {
-		Identity string `json:"__identity__"`
-	} `json:"identity"`
-	PlayerID     uint   `json:"player_id"`
-	Name         string `json:"name"`
+	Identity     client.Identity `json:"identity"`
+	PlayerID     uint            `json:"player_id"`
+	Name         string          `json:"name"`
 	OwnedCircles []uint
 }
 
@@ -102,10 +100,9 @@ func (gm *GameManager) findLocalPlayer() {
 	gm.playersMutex.RLock()
 	defer gm.playersMutex.RUnlock()
 
+	localIdentity := client.Identity{Identity: gm.localIdentity}
 	for _, player := range gm.players {
-		localIdentityWithPrefix := "0x" + gm.localIdentity
-
-		if player.Identity.Identity == localIdentityWithPrefix {
+		if player.Identity.Equal(localIdentity) {
 			log.Printf("Local player found: %s", player.Name)
 			gm.localPlayer = player
 			gm.updatePlayerCircles()
@@ -170,9 +167,7 @@ func parsePlayer(insertStr string) *Player {
 
 	return &Player{
 		PlayerID: uint(playerID),
-		Identity: struct {
-			Identity string `json:"__identity__"`
-		}{Identity: identityStr},
-		Name: name,
+		Identity: client.Identity{Identity: identityStr},
+		Name:     name,
 	}
 }
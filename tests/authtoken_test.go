@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
+)
+
+func TestAuthTokenFromEnv(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("STDB_TEST_TOKEN", "env-token")
+
+	token, err := client.NewAuthToken(client.WithAuthConfigRoot(root), client.WithAuthFromEnv("STDB_TEST_TOKEN"))
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+	if token.GetToken() != "env-token" {
+		t.Errorf("Expected the token from the environment, got %q", token.GetToken())
+	}
+
+	if err := token.SaveToken("new-token"); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+	if token.GetToken() != "new-token" {
+		t.Errorf("Expected the saved token in memory, got %q", token.GetToken())
+	}
+	if _, err := os.Stat(filepath.Join(root, ".spacetime_go_sdk")); !os.IsNotExist(err) {
+		t.Errorf("Expected no config directory to be created, got %v", err)
+	}
+}
+
+func TestAuthTokenFromEmptyEnvUsesFile(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("STDB_TEST_TOKEN", "")
+
+	token, err := client.NewAuthToken(client.WithAuthConfigRoot(root), client.WithAuthFromEnv("STDB_TEST_TOKEN"))
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+	if err := token.SaveToken("file-token"); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+	if _, err := os.Stat(token.GetFilePath()); err != nil {
+		t.Errorf("Expected the token file to be written: %v", err)
+	}
+}
+
+func TestWithAutoSaveToken(t *testing.T) {
+	root := t.TempDir()
+	store, err := client.NewAuthToken(client.WithAuthConfigRoot(root))
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+
+	server := newFrameServer(t, `{"SomeFutureMessage":{}}`, identityTokenFrame)
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	conn, err := stdb.Database.ConnectWebSocket("test", "", client.WithAutoSaveToken(store))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Raw reads still see the identity token
+	conn.ReceiveMessage()
+	if _, err := conn.ReceiveMessage(); err != nil {
+		t.Fatalf("Failed to receive identity token: %v", err)
+	}
+
+	if stdb.GetToken() != "token" || stdb.GetIdentity() != "c2001a2b3c" {
+		t.Errorf("Expected the client to adopt the token and identity, got %q and %q", stdb.GetToken(), stdb.GetIdentity())
+	}
+	reloaded, err := client.NewAuthToken(client.WithAuthConfigRoot(root))
+	if err != nil {
+		t.Fatalf("Failed to reload auth token: %v", err)
+	}
+	if reloaded.GetToken() != "token" {
+		t.Errorf("Expected the token to be persisted, got %q", reloaded.GetToken())
+	}
+}
+
+func TestWithAnonymousConnect(t *testing.T) {
+	tests := []struct {
+		name         string
+		build        func(*client.ClientBuilder) *client.ClientBuilder
+		wantToken    string
+		wantIdentity string
+	}{
+		{"without token", func(b *client.ClientBuilder) *client.ClientBuilder { return b }, "token", "c2001a2b3c"},
+		{"with token", func(b *client.ClientBuilder) *client.ClientBuilder { return b.WithToken("own") }, "own", ""},
+		{"with token provider", func(b *client.ClientBuilder) *client.ClientBuilder {
+			return b.WithTokenProvider(func(context.Context) (string, error) { return "provided", nil })
+		}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+			var mu sync.Mutex
+			var headers []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				headers = append(headers, r.Header.Get("Authorization"))
+				first := len(headers) == 1
+				mu.Unlock()
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(identityTokenFrame)); err != nil {
+					return
+				}
+				// Drop the first connection to make the client reconnect
+				if !first {
+					conn.ReadMessage()
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			root := t.TempDir()
+			store, err := client.NewAuthToken(client.WithAuthConfigRoot(root))
+			if err != nil {
+				t.Fatalf("Failed to create auth token: %v", err)
+			}
+			stdb, err := tt.build(client.NewClientBuilder().WithBaseURL(server.URL)).Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+
+			reconnect := func(int, error, time.Duration) bool { return true }
+			conn, err := stdb.Database.ConnectWebSocket("test", "",
+				client.WithAnonymousConnect(), client.WithAutoSaveToken(store), client.WithReconnectHandler(reconnect))
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer conn.Close()
+
+			for range 2 {
+				if _, err := conn.ReceiveServerMessage(); err != nil {
+					t.Fatalf("Failed to receive identity token: %v", err)
+				}
+			}
+
+			if stdb.GetToken() != tt.wantToken || stdb.GetIdentity() != tt.wantIdentity {
+				t.Errorf("Expected the client to have token %q and identity %q, got %q and %q",
+					tt.wantToken, tt.wantIdentity, stdb.GetToken(), stdb.GetIdentity())
+			}
+			if store.GetToken() != "token" {
+				t.Errorf("Expected the token to be saved, got %q", store.GetToken())
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if want := []string{"", "Bearer token"}; !slices.Equal(headers, want) {
+				t.Errorf("Expected Authorization headers %q, got %q", want, headers)
+			}
+		})
+	}
+}
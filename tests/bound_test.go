@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestForDatabase(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/v1/database/blackholio/sql":
+			w.Write([]byte(`[{"schema":{"elements":[]},"rows":[]}]`))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { stdb.Close() })
+
+	chat := stdb.ForDatabase("quickstart-chat")
+	game := stdb.ForDatabase("blackholio")
+	if chat.Name() != "quickstart-chat" {
+		t.Errorf("Expected bound name quickstart-chat, got %s", chat.Name())
+	}
+
+	if err := chat.CallReducer("SendMessage", []any{"hi"}); err != nil {
+		t.Fatalf("Failed to call reducer: %v", err)
+	}
+	if _, err := game.ExecuteSQL("SELECT * FROM entity"); err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+
+	expected := []string{
+		"POST /v1/database/quickstart-chat/call/SendMessage",
+		"POST /v1/database/blackholio/sql",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected requests %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Request %d: expected %s, got %s", i, expected[i], paths[i])
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func cacheUpdate(tables ...client.TableUpdate) client.DatabaseUpdate {
+	return client.DatabaseUpdate{Tables: tables}
+}
+
+func TestTableCacheApply(t *testing.T) {
+	cache := client.NewTableCache()
+	cache.Apply(cacheUpdate(tableRows("circle", `[1]`, `[2]`), tableRows("food", `[8]`)))
+
+	if rows := cache.Rows("circle"); !slices.Equal(rows, []string{`[1]`, `[2]`}) {
+		t.Errorf("Unexpected rows after insert: %v", rows)
+	}
+	if names := cache.TableNames(); !slices.Equal(names, []string{"circle", "food"}) {
+		t.Errorf("Unexpected table names: %v", names)
+	}
+
+	cache.Apply(cacheUpdate(removedRows("circle", `[1]`), removedRows("food", `[8]`)))
+	if rows := cache.Rows("circle"); !slices.Equal(rows, []string{`[2]`}) {
+		t.Errorf("Unexpected rows after delete: %v", rows)
+	}
+	if names := cache.TableNames(); !slices.Equal(names, []string{"circle"}) {
+		t.Errorf("Expected emptied tables to be left out, got %v", names)
+	}
+
+	// Deleting a row that isn't cached is ignored
+	cache.Apply(cacheUpdate(removedRows("circle", `[7]`), removedRows("nowhere", `[1]`)))
+	if count := cache.Count("circle"); count != 1 {
+		t.Errorf("Expected 1 row, got %d", count)
+	}
+}
+
+func TestTableCacheRefcount(t *testing.T) {
+	cache := client.NewTableCache()
+
+	// Two overlapping subscriptions both deliver row 2
+	cache.Apply(cacheUpdate(tableRows("circle", `[1]`, `[2]`)))
+	cache.Apply(cacheUpdate(tableRows("circle", `[2]`, `[3]`)))
+	if rows := cache.Rows("circle"); !slices.Equal(rows, []string{`[1]`, `[2]`, `[2]`, `[3]`}) {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+
+	// Unsubscribing one of them keeps the shared row
+	cache.Apply(cacheUpdate(removedRows("circle", `[1]`, `[2]`)))
+	if rows := cache.Rows("circle"); !slices.Equal(rows, []string{`[2]`, `[3]`}) {
+		t.Errorf("Expected the shared row to stay cached, got %v", rows)
+	}
+
+	cache.Apply(cacheUpdate(removedRows("circle", `[2]`, `[3]`)))
+	if count := cache.Count("circle"); count != 0 {
+		t.Errorf("Expected no rows once every reference is deleted, got %d", count)
+	}
+}
+
+func TestTableCacheReconcile(t *testing.T) {
+	cache := client.NewTableCache()
+	cache.Apply(cacheUpdate(
+		tableRows("circle", `[1]`, `[2]`, `[2]`, `[3]`),
+		tableRows("food", `[8]`),
+	))
+
+	// After a reconnect row 1 is gone, row 2 lost a reference, row 3 is
+	// unchanged, row 4 is new and the food table is missing entirely
+	delta := cache.Reconcile([]client.TableUpdate{tableRows("circle", `[2]`, `[3]`, `[4]`)})
+	if len(delta) != 2 {
+		t.Fatalf("Expected changes to 2 tables, got %+v", delta)
+	}
+
+	circle := delta[0]
+	if circle.TableName != "circle" || circle.NumRows != 3 {
+		t.Errorf("Unexpected circle delta %+v", circle)
+	}
+	if entry := circle.Updates[0]; !slices.Equal(entry.Deletes, []string{`[1]`, `[2]`}) || !slices.Equal(entry.Inserts, []string{`[4]`}) {
+		t.Errorf("Unexpected circle changes %+v", entry)
+	}
+	food := delta[1]
+	if food.TableName != "food" || !slices.Equal(food.Updates[0].Deletes, []string{`[8]`}) || len(food.Updates[0].Inserts) != 0 {
+		t.Errorf("Expected the missing food table to be emptied, got %+v", food)
+	}
+
+	if rows := cache.Rows("circle"); !slices.Equal(rows, []string{`[2]`, `[3]`, `[4]`}) {
+		t.Errorf("Unexpected rows after reconcile: %v", rows)
+	}
+	if count := cache.Count("food"); count != 0 {
+		t.Errorf("Expected the food table to be empty, got %d rows", count)
+	}
+
+	// A snapshot that drops a row and one that brings it back are reported as
+	// a delete and an insert
+	if delta := cache.Reconcile([]client.TableUpdate{tableRows("circle", `[3]`, `[4]`)}); len(delta) != 1 ||
+		!slices.Equal(delta[0].Updates[0].Deletes, []string{`[2]`}) || len(delta[0].Updates[0].Inserts) != 0 {
+		t.Errorf("Expected row 2 to be deleted, got %+v", delta)
+	}
+	if delta := cache.Reconcile([]client.TableUpdate{tableRows("circle", `[2]`, `[3]`, `[4]`)}); len(delta) != 1 ||
+		!slices.Equal(delta[0].Updates[0].Inserts, []string{`[2]`}) || len(delta[0].Updates[0].Deletes) != 0 {
+		t.Errorf("Expected row 2 to be inserted again, got %+v", delta)
+	}
+
+	// Reconciling the same snapshot again changes nothing
+	if delta := cache.Reconcile([]client.TableUpdate{tableRows("circle", `[2]`, `[3]`, `[4]`)}); len(delta) != 0 {
+		t.Errorf("Expected no changes, got %+v", delta)
+	}
+	// Changes appended to a snapshot apply on top of the rows before them
+	delta = cache.Reconcile([]client.TableUpdate{
+		tableRows("circle", `[2]`, `[3]`, `[4]`),
+		removedRows("circle", `[3]`),
+		tableRows("circle", `[5]`),
+	})
+	if len(delta) != 1 || !slices.Equal(delta[0].Updates[0].Deletes, []string{`[3]`}) ||
+		!slices.Equal(delta[0].Updates[0].Inserts, []string{`[5]`}) {
+		t.Errorf("Expected row 3 to be replaced by row 5, got %+v", delta)
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestClientMessageConstructors(t *testing.T) {
+	tests := []struct {
+		name    string
+		message client.ClientMessage
+		want    string
+	}{
+		{
+			"CallReducer",
+			client.NewCallReducerMessage("SendMessage", `["hi"]`, 7, client.CallReducerNoSuccessNotify),
+			`{"CallReducer":{"reducer":"SendMessage","args":"[\"hi\"]","request_id":7,"flags":1}}`,
+		},
+		{
+			"Subscribe",
+			client.NewSubscribeMessage([]string{"SELECT * FROM user"}, 2),
+			`{"Subscribe":{"query_strings":["SELECT * FROM user"],"request_id":2}}`,
+		},
+		{
+			"SubscribeSingle",
+			client.NewSubscribeSingleMessage("SELECT * FROM user", 3, client.QueryID{ID: 4}),
+			`{"SubscribeSingle":{"query":"SELECT * FROM user","request_id":3,"query_id":{"id":4}}}`,
+		},
+		{
+			"SubscribeMulti",
+			client.NewSubscribeMultiMessage([]string{"SELECT * FROM user", "SELECT * FROM message"}, 5, client.QueryID{ID: 6}),
+			`{"SubscribeMulti":{"query_strings":["SELECT * FROM user","SELECT * FROM message"],"request_id":5,"query_id":{"id":6}}}`,
+		},
+		{
+			"Unsubscribe",
+			client.NewUnsubscribeMessage(8, client.QueryID{ID: 4}),
+			`{"Unsubscribe":{"request_id":8,"query_id":{"id":4}}}`,
+		},
+		{
+			"UnsubscribeMulti",
+			client.NewUnsubscribeMultiMessage(9, client.QueryID{ID: 6}),
+			`{"UnsubscribeMulti":{"request_id":9,"query_id":{"id":6}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.message.Validate(); err != nil {
+				t.Errorf("Expected a valid message, got %v", err)
+			}
+			encoded, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatalf("Failed to encode message: %v", err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, encoded)
+			}
+		})
+	}
+}
+
+func TestNewOneOffQueryMessage(t *testing.T) {
+	msg := client.NewOneOffQueryMessage(nil, "SELECT * FROM user")
+	if msg.OneOffQuery == nil || msg.OneOffQuery.QueryString != "SELECT * FROM user" {
+		t.Fatalf("Unexpected one-off query message %+v", msg)
+	}
+	if len(msg.OneOffQuery.MessageID) == 0 {
+		t.Error("Expected a generated message ID")
+	}
+
+	id := []byte{1, 2, 3}
+	if msg := client.NewOneOffQueryMessage(id, "SELECT 1"); !client.MessageIDEqual(msg.OneOffQuery.MessageID, id) {
+		t.Errorf("Expected the given message ID, got %v", msg.OneOffQuery.MessageID)
+	}
+}
+
+func TestClientMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		message client.ClientMessage
+		wantErr string
+	}{
+		{"no variant", client.ClientMessage{}, "no variant"},
+		{"two variants", client.ClientMessage{
+			Subscribe:   &client.Subscribe{},
+			Unsubscribe: &client.Unsubscribe{},
+		}, "Subscribe, Unsubscribe"},
+		{"invalid reducer name", client.NewCallReducerMessage("bad name", "[]", 1, 0), "invalid reducer name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.message.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSendNilClientMessage(t *testing.T) {
+	conn := connectTo(t, newFrameServer(t))
+
+	var msg *client.ClientMessage
+	if err := conn.SendMessage(msg); err == nil || !strings.Contains(err.Error(), "nil") {
+		t.Errorf("Expected an error for a nil message, got %v", err)
+	}
+}
@@ -1,10 +1,18 @@
 package tests
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
 )
 
 const (
@@ -418,4 +426,277 @@ func TestReducerCalls(t *testing.T) {
 			}
 		})
 	}
+
+	// Wait for the sent message to become visible instead of sleeping
+	found, err := spacetimeClient.Database.WaitForRow(testDBName,
+		"SELECT * FROM message WHERE Text = 'Hello from Go SDK test!'", 5*time.Second)
+	if err != nil {
+		t.Logf("Failed to query sent message: %v", err)
+	} else if !found {
+		t.Log("Sent message did not appear before timeout")
+	} else {
+		t.Log("Sent message is visible")
+	}
+}
+
+func TestBuildBaseURLErrors(t *testing.T) {
+	if _, err := client.NewClientBuilder().Build(); !errors.Is(err, client.ErrBaseURLRequired) {
+		t.Errorf("Expected ErrBaseURLRequired without a base URL, got %v", err)
+	}
+
+	_, err := client.NewClientBuilder().WithBaseURL("http://[::1").Build()
+	if !errors.Is(err, client.ErrInvalidBaseURL) {
+		t.Errorf("Expected ErrInvalidBaseURL for an unparsable base URL, got %v", err)
+	}
+	var parseErr *url.Error
+	if !errors.As(err, &parseErr) {
+		t.Errorf("Expected the parse error to be wrapped, got %v", err)
+	}
+}
+
+func TestWithHTTP2(t *testing.T) {
+	protos := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.Proto
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name  string
+		http2 *bool
+		want  string
+	}{
+		{name: "default", want: "HTTP/2.0"},
+		{name: "disabled", http2: new(bool), want: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := client.NewClientBuilder().WithBaseURL(server.URL).WithInsecureSkipVerify()
+			if tt.http2 != nil {
+				builder = builder.WithHTTP2(*tt.http2)
+			}
+			stdb, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+
+			if err := stdb.Ping(); err != nil {
+				t.Fatalf("Ping failed: %v", err)
+			}
+			if proto := <-protos; proto != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, proto)
+			}
+		})
+	}
+}
+
+func TestWithMaxIdleConns(t *testing.T) {
+	stdb, err := client.NewClientBuilder().WithBaseURL(testBaseURL).WithMaxIdleConns(32).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	transport, ok := stdb.GetHTTPClient().Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected an *http.Transport, got %T", stdb.GetHTTPClient().Transport)
+	}
+	if transport.MaxIdleConns != 32 || transport.MaxIdleConnsPerHost != 32 {
+		t.Errorf("Expected 32 idle connections overall and per host, got %d and %d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	agents := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Method + " " + r.URL.Path + " " + r.UserAgent()
+		switch r.URL.Path {
+		case "/v1/database/chat/subscribe":
+			if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+				conn.Close()
+			}
+		case "/v1/database/chat/sql":
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: "spacetimedb-go-sdk/" + client.Version},
+		{name: "custom", userAgent: "my-game/1.2", want: "my-game/1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token")
+			if tt.userAgent != "" {
+				builder = builder.WithUserAgent(tt.userAgent)
+			}
+			stdb, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+
+			if err := stdb.Ping(); err != nil {
+				t.Fatalf("Ping failed: %v", err)
+			}
+			if _, err := stdb.Database.ExecuteSQL("chat", []string{"SELECT * FROM user"}); err != nil {
+				t.Fatalf("ExecuteSQL failed: %v", err)
+			}
+			conn, err := stdb.Database.ConnectWebSocket("chat", client.SatsProtocol)
+			if err != nil {
+				t.Fatalf("ConnectWebSocket failed: %v", err)
+			}
+			conn.Close()
+
+			for _, request := range []string{"GET /v1/ping", "POST /v1/database/chat/sql", "GET /v1/database/chat/subscribe"} {
+				if got := <-agents; got != request+" "+tt.want {
+					t.Errorf("Expected %q, got %q", request+" "+tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWithTokenProvider(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	auth := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.URL.Path + " " + r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/v1/database/chat/subscribe":
+			if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+				conn.Close()
+			}
+		case "/v1/database/chat/sql":
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	calls := 0
+	stdb, err := client.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithTokenProvider(func(ctx context.Context) (string, error) {
+			calls++
+			return fmt.Sprintf("oidc-%d", calls), nil
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	// Each request asks the provider for a fresh token
+	for i := range 2 {
+		if _, err := stdb.Database.ExecuteSQL("chat", []string{"SELECT * FROM user"}); err != nil {
+			t.Fatalf("ExecuteSQL failed: %v", err)
+		}
+		if got, want := <-auth, fmt.Sprintf("/v1/database/chat/sql Bearer oidc-%d", i+1); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+	conn, err := stdb.Database.ConnectWebSocket("chat", client.SatsProtocol)
+	if err != nil {
+		t.Fatalf("ConnectWebSocket failed: %v", err)
+	}
+	conn.Close()
+	if got, want := <-auth, "/v1/database/chat/subscribe Bearer oidc-3"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := stdb.GetToken(); got != "oidc-3" {
+		t.Errorf("Expected GetToken to report the last provided token, got %q", got)
+	}
+
+	failing, err := client.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithTokenProvider(func(ctx context.Context) (string, error) {
+			return "", errors.New("provider down")
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer failing.Close()
+	if _, err := failing.Database.ExecuteSQL("chat", []string{"SELECT * FROM user"}); err == nil || !strings.Contains(err.Error(), "provider down") {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+	if _, err := failing.Database.ConnectWebSocket("chat", client.SatsProtocol); err == nil || !strings.Contains(err.Error(), "provider down") {
+		t.Errorf("Expected the provider error from the handshake, got %v", err)
+	}
+	if len(auth) != 0 {
+		t.Errorf("Expected no request to be sent without a token, got %q", <-auth)
+	}
+}
+
+func TestIsAuthenticated(t *testing.T) {
+	stdb, err := client.NewClientBuilder().WithBaseURL("http://localhost:3000").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	if stdb.IsAuthenticated() {
+		t.Error("Expected a client without a token not to be authenticated")
+	}
+	if err := stdb.RequireAuth(); !errors.Is(err, client.ErrAuthRequired) {
+		t.Errorf("Expected ErrAuthRequired, got %v", err)
+	}
+	// Operations needing a token fail the same way before sending anything
+	if _, err := stdb.Database.ExecuteSQL("chat", []string{"SELECT * FROM user"}); !errors.Is(err, client.ErrAuthRequired) {
+		t.Errorf("Expected ExecuteSQL to fail with ErrAuthRequired, got %v", err)
+	}
+
+	stdb.SetToken("secret")
+	if !stdb.IsAuthenticated() || stdb.RequireAuth() != nil {
+		t.Error("Expected a client with a token to be authenticated")
+	}
+
+	provided, err := client.NewClientBuilder().
+		WithBaseURL("http://localhost:3000").
+		WithTokenProvider(func(ctx context.Context) (string, error) { return "oidc", nil }).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer provided.Close()
+	if !provided.IsAuthenticated() {
+		t.Error("Expected a client with a token provider to be authenticated")
+	}
+}
+
+// newTestClient serves handler and returns a client for it that authenticates
+// with "token". configure adjusts the builder before the client is built.
+func newTestClient(t *testing.T, handler http.HandlerFunc, configure ...func(*client.ClientBuilder)) *client.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	builder := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token")
+	for _, c := range configure {
+		c(builder)
+	}
+	stdb, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { stdb.Close() })
+	return stdb
+}
+
+// respondWith answers every request with status and body
+func respondWith(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
 }
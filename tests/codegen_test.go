@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestGenerateBindingsReducers(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+	schema.Reducers = append(schema.Reducers, client.NewInitReducer("init", client.ProductType{}))
+
+	source, err := client.GenerateBindings(schema, "chat")
+	if err != nil {
+		t.Fatalf("Failed to generate bindings: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "bindings.go", source, 0); err != nil {
+		t.Fatalf("Generated bindings do not parse: %v\n%s", err, source)
+	}
+
+	code := string(source)
+	for _, want := range []string{
+		"func (r *Reducers) SendMessage(text string) (uint32, error)",
+		"func (r *Reducers) SetName(name string) (uint32, error)",
+		`r.conn.CallReducerArgs("SendMessage", []any{text})`,
+		"func (t UserTable) FindByIdentity(identity client.Identity) (User, bool)",
+		"type User struct",
+		"type Message struct",
+		`Message: MessageTable{client.NewTableHandle[Message](cache, "message", -1)}`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected generated code to contain %q\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "Init(") {
+		t.Errorf("Expected lifecycle reducers to be skipped\n%s", code)
+	}
+}
+
+func TestGenerateBindingsShutdown(t *testing.T) {
+	source, err := client.GenerateBindings(parseSchema(t, chatSchemaJSON), "chat")
+	if err != nil {
+		t.Fatalf("Failed to generate bindings: %v", err)
+	}
+
+	code := string(source)
+	for _, want := range []string{
+		`"context"`,
+		`"sync"`,
+		"func (c *DbConnection) Go(fn func(ctx context.Context))",
+		"func (c *DbConnection) Shutdown(ctx context.Context) error",
+		"c.workers.Wait()",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected generated code to contain %q\n%s", want, code)
+		}
+	}
+
+	// The graceful close may block, so it must run in the goroutine whose wait
+	// is bounded by ctx rather than before it
+	file, err := parser.ParseFile(token.NewFileSet(), "bindings.go", source, 0)
+	if err != nil {
+		t.Fatalf("Generated bindings do not parse: %v", err)
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "Shutdown" {
+			continue
+		}
+		for _, stmt := range fn.Body.List {
+			ast.Inspect(stmt, func(node ast.Node) bool {
+				if _, ok := node.(*ast.FuncLit); ok {
+					return false
+				}
+				if sel, ok := node.(*ast.SelectorExpr); ok && sel.Sel.Name == "GracefulClose" {
+					t.Errorf("Expected Shutdown to call GracefulClose in a goroutine bounded by ctx\n%s", code)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestGenerateBindingsNamedTypes(t *testing.T) {
+	var schema client.RawModuleDef
+	vectorRef := schema.Typespace.AddType(client.NewProductAlgebraicType(client.ProductType{Elements: []client.ProductTypeElement{
+		{Name: &client.OptionalString{Some: ptr("x")}, AlgebraicType: client.AlgebraicType{Primitive: client.PrimitiveF32}},
+		{Name: &client.OptionalString{Some: ptr("y")}, AlgebraicType: client.AlgebraicType{Primitive: client.PrimitiveF32}},
+	}}))
+	schema.Types = []client.NamedTypeDef{{Name: client.TypeName{Name: "DbVector2"}, Type: vectorRef}}
+	schema.Reducers = []client.ReducerDef{client.NewReducer("update_player_input", client.ProductType{Elements: []client.ProductTypeElement{
+		{Name: &client.OptionalString{Some: ptr("direction")}, AlgebraicType: client.NewRefAlgebraicType(vectorRef)},
+	}})}
+
+	source, err := client.GenerateBindings(schema, "blackholio")
+	if err != nil {
+		t.Fatalf("Failed to generate bindings: %v", err)
+	}
+
+	code := string(source)
+	if !strings.Contains(code, "func (r *Reducers) UpdatePlayerInput(direction DbVector2) (uint32, error)") {
+		t.Errorf("Expected a typed UpdatePlayerInput method\n%s", code)
+	}
+	if !strings.Contains(code, "type DbVector2 struct") {
+		t.Errorf("Expected a DbVector2 struct\n%s", code)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
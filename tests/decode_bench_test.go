@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// messageRow is a row of the quickstart-chat message table
+var messageRow = []byte(`[["c200ab"],[1718000000000000],"hello world"]`)
+
+func BenchmarkDecodePositional(b *testing.B) {
+	var msg chatMessage
+	for b.Loop() {
+		if err := client.DecodePositional(messageRow, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRowDecoder decodes the same row through a prepared decoder, which
+// resolves the columns and the field mapping once instead of per row
+func BenchmarkRowDecoder(b *testing.B) {
+	var def client.RawModuleDef
+	if err := json.Unmarshal([]byte(chatSchemaJSON), &def); err != nil {
+		b.Fatal(err)
+	}
+	decoder, err := client.NewRowDecoders(&def).PrepareDecoder("message")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var msg chatMessage
+	for b.Loop() {
+		if err := decoder.Decode(messageRow, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// circleUpdate builds a 10k-row insert as a blackholio frame would carry it
+func circleUpdate() client.TableUpdate {
+	rows := make([]string, 10_000)
+	for i := range rows {
+		rows[i] = fmt.Sprintf(`[%d,3,[0.6,-0.8],12.5,1718000000000000]`, i)
+	}
+	return client.TableUpdate{TableName: "circle", Updates: []client.TableUpdateEntry{{Inserts: rows}}}
+}
+
+// BenchmarkTableUpdateRows compares decoding a 10k-row update by converting
+// each string row to a []byte with decoding from IterInserts
+func BenchmarkTableUpdateRows(b *testing.B) {
+	update := circleUpdate()
+
+	b.Run("string-slice", func(b *testing.B) {
+		var c circle
+		for b.Loop() {
+			for _, entry := range update.Updates {
+				for _, row := range entry.Inserts {
+					if err := client.DecodePositional([]byte(row), &c); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		}
+	})
+
+	b.Run("iter-inserts", func(b *testing.B) {
+		var c circle
+		for b.Loop() {
+			for raw := range update.IterInserts {
+				if err := client.DecodePositional(raw, &c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// Row types mirroring the example clients' tables
+
+type vector2 struct {
+	X float64
+	Y float64
+}
+
+type circle struct {
+	EntityID      uint
+	PlayerID      uint
+	Direction     vector2
+	Speed         float32
+	LastSplitTime int64
+}
+
+type entity struct {
+	EntityID uint
+	Position vector2
+	Mass     uint
+}
+
+type player struct {
+	Identity struct {
+		Identity string
+	}
+	PlayerID uint
+	Name     string
+}
+
+type food struct {
+	EntityID uint
+}
+
+type chatUser struct {
+	Identity string
+	Name     *string
+	Online   bool
+}
+
+type chatMessage struct {
+	Sender string
+	Sent   time.Time
+	Text   string
+}
+
+func TestDecodePositionalCircle(t *testing.T) {
+	var c circle
+	if err := client.DecodePositional([]byte(`[7,3,[0.6,-0.8],12.5,1718000000000000]`), &c); err != nil {
+		t.Fatalf("Failed to decode circle: %v", err)
+	}
+
+	expected := circle{EntityID: 7, PlayerID: 3, Direction: vector2{X: 0.6, Y: -0.8}, Speed: 12.5, LastSplitTime: 1718000000000000}
+	if c != expected {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+}
+
+func TestDecodePositionalEntity(t *testing.T) {
+	var e entity
+	if err := client.DecodePositional([]byte(`[42,[100.5,200.25],15]`), &e); err != nil {
+		t.Fatalf("Failed to decode entity: %v", err)
+	}
+
+	expected := entity{EntityID: 42, Position: vector2{X: 100.5, Y: 200.25}, Mass: 15}
+	if e != expected {
+		t.Errorf("Expected %+v, got %+v", expected, e)
+	}
+}
+
+func TestDecodePositionalPlayer(t *testing.T) {
+	var p player
+	if err := client.DecodePositional([]byte(`[["c2001a2b3c"],5,"alice"]`), &p); err != nil {
+		t.Fatalf("Failed to decode player: %v", err)
+	}
+
+	if p.Identity.Identity != "c2001a2b3c" || p.PlayerID != 5 || p.Name != "alice" {
+		t.Errorf("Unexpected player: %+v", p)
+	}
+}
+
+func TestDecodePositionalFood(t *testing.T) {
+	var f food
+	if err := client.DecodePositional([]byte(`[99]`), &f); err != nil {
+		t.Fatalf("Failed to decode food: %v", err)
+	}
+
+	if f.EntityID != 99 {
+		t.Errorf("Expected entity ID 99, got %d", f.EntityID)
+	}
+}
+
+func TestDecodePositionalUserOptionalName(t *testing.T) {
+	var named chatUser
+	if err := client.DecodePositional([]byte(`[["c2001a2b3c"],[0,"bob"],true]`), &named); err != nil {
+		t.Fatalf("Failed to decode user: %v", err)
+	}
+	if named.Identity != "c2001a2b3c" || named.Name == nil || *named.Name != "bob" || !named.Online {
+		t.Errorf("Unexpected user: %+v", named)
+	}
+
+	var anonymous chatUser
+	if err := client.DecodePositional([]byte(`[["c2001a2b3c"],[1,[]],false]`), &anonymous); err != nil {
+		t.Fatalf("Failed to decode user: %v", err)
+	}
+	if anonymous.Name != nil || anonymous.Online {
+		t.Errorf("Unexpected user: %+v", anonymous)
+	}
+}
+
+func TestDecodePositionalMessageTimestamp(t *testing.T) {
+	var m chatMessage
+	if err := client.DecodePositional([]byte(`[["c2001a2b3c"],[1718000000123456],"hi"]`), &m); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+
+	if m.Sender != "c2001a2b3c" || m.Text != "hi" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+	if !m.Sent.Equal(time.UnixMicro(1718000000123456)) {
+		t.Errorf("Unexpected timestamp: %v", m.Sent)
+	}
+}
+
+func TestDecodePositionalErrors(t *testing.T) {
+	var e entity
+	if err := client.DecodePositional([]byte(`[42,[1,2]]`), &e); err == nil {
+		t.Error("Expected an error for a row with too few elements")
+	}
+
+	var u chatUser
+	if err := client.DecodePositional([]byte(`[["id"],[2,"x"],true]`), &u); err == nil {
+		t.Error("Expected an error for an invalid option tag")
+	}
+
+	if err := client.DecodePositional([]byte(`[1]`), food{}); err == nil {
+		t.Error("Expected an error for a non-pointer destination")
+	}
+}
+
+func TestEncodePositionalRoundTrip(t *testing.T) {
+	name := "bob"
+	user := chatUser{Identity: "c2001a2b3c", Name: &name, Online: true}
+
+	data, err := client.EncodePositional(user)
+	if err != nil {
+		t.Fatalf("Failed to encode user: %v", err)
+	}
+	if string(data) != `["c2001a2b3c",[0,"bob"],true]` {
+		t.Errorf("Unexpected encoding: %s", data)
+	}
+
+	var decoded chatUser
+	if err := client.DecodePositional(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode user: %v", err)
+	}
+	if decoded.Identity != user.Identity || *decoded.Name != name || !decoded.Online {
+		t.Errorf("Unexpected round trip: %+v", decoded)
+	}
+
+	data, err = client.EncodePositional(chatUser{})
+	if err != nil {
+		t.Fatalf("Failed to encode user: %v", err)
+	}
+	if string(data) != `["",[1,[]],false]` {
+		t.Errorf("Unexpected encoding of a none option: %s", data)
+	}
+}
+
+// largeEntityID is 2^53 + 1, the smallest integer float64 cannot represent
+const largeEntityID = 9007199254740993
+
+func TestDecodeLargeIntegersKeepPrecision(t *testing.T) {
+	row := []byte(`[9007199254740993,[1.5,2.5],9007199254740993]`)
+
+	// Decoding into any rounds through float64, which is what the example parsers do
+	var untyped []any
+	if err := json.Unmarshal(row, &untyped); err != nil {
+		t.Fatalf("Failed to unmarshal row: %v", err)
+	}
+	if uint64(untyped[0].(float64)) == largeEntityID {
+		t.Fatal("Expected float64 decoding to lose precision")
+	}
+
+	values, err := client.DecodeRow(row)
+	if err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	id, ok := values[0].(json.Number)
+	if !ok || id.String() != "9007199254740993" {
+		t.Errorf("Expected entity ID as json.Number 9007199254740993, got %#v", values[0])
+	}
+	if position := values[1].([]any); position[0].(json.Number).String() != "1.5" {
+		t.Errorf("Unexpected nested position %v", position)
+	}
+
+	var e struct {
+		EntityID uint64
+		Position vector2
+		Mass     int64
+	}
+	if err := client.DecodePositional(row, &e); err != nil {
+		t.Fatalf("Failed to decode entity: %v", err)
+	}
+	if e.EntityID != largeEntityID || e.Mass != largeEntityID {
+		t.Errorf("Expected %d, got entity ID %d and mass %d", uint64(largeEntityID), e.EntityID, e.Mass)
+	}
+}
+
+// inventorySchemaJSON has a table with array columns of primitives, nested
+// arrays and products
+const inventorySchemaJSON = `{
+	"typespace": {"types": [
+		{"Product": {"elements": [
+			{"name": {"some": "player_id"}, "algebraic_type": {"U64": []}},
+			{"name": {"some": "owned_circles"}, "algebraic_type": {"Array": {"U64": []}}},
+			{"name": {"some": "tags"}, "algebraic_type": {"Array": {"String": []}}},
+			{"name": {"some": "grid"}, "algebraic_type": {"Array": {"Array": {"I32": []}}}},
+			{"name": {"some": "waypoints"}, "algebraic_type": {"Array": {"Ref": 1}}}
+		]}},
+		{"Product": {"elements": [
+			{"name": {"some": "x"}, "algebraic_type": {"F32": []}},
+			{"name": {"some": "y"}, "algebraic_type": {"F32": []}}
+		]}}
+	]},
+	"tables": [
+		{"name": "inventory", "product_type_ref": 0, "primary_key": [0], "indexes": [], "constraints": [], "sequences": [],
+		 "schedule": {"none": []}, "table_type": {"User": []}, "table_access": {"Public": []}}
+	],
+	"reducers": [],
+	"types": [],
+	"misc_exports": [],
+	"row_level_security": []
+}`
+
+type inventory struct {
+	PlayerID     uint64
+	OwnedCircles []uint64
+	Tags         []string
+	Grid         [][]int32
+	Waypoints    []vector2
+}
+
+func TestArrayColumns(t *testing.T) {
+	row := `[7,[1,9007199254740993],["red","big"],[[1,2],[],[3]],[[0.5,-1],[2,3]]]`
+	want := inventory{
+		PlayerID:     7,
+		OwnedCircles: []uint64{1, largeEntityID},
+		Tags:         []string{"red", "big"},
+		Grid:         [][]int32{{1, 2}, {}, {3}},
+		Waypoints:    []vector2{{X: 0.5, Y: -1}, {X: 2, Y: 3}},
+	}
+
+	schema := parseSchema(t, inventorySchemaJSON)
+	decoder, err := client.NewRowDecoders(&schema).PrepareDecoder("inventory")
+	if err != nil {
+		t.Fatalf("Failed to prepare decoder: %v", err)
+	}
+	var got inventory
+	if err := decoder.Decode([]byte(row), &got); err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected decoded row:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Arrays encode back to the same wire form, as a row or a reducer argument
+	encoded, err := client.EncodePositional(want)
+	if err != nil {
+		t.Fatalf("Failed to encode row: %v", err)
+	}
+	if string(encoded) != row {
+		t.Errorf("Unexpected encoding:\n got %s\nwant %s", encoded, row)
+	}
+	args, err := client.MarshalReducerArgs([]any{want.OwnedCircles, want.Tags, []uint64(nil)})
+	if err != nil {
+		t.Fatalf("Failed to encode arguments: %v", err)
+	}
+	if args != `[[1,9007199254740993],["red","big"],[]]` {
+		t.Errorf("Unexpected reducer arguments: %s", args)
+	}
+
+	// The schema-driven decoder recurses into the element types
+	value, err := schema.Typespace.DecodeProduct([]byte(row), *schema.Typespace.Types[0].GetProduct())
+	if err != nil {
+		t.Fatalf("Failed to decode product: %v", err)
+	}
+	circles := value.Elements[1].(client.BuiltinValue).Value.([]client.AlgebraicValue)
+	if len(circles) != 2 || circles[1].(client.BuiltinValue).Value != uint64(largeEntityID) {
+		t.Errorf("Unexpected owned circles: %#v", circles)
+	}
+	waypoints := value.Elements[4].(client.BuiltinValue).Value.([]client.AlgebraicValue)
+	if len(waypoints) != 2 || waypoints[0].(client.ProductValue).Elements[0].(client.BuiltinValue).Value != float32(0.5) {
+		t.Errorf("Unexpected waypoints: %#v", waypoints)
+	}
+
+	if err := decoder.Decode([]byte(`[7,[1,"x"],[],[],[]]`), &got); err == nil || !strings.Contains(err.Error(), "$.OwnedCircles[1]") {
+		t.Errorf("Expected an error naming the bad element, got %v", err)
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	type scores struct {
+		Name   string
+		Scores map[string]uint64
+	}
+	var row scores
+	if err := client.DecodePositional([]byte(`["bob",{"b":9007199254740993,"a":1}]`), &row); err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	if !reflect.DeepEqual(row.Scores, map[string]uint64{"a": 1, "b": largeEntityID}) {
+		t.Errorf("Unexpected scores: %v", row.Scores)
+	}
+
+	tests := []struct {
+		name  string
+		wire  string
+		value any // pointer to a map of the decoded type
+		want  any
+	}{
+		{"integer keys", `{"10":[3,4],"2":[1,2]}`, new(map[uint32]vector2), map[uint32]vector2{2: {X: 1, Y: 2}, 10: {X: 3, Y: 4}}},
+		{"bool keys", `{"false":[1,[]],"true":[0,"yes"]}`, new(map[bool]*string), map[bool]*string{true: ptr("yes"), false: nil}},
+		{"product keys", `[[[1,2],"a"],[[3,4],"b"]]`, new(map[vector2]string), map[vector2]string{{X: 1, Y: 2}: "a", {X: 3, Y: 4}: "b"}},
+		{"nested", `{"x":{"1":["a"]}}`, new(map[string]map[int][]string), map[string]map[int][]string{"x": {1: {"a"}}}},
+		{"empty", `{}`, new(map[string]int), map[string]int{}},
+		{"empty pairs", `[]`, new(map[vector2]int), map[vector2]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := client.DecodePositional([]byte(tt.wire), tt.value); err != nil {
+				t.Fatalf("Failed to decode %s: %v", tt.wire, err)
+			}
+			got := reflect.ValueOf(tt.value).Elem().Interface()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decoded %s into %#v, want %#v", tt.wire, got, tt.want)
+			}
+
+			encoded, err := client.EncodePositional(tt.want)
+			if err != nil {
+				t.Fatalf("Failed to encode %v: %v", tt.want, err)
+			}
+			if string(encoded) != tt.wire {
+				t.Errorf("Encoded %v as %s, want %s", tt.want, encoded, tt.wire)
+			}
+		})
+	}
+
+	args, err := client.MarshalReducerArgs([]any{map[string]int(nil), map[int]bool{3: true}})
+	if err != nil {
+		t.Fatalf("Failed to encode arguments: %v", err)
+	}
+	if args != `[{},{"3":true}]` {
+		t.Errorf("Unexpected reducer arguments: %s", args)
+	}
+
+	var bad map[int]string
+	if err := client.DecodePositional([]byte(`{"x":"a"}`), &bad); err == nil {
+		t.Error("Expected an error for a key that is not an integer")
+	}
+	if err := client.DecodePositional([]byte(`[[1]]`), &bad); err == nil || !strings.Contains(err.Error(), "[key, value] pair") {
+		t.Errorf("Expected an error for a malformed pair, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// newHealthServer answers pings and verifies identity "c200abc" with token "valid"
+func newHealthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/ping":
+			w.WriteHeader(http.StatusOK)
+		case "/v1/identity/c200abc/verify":
+			if r.Header.Get("Authorization") != "Bearer valid" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHealthCheck(t *testing.T) {
+	server := newHealthServer(t)
+
+	tests := []struct {
+		name          string
+		token         string
+		authenticated bool
+		wantErr       bool
+	}{
+		{name: "valid token", token: "valid", authenticated: true},
+		{name: "invalid token", token: "stale", wantErr: true},
+		{name: "no token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := client.NewClientBuilder().WithBaseURL(server.URL).WithIdentity("c200abc")
+			if tt.token != "" {
+				builder = builder.WithToken(tt.token)
+			}
+			stdb, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+
+			status, err := stdb.HealthCheck()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HealthCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !status.Reachable {
+				t.Error("Expected the server to be reachable")
+			}
+			if status.Authenticated != tt.authenticated {
+				t.Errorf("Expected Authenticated = %v, got %v", tt.authenticated, status.Authenticated)
+			}
+			if status.Latency <= 0 {
+				t.Errorf("Expected a positive latency, got %v", status.Latency)
+			}
+		})
+	}
+}
+
+func TestHealthCheckUnreachable(t *testing.T) {
+	stdb, err := client.NewClientBuilder().WithBaseURL("http://localhost:1").WithToken("valid").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	status, err := stdb.HealthCheck()
+	if err == nil {
+		t.Fatal("Expected an error for an unreachable server")
+	}
+	if status.Reachable || status.Authenticated {
+		t.Errorf("Expected an unreachable, unauthenticated status, got %+v", status)
+	}
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+const testIdentityHex = "c2001a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7"
+
+func TestIdentityFromHex(t *testing.T) {
+	id, err := client.IdentityFromHex("0x" + strings.ToUpper(testIdentityHex))
+	if err != nil {
+		t.Fatalf("Failed to parse identity: %v", err)
+	}
+	if id.Hex() != testIdentityHex {
+		t.Errorf("Expected canonical hex %s, got %s", testIdentityHex, id.Hex())
+	}
+
+	b, err := id.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to get identity bytes: %v", err)
+	}
+	if len(b) != 32 || b[0] != 0xc2 {
+		t.Errorf("Unexpected identity bytes: %x", b)
+	}
+
+	if !id.Equal(client.Identity{Identity: "0x" + testIdentityHex}) {
+		t.Error("Expected identities differing only in prefix and case to be equal")
+	}
+}
+
+func TestIdentityFromHexInvalid(t *testing.T) {
+	tests := map[string]string{
+		"too short":  testIdentityHex[:62],
+		"too long":   testIdentityHex + "00",
+		"odd length": testIdentityHex[:63],
+		"non-hex":    "zz" + testIdentityHex[2:],
+		"empty":      "",
+	}
+	for name, input := range tests {
+		if _, err := client.IdentityFromHex(input); err == nil {
+			t.Errorf("%s: expected an error for %q", name, input)
+		}
+	}
+
+	if _, err := (client.Identity{Identity: "abcd"}).Bytes(); err == nil {
+		t.Error("Expected Bytes to fail for a wrong-length identity")
+	}
+}
+
+func TestConnectionIDPrecision(t *testing.T) {
+	// 2^128 - 1 and a value that a float64 would round
+	var ids struct {
+		Max     client.ConnectionID `json:"max"`
+		Precise client.ConnectionID `json:"precise"`
+	}
+	data := `{"max":{"__connection_id__":340282366920938463463374607431768211455},"precise":{"__connection_id__":18446744073709551617}}`
+	if err := json.Unmarshal([]byte(data), &ids); err != nil {
+		t.Fatalf("Failed to decode connection IDs: %v", err)
+	}
+
+	if got := ids.Max.Hex(); got != strings.Repeat("f", 32) {
+		t.Errorf("Expected 32 f hex digits, got %s", got)
+	}
+	if got := ids.Precise.String(); got != "18446744073709551617" {
+		t.Errorf("Expected the exact decimal ID, got %s", got)
+	}
+	if got := ids.Precise.Hex(); got != "00000000000000010000000000000001" {
+		t.Errorf("Expected the exact hex ID, got %s", got)
+	}
+	if ids.Precise.Equal(ids.Max) || !ids.Precise.Equal(client.ConnectionID{ConnectionID: "18446744073709551617"}) {
+		t.Error("Expected connection IDs to compare by value")
+	}
+
+	encoded, err := json.Marshal(ids)
+	if err != nil || string(encoded) != data {
+		t.Errorf("Expected connection IDs to round trip, got %s (%v)", encoded, err)
+	}
+
+	// Connection ID columns keep their precision in positional rows too
+	var row struct{ Caller client.ConnectionID }
+	if err := client.DecodePositional([]byte(`[[340282366920938463463374607431768211455]]`), &row); err != nil || !row.Caller.Equal(ids.Max) {
+		t.Errorf("Expected the positional connection ID to decode exactly, got %s (%v)", row.Caller, err)
+	}
+	if encoded, err := client.EncodePositional(row); err != nil || string(encoded) != `[[340282366920938463463374607431768211455]]` {
+		t.Errorf("Expected the positional connection ID to encode as a number, got %s (%v)", encoded, err)
+	}
+
+	if !(client.ConnectionID{}).IsZero() || client.ConnectionIDFromUint64(7).IsZero() {
+		t.Error("Expected only the missing connection ID to be zero")
+	}
+}
+
+// setEmailHandler answers set-email requests with status and body, and counts
+// every request it receives
+func setEmailHandler(status int, body string) (http.HandlerFunc, *atomic.Int32) {
+	var requests atomic.Int32
+	respond := respondWith(status, body)
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !strings.HasSuffix(r.URL.Path, "/set-email") {
+			http.NotFound(w, r)
+			return
+		}
+		respond(w, r)
+	}, &requests
+}
+
+func TestSetEmailRejectsInvalidAddresses(t *testing.T) {
+	handler, requests := setEmailHandler(http.StatusOK, "")
+	stdb := newTestClient(t, handler)
+
+	for _, email := range []string{
+		"",
+		"plainaddress",
+		"@example.com",
+		"user@",
+		"user@@example.com",
+		" user@example.com",
+		"user@example.com ",
+		"User <user@example.com>",
+		strings.Repeat("a", 250) + "@example.com",
+	} {
+		err := stdb.Identity.SetEmail(testIdentityHex, email)
+		if !errors.Is(err, client.ErrInvalidEmail) {
+			t.Errorf("SetEmail(%q): expected ErrInvalidEmail, got %v", email, err)
+		}
+	}
+	if got := requests.Load(); got != 0 {
+		t.Errorf("Expected invalid addresses to be rejected client-side, got %d requests", got)
+	}
+
+	if err := stdb.Identity.SetEmail(testIdentityHex, "user@example.com"); err != nil {
+		t.Errorf("Expected a valid address to be accepted, got %v", err)
+	}
+}
+
+func TestSetEmailStatusErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		check  func(error) bool
+		want   string
+	}{
+		{http.StatusBadRequest, func(err error) bool { return errors.Is(err, client.ErrInvalidEmail) }, "ErrInvalidEmail"},
+		{http.StatusUnauthorized, func(err error) bool { return strings.Contains(err.Error(), "token is invalid") }, "an invalid token error"},
+		{http.StatusForbidden, func(err error) bool { return strings.Contains(err.Error(), "does not match identity "+testIdentityHex) }, "an identity mismatch error"},
+		{http.StatusNotFound, func(err error) bool {
+			var httpErr *client.HTTPError
+			return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound && httpErr.Body == "no such identity"
+		}, "an *HTTPError with status 404"},
+	}
+
+	for _, tt := range tests {
+		body := "no such identity"
+		handler, _ := setEmailHandler(tt.status, body)
+		stdb := newTestClient(t, handler)
+		err := stdb.Identity.SetEmail(testIdentityHex, "user@example.com")
+		if err == nil || !tt.check(err) {
+			t.Errorf("Status %d: expected %s, got %v", tt.status, tt.want, err)
+		}
+	}
+}
+
+func TestCreateWithEmailRestoresCredentials(t *testing.T) {
+	var setEmailAuth atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/identity":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"identity":"` + testIdentityHex + `","token":"new-token"}`))
+		case strings.HasSuffix(r.URL.Path, "/set-email"):
+			setEmailAuth.Store(r.Header.Get("Authorization"))
+			http.Error(w, "email taken", http.StatusConflict)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("old-token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+	stdb.SetIdentity("old-identity")
+
+	identity, err := stdb.Identity.CreateWithEmail("user@example.com")
+	if err == nil {
+		t.Fatal("Expected CreateWithEmail to fail when SetEmail fails")
+	}
+	if identity == nil || identity.Identity != testIdentityHex || identity.Token != "new-token" {
+		t.Errorf("Expected the created identity to be returned with the error, got %+v", identity)
+	}
+
+	// SetEmail must have been sent with the new identity's token
+	if got, _ := setEmailAuth.Load().(string); got != "Bearer new-token" {
+		t.Errorf("Expected SetEmail to authenticate as the new identity, got %q", got)
+	}
+	if got := stdb.GetToken(); got != "old-token" {
+		t.Errorf("Expected the previous token to be restored, got %q", got)
+	}
+	if got := stdb.GetIdentity(); got != "old-identity" {
+		t.Errorf("Expected the previous identity to be restored, got %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestGetLogsSince(t *testing.T) {
+	since := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour).UnixMicro()
+	after := since.Add(time.Minute).UnixMicro()
+
+	logs := strings.Join([]string{
+		fmt.Sprintf(`{"level":"Info","ts":%d,"message":"old"}`, before),
+		"old continuation",
+		fmt.Sprintf(`{"level":"Info","ts":%d,"message":"new"}`, after),
+		"new continuation",
+		`{"level":"Warn","ts":"2025-06-01T12:30:00Z","message":"newer"}`,
+	}, "\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/database/test/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, logs)
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	got, err := stdb.Database.GetLogsSince("test", since)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"new"`) || lines[1] != "new continuation" || !strings.Contains(lines[2], `"newer"`) {
+		t.Errorf("Unexpected filtered logs:\n%s", got)
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	disconnected := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("follow") != "true" {
+			t.Errorf("Expected follow=true, got %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, "first\r\nsecond\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(disconnected)
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").WithTimeout(50 * time.Millisecond).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lines []string
+	err = stdb.Database.FollowLogs(ctx, "test", func(line string) {
+		lines = append(lines, line)
+		if len(lines) == 2 {
+			// Outlive the client timeout before cancelling
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if !slices.Equal(lines, []string{"first", "second"}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Error("Expected the log stream to be closed after cancelling")
+	}
+}
+
+func TestFollowLogsStreamEnds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "only line")
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	var lines []string
+	db := stdb.ForDatabase("test")
+	if err := db.FollowLogs(context.Background(), func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatalf("Expected nil when the stream ends, got %v", err)
+	}
+	if !slices.Equal(lines, []string{"only line"}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
+)
+
+// tableUpdateJSON renders a table update with n circle rows as inserts
+func tableUpdateJSON(table string, first, n int) string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf(`"[%d,3,[0.6,-0.8],12.5,1718000000000000]"`, first+i)
+	}
+	return fmt.Sprintf(`{"table_id":4097,"table_name":%q,"num_rows":%d,"updates":[{"inserts":[%s],"deletes":[]}]}`,
+		table, n, strings.Join(rows, ","))
+}
+
+// benchFrames are representative frames: the initial rows of a blackholio
+// subscription and a per-tick transaction moving a few circles
+var benchFrames = []struct {
+	name  string
+	frame string
+}{
+	{
+		name: "InitialSubscription",
+		frame: fmt.Sprintf(`{"InitialSubscription":{"database_update":{"tables":[%s,%s]},"request_id":1,"total_host_execution_duration":{"__time_duration_micros__":1500}}}`,
+			tableUpdateJSON("circle", 0, 500), tableUpdateJSON("food", 0, 500)),
+	},
+	{
+		name: "TransactionUpdate",
+		frame: fmt.Sprintf(`{"TransactionUpdate":{"status":{"Committed":{"tables":[%s]}},"timestamp":{"__timestamp_micros_since_unix_epoch__":1718000000000000},"caller_identity":{"__identity__":"c2001a2b3c"},"caller_connection_id":{"__connection_id__":1},"reducer_call":{"reducer_name":"update_player_input","reducer_id":3,"args":"[[0.6,-0.8]]","request_id":7},"energy_quanta_used":{"quanta":0},"total_host_execution_duration":{"__time_duration_micros__":120}}}`,
+			tableUpdateJSON("circle", 0, 20)),
+	},
+}
+
+func BenchmarkParseServerMessage(b *testing.B) {
+	for _, bf := range benchFrames {
+		b.Run(bf.name, func(b *testing.B) {
+			data := []byte(bf.frame)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := client.ParseServerMessage(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkReceivePath reads frames from a local server. "reparse" is the
+// pattern of the examples, which re-encode the untyped message from
+// ReceiveMessage to parse it; "direct" parses the raw frame once with
+// ReceiveServerMessage.
+func BenchmarkReceivePath(b *testing.B) {
+	for _, bf := range benchFrames {
+		b.Run(bf.name+"/reparse", func(b *testing.B) {
+			conn := connectBenchServer(b, bf.frame)
+			b.SetBytes(int64(len(bf.frame)))
+			b.ReportAllocs()
+			for b.Loop() {
+				message, err := conn.ReceiveMessage()
+				if err != nil {
+					b.Fatal(err)
+				}
+				data, err := json.Marshal(message)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := client.ParseServerMessage(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(bf.name+"/direct", func(b *testing.B) {
+			conn := connectBenchServer(b, bf.frame)
+			b.SetBytes(int64(len(bf.frame)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := conn.ReceiveServerMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// connectBenchServer connects to a server that sends frame until the client disconnects
+func connectBenchServer(b *testing.B, frame string) *client.WebSocketConnection {
+	b.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+	}))
+	b.Cleanup(server.Close)
+	return connectTo(b, server)
+}
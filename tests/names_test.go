@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetNamesSuccess(t *testing.T) {
+	stdb := newTestClient(t, respondWith(http.StatusOK, `"Success"`))
+
+	results, err := stdb.Database.SetNames("test", []string{"alpha", "beta"})
+	if err != nil {
+		t.Fatalf("Failed to set names: %v", err)
+	}
+	for _, result := range results {
+		if !result.Registered || result.Error != "" {
+			t.Errorf("Expected %s to be registered, got %+v", result.Name, result)
+		}
+	}
+}
+
+func TestSetNamesPermissionDenied(t *testing.T) {
+	stdb := newTestClient(t, respondWith(http.StatusUnauthorized, `{"PermissionDeniedOnAny":{"domains":["beta"]}}`))
+
+	results, err := stdb.Database.SetNames("test", []string{"alpha", "beta"})
+	if err == nil {
+		t.Fatal("Expected an error when a name is denied")
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per name, got %+v", results)
+	}
+	if results[0].Registered || results[0].Error == "" || results[0].Error == "permission denied" {
+		t.Errorf("Expected alpha to be unset because of beta, got %+v", results[0])
+	}
+	if results[1].Registered || results[1].Error != "permission denied" {
+		t.Errorf("Expected beta to be denied, got %+v", results[1])
+	}
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
+)
+
+// newPoolServer serves every database with a TransactionUpdate naming it as the
+// reducer. Connections to "flaky" are closed after that message.
+func newPoolServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	connects := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		database := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/database/"), "/subscribe")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connects.Add(1)
+		frame := transactionFrame(database, "c2001a2b3c", `{"Committed":{"tables":[]}}`)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			return
+		}
+		if database == "flaky" {
+			return
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server, connects
+}
+
+// nextPoolMessage waits for the next message of a pool
+func nextPoolMessage(t *testing.T, pool *client.ConnectionPool) client.PoolMessage {
+	t.Helper()
+	select {
+	case msg, ok := <-pool.Messages():
+		if !ok {
+			t.Fatal("Messages closed unexpectedly")
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a pool message")
+	}
+	return client.PoolMessage{}
+}
+
+func TestConnectionPool(t *testing.T) {
+	server, connects := newPoolServer(t)
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	pool := stdb.Database.NewConnectionPool(client.SatsProtocol)
+	first, err := pool.Get("alpha")
+	if err != nil {
+		t.Fatalf("Failed to get alpha: %v", err)
+	}
+	if again, _ := pool.Get("alpha"); again != first {
+		t.Error("Expected Get to reuse the open connection")
+	}
+	if _, err := pool.Get("beta"); err != nil {
+		t.Fatalf("Failed to get beta: %v", err)
+	}
+	if got := pool.Databases(); !slices.Equal(got, []string{"alpha", "beta"}) {
+		t.Errorf("Unexpected pooled databases: %v", got)
+	}
+
+	// Messages are tagged with the database they came from
+	seen := map[string]bool{}
+	for range 2 {
+		msg := nextPoolMessage(t, pool)
+		tx, ok := msg.Message.AsTransactionUpdate()
+		if msg.Err != nil || !ok || tx.ReducerCall.ReducerName != msg.Database {
+			t.Fatalf("Unexpected pool message: %+v", msg)
+		}
+		seen[msg.Database] = true
+	}
+	if !seen["alpha"] || !seen["beta"] {
+		t.Errorf("Expected messages from alpha and beta, got %v", seen)
+	}
+
+	// A failed connection is reported and dropped, and Get connects again
+	if _, err := pool.Get("flaky"); err != nil {
+		t.Fatalf("Failed to get flaky: %v", err)
+	}
+	if msg := nextPoolMessage(t, pool); msg.Database != "flaky" || msg.Message == nil {
+		t.Fatalf("Expected the flaky message first, got %+v", msg)
+	}
+	if msg := nextPoolMessage(t, pool); msg.Database != "flaky" || msg.Err == nil {
+		t.Fatalf("Expected the flaky connection to fail, got %+v", msg)
+	}
+	if _, err := pool.Get("flaky"); err != nil {
+		t.Fatalf("Failed to reconnect flaky: %v", err)
+	}
+	if n := connects.Load(); n != 4 {
+		t.Errorf("Expected 4 connections, got %d", n)
+	}
+
+	if err := pool.CloseAll(); err != nil {
+		t.Errorf("CloseAll failed: %v", err)
+	}
+	for range pool.Messages() {
+		// Undelivered messages are dropped; the channel must close
+	}
+	if _, err := pool.Get("alpha"); !errors.Is(err, client.ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed after CloseAll, got %v", err)
+	}
+}
+
+func TestConnectionPoolConnectError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	pool := stdb.Database.NewConnectionPool(client.SatsProtocol)
+	defer pool.CloseAll()
+	if _, err := pool.Get("missing"); err == nil {
+		t.Fatal("Expected the handshake to fail")
+	}
+	if got := pool.Databases(); len(got) != 0 {
+		t.Errorf("Expected the failed connection to be dropped, got %v", got)
+	}
+}
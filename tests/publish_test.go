@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+const ownerIdentity = "c200aabbccddeeff00112233445566778899aabbccddeeff0011223344556677"
+
+// publishHandler serves a single existing database "chat" owned by ownerIdentity.
+// Publishing to it updates it, publishing anywhere else creates a database, and
+// clearing is rejected with 403 unless the request is authorized as the owner.
+func publishHandler() (http.HandlerFunc, *int) {
+	publishes := new(int)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/database/chat":
+			w.Write([]byte(`{"database_identity":{"__identity__":"c200"},"owner_identity":{"__identity__":"` + ownerIdentity + `"},"host_type":{"Wasm":[]},"initial_program":""}`))
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			*publishes++
+			if r.URL.Query().Get("clear") == "true" && r.Header.Get("Authorization") != "Bearer owner" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			op := "created"
+			if r.URL.Path == "/v1/database/chat" {
+				op = "updated"
+			}
+			w.Write([]byte(`{"Success":{"domain":null,"database_identity":"c200","op":"` + op + `"}}`))
+		}
+	}, publishes
+}
+
+func newPublishClient(t *testing.T, handler http.HandlerFunc, token, identity string) *client.Client {
+	t.Helper()
+	return newTestClient(t, handler, func(b *client.ClientBuilder) {
+		b.WithToken(token).WithIdentity(identity)
+	})
+}
+
+func TestPublishReportsClear(t *testing.T) {
+	handler, _ := publishHandler()
+	stdb := newPublishClient(t, handler, "owner", ownerIdentity)
+
+	resp, err := stdb.Database.PublishTo("chat", []byte("wasm"), true)
+	if err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if resp.Op() != "updated" || !resp.Cleared {
+		t.Errorf("Expected an updated and cleared database, got op %q cleared %v", resp.Op(), resp.Cleared)
+	}
+
+	resp, err = stdb.Database.PublishTo("fresh", []byte("wasm"), true)
+	if err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if resp.Op() != "created" || resp.Cleared {
+		t.Errorf("Expected a created database with nothing cleared, got op %q cleared %v", resp.Op(), resp.Cleared)
+	}
+}
+
+func TestPublishClearDenied(t *testing.T) {
+	handler, _ := publishHandler()
+	stdb := newPublishClient(t, handler, "someone-else", "")
+
+	_, err := stdb.Database.PublishTo("chat", []byte("wasm"), true)
+	if !errors.Is(err, client.ErrClearDenied) {
+		t.Fatalf("Expected ErrClearDenied, got %v", err)
+	}
+}
+
+func TestPublishDryRun(t *testing.T) {
+	handler, publishes := publishHandler()
+	owner := newPublishClient(t, handler, "owner", ownerIdentity)
+
+	resp, err := owner.Database.PublishWithOptions("chat", []byte("wasm"), client.PublishOptions{Clear: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed dry run: %v", err)
+	}
+	if !resp.DryRun || resp.Op() != "updated" || !resp.Cleared {
+		t.Errorf("Expected a dry run update that clears, got %+v", resp)
+	}
+
+	resp, err = owner.Database.PublishWithOptions("fresh", []byte("wasm"), client.PublishOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed dry run: %v", err)
+	}
+	if resp.Op() != "created" || resp.Cleared {
+		t.Errorf("Expected a dry run create, got %+v", resp)
+	}
+
+	other := newPublishClient(t, handler, "someone-else", "c201")
+	if _, err := other.Database.PublishWithOptions("chat", []byte("wasm"), client.PublishOptions{Clear: true, DryRun: true}); !errors.Is(err, client.ErrClearDenied) {
+		t.Errorf("Expected a dry run clear by a non-owner to be denied, got %v", err)
+	}
+
+	if *publishes != 0 {
+		t.Errorf("Expected dry runs not to publish, got %d publishes", *publishes)
+	}
+}
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// BenchmarkCallReducerMessage measures encoding a blackholio-style input update
+// and reports the bytes spent on the reducer name, the upper bound of what an
+// ID-based call could save per message
+func BenchmarkCallReducerMessage(b *testing.B) {
+	const reducerName = "update_player_input"
+	args := `[[0.6,-0.8]]`
+
+	var size int
+	for b.Loop() {
+		data, err := json.Marshal(client.NewCallReducerMessage(reducerName, args, 1, 0))
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+
+	b.ReportMetric(float64(size), "bytes/msg")
+	b.ReportMetric(float64(len(reducerName)), "name-bytes/msg")
+}
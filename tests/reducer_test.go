@@ -0,0 +1,508 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
+)
+
+func TestCallReducerInvalidArgument(t *testing.T) {
+	stdb, err := client.NewClientBuilder().WithBaseURL("http://localhost:1").WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	err = stdb.Database.CallReducer("test", "SendMessage", []any{"ok", make(chan int)})
+	if err == nil {
+		t.Fatal("Expected an error for an unserializable argument")
+	}
+	if !strings.Contains(err.Error(), "SendMessage") || !strings.Contains(err.Error(), "argument 1") {
+		t.Errorf("Expected the error to name the reducer and argument index, got: %v", err)
+	}
+}
+
+func TestInvalidReducerAndDatabaseNames(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	for _, name := range []string{"", "  ", "Send Message", "send/message", "send?x=1", "send#1", "send%2F"} {
+		if err := stdb.Database.CallReducer("test", name, nil); !errors.Is(err, client.ErrInvalidReducerName) {
+			t.Errorf("CallReducer(%q): expected ErrInvalidReducerName, got %v", name, err)
+		}
+		if err := client.NewCallReducerMessage(name, "[]", 1, 0).Validate(); !errors.Is(err, client.ErrInvalidReducerName) {
+			t.Errorf("Validate of a call to %q: expected ErrInvalidReducerName, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "\t", "chat/other", "chat?x"} {
+		if err := stdb.Database.CallReducer(name, "SendMessage", nil); !errors.Is(err, client.ErrInvalidDatabaseName) {
+			t.Errorf("CallReducer on %q: expected ErrInvalidDatabaseName, got %v", name, err)
+		}
+		if _, err := stdb.Database.ExecuteSQL(name, []string{"SELECT * FROM user"}); !errors.Is(err, client.ErrInvalidDatabaseName) {
+			t.Errorf("ExecuteSQL on %q: expected ErrInvalidDatabaseName, got %v", name, err)
+		}
+		if _, err := stdb.Database.ConnectWebSocket(name, client.SatsProtocol); !errors.Is(err, client.ErrInvalidDatabaseName) {
+			t.Errorf("ConnectWebSocket to %q: expected ErrInvalidDatabaseName, got %v", name, err)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected invalid names to be rejected before sending, got %d requests", n)
+	}
+
+	if err := stdb.Database.CallReducer("chat-2", "send_message", nil); err != nil {
+		t.Errorf("Expected a valid call to succeed, got %v", err)
+	}
+}
+
+func TestMarshalReducerArgsNestedStruct(t *testing.T) {
+	args, err := client.MarshalReducerArgs([]any{vector2{X: 0.5, Y: -1.25}})
+	if err != nil {
+		t.Fatalf("Failed to marshal arguments: %v", err)
+	}
+	if args != `[[0.5,-1.25]]` {
+		t.Errorf("Expected a Vector2 argument to nest as [[x,y]], got %s", args)
+	}
+
+	args, err = client.MarshalReducerArgs([]any{"north", vector2{X: 3, Y: 4}, circle{EntityID: 7, PlayerID: 2, Direction: vector2{X: 1, Y: 0}, Speed: 1.5}})
+	if err != nil {
+		t.Fatalf("Failed to marshal arguments: %v", err)
+	}
+	if args != `["north",[3,4],[7,2,[1,0],1.5,0]]` {
+		t.Errorf("Unexpected encoding of mixed arguments: %s", args)
+	}
+}
+
+func TestSendCallReducerArgsNestedStruct(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	received := make(chan *client.CallReducer, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var msg client.ClientMessage
+		if err := conn.ReadJSON(&msg); err == nil {
+			received <- msg.CallReducer
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn := connectTo(t, server)
+	if err := conn.SendCallReducerArgs("UpdatePlayerInput", []any{vector2{X: 0.5, Y: 0.5}}, 3); err != nil {
+		t.Fatalf("Failed to send reducer call: %v", err)
+	}
+
+	call := <-received
+	if call.Reducer != "UpdatePlayerInput" || call.RequestID != 3 {
+		t.Errorf("Unexpected reducer call: %+v", call)
+	}
+	if call.Args != `[[0.5,0.5]]` {
+		t.Errorf("Expected args [[0.5,0.5]], got %s", call.Args)
+	}
+}
+
+func TestMarshalReducerArgsStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"emoji", "hi 👋🏽", `["hi 👋🏽"]`},
+		{"newline and tab", "line one\nline\ttwo", `["line one\nline\ttwo"]`},
+		{"NUL", "a\x00b", `["a\u0000b"]`},
+		{"control characters", "\x01\x1b[0m\x7f", "[\"\\u0001\\u001b[0m\x7f\"]"},
+		{"quotes and backslashes", `say "hi" \ bye`, `["say \"hi\" \\ bye"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := client.MarshalReducerArgs([]any{tt.text})
+			if err != nil {
+				t.Fatalf("Failed to marshal arguments: %v", err)
+			}
+			if args != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, args)
+			}
+			var decoded []string
+			if err := json.Unmarshal([]byte(args), &decoded); err != nil || decoded[0] != tt.text {
+				t.Errorf("Expected the encoding to round trip, got %q (%v)", decoded, err)
+			}
+		})
+	}
+
+	_, err := client.MarshalReducerArgs([]any{"ok", vector2{}, "bad \xff\xfe bytes"})
+	if !errors.Is(err, client.ErrInvalidUTF8) {
+		t.Fatalf("Expected ErrInvalidUTF8, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "argument 2") {
+		t.Errorf("Expected the error to name the argument, got %v", err)
+	}
+
+	type message struct {
+		Text string
+	}
+	if _, err := client.EncodePositional(message{Text: "\xc3\x28"}); !errors.Is(err, client.ErrInvalidUTF8) || !strings.Contains(err.Error(), "$.Text") {
+		t.Errorf("Expected ErrInvalidUTF8 naming the field, got %v", err)
+	}
+}
+
+func TestSendCallReducerArgsInvalidUTF8(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	received := make(chan *client.CallReducer, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var msg client.ClientMessage
+		if err := conn.ReadJSON(&msg); err == nil {
+			received <- msg.CallReducer
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	strict := connectTo(t, server)
+	if err := strict.SendCallReducerArgs("SendMessage", []any{"bad \xff"}, 1); !errors.Is(err, client.ErrInvalidUTF8) {
+		t.Errorf("Expected ErrInvalidUTF8 by default, got %v", err)
+	}
+
+	lenient := connectTo(t, server, client.WithReplaceInvalidUTF8())
+	if err := lenient.SendCallReducerArgs("SendMessage", []any{"bad \xff\xfe\x00"}, 2); err != nil {
+		t.Fatalf("Failed to send reducer call: %v", err)
+	}
+	call := <-received
+	if call.RequestID != 2 || call.Args != "[\"bad \uFFFD\\u0000\"]" {
+		t.Errorf("Expected invalid bytes replaced and NUL escaped, got %+v", call)
+	}
+}
+
+func TestDefaultReducerFlags(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	received := make(chan *client.CallReducer, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg client.ClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			received <- msg.CallReducer
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn := connectTo(t, server, client.WithDefaultReducerFlags(client.CallReducerNoSuccessNotify))
+	if err := conn.SendCallReducer("Move", `[1]`, 1); err != nil {
+		t.Fatalf("SendCallReducer failed: %v", err)
+	}
+	if err := conn.SendCallReducerArgs("Move", []any{2}, 2); err != nil {
+		t.Fatalf("SendCallReducerArgs failed: %v", err)
+	}
+	if _, err := conn.CallReducer("Move", `[3]`); err != nil {
+		t.Fatalf("CallReducer failed: %v", err)
+	}
+	if err := conn.SendCallReducerWithFlags("Move", `[4]`, 4, client.CallReducerFullUpdate); err != nil {
+		t.Fatalf("SendCallReducerWithFlags failed: %v", err)
+	}
+
+	plain := connectTo(t, server)
+	if err := plain.SendCallReducer("Move", `[5]`, 5); err != nil {
+		t.Fatalf("SendCallReducer failed: %v", err)
+	}
+
+	want := map[string]uint8{
+		"[1]": client.CallReducerNoSuccessNotify,
+		"[2]": client.CallReducerNoSuccessNotify,
+		"[3]": client.CallReducerNoSuccessNotify,
+		"[4]": client.CallReducerFullUpdate,
+		"[5]": client.CallReducerFullUpdate,
+	}
+	for range want {
+		call := <-received
+		if flags, ok := want[call.Args]; !ok || call.Flags != flags {
+			t.Errorf("Call %s: expected flags %d, got %d", call.Args, flags, call.Flags)
+		}
+	}
+}
+
+func TestReducerCallInfoDecodeArgs(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+
+	var args struct {
+		Text string
+	}
+	info := client.ReducerCallInfo{ReducerName: "SendMessage", Args: []byte(`["hi"]`)}
+	if err := info.DecodeArgs(schema, &args); err != nil {
+		t.Fatalf("Failed to decode args: %v", err)
+	}
+	if args.Text != "hi" {
+		t.Errorf("Expected text 'hi', got %q", args.Text)
+	}
+
+	// Arguments may also arrive as a JSON string, and the reducer may be named by ID
+	args.Text = ""
+	info = client.ReducerCallInfo{ReducerID: 1, Args: []byte(`"[\"hello\"]"`)}
+	if err := info.DecodeArgs(schema, &args); err != nil {
+		t.Fatalf("Failed to decode string args by reducer ID: %v", err)
+	}
+	if args.Text != "hello" {
+		t.Errorf("Expected text 'hello', got %q", args.Text)
+	}
+
+	info = client.ReducerCallInfo{ReducerName: "SendMessage", Args: []byte(`[42]`)}
+	if err := info.DecodeArgs(schema, &args); err == nil {
+		t.Error("Expected an error for arguments not matching the reducer signature")
+	}
+	info = client.ReducerCallInfo{ReducerName: "Missing", Args: []byte(`[]`)}
+	if err := info.DecodeArgs(schema, &args); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("Expected an error naming the unknown reducer, got %v", err)
+	}
+}
+
+// namedArgsSchemaJSON declares a reducer whose parameters are listed in a
+// different order than the test passes them
+const namedArgsSchemaJSON = `{
+	"typespace": {"types": []},
+	"tables": [],
+	"reducers": [
+		{"name": "SendMessage", "params": {"elements": [
+			{"name": {"some": "channel"}, "algebraic_type": {"String": []}},
+			{"name": {"some": "text"}, "algebraic_type": {"String": []}},
+			{"name": {"some": "priority"}, "algebraic_type": {"U8": []}}
+		]}, "lifecycle": {"none": []}}
+	]
+}`
+
+func TestCallReducerNamed(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/database/chat/schema":
+			w.Write([]byte(namedArgsSchemaJSON))
+		case "/v1/database/chat/call/SendMessage":
+			body, _ := io.ReadAll(r.Body)
+			bodies <- string(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	err = stdb.Database.CallReducerNamed("chat", "SendMessage", map[string]any{"priority": 2, "text": "hi", "channel": "general"})
+	if err != nil {
+		t.Fatalf("Failed to call reducer: %v", err)
+	}
+	if body := <-bodies; body != `["general","hi",2]` {
+		t.Errorf("Expected arguments in parameter order, got %s", body)
+	}
+
+	type sendMessageArgs struct {
+		Priority uint8
+		Text     string
+		Channel  string
+	}
+	err = stdb.Database.CallReducerNamed("chat", "SendMessage", &sendMessageArgs{Priority: 1, Text: "yo", Channel: "random"})
+	if err != nil {
+		t.Fatalf("Failed to call reducer with struct arguments: %v", err)
+	}
+	if body := <-bodies; body != `["random","yo",1]` {
+		t.Errorf("Expected struct arguments in parameter order, got %s", body)
+	}
+
+	err = stdb.Database.CallReducerNamed("chat", "SendMessage", map[string]any{"text": "hi", "colour": "red"})
+	if err == nil || !strings.Contains(err.Error(), "missing arguments channel, priority") || !strings.Contains(err.Error(), "unknown arguments colour") {
+		t.Errorf("Expected missing and unknown arguments to be reported, got %v", err)
+	}
+	if err := stdb.Database.CallReducerNamed("chat", "Nope", nil); err == nil {
+		t.Error("Expected an error for an unknown reducer")
+	}
+	select {
+	case body := <-bodies:
+		t.Errorf("Expected invalid calls not to be sent, got %s", body)
+	default:
+	}
+}
+
+func TestReducerArgs(t *testing.T) {
+	chat := parseSchema(t, chatSchemaJSON)
+	named := parseSchema(t, namedArgsSchemaJSON)
+
+	type sendMessage struct {
+		Text string
+	}
+	type prioritizedMessage struct {
+		Text     string
+		Level    uint8 `stdb:"priority"`
+		Channel  string
+		internal int
+	}
+
+	tests := []struct {
+		name    string
+		schema  client.RawModuleDef
+		reducer string
+		args    any
+		want    string
+	}{
+		{"single field map", chat, "SendMessage", map[string]any{"text": "hi"}, `["hi"]`},
+		{"single field struct", chat, "SendMessage", sendMessage{Text: "hi"}, `["hi"]`},
+		{"multi field map", named, "SendMessage", map[string]any{"text": "hi", "priority": 3, "channel": "general"}, `["general","hi",3]`},
+		{"multi field struct", named, "SendMessage", &prioritizedMessage{Text: "hi", Level: 3, Channel: "general"}, `["general","hi",3]`},
+		{"positional", named, "SendMessage", []any{"general", "hi", 3}, `["general","hi",3]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.schema.ReducerArgs(tt.reducer, tt.args)
+			if err != nil {
+				t.Fatalf("ReducerArgs failed: %v", err)
+			}
+			encoded, err := client.MarshalReducerArgs(args)
+			if err != nil {
+				t.Fatalf("MarshalReducerArgs failed: %v", err)
+			}
+			if encoded != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, encoded)
+			}
+		})
+	}
+
+	type extraField struct {
+		Text  string
+		Color string
+	}
+	if _, err := chat.ReducerArgs("SendMessage", extraField{Text: "hi"}); err == nil || !strings.Contains(err.Error(), "unknown arguments Color") {
+		t.Errorf("Expected the unmatched field to be reported, got %v", err)
+	}
+	if _, err := named.ReducerArgs("SendMessage", sendMessage{Text: "hi"}); err == nil || !strings.Contains(err.Error(), "missing arguments channel, priority") {
+		t.Errorf("Expected missing parameters to be reported, got %v", err)
+	}
+	if _, err := named.ReducerArgs("SendMessage", []any{"hi"}); err == nil {
+		t.Error("Expected an error for too few positional arguments")
+	}
+	if _, err := named.ReducerArgs("SendMessage", 42); err == nil {
+		t.Error("Expected an error for unsupported arguments")
+	}
+}
+
+func TestCallReducerBulkResultOrder(t *testing.T) {
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var args []int
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Odd arguments fail, and later calls finish first
+		time.Sleep(time.Duration(10-args[0]) * time.Millisecond)
+		if args[0]%2 == 1 {
+			http.Error(w, fmt.Sprintf("odd %d", args[0]), http.StatusInternalServerError)
+		}
+	})
+
+	argsList := make([][]any, 10)
+	for i := range argsList {
+		argsList[i] = []any{i}
+	}
+	errs := stdb.Database.CallReducerBulk("test", "Add", argsList, 4)
+	if len(errs) != len(argsList) {
+		t.Fatalf("Expected %d results, got %d", len(argsList), len(errs))
+	}
+	for i, err := range errs {
+		if i%2 == 0 {
+			if err != nil {
+				t.Errorf("Call %d: expected success, got %v", i, err)
+			}
+			continue
+		}
+		var httpErr *client.HTTPError
+		if !errors.As(err, &httpErr) || !strings.Contains(httpErr.Body, fmt.Sprintf("odd %d", i)) {
+			t.Errorf("Call %d: expected its own failure, got %v", i, err)
+		}
+	}
+}
+
+func TestCallReducerBulkConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if current <= old || peak.CompareAndSwap(old, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	argsList := make([][]any, 12)
+	for i := range argsList {
+		argsList[i] = []any{i}
+	}
+	for i, err := range stdb.Database.CallReducerBulk("test", "Add", argsList, 3) {
+		if err != nil {
+			t.Errorf("Call %d failed: %v", i, err)
+		}
+	}
+	if got := peak.Load(); got > 3 || got < 2 {
+		t.Errorf("Expected up to 3 concurrent requests, got %d", got)
+	}
+}
+
+func TestCallReducerBulkStopsOnUnauthorized(t *testing.T) {
+	var requests atomic.Int32
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "token revoked", http.StatusUnauthorized)
+	})
+
+	argsList := make([][]any, 10)
+	for i := range argsList {
+		argsList[i] = []any{i}
+	}
+	errs := stdb.Database.CallReducerBulk("test", "Add", argsList, 1)
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("Expected dispatching to stop after 3 rejected calls, got %d requests", got)
+	}
+	for i, err := range errs {
+		var httpErr *client.HTTPError
+		switch {
+		case i < 3:
+			if !errors.As(err, &httpErr) || !httpErr.IsUnauthorized() {
+				t.Errorf("Call %d: expected the 401, got %v", i, err)
+			}
+		case err == nil || !strings.Contains(err.Error(), "repeated authentication failures"):
+			t.Errorf("Call %d: expected to be skipped, got %v", i, err)
+		}
+	}
+}
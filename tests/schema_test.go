@@ -0,0 +1,720 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// chatSchemaJSON is a trimmed v9 schema of the quickstart-chat module
+const chatSchemaJSON = `{
+	"typespace": {"types": [
+		{"Product": {"elements": [
+			{"name": {"some": "identity"}, "algebraic_type": {"Product": {"elements": [{"name": {"some": "__identity__"}, "algebraic_type": {"U256": []}}]}}},
+			{"name": {"some": "name"}, "algebraic_type": {"Sum": {"variants": [
+				{"name": {"some": "some"}, "algebraic_type": {"String": []}},
+				{"name": {"some": "none"}, "algebraic_type": {"Product": {"elements": []}}}
+			]}}},
+			{"name": {"some": "online"}, "algebraic_type": {"Bool": []}}
+		]}},
+		{"Product": {"elements": [
+			{"name": {"some": "sender"}, "algebraic_type": {"Product": {"elements": [{"name": {"some": "__identity__"}, "algebraic_type": {"U256": []}}]}}},
+			{"name": {"some": "sent"}, "algebraic_type": {"Product": {"elements": [{"name": {"some": "__timestamp_micros_since_unix_epoch__"}, "algebraic_type": {"I64": []}}]}}},
+			{"name": {"some": "text"}, "algebraic_type": {"String": []}}
+		]}}
+	]},
+	"tables": [
+		{"name": "user", "product_type_ref": 0, "primary_key": [0], "indexes": [], "constraints": [], "sequences": [],
+		 "schedule": {"none": []}, "table_type": {"User": []}, "table_access": {"Public": []}},
+		{"name": "message", "product_type_ref": 1, "primary_key": [], "indexes": [], "constraints": [], "sequences": [],
+		 "schedule": {"none": []}, "table_type": {"User": []}, "table_access": {"Public": []}}
+	],
+	"reducers": [
+		{"name": "SetName", "params": {"elements": [{"name": {"some": "name"}, "algebraic_type": {"String": []}}]}, "lifecycle": {"none": []}},
+		{"name": "SendMessage", "params": {"elements": [{"name": {"some": "text"}, "algebraic_type": {"String": []}}]}, "lifecycle": {"none": []}}
+	],
+	"types": [],
+	"misc_exports": [],
+	"row_level_security": []
+}`
+
+func parseSchema(t *testing.T, data string) client.RawModuleDef {
+	t.Helper()
+	var schema client.RawModuleDef
+	if err := json.Unmarshal([]byte(data), &schema); err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	return schema
+}
+
+func TestSchemaDiffNoChanges(t *testing.T) {
+	before := parseSchema(t, chatSchemaJSON)
+	after := parseSchema(t, chatSchemaJSON)
+
+	changes := client.SchemaDiff(before, after)
+	if !changes.IsEmpty() {
+		t.Fatalf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestSchemaDiffColumnRename(t *testing.T) {
+	before := parseSchema(t, chatSchemaJSON)
+	after := parseSchema(t, chatSchemaJSON)
+
+	// Rename message.text to message.body
+	body := "body"
+	after.Typespace.Types[1].Product.Elements[2].Name = &client.OptionalString{Some: &body}
+
+	changes := client.SchemaDiff(before, after)
+	if len(changes.ChangedTables) != 1 {
+		t.Fatalf("Expected 1 changed table, got %+v", changes.ChangedTables)
+	}
+
+	change := changes.ChangedTables[0]
+	if change.Name != "message" {
+		t.Errorf("Expected changed table 'message', got %q", change.Name)
+	}
+	if len(change.RemovedColumns) != 1 || change.RemovedColumns[0] != "text" {
+		t.Errorf("Expected removed column 'text', got %v", change.RemovedColumns)
+	}
+	if len(change.AddedColumns) != 1 || change.AddedColumns[0] != "body" {
+		t.Errorf("Expected added column 'body', got %v", change.AddedColumns)
+	}
+	if !changes.IsBreaking() {
+		t.Error("Expected a column rename to be breaking")
+	}
+}
+
+func TestSchemaDiffColumnRetype(t *testing.T) {
+	before := parseSchema(t, chatSchemaJSON)
+	after := parseSchema(t, chatSchemaJSON)
+
+	after.Typespace.Types[0].Product.Elements[2].AlgebraicType = client.AlgebraicType{Primitive: client.PrimitiveU8}
+
+	changes := client.SchemaDiff(before, after)
+	if len(changes.ChangedTables) != 1 || len(changes.ChangedTables[0].RetypedColumns) != 1 {
+		t.Fatalf("Expected 1 retyped column, got %+v", changes.ChangedTables)
+	}
+
+	retyped := changes.ChangedTables[0].RetypedColumns[0]
+	if retyped.Name != "online" || retyped.OldType != "bool" || retyped.NewType != "u8" {
+		t.Errorf("Unexpected retyped column: %+v", retyped)
+	}
+}
+
+func TestSchemaDiffReducerSignatureChange(t *testing.T) {
+	before := parseSchema(t, chatSchemaJSON)
+	after := parseSchema(t, chatSchemaJSON)
+
+	// SendMessage gains a second parameter
+	channel := "channel"
+	after.Reducers[1].Params.Elements = append(after.Reducers[1].Params.Elements, client.ProductTypeElement{
+		Name:          &client.OptionalString{Some: &channel},
+		AlgebraicType: client.AlgebraicType{Primitive: client.PrimitiveU32},
+	})
+
+	changes := client.SchemaDiff(before, after)
+	if len(changes.ChangedReducers) != 1 {
+		t.Fatalf("Expected 1 changed reducer, got %+v", changes.ChangedReducers)
+	}
+
+	change := changes.ChangedReducers[0]
+	if change.Name != "SendMessage" {
+		t.Errorf("Expected changed reducer 'SendMessage', got %q", change.Name)
+	}
+	if change.OldSignature != "(text: String)" || change.NewSignature != "(text: String, channel: u32)" {
+		t.Errorf("Unexpected signatures: %q -> %q", change.OldSignature, change.NewSignature)
+	}
+	if !changes.IsBreaking() {
+		t.Error("Expected a reducer signature change to be breaking")
+	}
+}
+
+func TestSchemaDiffAddedAndRemoved(t *testing.T) {
+	before := parseSchema(t, chatSchemaJSON)
+	after := parseSchema(t, chatSchemaJSON)
+
+	after.Tables = after.Tables[:1]
+	after.Tables = append(after.Tables, client.NewUserTable("channel", 1))
+	after.Reducers = append(after.Reducers, client.NewReducer("JoinChannel", client.ProductType{}))
+
+	changes := client.SchemaDiff(before, after)
+	if len(changes.AddedTables) != 1 || changes.AddedTables[0] != "channel" {
+		t.Errorf("Expected added table 'channel', got %v", changes.AddedTables)
+	}
+	if len(changes.RemovedTables) != 1 || changes.RemovedTables[0] != "message" {
+		t.Errorf("Expected removed table 'message', got %v", changes.RemovedTables)
+	}
+	if len(changes.AddedReducers) != 1 || changes.AddedReducers[0] != "JoinChannel" {
+		t.Errorf("Expected added reducer 'JoinChannel', got %v", changes.AddedReducers)
+	}
+}
+
+func TestReducerIDLookup(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+
+	id, ok := schema.ReducerID("SendMessage")
+	if !ok || id != 1 {
+		t.Fatalf("Expected SendMessage to have ID 1, got %d, %v", id, ok)
+	}
+	if name, ok := schema.ReducerName(id); !ok || name != "SendMessage" {
+		t.Errorf("Expected ID %d to resolve to SendMessage, got %q, %v", id, name, ok)
+	}
+	if _, ok := schema.ReducerID("Missing"); ok {
+		t.Error("Expected unknown reducer to have no ID")
+	}
+	if _, ok := schema.ReducerName(99); ok {
+		t.Error("Expected out-of-range ID to have no name")
+	}
+}
+
+func TestDecodeProductNested(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+	userType := schema.Typespace.Types[0].GetProduct()
+
+	row := `[["c200aabbccddeeff00112233445566778899aabbccddeeff0011223344556677"],[0,"alice"],true]`
+	value, err := schema.Typespace.DecodeProduct([]byte(row), *userType)
+	if err != nil {
+		t.Fatalf("Failed to decode user row: %v", err)
+	}
+	if len(value.Elements) != 3 {
+		t.Fatalf("Expected 3 elements, got %d", len(value.Elements))
+	}
+
+	identity, ok := value.Elements[0].(client.ProductValue)
+	if !ok || len(identity.Elements) != 1 {
+		t.Fatalf("Expected identity to decode as a product, got %#v", value.Elements[0])
+	}
+	if hex := identity.Elements[0].(client.BuiltinValue).Value; hex != "c200aabbccddeeff00112233445566778899aabbccddeeff0011223344556677" {
+		t.Errorf("Unexpected identity value %v", hex)
+	}
+
+	name, ok := value.Elements[1].(client.SumValue)
+	if !ok || name.Tag != "some" {
+		t.Fatalf("Expected name to decode as a 'some' sum, got %#v", value.Elements[1])
+	}
+	if name.Value.(client.BuiltinValue).Value != "alice" {
+		t.Errorf("Expected name 'alice', got %v", name.Value)
+	}
+	if value.Elements[2].(client.BuiltinValue).Value != true {
+		t.Errorf("Expected online to be true, got %v", value.Elements[2])
+	}
+
+	none, err := schema.Typespace.DecodeProduct([]byte(`[["00"],[1,[]],false]`), *userType)
+	if err != nil {
+		t.Fatalf("Failed to decode user row without a name: %v", err)
+	}
+	if tag := none.Elements[1].(client.SumValue).Tag; tag != "none" {
+		t.Errorf("Expected 'none' tag, got %q", tag)
+	}
+}
+
+func TestDecodeValueArraysAndErrors(t *testing.T) {
+	var typespace client.Typespace
+	var arrayType client.AlgebraicType
+	if err := json.Unmarshal([]byte(`{"Array": {"I32": []}}`), &arrayType); err != nil {
+		t.Fatalf("Failed to parse array type: %v", err)
+	}
+
+	value, err := typespace.DecodeValue([]byte(`[1,2,3]`), arrayType)
+	if err != nil {
+		t.Fatalf("Failed to decode array: %v", err)
+	}
+	elements := value.(client.BuiltinValue).Value.([]client.AlgebraicValue)
+	if len(elements) != 3 || elements[2].(client.BuiltinValue).Value != int32(3) {
+		t.Errorf("Unexpected array elements %#v", elements)
+	}
+
+	if _, err := typespace.DecodeValue([]byte(`[1,"two"]`), arrayType); err == nil {
+		t.Error("Expected error for mistyped array element")
+	}
+
+	schema := parseSchema(t, chatSchemaJSON)
+	if _, err := schema.Typespace.DecodeProduct([]byte(`[["00"],[0,"bob"]]`), *schema.Typespace.Types[0].GetProduct()); err == nil {
+		t.Error("Expected error for short product")
+	}
+}
+
+func TestTableSchemas(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+
+	tables := schema.TableSchemas()
+	if len(tables) != 2 {
+		t.Fatalf("Expected 2 tables, got %d", len(tables))
+	}
+
+	user := tables[0]
+	if user.Name != "user" || !user.IsPublic || user.IsSystem {
+		t.Errorf("Unexpected user table %+v", user)
+	}
+	if len(user.PrimaryKey) != 1 || user.PrimaryKey[0] != "identity" {
+		t.Errorf("Expected primary key [identity], got %v", user.PrimaryKey)
+	}
+	if len(user.Columns) != 3 {
+		t.Fatalf("Expected 3 user columns, got %d", len(user.Columns))
+	}
+	if got := schema.Typespace.FormatType(user.Columns[1].Type); got != "Option<String>" {
+		t.Errorf("Expected name column of type Option<String>, got %s", got)
+	}
+
+	message := tables[1]
+	if len(message.PrimaryKey) != 0 {
+		t.Errorf("Expected message table to have no primary key, got %v", message.PrimaryKey)
+	}
+	if message.Columns[2].Name != "text" || message.Columns[2].Type.Primitive != client.PrimitiveString {
+		t.Errorf("Unexpected text column %+v", message.Columns[2])
+	}
+}
+
+func TestTableSchemasUnnamedColumns(t *testing.T) {
+	schema := parseSchema(t, `{
+		"typespace": {"types": [{"Product": {"elements": [
+			{"algebraic_type": {"U32": []}},
+			{"algebraic_type": {"String": []}}
+		]}}]},
+		"tables": [{"name": "st_pairs", "product_type_ref": 0, "primary_key": [0], "indexes": [], "constraints": [],
+			"sequences": [], "schedule": {"none": []}, "table_type": {"System": []}, "table_access": {"Private": []}}],
+		"reducers": [], "types": [], "misc_exports": [], "row_level_security": []
+	}`)
+
+	tables := schema.TableSchemas()
+	if len(tables) != 1 {
+		t.Fatalf("Expected 1 table, got %d", len(tables))
+	}
+	table := tables[0]
+	if table.IsPublic || !table.IsSystem {
+		t.Errorf("Expected a private system table, got %+v", table)
+	}
+	if table.Columns[0].Name != "col_0" || table.Columns[1].Name != "col_1" {
+		t.Errorf("Expected positional column names, got %+v", table.Columns)
+	}
+	if len(table.PrimaryKey) != 1 || table.PrimaryKey[0] != "col_0" {
+		t.Errorf("Expected primary key [col_0], got %v", table.PrimaryKey)
+	}
+}
+
+func TestPrimaryKeyColumns(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+
+	columns, err := schema.PrimaryKeyColumns("user")
+	if err != nil {
+		t.Fatalf("PrimaryKeyColumns failed: %v", err)
+	}
+	if len(columns) != 1 || columns[0] != "identity" {
+		t.Errorf("Expected primary key [identity], got %v", columns)
+	}
+
+	columns, err = schema.PrimaryKeyColumns("message")
+	if err != nil {
+		t.Fatalf("PrimaryKeyColumns failed: %v", err)
+	}
+	if columns == nil || len(columns) != 0 {
+		t.Errorf("Expected an empty primary key for message, got %#v", columns)
+	}
+
+	if _, err := schema.PrimaryKeyColumns("missing"); err == nil {
+		t.Error("Expected an error for an unknown table")
+	}
+}
+
+func TestPrimaryKeyColumnsCompositeKey(t *testing.T) {
+	schema := parseSchema(t, `{
+		"typespace": {"types": [{"Product": {"elements": [
+			{"name": {"some": "region"}, "algebraic_type": {"U32": []}},
+			{"name": {"some": "slot"}, "algebraic_type": {"U16": []}},
+			{"name": {"some": "owner"}, "algebraic_type": {"String": []}}
+		]}}]},
+		"tables": [{"name": "slots", "product_type_ref": 0, "primary_key": [1, 0], "indexes": [], "constraints": [],
+			"sequences": [], "schedule": {"none": []}, "table_type": {"User": []}, "table_access": {"Public": []}}],
+		"reducers": [], "types": [], "misc_exports": [], "row_level_security": []
+	}`)
+
+	columns, err := schema.PrimaryKeyColumns("slots")
+	if err != nil {
+		t.Fatalf("PrimaryKeyColumns failed: %v", err)
+	}
+	if len(columns) != 2 || columns[0] != "slot" || columns[1] != "region" {
+		t.Errorf("Expected primary key [slot region], got %v", columns)
+	}
+
+	schema.Tables[0].PrimaryKey = []any{float64(5)}
+	if _, err := schema.PrimaryKeyColumns("slots"); err == nil {
+		t.Error("Expected an error for an out of range key column")
+	}
+}
+
+func TestRowLevelSecurityRules(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+	if rules := schema.RowLevelSecurityRules(); len(rules) != 0 {
+		t.Fatalf("Expected no rules, got %+v", rules)
+	}
+
+	schema.RowLevelSecurity = []any{
+		map[string]any{"sql": "SELECT * FROM user WHERE identity = :sender"},
+		map[string]any{"sql": "SELECT m.* FROM user u JOIN message m ON u.identity = m.sender WHERE u.online = true"},
+		map[string]any{"sql": "select message.* from message where text != ''"},
+	}
+
+	rules := schema.RowLevelSecurityRules()
+	expected := []client.RowLevelSecurityRule{
+		{SQL: "SELECT * FROM user WHERE identity = :sender", Table: "user", UsesSender: true},
+		{SQL: "SELECT m.* FROM user u JOIN message m ON u.identity = m.sender WHERE u.online = true", Table: "message"},
+		{SQL: "select message.* from message where text != ''", Table: "message"},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %+v", len(expected), rules)
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, expected[i], rules[i])
+		}
+	}
+
+	if tables := schema.RestrictedTables(); len(tables) != 2 || tables[0] != "message" || tables[1] != "user" {
+		t.Errorf("Expected restricted tables [message user], got %v", tables)
+	}
+}
+
+func TestPublicAndPrivateTables(t *testing.T) {
+	schema := parseSchema(t, chatSchemaJSON)
+	if tables := schema.PublicTables(); !slices.Equal(tables, []string{"message", "user"}) {
+		t.Errorf("Expected public tables [message user], got %v", tables)
+	}
+	if tables := schema.PrivateTables(); tables == nil || len(tables) != 0 {
+		t.Errorf("Expected an empty list of private tables, got %v", tables)
+	}
+
+	schema.Tables[1].TableAccess = client.TableAccessType{Private: []any{}}
+	schema.Tables = append(schema.Tables, client.TableDef{Name: "audit_log", TableAccess: client.TableAccessType{Private: []any{}}})
+	if tables := schema.PublicTables(); !slices.Equal(tables, []string{"user"}) {
+		t.Errorf("Expected public tables [user], got %v", tables)
+	}
+	if tables := schema.PrivateTables(); !slices.Equal(tables, []string{"audit_log", "message"}) {
+		t.Errorf("Expected private tables [audit_log message], got %v", tables)
+	}
+}
+
+func TestRowDecoders(t *testing.T) {
+	def := parseSchema(t, chatSchemaJSON)
+	decoders := client.NewRowDecoders(&def)
+
+	decoder, err := decoders.PrepareDecoder("user")
+	if err != nil {
+		t.Fatalf("Failed to prepare decoder: %v", err)
+	}
+	if again, _ := decoders.PrepareDecoder("user"); again != decoder {
+		t.Error("Expected the decoder to be cached per table")
+	}
+	if len(decoder.Columns) != 3 || decoder.Columns[1].Name != "name" {
+		t.Errorf("Unexpected columns: %+v", decoder.Columns)
+	}
+
+	// Fields are matched by column name, not position
+	var user struct {
+		Online   bool
+		Name     *string
+		Identity string
+	}
+	if err := decoder.Decode([]byte(`[["c200ab"],[0,"alice"],true]`), &user); err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	if user.Identity != "c200ab" || user.Name == nil || *user.Name != "alice" || !user.Online {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+
+	if err := decoder.Decode([]byte(`[["c200ab"],[1,[]]]`), &user); err == nil {
+		t.Error("Expected an error for a row with missing columns")
+	}
+	var partial struct{ Identity string }
+	if err := decoder.Decode([]byte(`[["c200ab"],[1,[]],false]`), &partial); err == nil {
+		t.Error("Expected an error for a struct without a field for every column")
+	}
+	if _, err := decoders.PrepareDecoder("missing"); err == nil {
+		t.Error("Expected an error for an unknown table")
+	}
+}
+
+func TestAlgebraicTypeUnknownTag(t *testing.T) {
+	// A newer server may use type tags this client doesn't know
+	def := parseSchema(t, `{
+		"typespace": {"types": [{"Product": {"elements": [
+			{"name": {"some": "id"}, "algebraic_type": {"U64": []}},
+			{"name": {"some": "half"}, "algebraic_type": {"F16": []}}
+		]}}]},
+		"tables": [{"name": "sample", "product_type_ref": 0, "primary_key": [0], "table_type": {"User": []}, "table_access": {"Public": []}}],
+		"reducers": []
+	}`)
+	if warnings := def.SchemaParseWarnings(); len(warnings) != 0 {
+		t.Errorf("Expected a nested unknown type to decode without warnings, got %v", warnings)
+	}
+
+	schemas := def.TableSchemas()
+	if len(schemas) != 1 || len(schemas[0].Columns) != 2 {
+		t.Fatalf("Expected the table with both columns, got %+v", schemas)
+	}
+	half := schemas[0].Columns[1].Type
+	if string(half.Unknown) != `{"F16": []}` {
+		t.Errorf("Expected the unknown type to keep its encoding, got %s", half.Unknown)
+	}
+	if got := def.Typespace.FormatType(half); got != "unknown" {
+		t.Errorf("Expected the unknown type to format as unknown, got %s", got)
+	}
+
+	encoded, err := json.Marshal(half)
+	if err != nil {
+		t.Fatalf("Failed to encode unknown type: %v", err)
+	}
+	if string(encoded) != `{"F16":[]}` {
+		t.Errorf("Expected the unknown type to encode as received, got %s", encoded)
+	}
+}
+
+func TestSchemaParseWarnings(t *testing.T) {
+	if warnings := parseSchema(t, chatSchemaJSON).SchemaParseWarnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for a complete schema, got %v", warnings)
+	}
+
+	// A schema from a different server version: an unknown field, no reducers,
+	// and a table in a shape this client can't decode
+	def := parseSchema(t, `{
+		"typespace": {"types": [
+			{"Product": {"elements": [{"name": {"some": "id"}, "algebraic_type": {"U64": []}}]}},
+			{"NewKind": []}
+		]},
+		"tables": [
+			{"name": "player", "product_type_ref": 0, "primary_key": [0], "table_type": {"User": []}, "table_access": {"Public": []}},
+			{"name": "broken", "product_type_ref": "zero"}
+		],
+		"views": []
+	}`)
+
+	if len(def.Tables) != 1 || def.Tables[0].Name != "player" {
+		t.Errorf("Expected the decodable table to be kept, got %+v", def.Tables)
+	}
+	if len(def.Typespace.Types) != 2 {
+		t.Errorf("Expected undecodable types to keep their slot, got %d types", len(def.Typespace.Types))
+	}
+	if schemas := def.TableSchemas(); len(schemas) != 1 || len(schemas[0].Columns) != 1 {
+		t.Errorf("Expected the partial schema to stay usable, got %+v", schemas)
+	}
+
+	warnings := def.SchemaParseWarnings()
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %v", warnings)
+	}
+	for i, prefix := range []string{"typespace.types[1]", "tables[1]", `missing field "reducers"`} {
+		if !strings.HasPrefix(warnings[i], prefix) {
+			t.Errorf("Expected warning %d to start with %s, got %q", i, prefix, warnings[i])
+		}
+	}
+
+	var invalid client.RawModuleDef
+	if err := json.Unmarshal([]byte(`[]`), &invalid); err == nil {
+		t.Error("Expected an error for a schema that is not an object")
+	}
+}
+
+func TestSchemaParseReducerPlaceholders(t *testing.T) {
+	// The second reducer is in a shape this client can't decode
+	def := parseSchema(t, `{
+		"typespace": {"types": []},
+		"tables": [],
+		"reducers": [
+			{"name": "send_message", "params": {"elements": [{"name": {"some": "text"}, "algebraic_type": {"String": []}}]}, "lifecycle": {"none": []}},
+			{"name": "future", "params": "new params encoding"},
+			{"name": "set_name", "params": {"elements": [{"name": {"some": "name"}, "algebraic_type": {"String": []}}]}, "lifecycle": {"none": []}}
+		]
+	}`)
+
+	if warnings := def.SchemaParseWarnings(); len(warnings) != 1 || !strings.HasPrefix(warnings[0], "reducers[1]") {
+		t.Errorf("Expected a warning for reducers[1], got %v", warnings)
+	}
+
+	// Reducers after the undecodable one keep the server's reducer IDs
+	if id, ok := def.ReducerID("set_name"); !ok || id != 2 {
+		t.Errorf("Expected set_name to have reducer ID 2, got %d, %v", id, ok)
+	}
+	if name, ok := def.ReducerName(2); !ok || name != "set_name" {
+		t.Errorf("Expected reducer ID 2 to be set_name, got %q, %v", name, ok)
+	}
+	if name, ok := def.ReducerName(1); ok {
+		t.Errorf("Expected the undecodable reducer ID 1 to be unknown, got %q", name)
+	}
+	if _, ok := def.ReducerID(""); ok {
+		t.Error("Expected no reducer ID for an empty name")
+	}
+
+	var args struct{ Name string }
+	info := client.ReducerCallInfo{ReducerID: 2, Args: json.RawMessage(`["alice"]`)}
+	if err := info.DecodeArgs(def, &args); err != nil || args.Name != "alice" {
+		t.Errorf("Expected the arguments of reducer ID 2 to decode as set_name, got %+v, %v", args, err)
+	}
+	info = client.ReducerCallInfo{ReducerID: 1, Args: json.RawMessage(`["alice"]`)}
+	if err := info.DecodeArgs(def, &args); err == nil {
+		t.Error("Expected an error decoding the arguments of the undecodable reducer")
+	}
+
+	var names []string
+	for _, signature := range def.ReducerSignatures() {
+		names = append(names, signature.Name)
+	}
+	if !slices.Equal(names, []string{"send_message", "set_name"}) {
+		t.Errorf("Expected the placeholder to be left out of the signatures, got %v", names)
+	}
+}
+
+func TestReducerSignatures(t *testing.T) {
+	def := parseSchema(t, `{
+		"typespace": {"types": [
+			{"Product": {"elements": [
+				{"name": {"some": "x"}, "algebraic_type": {"F32": []}},
+				{"name": {"some": "y"}, "algebraic_type": {"F32": []}}
+			]}}
+		]},
+		"tables": [],
+		"reducers": [
+			{"name": "init", "params": {"elements": []}, "lifecycle": {"some": {"Init": []}}},
+			{"name": "identity_connected", "params": {"elements": []}, "lifecycle": {"some": {"OnConnect": []}}},
+			{"name": "update_player_input", "params": {"elements": [
+				{"name": {"some": "direction"}, "algebraic_type": {"Ref": 0}},
+				{"algebraic_type": {"U32": []}}
+			]}, "lifecycle": {"none": []}}
+		]
+	}`)
+
+	signatures := def.ReducerSignatures()
+	if len(signatures) != 3 {
+		t.Fatalf("Expected 3 reducers, got %d", len(signatures))
+	}
+	if signatures[0].Lifecycle != "Init" || signatures[1].Lifecycle != "OnConnect" || signatures[0].Callable() {
+		t.Errorf("Expected lifecycle reducers to be flagged, got %+v", signatures[:2])
+	}
+
+	input := signatures[2]
+	if !input.Callable() || input.Lifecycle != "" {
+		t.Errorf("Expected update_player_input to be callable, got %+v", input)
+	}
+	if len(input.Params) != 2 || input.Params[0].Name != "direction" || input.Params[1].Name != "col_1" {
+		t.Fatalf("Unexpected params: %+v", input.Params)
+	}
+	if input.Params[0].Type.Product == nil || len(input.Params[0].Type.Product.Elements) != 2 {
+		t.Errorf("Expected the Vector2 parameter to be resolved through the typespace, got %+v", input.Params[0].Type)
+	}
+	if def.Typespace.FormatType(input.Params[1].Type) != "u32" {
+		t.Errorf("Unexpected type for the unnamed parameter: %s", def.Typespace.FormatType(input.Params[1].Type))
+	}
+}
+
+// wasmWithExports builds a minimal WebAssembly binary whose export section
+// lists the given function names
+func wasmWithExports(names ...string) []byte {
+	section := []byte{byte(len(names))}
+	for i, name := range names {
+		section = append(section, byte(len(name)))
+		section = append(section, name...)
+		section = append(section, 0x00, byte(i)) // function export and its index
+	}
+	wasm := []byte("\x00asm\x01\x00\x00\x00")
+	wasm = append(wasm, 0x07, byte(len(section)))
+	return append(wasm, section...)
+}
+
+func TestExtractSchema(t *testing.T) {
+	_, err := client.ExtractSchema(wasmWithExports("memory", "__describe_module__", "__call_reducer__"))
+	if !errors.Is(err, client.ErrWasmRuntimeRequired) {
+		t.Errorf("Expected ErrWasmRuntimeRequired for a SpacetimeDB module, got %v", err)
+	}
+
+	if _, err := client.ExtractSchema(wasmWithExports("_start")); !errors.Is(err, client.ErrNotSpacetimeModule) {
+		t.Errorf("Expected ErrNotSpacetimeModule, got %v", err)
+	}
+	if _, err := client.ExtractSchema([]byte(chatSchemaJSON)); !errors.Is(err, client.ErrNotWasmModule) {
+		t.Errorf("Expected ErrNotWasmModule for JSON, got %v", err)
+	}
+
+	truncated := wasmWithExports("__describe_module__")
+	if _, err := client.ExtractSchema(truncated[:len(truncated)-4]); !errors.Is(err, client.ErrNotWasmModule) {
+		t.Errorf("Expected ErrNotWasmModule for a truncated module, got %v", err)
+	}
+}
+
+func TestWatchSchema(t *testing.T) {
+	renamed := strings.Replace(chatSchemaJSON, `"name": "message"`, `"name": "note"`, 1)
+	// Polls see the same schema twice, a failure, then a changed schema
+	responses := []string{chatSchemaJSON, chatSchemaJSON, "", renamed}
+
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := responses[min(polls, len(responses)-1)]
+		polls++
+		mu.Unlock()
+
+		if body == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	schemas, stop := stdb.Database.WatchSchema("chat", 5*time.Millisecond)
+	var tables [][]string
+	for len(tables) < 2 {
+		select {
+		case schema := <-schemas:
+			tables = append(tables, schema.PublicTables())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for schemas, got %v", tables)
+		}
+	}
+	stop()
+
+	if !slices.Equal(tables[0], []string{"message", "user"}) || !slices.Equal(tables[1], []string{"note", "user"}) {
+		t.Errorf("Expected the first schema and then the changed one, got %v", tables)
+	}
+	// The channel is closed once the watcher stops
+	for range schemas {
+	}
+}
+
+func TestWatchSchemaNonPositiveInterval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(chatSchemaJSON))
+	}))
+	defer server.Close()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	schemas, stop := stdb.Database.WatchSchema("chat", 0)
+	defer stop()
+	select {
+	case schema := <-schemas:
+		if len(schema.Tables) != 2 {
+			t.Errorf("Unexpected schema %+v", schema)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the first schema")
+	}
+}
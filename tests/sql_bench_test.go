@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// BenchmarkExecuteSQLBurst measures concurrent ExecuteSQL calls against a local
+// server, with the default transport and with more idle connections per host.
+// With the default of 2, most of a burst opens and closes its own connection;
+// the conns/op metric reports how many connections the server accepted.
+func BenchmarkExecuteSQLBurst(b *testing.B) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"schema":{"elements":[]},"rows":[]}]`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	b.Cleanup(server.Close)
+
+	benchmarks := []struct {
+		name    string
+		options func(*client.ClientBuilder) *client.ClientBuilder
+	}{
+		{"default", func(builder *client.ClientBuilder) *client.ClientBuilder { return builder }},
+		{"max-idle-64", func(builder *client.ClientBuilder) *client.ClientBuilder { return builder.WithMaxIdleConns(64) }},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			stdb, err := bm.options(client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token")).Build()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer stdb.Close()
+
+			conns.Store(0)
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := stdb.Database.ExecuteSQL("test", []string{"SELECT * FROM user"}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
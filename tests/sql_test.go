@@ -0,0 +1,427 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	script := `SELECT * FROM t WHERE s = 'a;b'; SELECT * FROM "odd;name";; SELECT * FROM t WHERE s = 'it''s; fine';`
+	expected := []string{
+		`SELECT * FROM t WHERE s = 'a;b'`,
+		`SELECT * FROM "odd;name"`,
+		`SELECT * FROM t WHERE s = 'it''s; fine'`,
+	}
+	if statements := client.SplitSQLStatements(script); !slices.Equal(statements, expected) {
+		t.Errorf("Expected %q, got %q", expected, statements)
+	}
+}
+
+func TestExecuteSQLSemicolonInLiteral(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		// Like the server, answer with one result per parsed statement
+		statements := client.SplitSQLStatements(string(body))
+		results := make([]string, len(statements))
+		for i := range statements {
+			results[i] = `{"schema":{"elements":[]},"rows":[]}`
+		}
+		w.Write([]byte("[" + strings.Join(results, ",") + "]"))
+	}))
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	query := "SELECT * FROM t WHERE s = 'a;b'"
+	results, err := stdb.Database.ExecuteSQL("test", []string{query})
+	if err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected the query to execute as one statement, got %d results", len(results))
+	}
+	if bodies[0] != query {
+		t.Errorf("Expected the query to be sent unchanged, got %q", bodies[0])
+	}
+
+	results, err = stdb.Database.ExecuteSQL("test", []string{query + ";", "", "SELECT * FROM u;"})
+	if err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected trailing semicolons and empty queries to be dropped, got %d results for %q", len(results), bodies[1])
+	}
+
+	if _, err := stdb.Database.ExecuteSQL("test", []string{" ; "}); err == nil {
+		t.Error("Expected an error when no statement remains")
+	}
+}
+
+func TestExecuteSQLRejectsTransactions(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithToken("token").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	scripts := [][]string{
+		{"BEGIN", "UPDATE counter SET value = 1", "COMMIT"},
+		{"UPDATE counter SET value = 1; rollback;"},
+		{"start\ttransaction"},
+	}
+	for _, queries := range scripts {
+		if _, err := stdb.Database.ExecuteSQL("test", queries); !errors.Is(err, client.ErrSQLTransactionUnsupported) {
+			t.Errorf("Expected ErrSQLTransactionUnsupported for %q, got %v", queries, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request for rejected scripts, got %d", requests)
+	}
+
+	// Keywords inside literals and identifiers are not statements
+	if _, err := stdb.Database.ExecuteSQL("test", []string{"SELECT * FROM events WHERE kind = 'BEGIN; COMMIT'"}); err != nil {
+		t.Errorf("Expected a query mentioning BEGIN in a literal to run, got %v", err)
+	}
+}
+
+func TestRowsEqual(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []any
+		equal bool
+	}{
+		{"numbers of different types", []any{float64(1), "alice"}, []any{1, "alice"}, true},
+		{"unsigned and float", []any{uint64(42), float32(1.5)}, []any{42.0, 1.5}, true},
+		{"different numbers", []any{1.0}, []any{2}, false},
+		{"number and string", []any{1.0}, []any{"1"}, false},
+		{"some option", []any{[]any{0.0, []any{3.0, "x"}}}, []any{[]any{0, []any{3, "x"}}}, true},
+		{"none option", []any{[]any{1.0, []any{}}}, []any{[]any{1, []any{}}}, true},
+		{"some and none", []any{[]any{0.0, "x"}}, []any{[]any{1, []any{}}}, false},
+		{"typed slices", []any{[]int{1, 2}}, []any{[]any{1.0, 2.0}}, true},
+		{"nil cells", []any{nil, "a"}, []any{nil, "a"}, true},
+		{"nil and value", []any{nil}, []any{0}, false},
+		{"different lengths", []any{1}, []any{1, 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.RowsEqual(tt.a, tt.b); got != tt.equal {
+				t.Errorf("RowsEqual(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestSQLResultEqualUnordered(t *testing.T) {
+	var got []client.SQLResult
+	if err := json.Unmarshal([]byte(`[{
+		"schema": {"elements": [
+			{"name": {"some": "id"}, "algebraic_type": {"U32": []}},
+			{"name": {"some": "name"}, "algebraic_type": {"Sum": {"variants": [
+				{"name": {"some": "some"}, "algebraic_type": {"String": []}},
+				{"name": {"some": "none"}, "algebraic_type": {"Product": {"elements": []}}}
+			]}}}
+		]},
+		"rows": [[1, [0, "alice"]], [2, [1, []]], [2, [1, []]]]
+	}]`), &got); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	want := got[0]
+	want.Rows = []any{
+		[]any{2, []any{1, []any{}}},
+		[]any{1, []any{0, "alice"}},
+		[]any{2, []any{1, []any{}}},
+	}
+	if !got[0].EqualUnordered(want) {
+		t.Error("Expected results with reordered rows to be equal")
+	}
+
+	want.Rows = []any{
+		[]any{1, []any{0, "alice"}},
+		[]any{1, []any{0, "alice"}},
+		[]any{2, []any{1, []any{}}},
+	}
+	if got[0].EqualUnordered(want) {
+		t.Error("Expected duplicate rows to be counted")
+	}
+
+	want.Rows = want.Rows[:2]
+	if got[0].EqualUnordered(want) {
+		t.Error("Expected results with different row counts to differ")
+	}
+
+	renamed := got[0]
+	renamed.Schema = client.ProductType{Elements: slices.Clone(got[0].Schema.Elements)}
+	renamed.Schema.Elements[0].Name = nil
+	if got[0].EqualUnordered(renamed) {
+		t.Error("Expected results with different columns to differ")
+	}
+}
+
+func TestWaitForRow(t *testing.T) {
+	var polls atomic.Int32
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The row becomes visible on the third poll
+		rows := `[]`
+		if polls.Add(1) >= 3 {
+			rows = `[["alice"]]`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"schema":{"elements":[]},"rows":%s}]`, rows)
+	})
+
+	found, err := stdb.Database.WaitForRow("test", "SELECT name FROM user", 5*time.Second)
+	if err != nil || !found {
+		t.Fatalf("Expected the row to be found, got %v and %v", found, err)
+	}
+	if got := polls.Load(); got != 3 {
+		t.Errorf("Expected 3 polls, got %d", got)
+	}
+}
+
+func TestWaitForRowTimeout(t *testing.T) {
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"schema":{"elements":[]},"rows":[]}]`))
+	})
+	found, err := stdb.Database.WaitForRow("test", "SELECT name FROM user", 50*time.Millisecond)
+	if err != nil || found {
+		t.Errorf("Expected a timeout without error, got %v and %v", found, err)
+	}
+
+	// A query slower than the timeout is abandoned at the deadline
+	release := make(chan struct{})
+	defer close(release)
+	slow := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	start := time.Now()
+	found, err = slow.Database.WaitForRow("test", "SELECT name FROM user", 50*time.Millisecond)
+	if err != nil || found {
+		t.Errorf("Expected a timeout without error, got %v and %v", found, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the slow query to be abandoned at the deadline, took %s", elapsed)
+	}
+}
+
+func TestWaitForRowsQueryError(t *testing.T) {
+	stdb := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such table", http.StatusBadRequest)
+	})
+	_, err := stdb.Database.WaitForRows("test", "SELECT * FROM nowhere", time.Second, func(rows []any) bool { return true })
+	var httpErr *client.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the query error, got %v", err)
+	}
+}
+
+// exportSchema has a u64 id, an optional name, an array of tags and a product position
+const exportSchema = `{"elements":[
+	{"name":{"some":"id"},"algebraic_type":{"U64":[]}},
+	{"name":{"some":"name"},"algebraic_type":{"Sum":{"variants":[
+		{"name":{"some":"some"},"algebraic_type":{"String":[]}},
+		{"name":{"some":"none"},"algebraic_type":{"Product":{"elements":[]}}}
+	]}}},
+	{"name":{"some":"tags"},"algebraic_type":{"Array":{"String":[]}}},
+	{"name":{"some":"pos"},"algebraic_type":{"Product":{"elements":[
+		{"name":{"some":"x"},"algebraic_type":{"F64":[]}},
+		{"name":{"some":"y"},"algebraic_type":{"F64":[]}}
+	]}}}
+]}`
+
+// exportRows exercises large integers, some and none options, separators,
+// quotes and newlines inside strings, and nested arrays and products
+const exportRows = `[
+	[18446744073709551615,[0,"alice"],["a","b"],[1.5,2]],
+	[2,[1,[]],[],[0,-3]],
+	[3,[0,"Smith, \"Bob\"\nJr."],["x\ty"],[0.25,1e3]]
+]`
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errWriteFailed }
+
+func newExportClient(t *testing.T) *client.Client {
+	return newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"schema":%s,"rows":%s}]`, exportSchema, exportRows)
+	})
+}
+
+func TestExecuteSQLToWriterJSONLines(t *testing.T) {
+	stdb := newExportClient(t)
+
+	var sb strings.Builder
+	if err := stdb.Database.ExecuteSQLToWriter("test", "SELECT * FROM player", &sb, client.ExportJSONLines); err != nil {
+		t.Fatalf("ExecuteSQLToWriter failed: %v", err)
+	}
+
+	// Cells are written as received, so large integers keep their precision
+	want := `{"id":18446744073709551615,"name":[0,"alice"],"tags":["a","b"],"pos":[1.5,2]}
+{"id":2,"name":[1,[]],"tags":[],"pos":[0,-3]}
+{"id":3,"name":[0,"Smith, \"Bob\"\nJr."],"tags":["x\ty"],"pos":[0.25,1e3]}
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Unexpected JSON lines:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("Expected each line to be valid JSON, got %s", line)
+		}
+	}
+}
+
+func TestExecuteSQLToWriterCSV(t *testing.T) {
+	stdb := newExportClient(t)
+
+	var sb strings.Builder
+	if err := stdb.Database.ExecuteSQLToWriter("test", "SELECT * FROM player", &sb, client.ExportCSV); err != nil {
+		t.Fatalf("ExecuteSQLToWriter failed: %v", err)
+	}
+
+	// Options are flattened, none is empty and nested values are encoded as JSON
+	want := "id,name,tags,pos\n" +
+		"18446744073709551615,alice,\"[\"\"a\"\",\"\"b\"\"]\",\"[1.5,2]\"\n" +
+		"2,,[],\"[0,-3]\"\n" +
+		"3,\"Smith, \"\"Bob\"\"\nJr.\",\"[\"\"x\\ty\"\"]\",\"[0.25,1e3]\"\n"
+	if got := sb.String(); got != want {
+		t.Errorf("Unexpected CSV:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExecuteSQLToWriterWriteError(t *testing.T) {
+	stdb := newExportClient(t)
+
+	for _, format := range []client.ExportFormat{client.ExportJSONLines, client.ExportCSV} {
+		err := stdb.Database.ExecuteSQLToWriter("test", "SELECT * FROM player", failingWriter{}, format)
+		if !errors.Is(err, errWriteFailed) {
+			t.Errorf("Format %d: expected the writer error, got %v", format, err)
+		}
+	}
+
+	if err := stdb.Database.ExecuteSQLToWriter("test", "SELECT * FROM player", io.Discard, client.ExportFormat(99)); err == nil {
+		t.Error("Expected an error for an unsupported export format")
+	}
+}
+
+func TestSQLResultRecords(t *testing.T) {
+	// SQLResult decodes numbers as float64, so use an id that survives the round trip
+	rows := strings.Replace(exportRows, "18446744073709551615", "1", 1)
+
+	var result client.SQLResult
+	if err := json.Unmarshal([]byte(`{"schema":`+exportSchema+`,"rows":`+rows+`}`), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	want := [][]string{
+		{"1", "alice", `["a","b"]`, "[1.5,2]"},
+		{"2", "", "[]", "[0,-3]"},
+		{"3", "Smith, \"Bob\"\nJr.", `["x\ty"]`, "[0.25,1000]"},
+	}
+	got := result.Records()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("Record %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+// newFormatResult returns a result whose cells contain separators, quotes,
+// tabs, newlines and a none option
+func newFormatResult(t *testing.T) client.SQLResult {
+	t.Helper()
+	var result client.SQLResult
+	data := `{"schema":{"elements":[
+		{"name":{"some":"id"},"algebraic_type":{"U64":[]}},
+		{"name":{"some":"name"},"algebraic_type":{"String":[]}},
+		{"name":{"some":"note"},"algebraic_type":{"Sum":{"variants":[
+			{"name":{"some":"some"},"algebraic_type":{"String":[]}},
+			{"name":{"some":"none"},"algebraic_type":{"Product":{"elements":[]}}}
+		]}}}
+	]},"rows":[
+		[1,"alice",[0,"a,b"]],
+		[22,"Smith, \"Bob\"",[1,[]]],
+		[3,"tab\there",[0,"line\nbreak"]]
+	]}`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	return result
+}
+
+func TestSQLResultToCSV(t *testing.T) {
+	var sb strings.Builder
+	if err := newFormatResult(t).ToCSV(&sb); err != nil {
+		t.Fatalf("ToCSV failed: %v", err)
+	}
+
+	want := "id,name,note\n" +
+		"1,alice,\"a,b\"\n" +
+		"22,\"Smith, \"\"Bob\"\"\",\n" +
+		"3,tab\there,\"line\nbreak\"\n"
+	if got := sb.String(); got != want {
+		t.Errorf("Unexpected CSV:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestSQLResultToTSV(t *testing.T) {
+	var sb strings.Builder
+	if err := newFormatResult(t).ToTSV(&sb); err != nil {
+		t.Fatalf("ToTSV failed: %v", err)
+	}
+
+	// Only fields containing tabs, quotes or newlines are quoted
+	want := "id\tname\tnote\n" +
+		"1\talice\ta,b\n" +
+		"22\t\"Smith, \"\"Bob\"\"\"\t\n" +
+		"3\t\"tab\there\"\t\"line\nbreak\"\n"
+	if got := sb.String(); got != want {
+		t.Errorf("Unexpected TSV:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestSQLResultToTable(t *testing.T) {
+	want := `id | name         | note
+---+--------------+------------
+1  | alice        | a,b
+22 | Smith, "Bob" |
+3  | tab\there    | line\nbreak
+`
+	if got := newFormatResult(t).ToTable(); got != want {
+		t.Errorf("Unexpected table:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
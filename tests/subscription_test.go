@@ -0,0 +1,1615 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// fakeServer records client messages and answers them through respond,
+// delivering the replies to the subscription manager asynchronously
+type fakeServer struct {
+	mu       sync.Mutex
+	sent     []client.ClientMessage
+	manager  *client.SubscriptionManager
+	respond  func(msg client.ClientMessage) []*client.ServerMessage
+	handlers sync.WaitGroup
+}
+
+func (f *fakeServer) SendMessage(message any) error {
+	msg, ok := message.(client.ClientMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", message)
+	}
+
+	f.mu.Lock()
+	f.sent = append(f.sent, msg)
+	respond := f.respond
+	f.mu.Unlock()
+
+	if respond == nil {
+		return nil
+	}
+	replies := respond(msg)
+	f.handlers.Add(1)
+	go func() {
+		defer f.handlers.Done()
+		for _, reply := range replies {
+			f.manager.HandleMessage(reply)
+		}
+	}()
+	return nil
+}
+
+func (f *fakeServer) messages() []client.ClientMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent)
+}
+
+func newFakeServer(respond func(msg client.ClientMessage) []*client.ServerMessage) *fakeServer {
+	server := &fakeServer{respond: respond}
+	server.manager = client.NewSubscriptionManager(server, nil)
+	return server
+}
+
+// fakeRows holds the rows the fake server returns for each query
+var fakeRows = map[string]client.TableUpdate{
+	"SELECT * FROM circle WHERE region = 1": tableRows("circle", `[1,"a"]`, `[2,"b"]`),
+	"SELECT * FROM circle WHERE region = 2": tableRows("circle", `[2,"b"]`, `[3,"c"]`),
+	"SELECT * FROM circle":                  tableRows("circle", `[1,"a"]`, `[2,"b"]`, `[3,"c"]`),
+	"SELECT * FROM food":                    tableRows("food", `[8]`, `[9]`),
+	// Declares more rows than it holds
+	"SELECT * FROM circle WHERE region = 3": {
+		TableName: "circle",
+		NumRows:   5,
+		Updates:   []client.TableUpdateEntry{{Inserts: []string{`[4,"d"]`}}},
+	},
+}
+
+func tableRows(table string, rows ...string) client.TableUpdate {
+	return client.TableUpdate{
+		TableName: table,
+		NumRows:   uint32(len(rows)),
+		Updates:   []client.TableUpdateEntry{{Inserts: rows}},
+	}
+}
+
+func removedRows(table string, rows ...string) client.TableUpdate {
+	return client.TableUpdate{
+		TableName: table,
+		NumRows:   uint32(len(rows)),
+		Updates:   []client.TableUpdateEntry{{Deletes: rows}},
+	}
+}
+
+// subscriptionResponder answers subscribe and unsubscribe requests from fakeRows,
+// rejecting queries it doesn't know with a SubscriptionError
+func subscriptionResponder() func(msg client.ClientMessage) []*client.ServerMessage {
+	var mu sync.Mutex
+	active := make(map[uint32][]string)
+
+	return func(msg client.ClientMessage) []*client.ServerMessage {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case msg.SubscribeMulti != nil:
+			var update client.DatabaseUpdate
+			for _, query := range msg.SubscribeMulti.QueryStrings {
+				rows, ok := fakeRows[query]
+				if !ok {
+					queryID := msg.SubscribeMulti.QueryID.ID
+					return []*client.ServerMessage{{
+						Type:    client.ServerMessageTypeSubscriptionError,
+						Payload: &client.SubscriptionError{QueryID: &queryID, Error: "unknown query " + query},
+					}}
+				}
+				update.Tables = append(update.Tables, rows)
+			}
+			active[msg.SubscribeMulti.QueryID.ID] = msg.SubscribeMulti.QueryStrings
+			return []*client.ServerMessage{{
+				Type: client.ServerMessageTypeSubscribeMultiApplied,
+				Payload: &client.SubscribeMultiApplied{
+					RequestID: msg.SubscribeMulti.RequestID,
+					QueryID:   msg.SubscribeMulti.QueryID,
+					Update:    update,
+				},
+			}}
+		case msg.UnsubscribeMulti != nil:
+			var update client.DatabaseUpdate
+			for _, query := range active[msg.UnsubscribeMulti.QueryID.ID] {
+				rows := fakeRows[query]
+				update.Tables = append(update.Tables, removedRows(rows.TableName, rows.Updates[0].Inserts...))
+			}
+			delete(active, msg.UnsubscribeMulti.QueryID.ID)
+			return []*client.ServerMessage{{
+				Type: client.ServerMessageTypeUnsubscribeMultiApplied,
+				Payload: &client.UnsubscribeMultiApplied{
+					RequestID: msg.UnsubscribeMulti.RequestID,
+					QueryID:   msg.UnsubscribeMulti.QueryID,
+					Update:    update,
+				},
+			}}
+		}
+		return nil
+	}
+}
+
+func waitApplied(t *testing.T, sub *client.Subscription) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sub.Wait(ctx); err != nil {
+		t.Fatalf("Subscription failed: %v", err)
+	}
+}
+
+func TestSubscriptionManagerReplace(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	oldQueryID := sub.QueryID()
+
+	var updates []client.DatabaseUpdate
+	manager.OnUpdate(func(update client.DatabaseUpdate) {
+		updates = append(updates, update)
+	})
+
+	if err := manager.Replace(sub, []string{"SELECT * FROM circle WHERE region = 2"}); err != nil {
+		t.Fatalf("Failed to replace subscription: %v", err)
+	}
+	server.handlers.Wait()
+
+	rows := manager.Cache().Rows("circle")
+	if !slices.Equal(rows, []string{`[2,"b"]`, `[3,"c"]`}) {
+		t.Errorf("Unexpected cached rows after replace: %v", rows)
+	}
+	if sub.QueryID() == oldQueryID {
+		t.Error("Expected the subscription to move to a new query ID")
+	}
+	if queries := sub.Queries(); len(queries) != 1 || queries[0] != "SELECT * FROM circle WHERE region = 2" {
+		t.Errorf("Unexpected queries after replace: %v", queries)
+	}
+
+	// The transition is reported as one coalesced update: row 2 is in both sets
+	if len(updates) != 1 || len(updates[0].Tables) != 1 {
+		t.Fatalf("Expected one coalesced update, got %+v", updates)
+	}
+	entry := updates[0].Tables[0].Updates[0]
+	if !slices.Equal(entry.Deletes, []string{`[1,"a"]`}) || !slices.Equal(entry.Inserts, []string{`[3,"c"]`}) {
+		t.Errorf("Unexpected coalesced update: %+v", entry)
+	}
+}
+
+func TestSubscriptionManagerReplaceSharedQuery(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	first, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, first)
+	second, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, second)
+
+	var updates []client.DatabaseUpdate
+	manager.OnUpdate(func(update client.DatabaseUpdate) {
+		updates = append(updates, update)
+	})
+
+	if err := manager.Replace(second, []string{"SELECT * FROM circle WHERE region = 2"}); err != nil {
+		t.Fatalf("Failed to replace subscription: %v", err)
+	}
+	server.handlers.Wait()
+
+	// The old query is still used by first, so nothing is unsubscribed
+	for _, msg := range server.messages() {
+		if msg.UnsubscribeMulti != nil {
+			t.Error("Expected the shared query not to be unsubscribed")
+		}
+	}
+	if len(updates) != 1 || len(updates[0].Tables) != 1 {
+		t.Fatalf("Expected one update with the new rows, got %+v", updates)
+	}
+	if inserts := updates[0].Tables[0].Updates[0].Inserts; !slices.Equal(inserts, []string{`[2,"b"]`, `[3,"c"]`}) {
+		t.Errorf("Unexpected inserts after replace: %v", inserts)
+	}
+
+	// The new query is no longer quiet, so unsubscribing it is reported too
+	updates = nil
+	if err := manager.Unsubscribe(second); err != nil {
+		t.Fatalf("Failed to unsubscribe: %v", err)
+	}
+	server.handlers.Wait()
+	if len(updates) != 1 {
+		t.Errorf("Expected the removed rows to be reported, got %+v", updates)
+	}
+}
+
+func TestSubscriptionManagerReplaceKeepsOldOnError(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	oldQueryID := sub.QueryID()
+
+	if err := manager.Replace(sub, []string{"SELECT * FROM nowhere"}); err == nil {
+		t.Fatal("Expected replace with an invalid query to fail")
+	}
+	server.handlers.Wait()
+
+	if sub.QueryID() != oldQueryID {
+		t.Error("Expected the subscription to keep its old query ID")
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected the old rows to stay cached, got %v", rows)
+	}
+	for _, msg := range server.messages() {
+		if msg.UnsubscribeMulti != nil {
+			t.Error("Expected the old subscription not to be unsubscribed")
+		}
+	}
+}
+
+func TestSubscriptionManagerProjectedColumns(t *testing.T) {
+	const query = "SELECT name, online FROM user"
+
+	server := newFakeServer(func(msg client.ClientMessage) []*client.ServerMessage {
+		if msg.SubscribeMulti == nil {
+			return nil
+		}
+		// Projected rows only contain the selected columns
+		return []*client.ServerMessage{{
+			Type: client.ServerMessageTypeSubscribeMultiApplied,
+			Payload: &client.SubscribeMultiApplied{
+				RequestID: msg.SubscribeMulti.RequestID,
+				QueryID:   msg.SubscribeMulti.QueryID,
+				Update:    client.DatabaseUpdate{Tables: []client.TableUpdate{tableRows("user", `[[0,"alice"],true]`)}},
+			},
+		}}
+	})
+
+	sub, err := server.manager.Subscribe(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+
+	columns := client.ProjectionColumns(query)
+	if !slices.Equal(columns, []string{"name", "online"}) {
+		t.Fatalf("Unexpected projection columns: %v", columns)
+	}
+
+	rows := server.manager.Cache().Rows("user")
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 cached row, got %v", rows)
+	}
+
+	var user chatUser
+	if err := client.DecodeProjected([]byte(rows[0]), columns, &user); err != nil {
+		t.Fatalf("Failed to decode projected row: %v", err)
+	}
+	if user.Identity != "" || user.Name == nil || *user.Name != "alice" || !user.Online {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+
+	if columns := client.ProjectionColumns("SELECT * FROM user"); columns != nil {
+		t.Errorf("Expected no projection for SELECT *, got %v", columns)
+	}
+}
+
+func TestSubscriptionManagerSubscribeSingle(t *testing.T) {
+	const query = "SELECT * FROM circle WHERE region = 1"
+
+	server := newFakeServer(func(msg client.ClientMessage) []*client.ServerMessage {
+		switch {
+		case msg.SubscribeSingle != nil:
+			return []*client.ServerMessage{{
+				Type: client.ServerMessageTypeSubscribeApplied,
+				Payload: &client.SubscribeApplied{
+					RequestID: msg.SubscribeSingle.RequestID,
+					QueryID:   msg.SubscribeSingle.QueryID,
+					Rows:      client.SubscribeRows{TableName: "circle", TableRows: fakeRows[query]},
+				},
+			}}
+		case msg.Unsubscribe != nil:
+			rows := fakeRows[query]
+			return []*client.ServerMessage{{
+				Type: client.ServerMessageTypeUnsubscribeApplied,
+				Payload: &client.UnsubscribeApplied{
+					RequestID: msg.Unsubscribe.RequestID,
+					QueryID:   msg.Unsubscribe.QueryID,
+					Rows:      client.SubscribeRows{TableName: "circle", TableRows: removedRows("circle", rows.Updates[0].Inserts...)},
+				},
+			}}
+		}
+		return nil
+	})
+	manager := server.manager
+
+	var updates int
+	manager.OnUpdate(func(client.DatabaseUpdate) { updates++ })
+
+	sub, err := manager.SubscribeSingle(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	server.handlers.Wait()
+
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Fatalf("Expected the initial rows to be cached, got %v", rows)
+	}
+	if updates != 1 {
+		t.Errorf("Expected 1 update for the applied rows, got %d", updates)
+	}
+
+	if err := manager.Unsubscribe(sub); err != nil {
+		t.Fatalf("Failed to unsubscribe: %v", err)
+	}
+	server.handlers.Wait()
+
+	if rows := manager.Cache().Rows("circle"); len(rows) != 0 {
+		t.Errorf("Expected the rows to be removed, got %v", rows)
+	}
+	for _, msg := range server.messages() {
+		if msg.UnsubscribeMulti != nil {
+			t.Error("Expected a single subscription to be ended with Unsubscribe")
+		}
+	}
+}
+
+func TestSubscriptionManagerTransactionUpdateLight(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	server.handlers.Wait()
+
+	var updates []client.DatabaseUpdate
+	manager.OnUpdate(func(update client.DatabaseUpdate) {
+		updates = append(updates, update)
+	})
+
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeTransactionUpdateLight,
+		Payload: &client.TransactionUpdateLight{
+			RequestID: 7,
+			Update: client.DatabaseUpdate{Tables: []client.TableUpdate{{
+				TableName: "circle",
+				Updates:   []client.TableUpdateEntry{{Deletes: []string{`[1,"a"]`}, Inserts: []string{`[4,"d"]`}}},
+			}}},
+		},
+	})
+
+	rows := manager.Cache().Rows("circle")
+	if !slices.Equal(rows, []string{`[2,"b"]`, `[4,"d"]`}) {
+		t.Errorf("Unexpected cached rows after light update: %v", rows)
+	}
+	if len(updates) != 1 {
+		t.Errorf("Expected listeners to see the light update, got %d updates", len(updates))
+	}
+}
+
+func TestSubscriptionManagerDeduplicatesQueries(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+	query := "SELECT * FROM circle WHERE region = 1"
+
+	first, err := manager.Subscribe(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	second, err := manager.Subscribe(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe again: %v", err)
+	}
+	waitApplied(t, first)
+	waitApplied(t, second)
+	server.handlers.Wait()
+
+	if first.QueryID() != second.QueryID() {
+		t.Errorf("Expected identical queries to share a query ID, got %v and %v", first.QueryID(), second.QueryID())
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected rows to be cached once, got %v", rows)
+	}
+	if active := manager.ActiveQueries(); !slices.Equal(active, []string{query}) {
+		t.Errorf("Unexpected active queries: %v", active)
+	}
+
+	countUnsubscribes := func() int {
+		count := 0
+		for _, msg := range server.messages() {
+			if msg.UnsubscribeMulti != nil {
+				count++
+			}
+		}
+		return count
+	}
+
+	if err := manager.Unsubscribe(first); err != nil {
+		t.Fatalf("Failed to release first subscription: %v", err)
+	}
+	if err := manager.Unsubscribe(first); err == nil {
+		t.Error("Expected releasing the same subscription twice to fail")
+	}
+	server.handlers.Wait()
+	if n := countUnsubscribes(); n != 0 {
+		t.Errorf("Expected no unsubscribe while a reference remains, got %d", n)
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected rows to stay cached, got %v", rows)
+	}
+
+	if err := manager.Unsubscribe(second); err != nil {
+		t.Fatalf("Failed to release second subscription: %v", err)
+	}
+	server.handlers.Wait()
+	if n := countUnsubscribes(); n != 1 {
+		t.Errorf("Expected one unsubscribe after the last release, got %d", n)
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 0 {
+		t.Errorf("Expected rows to be removed, got %v", rows)
+	}
+	if active := manager.ActiveQueries(); len(active) != 0 {
+		t.Errorf("Expected no active queries, got %v", active)
+	}
+	for _, msg := range server.messages() {
+		if msg.SubscribeMulti != nil && msg.SubscribeMulti.QueryID != first.QueryID() {
+			t.Errorf("Unexpected extra subscribe request %+v", msg.SubscribeMulti)
+		}
+	}
+}
+
+func TestSubscriptionManagerWaitForInitialSubscription(t *testing.T) {
+	server := newFakeServer(nil)
+	manager := server.manager
+
+	initial := func(requestID uint32, row string) *client.ServerMessage {
+		return &client.ServerMessage{
+			Type: client.ServerMessageTypeInitialSubscription,
+			Payload: &client.InitialSubscription{
+				RequestID:      requestID,
+				DatabaseUpdate: client.DatabaseUpdate{Tables: []client.TableUpdate{tableRows("circle", row)}},
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Two subscribes are in flight; their replies arrive in reverse order
+	expected := map[uint32]string{1: `[1,"a"]`, 2: `[2,"b"]`}
+	var wg sync.WaitGroup
+	for requestID, row := range expected {
+		manager.ExpectInitialSubscription(requestID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := manager.WaitForInitialSubscription(ctx, requestID)
+			if err != nil {
+				t.Errorf("Failed waiting for request %d: %v", requestID, err)
+				return
+			}
+			if got.RequestID != requestID || got.DatabaseUpdate.Tables[0].Updates[0].Inserts[0] != row {
+				t.Errorf("Request %d waiter got the wrong payload: %+v", requestID, got)
+			}
+		}()
+	}
+
+	manager.HandleMessage(initial(2, expected[2]))
+	manager.HandleMessage(initial(1, expected[1]))
+	wg.Wait()
+
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected both initial payloads to be cached, got %v", rows)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	if _, err := manager.WaitForInitialSubscription(short, 3); err == nil {
+		t.Error("Expected waiting for an unanswered request to time out")
+	}
+}
+
+func TestSubscriptionManagerUnclaimedInitialSubscriptions(t *testing.T) {
+	server := newFakeServer(nil)
+	manager := server.manager
+
+	initial := func(requestID uint32, row string) *client.ServerMessage {
+		return &client.ServerMessage{
+			Type: client.ServerMessageTypeInitialSubscription,
+			Payload: &client.InitialSubscription{
+				RequestID:      requestID,
+				DatabaseUpdate: client.DatabaseUpdate{Tables: []client.TableUpdate{tableRows("circle", row)}},
+			},
+		}
+	}
+	waitBriefly := func(requestID uint32) (*client.InitialSubscription, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		return manager.WaitForInitialSubscription(ctx, requestID)
+	}
+
+	// Messages nobody announced or waits for are cached but not kept
+	manager.HandleMessage(initial(1, `[1,"a"]`))
+	if rows := manager.Cache().Rows("circle"); len(rows) != 1 {
+		t.Errorf("Expected the unclaimed rows to be cached, got %v", rows)
+	}
+	if got, err := waitBriefly(1); err == nil {
+		t.Errorf("Expected the unclaimed message not to be kept, got %+v", got)
+	}
+
+	// An announced message arriving early is kept until waited for, once
+	manager.ExpectInitialSubscription(2)
+	manager.HandleMessage(initial(2, `[2,"b"]`))
+	if got, err := waitBriefly(2); err != nil || got.RequestID != 2 {
+		t.Fatalf("Expected the announced message, got %+v and %v", got, err)
+	}
+	if got, err := waitBriefly(2); err == nil {
+		t.Errorf("Expected the message to be handed out only once, got %+v", got)
+	}
+
+	// A message arriving after its wait timed out does not answer a later wait
+	manager.ExpectInitialSubscription(3)
+	if _, err := waitBriefly(3); err == nil {
+		t.Fatal("Expected the wait to time out")
+	}
+	manager.HandleMessage(initial(3, `[3,"c"]`))
+	if got, err := waitBriefly(3); err == nil {
+		t.Errorf("Expected the late message not to be kept, got %+v", got)
+	}
+}
+
+func TestSubscriptionManagerCancelPending(t *testing.T) {
+	// The server never answers on its own; replies are delivered by hand to
+	// simulate the applied message crossing the cancel on the wire
+	server := newFakeServer(func(msg client.ClientMessage) []*client.ServerMessage { return nil })
+	manager := server.manager
+	query := "SELECT * FROM circle WHERE region = 1"
+
+	var notified int
+	manager.OnUpdate(func(update client.DatabaseUpdate) { notified++ })
+
+	sub, err := manager.Subscribe(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if err := manager.CancelPending(sub); err != nil {
+		t.Fatalf("Failed to cancel pending subscription: %v", err)
+	}
+	if err := manager.CancelPending(sub); err == nil {
+		t.Error("Expected cancelling twice to fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sub.Wait(ctx); !errors.Is(err, client.ErrSubscriptionCancelled) {
+		t.Errorf("Expected Wait to report the cancellation, got %v", err)
+	}
+
+	messages := server.messages()
+	if len(messages) != 2 || messages[1].UnsubscribeMulti == nil || messages[1].UnsubscribeMulti.QueryID != sub.QueryID() {
+		t.Fatalf("Expected an unsubscribe for the pending query ID, got %+v", messages)
+	}
+	if active := manager.ActiveQueries(); len(active) != 0 {
+		t.Errorf("Expected no active queries, got %v", active)
+	}
+
+	rows := fakeRows[query]
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeSubscribeMultiApplied,
+		Payload: &client.SubscribeMultiApplied{
+			QueryID: sub.QueryID(),
+			Update:  client.DatabaseUpdate{Tables: []client.TableUpdate{rows}},
+		},
+	})
+	if cached := manager.Cache().Rows("circle"); len(cached) != 0 {
+		t.Errorf("Expected late rows of a cancelled subscription to be ignored, got %v", cached)
+	}
+
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeUnsubscribeMultiApplied,
+		Payload: &client.UnsubscribeMultiApplied{
+			QueryID: sub.QueryID(),
+			Update:  client.DatabaseUpdate{Tables: []client.TableUpdate{removedRows("circle", rows.Updates[0].Inserts...)}},
+		},
+	})
+	if notified != 0 {
+		t.Errorf("Expected no listener notifications for a cancelled subscription, got %d", notified)
+	}
+
+	// A new subscription to the same query is not affected by the cancelled one
+	next, err := manager.Subscribe(query)
+	if err != nil {
+		t.Fatalf("Failed to subscribe again: %v", err)
+	}
+	if next.QueryID() == sub.QueryID() {
+		t.Error("Expected a new query ID after cancelling")
+	}
+}
+
+func TestSubscriptionManagerCancelAppliedFails(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	sub, err := server.manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+
+	if err := server.manager.CancelPending(sub); err == nil {
+		t.Error("Expected cancelling an applied subscription to fail")
+	}
+	if err := server.manager.Unsubscribe(sub); err != nil {
+		t.Errorf("Expected the subscription to stay active, got %v", err)
+	}
+}
+
+// regionCircle is the row type of the fake circle table
+type regionCircle struct {
+	ID   uint32
+	Name string
+}
+
+func TestSubscribeByKey(t *testing.T) {
+	server := newFakeServer(func(client.ClientMessage) []*client.ServerMessage { return nil })
+	manager := server.manager
+
+	identity, err := client.IdentityFromHex("0xC2001A2B3C" + strings.Repeat("00", 27))
+	if err != nil {
+		t.Fatalf("IdentityFromHex failed: %v", err)
+	}
+	type entityID uint32
+	for _, tc := range []struct {
+		table, column string
+		value         any
+		want          string
+	}{
+		{"player", "identity", identity, "SELECT * FROM player WHERE identity = 0xc2001a2b3c" + strings.Repeat("00", 27)},
+		{"circle", "entity_id", entityID(42), "SELECT * FROM circle WHERE entity_id = 42"},
+		{"circle", "entity_id", int64(-7), "SELECT * FROM circle WHERE entity_id = -7"},
+		{"user", "name", "O'Brien", "SELECT * FROM user WHERE name = 'O''Brien'"},
+		{"session", "connection_id", client.ConnectionIDFromUint64(9), "SELECT * FROM session WHERE connection_id = 9"},
+	} {
+		if _, err := manager.SubscribeByKey(tc.table, tc.column, tc.value); err != nil {
+			t.Fatalf("SubscribeByKey(%v) failed: %v", tc.value, err)
+		}
+		sent := server.messages()
+		if last := sent[len(sent)-1]; last.SubscribeSingle == nil || last.SubscribeSingle.Query != tc.want {
+			t.Errorf("Expected SubscribeSingle %q, got %+v", tc.want, last)
+		}
+	}
+
+	for _, tc := range []struct {
+		table, column string
+		value         any
+	}{
+		{"player; DROP TABLE player", "id", 1},
+		{"player", "id = 1 OR 1", 1},
+		{"player", "id", 1.5},
+		{"player", "identity", client.Identity{Identity: "not hex"}},
+	} {
+		before := len(server.messages())
+		if _, err := manager.SubscribeByKey(tc.table, tc.column, tc.value); err == nil {
+			t.Errorf("Expected SubscribeByKey(%q, %q, %v) to fail", tc.table, tc.column, tc.value)
+		}
+		if len(server.messages()) != before {
+			t.Errorf("Expected no request for a rejected key subscription")
+		}
+	}
+}
+
+func TestSubscribeWhere(t *testing.T) {
+	server := newFakeServer(func(client.ClientMessage) []*client.ServerMessage { return nil })
+	manager := server.manager
+
+	identity, err := client.IdentityFromHex("c2001a2b3c" + strings.Repeat("00", 27))
+	if err != nil {
+		t.Fatalf("IdentityFromHex failed: %v", err)
+	}
+	for _, tc := range []struct {
+		column, op string
+		value      any
+		want       string
+	}{
+		{"sender", "=", identity, "SELECT * FROM message WHERE sender = 0xc2001a2b3c" + strings.Repeat("00", 27)},
+		{"sent", ">=", uint64(1718000000), "SELECT * FROM message WHERE sent >= 1718000000"},
+		{"score", "<", 0.25, "SELECT * FROM message WHERE score < 0.25"},
+		{"text", "!=", "it's", "SELECT * FROM message WHERE text != 'it''s'"},
+	} {
+		if _, err := manager.SubscribeWhere("message", tc.column, tc.op, tc.value); err != nil {
+			t.Fatalf("SubscribeWhere(%s %s %v) failed: %v", tc.column, tc.op, tc.value, err)
+		}
+		sent := server.messages()
+		if last := sent[len(sent)-1]; last.SubscribeSingle == nil || last.SubscribeSingle.Query != tc.want {
+			t.Errorf("Expected SubscribeSingle %q, got %+v", tc.want, last)
+		}
+	}
+
+	for _, tc := range []struct {
+		op    string
+		value any
+	}{
+		{"= 1 OR 1 =", 1},
+		{"LIKE", "a%"},
+		{"=", math.NaN()},
+		{"=", []int{1}},
+	} {
+		if _, err := manager.SubscribeWhere("message", "sent", tc.op, tc.value); err == nil {
+			t.Errorf("Expected SubscribeWhere with %q and %v to fail", tc.op, tc.value)
+		}
+	}
+}
+
+func TestSubscribeAndLoad(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	first, sub, err := client.SubscribeAndLoad[regionCircle](manager, "SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", err)
+	}
+	if want := []regionCircle{{1, "a"}, {2, "b"}}; !slices.Equal(first, want) {
+		t.Errorf("Expected %v, got %v", want, first)
+	}
+	if sub.Table() != "circle" {
+		t.Errorf("Expected table circle, got %q", sub.Table())
+	}
+
+	changes := make(chan []regionCircle, 1)
+	sub.OnChange(func(inserted, deleted []regionCircle) {
+		changes <- deleted
+	})
+
+	// The snapshot holds the rows of this query only, not the whole cached table
+	second, other, err := client.SubscribeAndLoad[regionCircle](manager, "SELECT * FROM circle WHERE region = 2")
+	if err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", err)
+	}
+	if want := []regionCircle{{2, "b"}, {3, "c"}}; !slices.Equal(second, want) {
+		t.Errorf("Expected %v, got %v", want, second)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("Expected OnChange to receive the second subscription's rows")
+	}
+
+	if err := manager.Unsubscribe(other.Subscription); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	select {
+	case deleted := <-changes:
+		if want := []regionCircle{{2, "b"}, {3, "c"}}; !slices.Equal(deleted, want) {
+			t.Errorf("Expected deleted rows %v, got %v", want, deleted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected OnChange to receive the removed rows")
+	}
+	if got := manager.Cache().Count("circle"); got != 2 {
+		t.Errorf("Expected 2 cached circles, got %d", got)
+	}
+}
+
+func TestTypedSubscriptionOnChangeReleased(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	_, sub, err := client.SubscribeAndLoad[regionCircle](manager, "SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", err)
+	}
+
+	// The callback holds a value whose finalizer shows when it was dropped
+	var calls atomic.Int32
+	finalized := make(chan struct{})
+	onChange := func(held *int) {
+		runtime.SetFinalizer(held, func(*int) { close(finalized) })
+		sub.OnChange(func(inserted, deleted []regionCircle) {
+			_ = *held
+			calls.Add(1)
+		})
+	}
+	onChange(new(int))
+
+	commit := func() {
+		manager.HandleMessage(&client.ServerMessage{
+			Type: client.ServerMessageTypeTransactionUpdateLight,
+			Payload: &client.TransactionUpdateLight{Update: client.DatabaseUpdate{
+				Tables: []client.TableUpdate{tableRows("circle", `[5,"e"]`)},
+			}},
+		})
+	}
+	commit()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("Expected OnChange to be called once, got %d", got)
+	}
+
+	if err := manager.Unsubscribe(sub.Subscription); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	server.handlers.Wait()
+	commit()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected no OnChange calls after Unsubscribe, got %d", got-1)
+	}
+
+	// The manager stays alive, so only dropping the listener frees the callback
+	dropped := false
+	for i := 0; i < 10 && !dropped; i++ {
+		runtime.GC()
+		select {
+		case <-finalized:
+			dropped = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	runtime.KeepAlive(manager)
+	if !dropped {
+		t.Error("Expected the OnChange listener to be dropped after Unsubscribe")
+	}
+}
+
+func TestSubscribeAndLoadSharedPending(t *testing.T) {
+	const query = "SELECT * FROM circle WHERE region = 1"
+	want := []regionCircle{{1, "a"}, {2, "b"}}
+
+	// The first caller's send blocks, so the subscription is applied and
+	// shared by a second caller before the first one reads its rows
+	subscribes := make(chan client.ClientMessage, 1)
+	release := make(chan struct{})
+	server := newFakeServer(func(msg client.ClientMessage) []*client.ServerMessage {
+		subscribes <- msg
+		<-release
+		return nil
+	})
+
+	type result struct {
+		rows []regionCircle
+		err  error
+	}
+	first := make(chan result, 1)
+	go func() {
+		rows, _, err := client.SubscribeAndLoad[regionCircle](server.manager, query)
+		first <- result{rows, err}
+	}()
+	for _, reply := range subscriptionResponder()(<-subscribes) {
+		server.manager.HandleMessage(reply)
+	}
+
+	rows, _, err := client.SubscribeAndLoad[regionCircle](server.manager, query)
+	if err != nil {
+		t.Fatalf("Shared SubscribeAndLoad failed: %v", err)
+	}
+	if !slices.Equal(rows, want) {
+		t.Errorf("Expected the sharing caller to load %v, got %v", want, rows)
+	}
+
+	close(release)
+	got := <-first
+	if got.err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", got.err)
+	}
+	if !slices.Equal(got.rows, want) {
+		t.Errorf("Expected the subscribing caller to load %v, got %v", want, got.rows)
+	}
+}
+
+func TestSubscribeAndLoadNumRowsMismatch(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	server := newFakeServer(subscriptionResponder())
+	rows, sub, err := client.SubscribeAndLoad[regionCircle](server.manager, "SELECT * FROM circle WHERE region = 3")
+	if err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", err)
+	}
+	if want := []regionCircle{{4, "d"}}; !slices.Equal(rows, want) {
+		t.Errorf("Expected %v, got %v", want, rows)
+	}
+	if !strings.Contains(logged.String(), "update of table circle declares 5 rows but holds 1") {
+		t.Errorf("Expected a NumRows mismatch warning, got %q", logged.String())
+	}
+
+	// The update is checked once, however many listeners see it
+	logged.Reset()
+	for range 2 {
+		sub.OnChange(func(inserted, deleted []regionCircle) {})
+	}
+	server.manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeTransactionUpdate,
+		Payload: &client.TransactionUpdate{Status: client.UpdateStatus{Committed: &client.DatabaseUpdate{
+			Tables: []client.TableUpdate{{
+				TableName: "circle",
+				NumRows:   3,
+				Updates:   []client.TableUpdateEntry{{Inserts: []string{`[5,"e"]`}}},
+			}},
+		}}},
+	})
+	if n := strings.Count(logged.String(), "declares 3 rows but holds 1"); n != 1 {
+		t.Errorf("Expected one NumRows mismatch warning, got %d: %q", n, logged.String())
+	}
+
+	logged.Reset()
+	if _, _, err := client.SubscribeAndLoad[regionCircle](server.manager, "SELECT * FROM circle WHERE region = 1"); err != nil {
+		t.Fatalf("SubscribeAndLoad failed: %v", err)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("Expected no warning for a matching NumRows, got %q", logged.String())
+	}
+}
+
+func TestSubscribeAndLoadErrors(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+
+	if _, _, err := client.SubscribeAndLoad[regionCircle](server.manager, "SELECT * FROM *"); err == nil {
+		t.Error("Expected an error for a query over every table")
+	}
+	if len(server.messages()) != 0 {
+		t.Error("Expected no subscribe request for a rejected query")
+	}
+
+	if _, _, err := client.SubscribeAndLoad[regionCircle](server.manager, "SELECT * FROM circle WHERE region = 9"); err == nil {
+		t.Error("Expected the subscription error to be returned")
+	}
+
+	type wrongRow struct {
+		ID   string
+		Name string
+	}
+	if _, _, err := client.SubscribeAndLoad[wrongRow](server.manager, "SELECT * FROM circle WHERE region = 1"); err == nil {
+		t.Error("Expected an error for rows that don't decode")
+	}
+}
+
+func TestSubscribeTimeout(t *testing.T) {
+	// The server never answers subscribe requests
+	server := &fakeServer{}
+	server.manager = client.NewSubscriptionManager(server, nil, client.WithSubscribeTimeout(20*time.Millisecond))
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	start := time.Now()
+	if err := sub.Wait(context.Background()); !errors.Is(err, client.ErrSubscribeTimeout) {
+		t.Fatalf("Expected ErrSubscribeTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Wait to give up after the timeout, took %s", elapsed)
+	}
+	if queries := manager.ActiveQueries(); len(queries) != 1 {
+		t.Errorf("Expected the timed out subscription to stay pending, got %v", queries)
+	}
+
+	if _, err := manager.WaitForInitialSubscription(context.Background(), 42); !errors.Is(err, client.ErrSubscribeTimeout) {
+		t.Errorf("Expected ErrSubscribeTimeout from WaitForInitialSubscription, got %v", err)
+	}
+	if _, _, err := client.SubscribeAndLoad[regionCircle](manager, "SELECT * FROM circle WHERE region = 2"); !errors.Is(err, client.ErrSubscribeTimeout) {
+		t.Errorf("Expected ErrSubscribeTimeout from SubscribeAndLoad, got %v", err)
+	}
+	if err := manager.Replace(sub, []string{"SELECT * FROM circle WHERE region = 3"}); !errors.Is(err, client.ErrSubscribeTimeout) {
+		t.Errorf("Expected ErrSubscribeTimeout from Replace, got %v", err)
+	}
+
+	// A caller deadline shorter than the timeout still wins
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := sub.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller's deadline, got %v", err)
+	}
+}
+
+func TestSubscribeTimeoutUnsubscribes(t *testing.T) {
+	server := &fakeServer{}
+	server.manager = client.NewSubscriptionManager(server, nil,
+		client.WithSubscribeTimeout(20*time.Millisecond), client.WithUnsubscribeOnTimeout())
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := sub.Wait(context.Background()); !errors.Is(err, client.ErrSubscribeTimeout) {
+		t.Fatalf("Expected ErrSubscribeTimeout, got %v", err)
+	}
+	if queries := manager.ActiveQueries(); len(queries) != 0 {
+		t.Errorf("Expected the stuck query to be unsubscribed, got %v", queries)
+	}
+	messages := server.messages()
+	if len(messages) != 2 || messages[1].UnsubscribeMulti == nil || messages[1].UnsubscribeMulti.QueryID != messages[0].SubscribeMulti.QueryID {
+		t.Fatalf("Expected an unsubscribe for the stuck query, got %+v", messages)
+	}
+
+	// A late applied message for the cancelled query is not cached
+	queryID := messages[0].SubscribeMulti.QueryID
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeSubscribeMultiApplied,
+		Payload: &client.SubscribeMultiApplied{
+			QueryID: queryID,
+			Update:  client.DatabaseUpdate{Tables: []client.TableUpdate{fakeRows["SELECT * FROM circle WHERE region = 1"]}},
+		},
+	})
+	if got := manager.Cache().Count("circle"); got != 0 {
+		t.Errorf("Expected no cached rows for the timed out query, got %d", got)
+	}
+}
+
+func TestSubscriptionManagerResync(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	for _, query := range []string{"SELECT * FROM circle WHERE region = 1", "SELECT * FROM circle WHERE region = 2"} {
+		sub, err := manager.Subscribe(query)
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		waitApplied(t, sub)
+	}
+	want := manager.Cache().Rows("circle")
+
+	// Simulate a lost delete and a duplicated insert
+	manager.Cache().Apply(client.DatabaseUpdate{Tables: []client.TableUpdate{
+		removedRows("circle", `[1,"a"]`),
+		tableRows("circle", `[4,"d"]`),
+	}})
+
+	var updates []client.DatabaseUpdate
+	var desyncs []client.Desync
+	manager.OnUpdate(func(update client.DatabaseUpdate) {
+		updates = append(updates, update)
+	})
+	manager.OnDesyncDetected(func(desync client.Desync) {
+		desyncs = append(desyncs, desync)
+	})
+
+	delta, err := manager.Resync(context.Background())
+	if err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+	server.handlers.Wait()
+
+	if rows := manager.Cache().Rows("circle"); !slices.Equal(rows, want) {
+		t.Errorf("Expected the cache to be restored to %v, got %v", want, rows)
+	}
+	if len(delta) != 1 {
+		t.Fatalf("Expected a delta for one table, got %+v", delta)
+	}
+	entry := delta[0].Updates[0]
+	if !slices.Equal(entry.Inserts, []string{`[1,"a"]`}) || !slices.Equal(entry.Deletes, []string{`[4,"d"]`}) {
+		t.Errorf("Unexpected resync delta: %+v", entry)
+	}
+	if len(updates) != 1 || len(updates[0].Tables) != 1 {
+		t.Errorf("Expected listeners to receive the delta once, got %+v", updates)
+	}
+	if len(desyncs) != 1 || desyncs[0].Table != "circle" {
+		t.Errorf("Expected a desync for circle, got %+v", desyncs)
+	}
+
+	// Both query sets are probed in one request, whose query ID is then
+	// unsubscribed, and its removal leaves the cache alone
+	var probes, unsubscribes int
+	for _, msg := range server.messages() {
+		if msg.SubscribeMulti != nil && len(msg.SubscribeMulti.QueryStrings) == 2 {
+			probes++
+		}
+		if msg.UnsubscribeMulti != nil {
+			unsubscribes++
+		}
+	}
+	if probes != 1 || unsubscribes != 1 {
+		t.Errorf("Expected one resync probe to be subscribed and unsubscribed, got %d and %d", probes, unsubscribes)
+	}
+	if rows := manager.Cache().Rows("circle"); !slices.Equal(rows, want) {
+		t.Errorf("Expected unsubscribing the resync queries to keep the cache, got %v", rows)
+	}
+	if queries := manager.ActiveQueries(); len(queries) != 2 {
+		t.Errorf("Expected the original queries to stay active, got %v", queries)
+	}
+
+	// A cache in sync produces no delta
+	delta, err = manager.Resync(context.Background())
+	if err != nil {
+		t.Fatalf("Second resync failed: %v", err)
+	}
+	if len(delta) != 0 {
+		t.Errorf("Expected no delta for a cache in sync, got %+v", delta)
+	}
+}
+
+func TestSubscriptionManagerResyncConcurrentTransaction(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	for _, query := range []string{"SELECT * FROM circle WHERE region = 1", "SELECT * FROM food"} {
+		sub, err := manager.Subscribe(query)
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		waitApplied(t, sub)
+	}
+	server.handlers.Wait()
+
+	// Hold the resync subscribes so the test decides the order of the replies
+	probes := make(chan client.ClientMessage, 4)
+	server.mu.Lock()
+	server.respond = func(msg client.ClientMessage) []*client.ServerMessage {
+		if msg.SubscribeMulti != nil {
+			probes <- msg
+		}
+		return nil
+	}
+	server.mu.Unlock()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := manager.Resync(context.Background())
+		result <- err
+	}()
+
+	// A transaction commits after the server answered the first resync
+	// subscribe, and must not be reverted by rows taken before it
+	respond := subscriptionResponder()
+	for i := 0; ; i++ {
+		var msg client.ClientMessage
+		select {
+		case msg = <-probes:
+		case <-time.After(100 * time.Millisecond):
+		}
+		if msg.SubscribeMulti == nil {
+			if i == 0 {
+				t.Fatal("Resync sent no subscribe")
+			}
+			break
+		}
+		for _, reply := range respond(msg) {
+			manager.HandleMessage(reply)
+		}
+		if i == 0 {
+			manager.HandleMessage(&client.ServerMessage{
+				Type: client.ServerMessageTypeTransactionUpdate,
+				Payload: &client.TransactionUpdate{Status: client.UpdateStatus{Committed: &client.DatabaseUpdate{
+					Tables: []client.TableUpdate{tableRows("circle", `[5,"e"]`)},
+				}}},
+			})
+		}
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+
+	want := []string{`[1,"a"]`, `[2,"b"]`, `[5,"e"]`}
+	if rows := manager.Cache().Rows("circle"); !slices.Equal(rows, want) {
+		t.Errorf("Expected the committed row to survive the resync, got %v", rows)
+	}
+	if rows := manager.Cache().Rows("food"); !slices.Equal(rows, []string{`[8]`, `[9]`}) {
+		t.Errorf("Expected the food rows to be kept, got %v", rows)
+	}
+}
+
+func TestSubscriptionManagerResyncTimeout(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	sub, err := manager.Subscribe("SELECT * FROM circle WHERE region = 1")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	server.handlers.Wait()
+
+	// The server stops answering
+	server.mu.Lock()
+	server.respond = nil
+	server.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := manager.Resync(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the resync to time out, got %v", err)
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected the cache to be left alone, got %v", rows)
+	}
+}
+
+// sessionResponder is a subscriptionResponder for one connection session: it
+// rejects unsubscribes for query IDs that were not subscribed on it
+func sessionResponder() func(msg client.ClientMessage) []*client.ServerMessage {
+	respond := subscriptionResponder()
+	var mu sync.Mutex
+	known := make(map[uint32]bool)
+
+	return func(msg client.ClientMessage) []*client.ServerMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case msg.SubscribeMulti != nil:
+			known[msg.SubscribeMulti.QueryID.ID] = true
+		case msg.UnsubscribeMulti != nil && !known[msg.UnsubscribeMulti.QueryID.ID]:
+			queryID := msg.UnsubscribeMulti.QueryID.ID
+			return []*client.ServerMessage{{
+				Type:    client.ServerMessageTypeSubscriptionError,
+				Payload: &client.SubscriptionError{QueryID: &queryID, Error: "unknown query ID"},
+			}}
+		}
+		return respond(msg)
+	}
+}
+
+func TestSubscriptionManagerResubscribe(t *testing.T) {
+	server := newFakeServer(sessionResponder())
+	manager := server.manager
+
+	var subs []*client.Subscription
+	for _, query := range []string{"SELECT * FROM circle WHERE region = 1", "SELECT * FROM circle WHERE region = 2"} {
+		sub, err := manager.Subscribe(query)
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		waitApplied(t, sub)
+		subs = append(subs, sub)
+	}
+	server.handlers.Wait()
+	want := manager.Cache().Rows("circle")
+	staleID := subs[0].QueryID()
+
+	// Reconnect to a new session that knows none of the old query IDs
+	server.mu.Lock()
+	server.respond = sessionResponder()
+	server.mu.Unlock()
+
+	var updates int
+	manager.OnUpdate(func(client.DatabaseUpdate) { updates++ })
+	if err := manager.Resubscribe(); err != nil {
+		t.Fatalf("Resubscribe failed: %v", err)
+	}
+	server.handlers.Wait()
+
+	newID := subs[0].QueryID()
+	if newID == staleID {
+		t.Fatalf("Expected a new query ID, still %d", newID.ID)
+	}
+	sent := server.messages()
+	resent := sent[len(sent)-2:]
+	for i, msg := range resent {
+		if msg.SubscribeMulti == nil || msg.SubscribeMulti.QueryID != subs[i].QueryID() {
+			t.Errorf("Expected subscription %d to be sent again under query ID %d, got %+v", i, subs[i].QueryID().ID, msg)
+		}
+	}
+	if rows := manager.Cache().Rows("circle"); !slices.Equal(rows, want) {
+		t.Errorf("Expected the cache to hold the same rows once, got %v", rows)
+	}
+	if updates != 0 {
+		t.Errorf("Expected no listener update for unchanged rows, got %d", updates)
+	}
+
+	// Unsubscribing targets the new query ID, which the new session knows
+	if err := manager.Unsubscribe(subs[0]); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	server.handlers.Wait()
+	sent = server.messages()
+	if last := sent[len(sent)-1]; last.UnsubscribeMulti == nil || last.UnsubscribeMulti.QueryID != newID {
+		t.Errorf("Expected an unsubscribe for query ID %d, got %+v", newID.ID, last)
+	}
+	if rows := manager.Cache().Rows("circle"); len(rows) != 2 {
+		t.Errorf("Expected the region 1 rows to be removed, got %v", rows)
+	}
+	if queries := manager.ActiveQueries(); !slices.Equal(queries, []string{"SELECT * FROM circle WHERE region = 2"}) {
+		t.Errorf("Expected only region 2 to stay subscribed, got %v", queries)
+	}
+}
+
+func TestSubscriptionManagerResubscribeConcurrentTransaction(t *testing.T) {
+	server := newFakeServer(sessionResponder())
+	manager := server.manager
+
+	for _, query := range []string{"SELECT * FROM circle WHERE region = 1", "SELECT * FROM food"} {
+		sub, err := manager.Subscribe(query)
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		waitApplied(t, sub)
+	}
+	server.handlers.Wait()
+
+	// Hold the new session's replies so the test decides their order
+	var resent []client.ClientMessage
+	server.mu.Lock()
+	server.respond = func(msg client.ClientMessage) []*client.ServerMessage {
+		resent = append(resent, msg)
+		return nil
+	}
+	server.mu.Unlock()
+	if err := manager.Resubscribe(); err != nil {
+		t.Fatalf("Resubscribe failed: %v", err)
+	}
+	if len(resent) != 2 {
+		t.Fatalf("Expected 2 subscriptions to be sent again, got %d", len(resent))
+	}
+
+	// The new session applies the circle subscription, commits a transaction
+	// that inserts into it and only then applies the food subscription
+	respond := sessionResponder()
+	for i, msg := range resent {
+		for _, reply := range respond(msg) {
+			manager.HandleMessage(reply)
+		}
+		if i == 0 {
+			manager.HandleMessage(&client.ServerMessage{
+				Type: client.ServerMessageTypeTransactionUpdate,
+				Payload: &client.TransactionUpdate{Status: client.UpdateStatus{Committed: &client.DatabaseUpdate{
+					Tables: []client.TableUpdate{
+						tableRows("circle", `[5,"e"]`),
+						removedRows("circle", `[1,"a"]`),
+					},
+				}}},
+			})
+		}
+	}
+
+	want := []string{`[2,"b"]`, `[5,"e"]`}
+	if rows := manager.Cache().Rows("circle"); !slices.Equal(rows, want) {
+		t.Errorf("Expected the committed changes to survive the resubscribe, got %v", rows)
+	}
+	if rows := manager.Cache().Rows("food"); !slices.Equal(rows, []string{`[8]`, `[9]`}) {
+		t.Errorf("Expected the food rows to be kept, got %v", rows)
+	}
+
+	// Transactions after the resubscribe completed only reach the cache
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeTransactionUpdate,
+		Payload: &client.TransactionUpdate{Status: client.UpdateStatus{Committed: &client.DatabaseUpdate{
+			Tables: []client.TableUpdate{tableRows("food", `[10]`)},
+		}}},
+	})
+	if rows := manager.Cache().Rows("food"); !slices.Equal(rows, []string{`[10]`, `[8]`, `[9]`}) {
+		t.Errorf("Expected the later insert to be cached, got %v", rows)
+	}
+}
+
+func TestSubscriptionManagerResubscribeDuringSubscribe(t *testing.T) {
+	server := newFakeServer(nil)
+	manager := server.manager
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			if _, err := manager.Subscribe(fmt.Sprintf("SELECT * FROM circle WHERE region = %d", i)); err != nil {
+				t.Errorf("Failed to subscribe: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			if err := manager.Resubscribe(); err != nil {
+				t.Errorf("Resubscribe failed: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	// Each query ID is subscribed once, whether by Subscribe or Resubscribe
+	seen := make(map[uint32]bool)
+	for _, msg := range server.messages() {
+		if msg.SubscribeMulti == nil {
+			continue
+		}
+		queryID := msg.SubscribeMulti.QueryID.ID
+		if seen[queryID] {
+			t.Errorf("Query ID %d was subscribed twice", queryID)
+		}
+		seen[queryID] = true
+	}
+}
+
+func TestSubscriptionManagerCheckIntegrity(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	for _, query := range []string{"SELECT * FROM circle", "SELECT * FROM circle WHERE region = 1"} {
+		sub, err := manager.Subscribe(query)
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		waitApplied(t, sub)
+	}
+
+	var counted []string
+	counter := func(table string) (int, error) {
+		counted = append(counted, table)
+		return 3, nil
+	}
+	var reported []client.Desync
+	manager.OnDesyncDetected(func(desync client.Desync) {
+		reported = append(reported, desync)
+	})
+
+	desyncs, err := manager.CheckIntegrity(counter)
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if len(desyncs) != 0 || len(reported) != 0 {
+		t.Errorf("Expected no desync, got %+v", desyncs)
+	}
+	if !slices.Equal(counted, []string{"circle"}) {
+		t.Errorf("Expected only the fully subscribed table to be counted once, got %v", counted)
+	}
+
+	manager.Cache().Apply(client.DatabaseUpdate{Tables: []client.TableUpdate{tableRows("circle", `[4,"d"]`)}})
+	desyncs, err = manager.CheckIntegrity(counter)
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	want := client.Desync{Table: "circle", Cached: 4, Server: 3}
+	if len(desyncs) != 1 || desyncs[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, desyncs)
+	}
+	if len(reported) != 1 || reported[0] != want {
+		t.Errorf("Expected the callback to receive %+v, got %+v", want, reported)
+	}
+
+	failing := func(string) (int, error) { return 0, errors.New("boom") }
+	if _, err := manager.CheckIntegrity(failing); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the counter error, got %v", err)
+	}
+}
+
+func TestSubscriptionManagerStartIntegrityChecks(t *testing.T) {
+	manager := newFakeServer(nil).manager
+	counter := func(string) (int, error) { return 0, nil }
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := manager.StartIntegrityChecks(context.Background(), interval, counter); err == nil {
+			t.Errorf("Expected interval %s to be rejected", interval)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := manager.StartIntegrityChecks(ctx, time.Millisecond, counter); err != nil {
+		t.Errorf("Failed to start integrity checks: %v", err)
+	}
+}
+
+func TestSubscriptionManagerLogger(t *testing.T) {
+	mismatch := &client.ServerMessage{
+		Type: client.ServerMessageTypeTransactionUpdateLight,
+		Payload: &client.TransactionUpdateLight{Update: client.DatabaseUpdate{Tables: []client.TableUpdate{
+			{TableName: "circle", NumRows: 2, Updates: []client.TableUpdateEntry{{Inserts: []string{`[1,"a"]`}}}},
+		}}},
+	}
+
+	var logged bytes.Buffer
+	manager := client.NewSubscriptionManager(&fakeServer{}, nil, client.WithSubscriptionLogger(log.New(&logged, "", 0)))
+	manager.HandleMessage(mismatch)
+	if !strings.Contains(logged.String(), "declares 2 rows but holds 1") {
+		t.Errorf("Expected the warning in the manager's logger, got %q", logged.String())
+	}
+
+	// Without the option, the manager logs to its connection's logger
+	logged.Reset()
+	conn := connectTo(t, newFrameServer(t), client.WithLogger(log.New(&logged, "", 0)))
+	client.NewSubscriptionManager(conn, nil).HandleMessage(mismatch)
+	if !strings.Contains(logged.String(), "declares 2 rows but holds 1") {
+		t.Errorf("Expected the warning in the connection's logger, got %q", logged.String())
+	}
+}
+
+func TestSubscriptionManagerOnTableUpdate(t *testing.T) {
+	manager := newFakeServer(nil).manager
+
+	var events []string
+	manager.OnTableUpdate(client.DeletesFirst, func(table string, entry client.TableUpdateEntry) {
+		events = append(events, fmt.Sprintf("ordered %s -%v +%v", table, entry.Deletes, entry.Inserts))
+	})
+	manager.OnTableUpdate(client.WireOrder, func(table string, entry client.TableUpdateEntry) {
+		events = append(events, fmt.Sprintf("wire %s -%v +%v", table, entry.Deletes, entry.Inserts))
+	})
+	manager.OnTransactionComplete(func() {
+		events = append(events, "complete")
+	})
+
+	manager.HandleMessage(&client.ServerMessage{
+		Type: client.ServerMessageTypeTransactionUpdateLight,
+		Payload: &client.TransactionUpdateLight{Update: client.DatabaseUpdate{Tables: []client.TableUpdate{
+			{TableName: "circle", Updates: []client.TableUpdateEntry{{Inserts: []string{`[1,"a"]`}}}},
+			{TableName: "food", Updates: []client.TableUpdateEntry{{Deletes: []string{`[7]`}, Inserts: []string{`[8]`}}}},
+		}}},
+	})
+	// An update that changes no rows has no boundary
+	manager.HandleMessage(&client.ServerMessage{
+		Type:    client.ServerMessageTypeTransactionUpdateLight,
+		Payload: &client.TransactionUpdateLight{},
+	})
+
+	want := []string{
+		`ordered food -[[7]] +[]`,
+		`ordered circle -[] +[[1,"a"]]`,
+		`ordered food -[] +[[8]]`,
+		`wire circle -[] +[[1,"a"]]`,
+		`wire food -[[7]] +[[8]]`,
+		"complete",
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("Unexpected delivery order:\n got %q\nwant %q", events, want)
+	}
+}
+
+func TestSubscribeMultiAppliedPopulatesEveryTable(t *testing.T) {
+	server := newFakeServer(subscriptionResponder())
+	manager := server.manager
+
+	tables := make(map[string]int)
+	manager.OnTableUpdate(client.WireOrder, func(table string, entry client.TableUpdateEntry) {
+		tables[table] += len(entry.Inserts)
+	})
+
+	sub, err := manager.Subscribe("SELECT * FROM circle", "SELECT * FROM food")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	waitApplied(t, sub)
+	server.handlers.Wait()
+
+	if got := manager.Cache().Count("circle"); got != 3 {
+		t.Errorf("Expected 3 cached circles, got %d", got)
+	}
+	if got := manager.Cache().Count("food"); got != 2 {
+		t.Errorf("Expected 2 cached food rows, got %d", got)
+	}
+	if tables["circle"] != 3 || tables["food"] != 2 {
+		t.Errorf("Expected table callbacks for both tables, got %v", tables)
+	}
+
+	// A SubscribeMulti sent directly on the connection is cached the same way
+	direct := client.NewSubscriptionManager(nil, nil)
+	msg, err := client.ParseServerMessage([]byte(`{"SubscribeMultiApplied":{"request_id":1,"total_host_execution_duration_micros":0,"query_id":{"id":7},"update":{"tables":[` +
+		`{"table_id":1,"table_name":"circle","num_rows":1,"updates":[{"inserts":["[1,\"a\"]"],"deletes":[]}]},` +
+		`{"table_id":2,"table_name":"food","num_rows":2,"updates":[{"inserts":["[8]","[9]"],"deletes":[]}]}]}}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	direct.HandleMessage(msg)
+	if direct.Cache().Count("circle") != 1 || direct.Cache().Count("food") != 2 {
+		t.Errorf("Expected both tables to be cached, got tables %v", direct.Cache().TableNames())
+	}
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+func TestTableHandleFindByPrimaryKey(t *testing.T) {
+	cache := client.NewTableCache()
+	entities := client.NewTableHandle[entity](cache, "entity", 0)
+
+	cache.Apply(client.DatabaseUpdate{Tables: []client.TableUpdate{
+		tableRows("entity", `[1,[0.5,1.5],10]`, `[2,[3,4],20]`),
+	}})
+
+	if entities.Count() != 2 {
+		t.Fatalf("Expected 2 entities, got %d", entities.Count())
+	}
+
+	found, ok := entities.FindByPrimaryKey(uint(2))
+	if !ok || found.Mass != 20 || found.Position != (vector2{X: 3, Y: 4}) {
+		t.Errorf("Unexpected lookup result: %+v, %v", found, ok)
+	}
+
+	// The index follows cache changes
+	cache.Apply(client.DatabaseUpdate{Tables: []client.TableUpdate{{
+		TableName: "entity",
+		Updates:   []client.TableUpdateEntry{{Deletes: []string{`[2,[3,4],20]`}, Inserts: []string{`[3,[0,0],5]`}}},
+	}}})
+
+	if _, ok := entities.FindByPrimaryKey(uint(2)); ok {
+		t.Error("Expected deleted entity 2 to be gone")
+	}
+	if found, ok := entities.FindByPrimaryKey(uint(3)); !ok || found.Mass != 5 {
+		t.Errorf("Expected inserted entity 3, got %+v, %v", found, ok)
+	}
+
+	var masses []uint
+	for e := range entities.Iter() {
+		masses = append(masses, e.Mass)
+	}
+	if len(masses) != 2 {
+		t.Errorf("Expected to iterate 2 entities, got %v", masses)
+	}
+}
+
+func TestTableHandleIdentityKey(t *testing.T) {
+	cache := client.NewTableCache()
+	players := client.NewTableHandle[player](cache, "player", 0)
+
+	cache.Apply(client.DatabaseUpdate{Tables: []client.TableUpdate{
+		tableRows("player", `[["c2001a2b3c"],5,"alice"]`),
+	}})
+
+	found, ok := players.FindByPrimaryKey(struct{ Identity string }{"c2001a2b3c"})
+	if !ok || found.Name != "alice" {
+		t.Errorf("Unexpected lookup result: %+v, %v", found, ok)
+	}
+}
+
+func TestTableUpdateIterInserts(t *testing.T) {
+	update := client.TableUpdate{
+		TableName: "circle",
+		Updates: []client.TableUpdateEntry{
+			{Inserts: []string{`[1,1,[0,0],1,0]`, `[2,1,[0,0],1,0]`}, Deletes: []string{`[9,1,[0,0],1,0]`}},
+			{Inserts: []string{`[3,1,[0,0],1,0]`}},
+		},
+	}
+
+	var ids []uint
+	for raw := range update.IterInserts {
+		var c circle
+		if err := client.DecodePositional(raw, &c); err != nil {
+			t.Fatalf("Failed to decode %s: %v", raw, err)
+		}
+		ids = append(ids, c.EntityID)
+	}
+	if !slices.Equal(ids, []uint{1, 2, 3}) {
+		t.Errorf("Expected inserts 1, 2, 3 across entries, got %v", ids)
+	}
+
+	var deletes []string
+	for raw := range update.IterDeletes {
+		deletes = append(deletes, string(raw))
+	}
+	if !slices.Equal(deletes, []string{`[9,1,[0,0],1,0]`}) {
+		t.Errorf("Unexpected deletes: %v", deletes)
+	}
+
+	count := 0
+	for range update.IterInserts {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("Expected iteration to stop after break, got %d rows", count)
+	}
+}
+
+func TestBsatnRowListIterRows(t *testing.T) {
+	size := uint16(2)
+	fixed := client.BsatnRowList{SizeHint: client.RowSizeHint{FixedSize: &size}, RowsData: []byte{1, 2, 3, 4, 5, 6}}
+	var rows [][]byte
+	for row := range fixed.IterRows {
+		rows = append(rows, row)
+	}
+	if len(rows) != 3 || !slices.Equal(rows[2], []byte{5, 6}) {
+		t.Errorf("Unexpected fixed-size rows: %v", rows)
+	}
+
+	offsets := client.BsatnRowList{SizeHint: client.RowSizeHint{RowOffsets: []uint64{0, 1, 4}}, RowsData: []byte{1, 2, 3, 4, 5}}
+	rows = nil
+	for row := range offsets.IterRows {
+		rows = append(rows, row)
+	}
+	if len(rows) != 3 || !slices.Equal(rows[0], []byte{1}) || !slices.Equal(rows[1], []byte{2, 3, 4}) || !slices.Equal(rows[2], []byte{5}) {
+		t.Errorf("Unexpected offset rows: %v", rows)
+	}
+}
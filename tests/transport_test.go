@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// fakeTransport answers requests with canned bodies keyed by "METHOD path",
+// records every request it sees, and returns 404 for anything else
+type fakeTransport struct {
+	mu        sync.Mutex
+	responses map[string]string
+	requests  []*http.Request
+	bodies    []string
+}
+
+func (f *fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		r.Body.Close()
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+	f.mu.Unlock()
+
+	status := http.StatusOK
+	response, ok := f.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Request:    r,
+	}, nil
+}
+
+// last returns the last request sent with a method, and its body
+func (f *fakeTransport) last(t *testing.T, method string) (*http.Request, string) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].Method == method {
+			return f.requests[i], f.bodies[i]
+		}
+	}
+	t.Fatalf("No %s request was sent", method)
+	return nil, ""
+}
+
+func newFakeTransportClient(t *testing.T, responses map[string]string) (*client.Client, *fakeTransport) {
+	t.Helper()
+	transport := &fakeTransport{responses: responses}
+	stdb, err := client.NewClientBuilder().
+		WithBaseURL("http://spacetime.test").
+		WithToken("secret").
+		WithRoundTripper(transport).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { stdb.Close() })
+	return stdb, transport
+}
+
+func TestRoundTripperPublishTo(t *testing.T) {
+	stdb, transport := newFakeTransportClient(t, map[string]string{
+		"POST /v1/database/chat": `{"Success":{"domain":null,"database_identity":"c200","op":"created"}}`,
+	})
+
+	if _, err := stdb.Database.PublishTo("chat", []byte("wasm"), true); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	req, body := transport.last(t, http.MethodPost)
+	if req.URL.Query().Get("clear") != "true" {
+		t.Errorf("Expected clear=true, got query %q", req.URL.RawQuery)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected the bearer token, got %q", got)
+	}
+	if body != "wasm" {
+		t.Errorf("Expected the module as the body, got %q", body)
+	}
+
+	if _, err := stdb.Database.PublishTo("chat", []byte("wasm"), false); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if req, _ := transport.last(t, http.MethodPost); req.URL.Query().Has("clear") {
+		t.Errorf("Expected no clear parameter, got query %q", req.URL.RawQuery)
+	}
+}
+
+func TestRoundTripperExecuteSQL(t *testing.T) {
+	stdb, transport := newFakeTransportClient(t, map[string]string{
+		"POST /v1/database/chat/sql": `[{"schema":{"elements":[]},"rows":[]},{"schema":{"elements":[]},"rows":[]}]`,
+	})
+
+	results, err := stdb.Database.ExecuteSQL("chat", []string{"SELECT * FROM user", "SELECT * FROM message"})
+	if err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+	req, body := transport.last(t, http.MethodPost)
+	if body != "SELECT * FROM user;\nSELECT * FROM message" {
+		t.Errorf("Unexpected SQL body %q", body)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected the bearer token, got %q", got)
+	}
+}
+
+func TestRoundTripperGetSchema(t *testing.T) {
+	stdb, transport := newFakeTransportClient(t, map[string]string{
+		"GET /v1/database/chat/schema": chatSchemaJSON,
+	})
+
+	if _, err := stdb.Database.GetSchema("chat", nil); err != nil {
+		t.Fatalf("Failed to get schema: %v", err)
+	}
+	req, _ := transport.last(t, http.MethodGet)
+	if req.URL.Query().Get("version") != "9" {
+		t.Errorf("Expected version=9, got query %q", req.URL.RawQuery)
+	}
+	if req.URL.Host != "spacetime.test" {
+		t.Errorf("Expected the request to target the base URL, got host %q", req.URL.Host)
+	}
+}
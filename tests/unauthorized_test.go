@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+)
+
+// newTokenServer accepts only requests authorized with validToken, and checks
+// that retried requests still carry the SQL body
+func newTokenServer(t *testing.T, validToken string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	requests := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if string(body) != "SELECT * FROM user" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[{"schema":{"elements":[]},"rows":[]}]`))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestUnauthorizedHandlerRefreshesToken(t *testing.T) {
+	server, requests := newTokenServer(t, "fresh")
+
+	refreshes := 0
+	stdb, err := client.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithToken("expired").
+		WithUnauthorizedHandler(func() (string, error) {
+			refreshes++
+			return "fresh", nil
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	if _, err := stdb.Database.ExecuteSQL("test", []string{"SELECT * FROM user"}); err != nil {
+		t.Fatalf("Expected the request to succeed after refreshing, got %v", err)
+	}
+	if refreshes != 1 || requests.Load() != 2 {
+		t.Errorf("Expected 1 refresh and 2 requests, got %d and %d", refreshes, requests.Load())
+	}
+	if stdb.GetToken() != "fresh" {
+		t.Errorf("Expected the refreshed token to be stored, got %q", stdb.GetToken())
+	}
+}
+
+func TestUnauthorizedHandlerRetriesOnce(t *testing.T) {
+	server, requests := newTokenServer(t, "never")
+
+	refreshes := 0
+	stdb, err := client.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithToken("expired").
+		WithUnauthorizedHandler(func() (string, error) {
+			refreshes++
+			return "still-wrong", nil
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	_, err = stdb.Database.ExecuteSQL("test", []string{"SELECT * FROM user"})
+	var httpErr *client.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401 error, got %v", err)
+	}
+	if refreshes != 1 || requests.Load() != 2 {
+		t.Errorf("Expected 1 refresh and 2 requests, got %d and %d", refreshes, requests.Load())
+	}
+}
+
+func TestUnauthorizedHandlerError(t *testing.T) {
+	server, requests := newTokenServer(t, "fresh")
+
+	stdb, err := client.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithToken("expired").
+		WithUnauthorizedHandler(func() (string, error) {
+			return "", errors.New("auth service down")
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	if _, err := stdb.Database.ExecuteSQL("test", []string{"SELECT * FROM user"}); err == nil {
+		t.Fatal("Expected the original 401 to be returned")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected no retry when refreshing fails, got %d requests", requests.Load())
+	}
+}
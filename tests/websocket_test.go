@@ -0,0 +1,1563 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yuni-sa/spacetimedb-go-sdk/client"
+	"github.com/gorilla/websocket"
+)
+
+// newFrameServer starts a WebSocket server that sends the given frames to every
+// client that connects
+func newFrameServer(t *testing.T, frames ...string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, frame := range frames {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		// Keep the connection open until the client is done
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func connectTo(t testing.TB, server *httptest.Server, options ...client.WebSocketOption) *client.WebSocketConnection {
+	t.Helper()
+	stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { stdb.Close() })
+
+	conn, err := stdb.Database.ConnectWebSocket("test", "", options...)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+const identityTokenFrame = `{"IdentityToken":{"identity":{"__identity__":"c2001a2b3c"},"token":"token","connection_id":{"__connection_id__":1}}}`
+
+func TestSkipUnknownMessages(t *testing.T) {
+	server := newFrameServer(t,
+		`{"SomeFutureMessage":{"field":1}}`,
+		`{"truncated":`,
+		identityTokenFrame,
+	)
+	conn := connectTo(t, server, client.WithSkipUnknownMessages())
+
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Expected unknown messages to be skipped, got error: %v", err)
+	}
+	token, ok := msg.AsIdentityToken()
+	if !ok || token.Token != "token" {
+		t.Errorf("Expected the identity token after the skipped messages, got %+v", msg)
+	}
+}
+
+func TestUnknownMessageReturnsError(t *testing.T) {
+	server := newFrameServer(t, `{"SomeFutureMessage":{"field":1}}`, identityTokenFrame)
+	conn := connectTo(t, server)
+
+	if _, err := conn.ReceiveServerMessage(); err == nil {
+		t.Fatal("Expected an error for an unknown message without WithSkipUnknownMessages")
+	}
+
+	// The connection stays usable after the error
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Failed to receive the next message: %v", err)
+	}
+	if _, ok := msg.AsIdentityToken(); !ok {
+		t.Errorf("Expected an identity token, got %+v", msg)
+	}
+}
+
+func TestHostExecutionDuration(t *testing.T) {
+	tests := []struct {
+		frame string
+		want  time.Duration
+		ok    bool
+	}{
+		{`{"InitialSubscription":{"database_update":{"tables":[]},"request_id":1,"total_host_execution_duration":{"__time_duration_micros__":1500}}}`, 1500 * time.Microsecond, true},
+		{`{"OneOffQueryResponse":{"message_id":[],"tables":[],"total_host_execution_duration":{"__time_duration_micros__":20}}}`, 20 * time.Microsecond, true},
+		{`{"SubscribeApplied":{"request_id":1,"total_host_execution_duration_micros":2500,"query_id":{"id":1},"rows":{"table_id":1,"table_name":"circle","table_rows":{"inserts":[],"deletes":[]}}}}`, 2500 * time.Microsecond, true},
+		{`{"SubscribeMultiApplied":{"request_id":1,"total_host_execution_duration_micros":7,"query_id":{"id":1},"update":{"tables":[]}}}`, 7 * time.Microsecond, true},
+		{identityTokenFrame, 0, false},
+	}
+
+	for _, tt := range tests {
+		msg, err := client.ParseServerMessage([]byte(tt.frame))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.frame, err)
+		}
+		got, ok := msg.HostExecutionDuration()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("HostExecutionDuration() of %s = %v, %v, want %v, %v", tt.frame, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	a, b := client.NewMessageID(), client.NewMessageID()
+	if len(a) != 16 || len(b) != 16 {
+		t.Fatalf("Expected 16 byte message IDs, got %d and %d bytes", len(a), len(b))
+	}
+	if client.MessageIDEqual(a, b) {
+		t.Errorf("Expected two generated message IDs to differ, both were %x", a)
+	}
+	if !client.MessageIDEqual(nil, []byte{}) {
+		t.Error("Expected nil and empty message IDs to be equal")
+	}
+
+	msg := client.NewOneOffQueryMessage(nil, "SELECT * FROM user")
+	id := msg.OneOffQuery.MessageID
+	if len(id) != 16 {
+		t.Fatalf("Expected NewOneOffQueryMessage to generate a message ID, got %x", id)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+	var sent struct {
+		OneOffQuery struct {
+			MessageID string `json:"message_id"`
+		}
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		t.Fatalf("Failed to unmarshal %s: %v", data, err)
+	}
+
+	// The response echoes the base64 encoded ID
+	frame := fmt.Sprintf(`{"OneOffQueryResponse":{"message_id":%q,"tables":[],"total_host_execution_duration":{"__time_duration_micros__":1}}}`, sent.OneOffQuery.MessageID)
+	response, err := client.ParseServerMessage([]byte(frame))
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", frame, err)
+	}
+	if got := response.Payload.(*client.OneOffQueryResponse).MessageID; !client.MessageIDEqual(got, id) {
+		t.Errorf("Message ID did not round-trip: sent %x, got %x", id, got)
+	}
+}
+
+func TestUpdateStatusVariants(t *testing.T) {
+	tests := []struct {
+		status  string
+		wantErr string
+	}{
+		{status: `{"Committed":{"tables":[]}}`},
+		{status: `{"Failed":"boom"}`},
+		{status: `{"OutOfEnergy":[]}`},
+		{status: `{}`, wantErr: "no variant set"},
+		{status: `{"Committed":{"tables":[]},"Failed":"boom"}`, wantErr: "multiple variants set: Committed, Failed"},
+	}
+
+	for _, tt := range tests {
+		frame := `{"TransactionUpdate":{"status":` + tt.status + `,"reducer_call":{"reducer_name":"SendMessage","request_id":1}}}`
+		_, err := client.ParseServerMessage([]byte(frame))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("Expected status %s to parse, got %v", tt.status, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("Expected status %s to fail with %q, got %v", tt.status, tt.wantErr, err)
+		}
+	}
+}
+
+func TestCompressableQueryUpdateVariants(t *testing.T) {
+	var update client.CompressableQueryUpdate
+	if err := json.Unmarshal([]byte(`{"Uncompressed":{"deletes":{"size_hint":{"FixedSize":4},"rows_data":""},"inserts":{"size_hint":{"FixedSize":4},"rows_data":""}}}`), &update); err != nil {
+		t.Errorf("Expected an uncompressed update to parse, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{}`), &update); err == nil || !strings.Contains(err.Error(), "no variant set") {
+		t.Errorf("Expected an error for an update without a variant, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"Brotli":"AAE=","Gzip":"AAE="}`), &update); err == nil || !strings.Contains(err.Error(), "multiple variants set: Brotli, Gzip") {
+		t.Errorf("Expected an error for an update with two variants, got %v", err)
+	}
+}
+
+func TestServerMessageString(t *testing.T) {
+	tests := []struct {
+		frame string
+		want  string
+	}{
+		{
+			`{"InitialSubscription":{"database_update":{"tables":[{"table_name":"circle","num_rows":2,"updates":[{"inserts":["[1]","[2]"]}]},{"table_name":"food","num_rows":1,"updates":[{"inserts":["[3]"]}]}]},"request_id":1,"total_host_execution_duration":{"__time_duration_micros__":0}}}`,
+			"InitialSubscription(request_id=1, 2 tables, 3 rows)",
+		},
+		{
+			`{"TransactionUpdate":{"status":{"Committed":{"tables":[{"table_name":"message","num_rows":1,"updates":[{"inserts":["[1]"]}]}]}},"reducer_call":{"reducer_name":"SendMessage","request_id":2}}}`,
+			"TransactionUpdate(reducer=SendMessage, status=committed, 1 tables, 1 rows)",
+		},
+		{
+			`{"TransactionUpdate":{"status":{"Failed":"name taken"},"reducer_call":{"reducer_name":"SetName","request_id":3}}}`,
+			`TransactionUpdate(reducer=SetName, status=failed "name taken")`,
+		},
+		{
+			`{"SubscriptionError":{"total_host_execution_duration_micros":0,"query_id":5,"error":"no such table"}}`,
+			`SubscriptionError(query_id=5, "no such table")`,
+		},
+		{identityTokenFrame, "IdentityToken(identity=c2001a2b3c)"},
+	}
+
+	for _, tt := range tests {
+		msg, err := client.ParseServerMessage([]byte(tt.frame))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.frame, err)
+		}
+		if got := msg.String(); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestAutoRequestIDs(t *testing.T) {
+	received := make(chan client.ClientMessage, 2)
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg client.ClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			received <- msg
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn := connectTo(t, server)
+
+	first, err := conn.CallReducer("SendMessage", `["hello"]`)
+	if err != nil {
+		t.Fatalf("Failed to call reducer: %v", err)
+	}
+	second, err := conn.CallReducerArgs("SendMessage", []any{"world"})
+	if err != nil {
+		t.Fatalf("Failed to call reducer: %v", err)
+	}
+
+	if first == 0 || second == 0 || first == second {
+		t.Fatalf("Expected unique non-zero request IDs, got %d and %d", first, second)
+	}
+	for _, want := range []uint32{first, second} {
+		msg := <-received
+		if msg.CallReducer == nil || msg.CallReducer.RequestID != want {
+			t.Errorf("Expected a reducer call with request ID %d, got %+v", want, msg)
+		}
+	}
+}
+
+// newReducerServer starts a WebSocket server that answers reducer calls with a
+// TransactionUpdate carrying their request ID. Calls to "Fail" fail, calls to
+// "Ignore" are never answered, and replies are sent in reverse order of arrival.
+func newReducerServer(t *testing.T, batchSize int) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var calls []*client.CallReducer
+		for len(calls) < batchSize {
+			var msg client.ClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			calls = append(calls, msg.CallReducer)
+		}
+
+		for i := len(calls) - 1; i >= 0; i-- {
+			call := calls[i]
+			status := `{"Committed":{"tables":[]}}`
+			switch call.Reducer {
+			case "Ignore":
+				continue
+			case "Fail":
+				status = `{"Failed":"boom"}`
+			}
+			frame := fmt.Sprintf(`{"TransactionUpdate":{"status":%s,"reducer_call":{"reducer_name":%q,"request_id":%d}}}`, status, call.Reducer, call.RequestID)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startReadLoop receives messages until the connection closes
+func startReadLoop(conn *client.WebSocketConnection) {
+	go func() {
+		for {
+			if _, err := conn.ReceiveServerMessage(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestCallReducerBatchAwait(t *testing.T) {
+	conn := connectTo(t, newReducerServer(t, 3))
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	results, err := conn.CallReducerBatchAwait(ctx, []client.ReducerCall{
+		{Reducer: "SendMessage", Args: []any{"one"}},
+		{Reducer: "Fail"},
+		{Reducer: "SetName", Args: []any{"bob"}},
+	})
+	if !errors.Is(err, client.ErrReducerFailed) {
+		t.Fatalf("Expected the failed call to be reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "call 1 (Fail)") {
+		t.Errorf("Expected the error to identify the failed call, got %v", err)
+	}
+
+	for i, want := range []string{"SendMessage", "Fail", "SetName"} {
+		if results[i] == nil || results[i].ReducerCall.ReducerName != want {
+			t.Errorf("Result %d: expected the update for %s, got %+v", i, want, results[i])
+		}
+	}
+}
+
+// transactionFrame is a TransactionUpdate for a reducer called by caller
+func transactionFrame(reducer, caller, status string) string {
+	return fmt.Sprintf(`{"TransactionUpdate":{"status":%s,"caller_identity":{"__identity__":%q},"reducer_call":{"reducer_name":%q,"request_id":0}}}`, status, caller, reducer)
+}
+
+func TestCallReducerAwaitIgnoresOtherCallers(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(identityTokenFrame)); err != nil {
+			return
+		}
+
+		var msg client.ClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		// Another client's call with the same request ID is broadcast first
+		for _, reply := range []struct {
+			connectionID int
+			status       string
+		}{
+			{2, `{"Failed":"someone else"}`},
+			{1, `{"Committed":{"tables":[]}}`},
+		} {
+			frame := fmt.Sprintf(`{"TransactionUpdate":{"status":%s,"caller_connection_id":{"__connection_id__":%d},"reducer_call":{"reducer_name":%q,"request_id":%d}}}`,
+				reply.status, reply.connectionID, msg.CallReducer.Reducer, msg.CallReducer.RequestID)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+
+	conn := connectTo(t, server)
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	update, err := conn.CallReducerAwait(ctx, "SendMessage", []any{"hi"})
+	if err != nil {
+		t.Fatalf("Expected the call to resolve with its own update, got %v", err)
+	}
+	if update.CallerConnectionID.String() != "1" {
+		t.Errorf("Expected the update of connection 1, got %s", update.CallerConnectionID)
+	}
+}
+
+func TestCallAndWait(t *testing.T) {
+	const committed = `{"Committed":{"tables":[]}}`
+	tests := []struct {
+		name    string
+		frames  []string
+		wantErr string
+	}{
+		{
+			name: "committed",
+			frames: []string{
+				transactionFrame("SendMessage", "ffff", `{"Failed":"someone else"}`),
+				transactionFrame("SetName", "c2001a2b3c", `{"Failed":"other reducer"}`),
+				transactionFrame("SendMessage", "0xC2001A2B3C", committed),
+			},
+		},
+		{
+			name:    "failed",
+			frames:  []string{transactionFrame("SendMessage", "c2001a2b3c", `{"Failed":"message is empty"}`)},
+			wantErr: "message is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newEchoFramesServer(t, tt.frames...)
+			stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).WithIdentity("c2001a2b3c").Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+			conn, err := stdb.Database.ConnectWebSocket("test", "")
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer conn.Close()
+			startReadLoop(conn)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = conn.CallAndWait(ctx, "SendMessage", `{"text":"hi"}`)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected the call to commit, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, client.ErrReducerFailed) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected ErrReducerFailed with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCallAndWaitRespectsContext(t *testing.T) {
+	conn := connectTo(t, newEchoFramesServer(t, transactionFrame("Other", "c2001a2b3c", `{"Committed":{"tables":[]}}`)))
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := conn.CallAndWait(ctx, "SendMessage", `[]`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+}
+
+func TestCallReducerBatchAwaitRespectsContext(t *testing.T) {
+	conn := connectTo(t, newReducerServer(t, 2))
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	results, err := conn.CallReducerBatchAwait(ctx, []client.ReducerCall{
+		{Reducer: "SendMessage", Args: []any{"one"}},
+		{Reducer: "Ignore"},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if results[0] == nil || results[1] != nil {
+		t.Errorf("Expected only the answered call to have a result, got %+v", results)
+	}
+}
+
+func TestReducerLatencyHook(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var msg client.ClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		time.Sleep(delay)
+		frame := fmt.Sprintf(`{"TransactionUpdate":{"status":{"Committed":{"tables":[]}},"reducer_call":{"reducer_name":%q,"request_id":%d},"total_host_execution_duration":{"__time_duration_micros__":1500}}}`,
+			msg.CallReducer.Reducer, msg.CallReducer.RequestID)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			return
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+
+	latencies := make(chan client.ReducerLatency, 1)
+	conn := connectTo(t, server, client.WithReducerLatencyHook(func(latency client.ReducerLatency) {
+		latencies <- latency
+	}))
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	update, err := conn.CallReducerAwait(ctx, "SendMessage", []any{"hi"})
+	if err != nil {
+		t.Fatalf("Failed to call reducer: %v", err)
+	}
+
+	latency := <-latencies
+	if latency.Reducer != "SendMessage" || latency.RequestID != update.ReducerCall.RequestID || latency.Update != update {
+		t.Errorf("Expected the latency of the SendMessage call, got %+v", latency)
+	}
+	if latency.RoundTrip < delay {
+		t.Errorf("Expected a round trip of at least %s, got %s", delay, latency.RoundTrip)
+	}
+	if latency.HostExecution != 1500*time.Microsecond {
+		t.Errorf("Expected the host execution duration 1.5ms, got %s", latency.HostExecution)
+	}
+}
+
+func TestWebSocketNetDialer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "stdb.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(identityTokenFrame))
+		conn.ReadMessage()
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL("http://spacetimedb.local").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { stdb.Close() })
+
+	var dialed string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+	conn, err := stdb.Database.ConnectWebSocket("test", "", client.WithWebSocketNetDialer(dial))
+	if err != nil {
+		t.Fatalf("Failed to connect over unix socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if dialed != "spacetimedb.local:80" {
+		t.Errorf("Expected the dialer to receive the base URL host, got %q", dialed)
+	}
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Failed to receive message: %v", err)
+	}
+	if token, ok := msg.AsIdentityToken(); !ok || token.Token != "token" {
+		t.Errorf("Expected an identity token, got %+v", msg)
+	}
+}
+
+func TestMessagesOfType(t *testing.T) {
+	server := newFrameServer(t,
+		identityTokenFrame,
+		`{"SubscribeMultiApplied":{"request_id":1,"total_host_execution_duration_micros":0,"query_id":{"id":1},"update":{"tables":[]}}}`,
+		`{"TransactionUpdate":{"status":{"Committed":{"tables":[]}},"reducer_call":{"reducer_name":"SetName","request_id":7}}}`,
+		`{"SomeFutureMessage":{}}`,
+		`{"TransactionUpdate":{"status":{"Committed":{"tables":[]}},"reducer_call":{"reducer_name":"SendMessage","request_id":8}}}`,
+	)
+	conn := connectTo(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	messages := conn.MessagesOfType(ctx, client.ServerMessageTypeTransactionUpdate)
+	for _, want := range []string{"SetName", "SendMessage"} {
+		select {
+		case msg := <-messages:
+			tx, ok := msg.AsTransactionUpdate()
+			if !ok {
+				t.Fatalf("Expected only transaction updates, got type %v", msg.Type)
+			}
+			if tx.ReducerCall.ReducerName != want {
+				t.Errorf("Expected the update for %s, got %s", want, tx.ReducerCall.ReducerName)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the %s update", want)
+		}
+	}
+
+	cancel()
+	conn.Close()
+	for msg := range messages {
+		t.Errorf("Unexpected message after cancel: %+v", msg)
+	}
+}
+
+// newFlakyServer accepts WebSocket connections, sends each an identity token
+// naming the connection number, and drops every connection but the last of
+// dropped+1 right after
+func newFlakyServer(t *testing.T, dropped int) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		frame := fmt.Sprintf(`{"IdentityToken":{"identity":{"__identity__":"c200"},"token":"token-%d","connection_id":{"__connection_id__":%d}}}`, n, n)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			return
+		}
+		if n <= dropped {
+			return
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReconnectHandler(t *testing.T) {
+	var attempts []int
+	handler := func(attempt int, lastErr error, nextDelay time.Duration) bool {
+		if lastErr == nil || nextDelay <= 0 {
+			t.Errorf("Expected an error and a delay, got %v and %s", lastErr, nextDelay)
+		}
+		attempts = append(attempts, attempt)
+		return true
+	}
+	conn := connectTo(t, newFlakyServer(t, 1), client.WithReconnectHandler(handler))
+
+	for _, want := range []string{"token-1", "token-2"} {
+		msg, err := conn.ReceiveServerMessage()
+		if err != nil {
+			t.Fatalf("Failed to receive %s: %v", want, err)
+		}
+		if token, ok := msg.AsIdentityToken(); !ok || token.Token != want {
+			t.Errorf("Expected identity token %s, got %+v", want, msg)
+		}
+	}
+	if !slices.Equal(attempts, []int{1}) {
+		t.Errorf("Expected one reconnect attempt, got %v", attempts)
+	}
+}
+
+func TestReconnectHandlerAborts(t *testing.T) {
+	calls := 0
+	handler := func(attempt int, lastErr error, nextDelay time.Duration) bool {
+		calls++
+		return false
+	}
+	conn := connectTo(t, newFlakyServer(t, 1), client.WithReconnectHandler(handler))
+
+	if _, err := conn.ReceiveServerMessage(); err != nil {
+		t.Fatalf("Failed to receive the first message: %v", err)
+	}
+	if _, err := conn.ReceiveServerMessage(); err == nil {
+		t.Fatal("Expected the read to fail once reconnecting was aborted")
+	}
+	if calls != 1 {
+		t.Errorf("Expected the handler to be called once, got %d", calls)
+	}
+}
+
+// newClosingServer closes the first connection with a close frame carrying
+// code, and sends an IdentityToken on later ones
+func newClosingServer(t *testing.T, code int) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		first := connections == 1
+		mu.Unlock()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if first {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, "closing"))
+			return
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(identityTokenFrame)); err != nil {
+			return
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestShouldReconnect(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          int
+		options       []client.WebSocketOption
+		wantReconnect bool
+	}{
+		{"going away", websocket.CloseGoingAway, nil, true},
+		{"policy violation", websocket.ClosePolicyViolation, nil, false},
+		{"custom rejects", websocket.CloseGoingAway, []client.WebSocketOption{
+			client.WithShouldReconnect(func(closeCode int, err error) bool { return false }),
+		}, false},
+		{"custom accepts", websocket.ClosePolicyViolation, []client.WebSocketOption{
+			client.WithShouldReconnect(func(closeCode int, err error) bool { return closeCode == websocket.ClosePolicyViolation }),
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := func(attempt int, lastErr error, nextDelay time.Duration) bool {
+				calls++
+				return true
+			}
+			options := append([]client.WebSocketOption{client.WithReconnectHandler(handler)}, tt.options...)
+			conn := connectTo(t, newClosingServer(t, tt.code), options...)
+
+			msg, err := conn.ReceiveServerMessage()
+			if !tt.wantReconnect {
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) || closeErr.Code != tt.code {
+					t.Fatalf("Expected the read to fail with close code %d, got %v", tt.code, err)
+				}
+				if calls != 0 {
+					t.Errorf("Expected no reconnect attempt, got %d", calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected to reconnect, got %v", err)
+			}
+			if _, ok := msg.AsIdentityToken(); !ok || calls != 1 {
+				t.Errorf("Expected the identity token after one reconnect, got %+v after %d attempts", msg, calls)
+			}
+		})
+	}
+}
+
+// newRevokedServer accepts the first connection and drops it after an identity
+// token, then refuses every later handshake with status
+func newRevokedServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) > 1 {
+			http.Error(w, "token revoked", status)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(identityTokenFrame))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestShouldReconnectHandshakeRefused(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		options   []client.WebSocketOption
+		wantCalls int
+	}{
+		{"unauthorized", http.StatusUnauthorized, nil, 1},
+		{"forbidden", http.StatusForbidden, nil, 1},
+		{"unavailable", http.StatusServiceUnavailable, nil, 2},
+		{"custom accepts", http.StatusUnauthorized, []client.WebSocketOption{
+			client.WithShouldReconnect(func(closeCode int, err error) bool { return true }),
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := func(attempt int, lastErr error, nextDelay time.Duration) bool {
+				calls++
+				return attempt < 2
+			}
+			options := append([]client.WebSocketOption{client.WithReconnectHandler(handler)}, tt.options...)
+			conn := connectTo(t, newRevokedServer(t, tt.status), options...)
+
+			if _, err := conn.ReceiveServerMessage(); err != nil {
+				t.Fatalf("Failed to receive the first message: %v", err)
+			}
+			_, err := conn.ReceiveServerMessage()
+			var handshakeErr *client.HandshakeError
+			if !errors.As(err, &handshakeErr) || handshakeErr.StatusCode != tt.status {
+				t.Fatalf("Expected a handshake error with status %d, got %v", tt.status, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d reconnect attempts, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+// newEchoFramesServer sends the given frames every time the client sends a message
+func newEchoFramesServer(t *testing.T, frames ...string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			for _, frame := range frames {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWaitForCondition(t *testing.T) {
+	conn := connectTo(t, newEchoFramesServer(t,
+		`{"SubscribeMultiApplied":{"request_id":1,"total_host_execution_duration_micros":0,"query_id":{"id":1},"update":{"tables":[{"table_id":1,"table_name":"circle","num_rows":1,"updates":[{"deletes":[],"inserts":["[1,3,[0,0],1,0]"]}]}]}}}`,
+		`{"TransactionUpdate":{"status":{"Committed":{"tables":[{"table_id":1,"table_name":"circle","num_rows":1,"updates":[{"deletes":[],"inserts":["[7,3,[0,0],1,0]"]}]}]}},"reducer_call":{"reducer_name":"EnterGame","request_id":2}}}`,
+	))
+	startReadLoop(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	isEntity := func(id uint) func(row json.RawMessage) bool {
+		return func(row json.RawMessage) bool {
+			var c circle
+			return client.DecodePositional(row, &c) == nil && c.EntityID == id
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.WaitForCondition(ctx, "circle", isEntity(7))
+	}()
+
+	short, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+	missing := make(chan error, 1)
+	go func() {
+		missing <- conn.WaitForCondition(short, "circle", isEntity(99))
+	}()
+
+	// Trigger the frames until the waiter has registered and seen them
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Expected the condition to match, got %v", err)
+			}
+			waiting = false
+		case <-ticker.C:
+			if _, err := conn.CallReducer("Trigger", "[]"); err != nil {
+				t.Fatalf("Failed to trigger frames: %v", err)
+			}
+		}
+	}
+
+	if err := <-missing; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a condition that never matches to time out, got %v", err)
+	}
+}
+
+func TestWithLightUpdates(t *testing.T) {
+	queries := make(chan string, 2)
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"TransactionUpdateLight":{"request_id":0,"update":{"tables":[{"table_id":1,"table_name":"circle","num_rows":1,"updates":[{"inserts":["[7,3,[0,0],1,0]"]}]}]}}}`))
+		conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+
+	conn := connectTo(t, server, client.WithLightUpdates())
+	if query := <-queries; query != "light=true" {
+		t.Errorf("Expected the light flag on the subscribe URL, got %q", query)
+	}
+
+	manager := client.NewSubscriptionManager(conn, nil)
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Failed to receive message: %v", err)
+	}
+	if msg.Type != client.ServerMessageTypeTransactionUpdateLight {
+		t.Fatalf("Expected a light transaction update, got %+v", msg)
+	}
+	manager.HandleMessage(msg)
+	if rows := manager.Cache().Rows("circle"); len(rows) != 1 {
+		t.Errorf("Expected the light update to reach the cache, got %v", rows)
+	}
+
+	connectTo(t, server)
+	if query := <-queries; query != "" {
+		t.Errorf("Expected no query without WithLightUpdates, got %q", query)
+	}
+}
+
+// drainMessages feeds every message of a source to a subscription manager and
+// returns their summaries
+func drainMessages(t *testing.T, source client.MessageSource, count int, manager *client.SubscriptionManager) []string {
+	t.Helper()
+	var summaries []string
+	for range count {
+		msg, err := source.ReceiveServerMessage()
+		if err != nil {
+			t.Fatalf("Failed to receive message: %v", err)
+		}
+		manager.HandleMessage(msg)
+		summaries = append(summaries, msg.String())
+	}
+	return summaries
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newFrameServer(t,
+		identityTokenFrame,
+		// Multi-line frames are recorded on a single line
+		"{\"InitialSubscription\":{\"database_update\":{\"tables\":[{\"table_name\":\"circle\",\"num_rows\":1,\n\"updates\":[{\"inserts\":[\"[7,3,[0,0],1,0]\"]}]}]},\"request_id\":1,\"total_host_execution_duration\":{\"__time_duration_micros__\":0}}}",
+	)
+	conn := connectTo(t, server)
+
+	var recording bytes.Buffer
+	conn.RecordTo(&recording)
+	live := client.NewSubscriptionManager(conn, nil)
+	recorded := drainMessages(t, conn, 2, live)
+
+	if lines := strings.Count(recording.String(), "\n"); lines != 2 {
+		t.Fatalf("Expected one line per frame, got %d lines:\n%s", lines, recording.String())
+	}
+
+	replay := client.NewReplayConnection(strings.NewReader(recording.String()))
+	offline := client.NewSubscriptionManager(conn, nil)
+	replayed := drainMessages(t, replay, 2, offline)
+
+	if !slices.Equal(recorded, replayed) {
+		t.Errorf("Expected the replay to match the recording, got %v and %v", recorded, replayed)
+	}
+	if rows := offline.Cache().Rows("circle"); len(rows) != 1 {
+		t.Errorf("Expected the replayed rows in the cache, got %v", rows)
+	}
+	if _, err := replay.ReceiveServerMessage(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the recording, got %v", err)
+	}
+}
+
+func TestRecordStopsAtNonJSONFrame(t *testing.T) {
+	server := newFrameServer(t, identityTokenFrame, "not json", identityTokenFrame)
+	var logged bytes.Buffer
+	conn := connectTo(t, server, client.WithLogger(log.New(&logged, "", 0)), client.WithSkipUnknownMessages())
+
+	var recording bytes.Buffer
+	conn.RecordTo(&recording)
+	for range 2 {
+		if _, err := conn.ReceiveServerMessage(); err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+	}
+
+	if lines := strings.Count(recording.String(), "\n"); lines != 1 {
+		t.Errorf("Expected recording to stop at the frame that is not JSON, got %d lines:\n%s", lines, recording.String())
+	}
+	if n := strings.Count(logged.String(), "stopped recording"); n != 1 {
+		t.Errorf("Expected the stop to be logged once to the connection's logger, got %q", logged.String())
+	}
+}
+
+func TestReducerRateLimit(t *testing.T) {
+	conn := connectTo(t, newEchoFramesServer(t), client.WithReducerRateLimit(1, 2))
+
+	for i := range 2 {
+		if _, err := conn.CallReducer("UpdatePlayerInput", "[]"); err != nil {
+			t.Fatalf("Expected call %d within the burst to succeed, got %v", i, err)
+		}
+	}
+	if _, err := conn.CallReducer("UpdatePlayerInput", "[]"); !errors.Is(err, client.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited after the burst, got %v", err)
+	}
+	if _, err := conn.Subscribe([]string{"SELECT * FROM circle"}); err != nil {
+		t.Errorf("Expected subscriptions not to be rate limited, got %v", err)
+	}
+}
+
+func TestReducerRateLimitWait(t *testing.T) {
+	conn := connectTo(t, newEchoFramesServer(t), client.WithReducerRateLimit(20, 1), client.WithRateLimitWait())
+
+	start := time.Now()
+	for i := range 3 {
+		if _, err := conn.CallReducer("UpdatePlayerInput", "[]"); err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+	}
+	// The first call uses the burst, the other two wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected waiting calls to be spaced by the rate, took %v", elapsed)
+	}
+}
+
+func TestConnectionID(t *testing.T) {
+	const id = "170141183460469231731687303715884105729"
+	server := newFrameServer(t,
+		`{"IdentityToken":{"identity":{"__identity__":"c2001a2b3c"},"token":"token","connection_id":{"__connection_id__":`+id+`}}}`,
+		transactionFrame("SendMessage", "c2001a2b3c", `{"Committed":{"tables":[]}}`),
+	)
+	conn := connectTo(t, server)
+
+	if _, ok := conn.ConnectionID(); ok {
+		t.Error("Expected no connection ID before the IdentityToken is received")
+	}
+	if _, err := conn.ReceiveMessage(); err != nil {
+		t.Fatalf("Failed to receive IdentityToken: %v", err)
+	}
+	connectionID, ok := conn.ConnectionID()
+	if !ok || connectionID.String() != id {
+		t.Fatalf("Expected connection ID %s, got %s (%v)", id, connectionID, ok)
+	}
+
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Failed to receive TransactionUpdate: %v", err)
+	}
+	tx, _ := msg.AsTransactionUpdate()
+	if tx.CallerConnectionID.Equal(connectionID) {
+		t.Error("Expected an update without a caller connection ID not to match")
+	}
+}
+
+func TestWebSocketRedirectCrossHost(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	auth := make(chan string, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(target.Close)
+	redirector := httptest.NewServer(http.RedirectHandler(target.URL+"/v1/database/test/subscribe", http.StatusFound))
+	t.Cleanup(redirector.Close)
+
+	for _, tc := range []struct {
+		name    string
+		options []client.WebSocketOption
+		want    string
+	}{
+		{"default", nil, ""},
+		{"opted in", []client.WebSocketOption{client.WithRedirectAuthorization()}, "Bearer secret"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdb, err := client.NewClientBuilder().WithBaseURL(redirector.URL).WithToken("secret").Build()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer stdb.Close()
+
+			conn, err := stdb.Database.ConnectWebSocket("test", client.SatsProtocol, tc.options...)
+			if err != nil {
+				t.Fatalf("Failed to follow the redirect: %v", err)
+			}
+			conn.Close()
+			if got := <-auth; got != tc.want {
+				t.Errorf("Expected Authorization %q on the other host, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWebSocketRedirect(t *testing.T) {
+	target := newFrameServer(t, transactionFrame("Moved", "c2001a2b3c", `{"Committed":{"tables":[]}}`))
+	var auth, protocol string
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/database/test/subscribe":
+			http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+		case "/moved":
+			auth, protocol = r.Header.Get("Authorization"), r.Header.Get("Sec-WebSocket-Protocol")
+			http.Redirect(w, r, target.URL+"/v1/database/test/subscribe", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/page":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(redirector.Close)
+
+	stdb, err := client.NewClientBuilder().WithBaseURL(redirector.URL).WithToken("secret").Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	conn, err := stdb.Database.ConnectWebSocket("test", client.SatsProtocol)
+	if err != nil {
+		t.Fatalf("Failed to follow the redirects: %v", err)
+	}
+	defer conn.Close()
+	if auth != "Bearer secret" || protocol != client.SatsProtocol {
+		t.Errorf("Expected auth and protocol headers on the redirected dial, got %q and %q", auth, protocol)
+	}
+	msg, err := conn.ReceiveServerMessage()
+	if err != nil {
+		t.Fatalf("Failed to receive from the redirect target: %v", err)
+	}
+	if tx, ok := msg.AsTransactionUpdate(); !ok || tx.ReducerCall.ReducerName != "Moved" {
+		t.Errorf("Unexpected message from the redirect target: %v", msg)
+	}
+
+	for _, tc := range []struct {
+		location string
+		want     string
+	}{
+		{redirector.URL + "/page", "non-WebSocket endpoint"},
+		{"ftp://example.com/file", "non-WebSocket endpoint"},
+		{redirector.URL + "/loop", "redirected more than"},
+	} {
+		server := httptest.NewServer(http.RedirectHandler(tc.location, http.StatusFound))
+		stdb, err := client.NewClientBuilder().WithBaseURL(server.URL).Build()
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		_, err = stdb.Database.ConnectWebSocket("test", client.SatsProtocol)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Redirect to %s: expected an error containing %q, got %v", tc.location, tc.want, err)
+		}
+		if tc.want == "non-WebSocket endpoint" && !errors.Is(err, client.ErrRedirectNotWebSocket) {
+			t.Errorf("Redirect to %s: expected ErrRedirectNotWebSocket, got %v", tc.location, err)
+		}
+		stdb.Close()
+		server.Close()
+	}
+}
+
+func TestReceiveServerMessageRaw(t *testing.T) {
+	first := transactionFrame("First", "c2001a2b3c", `{"Committed":{"tables":[]}}`)
+	second := transactionFrame("Second", "c2001a2b3c", `{"Committed":{"tables":[]}}`)
+	conn := connectTo(t, newFrameServer(t, first, second))
+
+	msg, raw, err := conn.ReceiveServerMessageRaw()
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if string(raw) != first {
+		t.Errorf("Expected the exact frame bytes, got %s", raw)
+	}
+	if tx, ok := msg.AsTransactionUpdate(); !ok || tx.ReducerCall.ReducerName != "First" {
+		t.Errorf("Unexpected parsed message: %v", msg)
+	}
+
+	// The returned bytes are not reused for the next frame
+	kept := raw
+	if _, raw, err = conn.ReceiveServerMessageRaw(); err != nil || string(raw) != second {
+		t.Fatalf("Expected the second frame, got %s (%v)", raw, err)
+	}
+	if string(kept) != first {
+		t.Errorf("Expected earlier frame bytes to stay intact, got %s", kept)
+	}
+}
+
+func TestDryRunReducer(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	frames := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- string(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn := connectTo(t, server)
+
+	type point struct {
+		X, Y int32
+	}
+	preview, err := conn.DryRunReducer("MoveTo", point{1, 2}, "fast <now>")
+	if err != nil {
+		t.Fatalf("DryRunReducer failed: %v", err)
+	}
+	select {
+	case frame := <-frames:
+		t.Fatalf("Expected nothing to be sent, got %s", frame)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The preview is the exact frame the real call sends
+	if err := conn.SendCallReducerArgs("MoveTo", []any{point{1, 2}, "fast <now>"}, 0); err != nil {
+		t.Fatalf("SendCallReducerArgs failed: %v", err)
+	}
+	select {
+	case frame := <-frames:
+		if frame != preview {
+			t.Errorf("Expected the sent frame to match the preview\nsent:    %s\npreview: %s", frame, preview)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the reducer call")
+	}
+	var msg client.ClientMessage
+	if err := json.Unmarshal([]byte(preview), &msg); err != nil || msg.CallReducer == nil || msg.CallReducer.Reducer != "MoveTo" {
+		t.Errorf("Expected a CallReducer preview, got %s (%v)", preview, err)
+	}
+
+	if _, err := conn.DryRunReducer("", 1); !errors.Is(err, client.ErrInvalidReducerName) {
+		t.Errorf("Expected ErrInvalidReducerName, got %v", err)
+	}
+	if _, err := conn.DryRunReducer("Say", "\xc3\x28"); !errors.Is(err, client.ErrInvalidUTF8) {
+		t.Errorf("Expected ErrInvalidUTF8, got %v", err)
+	}
+}
+
+func TestWithHandshakeTimeout(t *testing.T) {
+	// The server accepts connections but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var accepted []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range accepted {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			accepted = append(accepted, conn)
+			mu.Unlock()
+		}
+	}()
+
+	stdb, err := client.NewClientBuilder().WithBaseURL("http://" + listener.Addr().String()).Build()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer stdb.Close()
+
+	start := time.Now()
+	_, err = stdb.Database.ConnectWebSocket("test", client.SatsProtocol, client.WithHandshakeTimeout(50*time.Millisecond))
+	if err == nil {
+		t.Fatal("Expected the handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected to fail after about 50ms, took %s", elapsed)
+	}
+}
+
+func TestTransactionUpdateIsCaller(t *testing.T) {
+	me := client.Identity{Identity: "c2001a2b3c"}
+	msg, err := client.ParseServerMessage([]byte(transactionFrame("SendMessage", "0xC2001A2B3C", `{"Committed":{"tables":[]}}`)))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	tx, _ := msg.AsTransactionUpdate()
+	if !tx.IsCaller(me) {
+		t.Error("Expected the caller to match regardless of hex case and prefix")
+	}
+	if tx.IsCaller(client.Identity{Identity: "c2001a2b3d"}) || tx.IsCaller(client.Identity{}) {
+		t.Error("Expected other and empty identities not to match")
+	}
+
+	// The reducer call info carries the caller as an Identity in either encoding
+	for _, caller := range []string{`"c2001a2b3c"`, `{"__identity__":"c2001a2b3c"}`} {
+		var info client.ReducerCallInfo
+		if err := json.Unmarshal([]byte(`{"reducer_name":"SendMessage","caller_identity":`+caller+`}`), &info); err != nil {
+			t.Fatalf("Failed to decode caller %s: %v", caller, err)
+		}
+		if !info.CallerIdentity.Equal(me) {
+			t.Errorf("Expected caller %s to decode to %s, got %q", caller, me.Hex(), info.CallerIdentity.Identity)
+		}
+		if !(&client.TransactionUpdate{ReducerCall: info}).IsCaller(me) {
+			t.Errorf("Expected IsCaller to fall back to the reducer call's caller %s", caller)
+		}
+	}
+}
+
+func TestSubscriptionQueryValidation(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn := connectTo(t, server)
+
+	for _, query := range []string{"SELECT * FROM user", "  select * from user\n", "Select\t*\tFROM message"} {
+		if _, err := conn.SubscribeSingle(query, client.QueryID{ID: 1}); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", query, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		subscribe func() error
+	}{
+		{"Subscribe", func() error {
+			_, err := conn.Subscribe([]string{"DELETE FROM user"})
+			return err
+		}},
+		{"SubscribeSingle", func() error {
+			_, err := conn.SubscribeSingle("INSERT INTO user VALUES (1)", client.QueryID{ID: 2})
+			return err
+		}},
+		{"SubscribeMulti", func() error {
+			_, err := conn.SubscribeMulti([]string{"SELECT * FROM user", "SELECTED"}, client.QueryID{ID: 3})
+			return err
+		}},
+		{"empty", func() error {
+			_, err := conn.Subscribe([]string{"  "})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.subscribe()
+			if !errors.Is(err, client.ErrInvalidSubscriptionQuery) {
+				t.Fatalf("Expected ErrInvalidSubscriptionQuery, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "CallReducer") {
+				t.Errorf("Expected the error to point to CallReducer, got %v", err)
+			}
+		})
+	}
+
+	unchecked := connectTo(t, server, client.WithUncheckedSubscriptionQueries())
+	if _, err := unchecked.Subscribe([]string{"SUBSCRIBE TO user"}); err != nil {
+		t.Errorf("Expected unchecked queries to be sent, got %v", err)
+	}
+}
+
+func TestConcurrentWritesAreSerialized(t *testing.T) {
+	const senders, perSender = 16, 25
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	frames := make(chan []byte, senders*perSender)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- data
+		}
+	}))
+	defer server.Close()
+	conn := connectTo(t, server)
+
+	// Large frames span several socket writes, so unserialized writers would interleave
+	args := fmt.Sprintf(`[%q]`, strings.Repeat("x", 64<<10))
+	var wg sync.WaitGroup
+	for s := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perSender {
+				if err := conn.SendCallReducer("Send", args, uint32(s*perSender+i+1)); err != nil {
+					t.Errorf("SendCallReducer failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint32]bool)
+	for range senders * perSender {
+		select {
+		case data := <-frames:
+			var message struct {
+				CallReducer struct {
+					Reducer   string `json:"reducer"`
+					RequestID uint32 `json:"request_id"`
+				}
+			}
+			if err := json.Unmarshal(data, &message); err != nil || message.CallReducer.Reducer != "Send" {
+				t.Fatalf("Received a corrupted frame (%v): %.100s", err, data)
+			}
+			seen[message.CallReducer.RequestID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after receiving %d of %d frames", len(seen), senders*perSender)
+		}
+	}
+	if len(seen) != senders*perSender {
+		t.Errorf("Expected %d distinct requests, got %d", senders*perSender, len(seen))
+	}
+}
+
+// newStalledServer starts a WebSocket server that accepts connections and then
+// never reads, so the client's socket buffers fill up
+func newStalledServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{client.SatsProtocol}}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server
+}
+
+func TestWriteTimeout(t *testing.T) {
+	conn := connectTo(t, newStalledServer(t), client.WithWriteTimeout(100*time.Millisecond))
+
+	args := fmt.Sprintf(`[%q]`, strings.Repeat("x", 1<<20))
+	start := time.Now()
+	var err error
+	for i := 0; err == nil && i < 256; i++ {
+		err = conn.SendCallReducer("Send", args, uint32(i+1))
+	}
+	if !errors.Is(err, client.ErrWriteTimeout) {
+		t.Fatalf("Expected ErrWriteTimeout from a stalled peer, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the stalled write to time out promptly, took %s", elapsed)
+	}
+}
+
+func TestCloseDuringStalledWrite(t *testing.T) {
+	for _, graceful := range []bool{false, true} {
+		conn := connectTo(t, newStalledServer(t))
+
+		// Without a write timeout the sender blocks until the connection is closed
+		sendErr := make(chan error, 1)
+		go func() {
+			args := fmt.Sprintf(`[%q]`, strings.Repeat("x", 1<<20))
+			for i := 0; ; i++ {
+				if err := conn.SendCallReducer("Send", args, uint32(i+1)); err != nil {
+					sendErr <- err
+					return
+				}
+			}
+		}()
+		time.Sleep(300 * time.Millisecond)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			if graceful {
+				conn.GracefulClose()
+			} else {
+				conn.Close()
+			}
+		}()
+		select {
+		case <-closed:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Close (graceful %v) blocked behind a stalled write", graceful)
+		}
+
+		select {
+		case err := <-sendErr:
+			if err == nil {
+				t.Errorf("Expected the stalled send to fail after Close")
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("Stalled send was not released by Close (graceful %v)", graceful)
+		}
+	}
+}